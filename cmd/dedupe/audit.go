@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/manifest"
+)
+
+// runAudit compares the scan with the known-good manifest and returns an error when
+// the tree differs from it, so scheduled audits fail visibly.
+func (d *Deduplicator) runAudit() error {
+	res := manifest.Compare(d.known, d.fileMap)
+	d.audit = &res
+	if res.OK() {
+		return nil
+	}
+	return fmt.Errorf("audit failed: %d changed, %d moved, %d new, %d missing",
+		len(res.Changed), len(res.Moved), len(res.New), len(res.Missing))
+}
+
+// reportAudit prints every file that differs from the manifest and the totals.
+func (d *Deduplicator) reportAudit() {
+	res := d.audit
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Audit against manifest"))
+	for _, p := range res.Changed {
+		fmt.Fprintf(d.out, "%s  %s\n", d.paint(ansiRed, "CHANGED"), displayPath(p))
+	}
+	for _, m := range res.Moved {
+		fmt.Fprintf(d.out, "%s    %s -> %s\n", d.paint(ansiYellow, "MOVED"), displayPath(m.From), displayPath(m.To))
+	}
+	for _, p := range res.New {
+		fmt.Fprintf(d.out, "%s      %s\n", d.paint(ansiCyan, "NEW"), displayPath(p))
+	}
+	for _, p := range res.Missing {
+		fmt.Fprintf(d.out, "%s  %s\n", d.paint(ansiRed, "MISSING"), displayPath(p))
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+	fmt.Fprintln(d.out, d.paint(ansiBold, fmt.Sprintf("%d matched, %d changed, %d moved, %d new, %d missing",
+		res.Matched, len(res.Changed), len(res.Moved), len(res.New), len(res.Missing))))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// BaselineResult compares the scan with a scan index exported on another machine.
+type BaselineResult struct {
+	Host         string          `json:"host"`
+	Root         string          `json:"root"`
+	Created      time.Time       `json:"created"`
+	Files        int             `json:"files"` // Files in the baseline
+	Present      []BaselineMatch `json:"present"`
+	PresentBytes int64           `json:"present_bytes"`
+	Absent       []string        `json:"absent"` // Local files whose content the baseline lacks
+}
+
+// BaselineMatch is a local file whose content the baseline also holds.
+type BaselineMatch struct {
+	Path          string   `json:"path"`
+	Size          int64    `json:"size"`
+	BaselinePaths []string `json:"baseline_paths"`
+}
+
+// compareBaseline matches every scanned file against the imported index by content.
+func (d *Deduplicator) compareBaseline() *BaselineResult {
+	res := &BaselineResult{
+		Host:    d.baseline.Host,
+		Root:    d.baseline.Root,
+		Created: d.baseline.Created,
+		Files:   len(d.baseline.Files),
+		Present: []BaselineMatch{},
+		Absent:  []string{},
+	}
+	byHash := d.baseline.ByHash()
+	for _, path := range d.sortedPaths() {
+		rec := d.fileMap[path]
+		if remote := byHash[iphash.HashToString(rec.Sum)]; len(remote) > 0 {
+			res.Present = append(res.Present, BaselineMatch{Path: path, Size: rec.Size, BaselinePaths: remote})
+			res.PresentBytes += rec.Size
+		} else {
+			res.Absent = append(res.Absent, path)
+		}
+	}
+	return res
+}
+
+// reportBaseline lists the local files found in the baseline and the totals.
+func (d *Deduplicator) reportBaseline() {
+	res := d.baselineCmp
+	title := fmt.Sprintf("Baseline %s:%s (%d files, %s)", res.Host, res.Root, res.Files, res.Created.Format(time.RFC3339))
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, title))
+	for _, m := range res.Present {
+		fmt.Fprintf(d.out, "%s == %s:%s\n", displayPath(m.Path), res.Host, displayPath(m.BaselinePaths[0]))
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+	fmt.Fprintln(d.out, d.paint(ansiBold, fmt.Sprintf("%d files (%s) already in the baseline, %d not",
+		len(res.Present), formatSize(res.PresentBytes), len(res.Absent))))
+}
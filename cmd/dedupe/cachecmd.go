@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hashcache"
+)
+
+// cacheVerbs lists the operations of the cache command.
+var cacheVerbs = map[string]bool{"stats": true, "prune": true, "verify": true, "clear": true}
+
+// runCacheCommand performs one cache operation on the cache at path and prints the
+// outcome to out, as text or JSON.
+func runCacheCommand(verb string, c *hashcache.Cache, path string, hash fswalk.HashFunc, sample int, format string, out io.Writer) error {
+	var result interface{}
+	switch verb {
+	case "stats":
+		st := c.Stats()
+		result = st
+		if format == "text" {
+			fmt.Fprintf(out, "Cache %s (%s)\n", path, st.Algo)
+			fmt.Fprintf(out, "%d entries for %s of files\n", st.Entries, formatSize(st.Bytes))
+			fmt.Fprintf(out, "%d never verified\n", st.NeverVerified)
+			if st.Dirs > 0 {
+				fmt.Fprintf(out, "%d directories in the --dir-index index\n", st.Dirs)
+			}
+			if !st.OldestVerify.IsZero() {
+				fmt.Fprintf(out, "Verified between %s and %s\n", st.OldestVerify.Format(time.RFC3339), st.NewestVerify.Format(time.RFC3339))
+			}
+		}
+	case "prune":
+		n := c.Prune()
+		result = map[string]int{"pruned": n, "entries": c.Len()}
+		if format == "text" {
+			fmt.Fprintf(out, "Pruned %d entries of deleted files, %d left\n", n, c.Len())
+		}
+	case "verify":
+		res := c.Verify(hash, sample, rand.New(rand.NewSource(time.Now().UnixNano())))
+		result = res
+		if format == "text" {
+			for _, p := range res.Mismatch {
+				fmt.Fprintf(out, "MISMATCH  %s\n", displayPath(p))
+			}
+			fmt.Fprintf(out, "%d checked: %d ok, %d stale, %d mismatched, %d unreadable\n",
+				res.Checked, res.OK, res.Stale, len(res.Mismatch), res.Errors)
+		}
+	case "clear":
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to clear hash cache: %w", err)
+		}
+		log.Printf("Removed hash cache %s.", path)
+		return nil
+	}
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(result); err != nil {
+			return err
+		}
+	}
+	if verb == "stats" {
+		return nil
+	}
+	return c.Save(path)
+}
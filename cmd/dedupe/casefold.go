@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// CaseResult is the outcome of --case-collisions: files and directories whose paths
+// only differ in case or Unicode normalization, which cannot coexist once copied to a
+// case-insensitive filesystem such as a default APFS, NTFS or exFAT volume. They are
+// reported for review and never acted on.
+type CaseResult struct {
+	Groups []CaseGroup `json:"groups"`
+}
+
+// CaseGroup is a set of paths that name the same entry on a case-insensitive filesystem.
+type CaseGroup struct {
+	Paths       []string `json:"paths"`        // In path order
+	Dirs        bool     `json:"dirs"`         // The colliding entries are directories, whose contents would merge
+	SameContent bool     `json:"same_content"` // Files with identical content: all but one can simply go
+}
+
+// caseCollisions groups the scanned files and directories by their case-folded NFC
+// path. A group is only reported when two of its names differ in their last
+// component: entries below colliding directories that share their own name follow from
+// the directories' collision and are not repeated.
+func (d *Deduplicator) caseCollisions() *CaseResult {
+	byKey := make(map[string][]string)
+	for path := range d.fileMap {
+		key := fswalk.PathKey(path, true)
+		byKey[key] = append(byKey[key], path)
+	}
+	isDir := make(map[string]bool, len(d.discoveredPaths))
+	for _, dir := range d.discoveredPaths {
+		isDir[dir] = true
+		key := fswalk.PathKey(dir, true)
+		byKey[key] = append(byKey[key], dir)
+	}
+	res := &CaseResult{Groups: []CaseGroup{}}
+	for _, paths := range byKey {
+		if len(paths) < 2 {
+			continue
+		}
+		distinct := false
+		for _, p := range paths[1:] {
+			distinct = distinct || filepath.Base(p) != filepath.Base(paths[0])
+		}
+		if !distinct {
+			continue
+		}
+		sort.Strings(paths)
+		g := CaseGroup{Paths: paths, Dirs: isDir[paths[0]], SameContent: !isDir[paths[0]]}
+		first := d.fileMap[paths[0]]
+		for _, p := range paths[1:] {
+			rec, ok := d.fileMap[p]
+			if !ok || rec.Size != first.Size || first.Sum == nil || !bytes.Equal(rec.Sum, first.Sum) {
+				g.SameContent = false
+			}
+			g.Dirs = g.Dirs || isDir[p]
+		}
+		res.Groups = append(res.Groups, g)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool { return res.Groups[i].Paths[0] < res.Groups[j].Paths[0] })
+	return res
+}
+
+// reportCaseCollisions prints the paths that would collide on a case-insensitive
+// filesystem.
+func (d *Deduplicator) reportCaseCollisions() {
+	res := d.collisions
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Paths colliding on a case-insensitive filesystem"))
+	for _, g := range res.Groups {
+		switch {
+		case g.Dirs:
+			fmt.Fprintln(d.out, "Directories (their contents would merge):")
+		case g.SameContent:
+			fmt.Fprintln(d.out, "Files with identical content:")
+		default:
+			fmt.Fprintln(d.out, "Files with different content:")
+		}
+		for _, p := range g.Paths {
+			fmt.Fprintf(d.out, "  %s\n", displayPath(p))
+		}
+	}
+	if len(res.Groups) == 0 {
+		fmt.Fprintln(d.out, "No two paths differ only in case.")
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/cdc"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// maxChunkSharers bounds how many files a chunk is compared across. Chunks held by
+// many files, such as runs of zeros in disk images, say little about similarity and
+// would make the comparison quadratic.
+const maxChunkSharers = 64
+
+// ChunkResult is the outcome of the chunks command: pairs of large files that share
+// much of their content without being identical.
+type ChunkResult struct {
+	Files int         `json:"files"` // Distinct contents chunked
+	Pairs []ChunkPair `json:"pairs"` // Most shared bytes first
+}
+
+// ChunkPair is two files sharing content-defined chunks.
+type ChunkPair struct {
+	A           string  `json:"a"`
+	B           string  `json:"b"`
+	SharedBytes int64   `json:"shared_bytes"`
+	Similarity  float64 `json:"similarity"` // Shared bytes over the distinct chunk bytes of the smaller file
+}
+
+// chunkedFile is the set of distinct chunks of one file.
+type chunkedFile struct {
+	path   string
+	chunks map[[sha256.Size]byte]int
+	bytes  int64 // Of the distinct chunks
+}
+
+// findSimilarFiles chunks one copy of every distinct content of at least chunkMinSize
+// bytes and reports the pairs sharing at least chunkThreshold of the smaller file.
+// Exact duplicates are already grouped and are only chunked once.
+func (d *Deduplicator) findSimilarFiles(ctx context.Context, numWorkers int) (*ChunkResult, error) {
+	paths := d.distinctPaths(func(path string, rec fswalk.FileRecord) bool { return rec.Size >= d.chunkMinSize })
+	log.Printf("Chunking %d files of at least %s...", len(paths), formatSize(d.chunkMinSize))
+
+	files := make([]*chunkedFile, len(paths))
+	err := forEachWorker(ctx, len(paths), numWorkers, func(i int) {
+		chunks, err := cdc.FileChunks(paths[i], cdc.DefaultParams)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error chunking file %s: %v\n", paths[i], err)
+			return
+		}
+		f := &chunkedFile{path: paths[i], chunks: make(map[[sha256.Size]byte]int)}
+		for _, c := range chunks {
+			if _, ok := f.chunks[c.Sum]; !ok {
+				f.chunks[c.Sum] = c.Size
+				f.bytes += int64(c.Size)
+			}
+		}
+		files[i] = f
+	})
+	if err != nil {
+		return nil, err
+	}
+	return similarPairs(files, d.chunkThreshold), nil
+}
+
+// similarPairs finds the pairs of files sharing at least threshold of the distinct
+// chunk bytes of the smaller one. Nil entries, files that could not be read, are
+// ignored.
+func similarPairs(files []*chunkedFile, threshold float64) *ChunkResult {
+	res := &ChunkResult{Pairs: []ChunkPair{}}
+	holders := make(map[[sha256.Size]byte][]int)
+	for i, f := range files {
+		if f == nil {
+			continue
+		}
+		res.Files++
+		for sum := range f.chunks {
+			holders[sum] = append(holders[sum], i)
+		}
+	}
+	type pair struct{ a, b int }
+	shared := make(map[pair]int64)
+	for sum, idx := range holders {
+		if len(idx) < 2 || len(idx) > maxChunkSharers {
+			continue
+		}
+		sort.Ints(idx)
+		for x := 0; x < len(idx); x++ {
+			for y := x + 1; y < len(idx); y++ {
+				shared[pair{idx[x], idx[y]}] += int64(files[idx[x]].chunks[sum])
+			}
+		}
+	}
+	for p, n := range shared {
+		a, b := files[p.a], files[p.b]
+		smaller := a.bytes
+		if b.bytes < smaller {
+			smaller = b.bytes
+		}
+		sim := float64(n) / float64(smaller)
+		if sim >= threshold {
+			res.Pairs = append(res.Pairs, ChunkPair{A: a.path, B: b.path, SharedBytes: n, Similarity: sim})
+		}
+	}
+	sort.Slice(res.Pairs, func(i, j int) bool {
+		pi, pj := res.Pairs[i], res.Pairs[j]
+		if pi.SharedBytes != pj.SharedBytes {
+			return pi.SharedBytes > pj.SharedBytes
+		}
+		if pi.A != pj.A {
+			return pi.A < pj.A
+		}
+		return pi.B < pj.B
+	})
+	return res
+}
+
+// reportChunks prints the pairs of files sharing chunks.
+func (d *Deduplicator) reportChunks() {
+	res := d.chunked
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Files sharing content-defined chunks, most shared bytes first"))
+	for _, p := range res.Pairs {
+		fmt.Fprintf(d.out, "%3.0f%%  %s shared: %s <-> %s\n", 100*p.Similarity, formatSize(p.SharedBytes), displayPath(p.A), displayPath(p.B))
+	}
+	if len(res.Pairs) == 0 {
+		fmt.Fprintf(d.out, "No two of the %d files compared share %.0f%% of their content.\n", res.Files, 100*d.chunkThreshold)
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
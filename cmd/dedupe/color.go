@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// ANSI escape sequences used by the text report.
+const (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiDim    = "\033[2m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiCyan   = "\033[36m"
+)
+
+// useColor resolves --color for a report written to out. "auto" colors only
+// terminals and honours the NO_COLOR convention (https://no-color.org).
+func useColor(mode string, out *os.File) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+			return false, nil
+		}
+		return isTerminal(out), nil
+	}
+	return false, fmt.Errorf("unknown --color %q (want auto, always or never)", mode)
+}
+
+// paint wraps s in the given escape sequence when color is enabled.
+func (d *Deduplicator) paint(code, s string) string {
+	if !d.color {
+		return s
+	}
+	return code + s + ansiReset
+}
+
+// actionColor is the color of an action in the duplicate report: kept copies are
+// green, destructive actions red or yellow.
+func actionColor(a policy.Action) string {
+	switch a {
+	case policy.ActionKeep:
+		return ansiGreen
+	case policy.ActionRemove:
+		return ansiRed
+	case policy.ActionLink, policy.ActionReflink:
+		return ansiYellow
+	}
+	return ansiDim
+}
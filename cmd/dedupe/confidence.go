@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/throttle"
+)
+
+// Confidence levels of a duplicate group, from the weakest to the strongest evidence
+// that its copies are identical. No current mode groups files by size alone; the level
+// is listed so consumers can gate on it once one does.
+const (
+	confSizeOnly     = "size-only"
+	confPartialHash  = "partial-hash"  // Quick digests of three samples, not confirmed
+	confFullHash     = "full-hash"     // Digests of the whole content
+	confByteVerified = "byte-verified" // Compared byte by byte with --verify-bytes
+)
+
+// confidenceLevels lists the levels in increasing order.
+var confidenceLevels = []string{confSizeOnly, confPartialHash, confFullHash, confByteVerified}
+
+// confidenceRank returns the position of level in confidenceLevels, or -1.
+func confidenceRank(level string) int {
+	for i, l := range confidenceLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// groupConfidence returns the confidence level of a duplicate group.
+func (d *Deduplicator) groupConfidence(hashString string) string {
+	if d.verified[hashString] {
+		return confByteVerified
+	}
+	if d.strategies != nil {
+		for _, p := range d.fileByteMapDups[hashString] {
+			if d.strategies.quick[p] {
+				return confPartialHash
+			}
+		}
+	}
+	return confFullHash
+}
+
+// gateConfidence turns every planned action of a group below --min-confidence into a
+// skip, so its copies are reported but never modified.
+func (d *Deduplicator) gateConfidence(hashString string, decision policy.Decision) policy.Decision {
+	level := d.groupConfidence(hashString)
+	if confidenceRank(level) >= confidenceRank(d.minConfidence) {
+		return decision
+	}
+	return skipAll(decision, level+" below --min-confidence")
+}
+
+// verifyGroups compares every copy of each duplicate group byte by byte with the
+// group's first copy. Copies that differ (a hash collision, or a file changed since
+// it was hashed) or cannot be read are dropped from their group, and groups left
+// with a single copy are dropped from the report.
+func (d *Deduplicator) verifyGroups(ctx context.Context, numWorkers int) error {
+	log.Printf("Verifying %d duplicate groups byte by byte...", len(d.groupOrder))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	kept := make(map[string][]string) // hash -> copies identical to the first
+	work := make(chan string)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for hashString := range work {
+				paths := d.fileByteMapDups[hashString]
+				same := []string{paths[0]}
+				for _, p := range paths[1:] {
+					ok, err := sameContent(ctx, d.limiter, paths[0], p)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error verifying file %s: %v\n", p, err)
+						continue
+					}
+					if !ok {
+						log.Printf("Warning: %s differs from %s despite an equal digest; left out of its group.", p, paths[0])
+						continue
+					}
+					same = append(same, p)
+				}
+				mu.Lock()
+				kept[hashString] = same
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, hashString := range d.groupOrder {
+		select {
+		case work <- hashString:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	order := d.groupOrder[:0]
+	for _, hashString := range d.groupOrder {
+		d.fileByteMapDups[hashString] = kept[hashString]
+		if len(kept[hashString]) < 2 {
+			delete(d.fileByteMapDups, hashString)
+			continue
+		}
+		d.verified[hashString] = true
+		order = append(order, hashString)
+	}
+	d.groupOrder = order
+	return nil
+}
+
+// sameContent reports whether two files hold the same bytes, reading them no faster
+// than limiter allows when it is not nil.
+func sameContent(ctx context.Context, limiter *throttle.Limiter, a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+
+	bufA := make([]byte, 64<<10)
+	bufB := make([]byte, 64<<10)
+	for {
+		if limiter != nil {
+			if err := limiter.Wait(ctx, len(bufA)+len(bufB)); err != nil {
+				return false, err
+			}
+		}
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		if errA != nil && !endA {
+			return false, errA
+		}
+		if errB != nil && !endB {
+			return false, errB
+		}
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		if endA || endB {
+			return endA == endB, nil
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hooks"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// Config is the optional JSON configuration file given with --config.
+type Config struct {
+	// Rules are evaluated in order after the --keep-matching/--remove-matching flags;
+	// the first matching rule decides a file's action.
+	Rules []policy.Spec `json:"rules"`
+
+	// Hooks are notified with the JSON run summary when a run completes or fails.
+	Hooks []hooks.RunHook `json:"hooks"`
+
+	// Extensions override how matching files are hashed, e.g. quick digests for large
+	// videos or skipping disk images.
+	Extensions []ExtStrategy `json:"extensions"`
+}
+
+// loadConfig reads and decodes a config file, rejecting unknown fields so typos are not silently ignored.
+func loadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config %s: %w", path, err)
+	}
+	defer f.Close()
+
+	var cfg Config
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
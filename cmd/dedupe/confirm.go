@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// isTerminal reports whether f is an interactive character device.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmActions shows the planned totals and returns true only if the user types "yes".
+func confirmActions(in io.Reader, out io.Writer, files int, bytes int64) bool {
+	fmt.Fprintf(out, "\nAbout to modify %d files (%s). This cannot be undone.\n", files, formatSize(bytes))
+	fmt.Fprint(out, "Type 'yes' to continue: ")
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && answer == "" {
+		return false
+	}
+	return strings.TrimSpace(answer) == "yes"
+}
+
+// formatSize renders a byte count for reports: in binary units, or as a raw number
+// of bytes with --bytes.
+func formatSize(n int64) string {
+	if *rawBytes {
+		return fmt.Sprintf("%d bytes", n)
+	}
+	return formatBytes(n)
+}
+
+// formatBytes renders a byte count in binary units, e.g. 1.5 GiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hashcache"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/memwatch"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/schema"
+)
+
+// Phases of a run as reported by the control socket.
+const (
+	phaseStarting = "starting"
+	phaseScanning = "scanning" // Walking and hashing
+	phaseGrouping = "grouping"
+	phaseApplying = "applying"
+	phaseWaiting  = "waiting" // Between --watch passes
+	phaseFinished = "finished"
+	phaseFailed   = "failed"
+)
+
+// statusBoard holds what the control socket reports beyond the live counters: the
+// current phase and the outcome of the last finished --watch pass. It is safe for
+// concurrent use.
+type statusBoard struct {
+	mu      sync.Mutex
+	started time.Time
+	phase   string
+	detail  string
+	since   time.Time
+	pass    int
+	lastRun *RunSummary
+}
+
+func newStatusBoard() *statusBoard {
+	now := time.Now()
+	return &statusBoard{started: now, phase: phaseStarting, since: now}
+}
+
+// setPhase records the phase the run entered and shows its description in the systemd
+// status line.
+func (d *Deduplicator) setPhase(phase, format string, args ...interface{}) {
+	d.notify.Status(format, args...)
+	b := d.board
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if phase != b.phase {
+		b.since = time.Now()
+	}
+	b.phase, b.detail = phase, fmt.Sprintf(format, args...)
+}
+
+// passDone records the outcome of a --watch pass.
+func (d *Deduplicator) passDone(pass int, s RunSummary) {
+	d.board.mu.Lock()
+	d.board.pass, d.board.lastRun = pass, &s
+	d.board.mu.Unlock()
+}
+
+// ServiceStatus is served by the control socket and printed by the status command.
+type ServiceStatus struct {
+	SchemaVersion int          `json:"schema_version"`
+	PID           int          `json:"pid"`
+	Root          string       `json:"root"`
+	Started       time.Time    `json:"started"`
+	Updated       time.Time    `json:"updated"` // When this status was taken
+	Phase         string       `json:"phase"`   // starting, scanning, grouping, applying, waiting, finished or failed
+	Detail        string       `json:"detail"`
+	PhaseSince    time.Time    `json:"phase_since"`
+	Passes        int          `json:"passes_done,omitempty"` // --watch passes finished
+	FilesFound    uint64       `json:"files_found"`           // In the current or last pass
+	FilesHashed   uint64       `json:"files_hashed"`
+	BytesHashed   uint64       `json:"bytes_hashed"`
+	HeapBytes     uint64       `json:"heap_bytes"` // Of live and not yet collected objects
+	SysBytes      uint64       `json:"sys_bytes"`  // Obtained from the operating system
+	Goroutines    int          `json:"goroutines"`
+	LastRun       *RunSummary  `json:"last_run,omitempty"` // Last finished --watch pass
+	Cache         *CacheStatus `json:"cache,omitempty"`
+}
+
+// CacheStatus describes the hash cache of a running process.
+type CacheStatus struct {
+	Path string `json:"path"`
+	Hits uint64 `json:"hits"` // Digests taken from the cache since the process started
+	hashcache.Stats
+}
+
+// serviceStatus collects the status of the running process.
+func (d *Deduplicator) serviceStatus() ServiceStatus {
+	b := d.board
+	b.mu.Lock()
+	s := ServiceStatus{
+		SchemaVersion: schema.Version,
+		PID:           os.Getpid(),
+		Root:          d.rootDir,
+		Started:       b.started,
+		Updated:       time.Now(),
+		Phase:         b.phase,
+		Detail:        b.detail,
+		PhaseSince:    b.since,
+		Passes:        b.pass,
+		LastRun:       b.lastRun,
+	}
+	b.mu.Unlock()
+	s.FilesFound = d.filesFoundCount.Load()
+	s.FilesHashed = d.filesHashedCount.Load()
+	s.BytesHashed = d.walkStats.HashedBytes.Load()
+	mem := memwatch.Read()
+	s.HeapBytes, s.SysBytes, s.Goroutines = mem.Heap, mem.Sys, mem.Goroutines
+	if d.cache != nil {
+		s.Cache = &CacheStatus{Path: d.cachePath, Hits: d.cache.Hits(), Stats: d.cache.Stats()}
+	}
+	return s
+}
+
+// serveControl answers GET /status on the Unix socket at path with the status of the
+// run until ctx is done. The socket is only accessible to the owner; a stale socket
+// left by a killed process is replaced.
+func (d *Deduplicator) serveControl(ctx context.Context, path string) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return fmt.Errorf("control socket %s is in use by another process", path)
+		}
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("failed to open control socket: %w", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return fmt.Errorf("failed to open control socket: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(d.serviceStatus())
+	})
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close() // Also removes the socket file
+	}()
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// fetchStatus asks the process serving the control socket at path for its status.
+func fetchStatus(path string) (ServiceStatus, error) {
+	var s ServiceStatus
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		}},
+	}
+	resp, err := client.Get("http://dedupe/status")
+	if err != nil {
+		return s, fmt.Errorf("no running process answers on %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s, fmt.Errorf("control socket %s: %s", path, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return s, fmt.Errorf("control socket %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// runStatusCommand prints the status of the process serving the control socket at
+// path, as text or JSON.
+func runStatusCommand(path, format string, out io.Writer) error {
+	s, err := fetchStatus(path)
+	if err != nil {
+		return err
+	}
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(s)
+	}
+	writeStatusText(out, s, time.Now())
+	return nil
+}
+
+// writeStatusText prints a status for people.
+func writeStatusText(out io.Writer, s ServiceStatus, now time.Time) {
+	fmt.Fprintf(out, "Process %d on %s, running for %s\n", s.PID, displayPath(s.Root), now.Sub(s.Started).Round(time.Second))
+	fmt.Fprintf(out, "Phase: %s for %s (%s)\n", s.Phase, now.Sub(s.PhaseSince).Round(time.Second), s.Detail)
+	fmt.Fprintf(out, "Progress: %d of %d files found hashed, %s read\n", s.FilesHashed, s.FilesFound, formatSize(int64(s.BytesHashed)))
+	fmt.Fprintf(out, "Memory: %s heap, %s from the system, %d goroutines\n", formatSize(int64(s.HeapBytes)), formatSize(int64(s.SysBytes)), s.Goroutines)
+	if r := s.LastRun; r != nil {
+		fmt.Fprintf(out, "Last pass (%d done): %s at %s, %d files, %d duplicate groups, %s reclaimable, %d actions applied\n",
+			s.Passes, r.Status, r.Finished.Format(time.RFC3339), r.FilesScanned, r.DuplicateGroups, formatSize(r.ReclaimApparent), r.ActionsApplied)
+		if r.Error != "" {
+			fmt.Fprintf(out, "  Error: %s\n", r.Error)
+		}
+	}
+	if c := s.Cache; c != nil {
+		fmt.Fprintf(out, "Cache %s (%s): %d entries for %s of files, %d hits\n", displayPath(c.Path), c.Algo, c.Entries, formatSize(c.Bytes), c.Hits)
+	}
+}
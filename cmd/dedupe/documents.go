@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/doctext"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// DocumentResult is the outcome of --compare-documents: PDF and DOCX files whose
+// bytes differ but whose text is the same, such as re-saved or re-exported copies.
+// They are likely duplicates for manual review and are never acted on.
+type DocumentResult struct {
+	Files  int             `json:"files"`   // Distinct contents compared
+	NoText int             `json:"no_text"` // Of those, documents without extractable text
+	Groups []DocumentGroup `json:"groups"`
+}
+
+// DocumentGroup is a set of documents with the same normalized text.
+type DocumentGroup struct {
+	TextHash string   `json:"text_hash"` // SHA-256 of the normalized text
+	Paths    []string `json:"paths"`     // One per distinct content, in path order
+}
+
+// compareDocuments extracts the text of one copy of every distinct PDF and DOCX
+// content and groups the documents whose normalized text is identical.
+func (d *Deduplicator) compareDocuments(ctx context.Context, numWorkers int) (*DocumentResult, error) {
+	paths := d.distinctPaths(func(path string, rec fswalk.FileRecord) bool { return doctext.Supported(path) })
+	log.Printf("Extracting the text of %d documents...", len(paths))
+	keys := make([]string, len(paths))
+	err := forEachWorker(ctx, len(paths), numWorkers, func(i int) {
+		text, err := doctext.Extract(paths[i])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading text of %s: %v\n", paths[i], err)
+			return
+		}
+		if norm := normalizeText(text); norm != "" {
+			sum := sha256.Sum256([]byte(norm))
+			keys[i] = hex.EncodeToString(sum[:])
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DocumentResult{Files: len(paths), Groups: []DocumentGroup{}}
+	byText := make(map[string][]string)
+	for i, key := range keys {
+		if key == "" {
+			res.NoText++
+			continue
+		}
+		byText[key] = append(byText[key], paths[i])
+	}
+	for key, ps := range byText {
+		if len(ps) > 1 {
+			res.Groups = append(res.Groups, DocumentGroup{TextHash: key, Paths: ps}) // paths are sorted
+		}
+	}
+	sort.Slice(res.Groups, func(i, j int) bool { return res.Groups[i].Paths[0] < res.Groups[j].Paths[0] })
+	return res, nil
+}
+
+// normalizeText keeps only the letters and digits of text, lower-cased. Spacing,
+// line breaks and punctuation differ between exports of one document, and word
+// boundaries are not reliable in PDF text at all.
+func normalizeText(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// reportDocuments prints the groups of documents with identical text.
+func (d *Deduplicator) reportDocuments() {
+	res := d.documents
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Documents with identical text (likely duplicates, review manually)"))
+	for _, g := range res.Groups {
+		fmt.Fprintf(d.out, "Text %s:\n", g.TextHash[:16])
+		for _, p := range g.Paths {
+			fmt.Fprintf(d.out, "  %s\n", displayPath(p))
+		}
+	}
+	if len(res.Groups) == 0 {
+		fmt.Fprintf(d.out, "No two of the %d documents compared have the same text.\n", res.Files)
+	}
+	if res.NoText > 0 {
+		fmt.Fprintf(d.out, "%d documents had no extractable text (scanned, encrypted or empty).\n", res.NoText)
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// DirUsage is the size of one directory: the apparent size of every file below it
+// (raw) and the size with each distinct content counted once (deduplicated).
+type DirUsage struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Raw   int64  `json:"raw_bytes"`
+	Dedup int64  `json:"dedup_bytes"`
+}
+
+// diskUsage sizes root and every directory below it holding files, at most depth
+// levels deep unless depth is negative, in path order. Hard links of one file count
+// once in the deduplicated size only, as any copies of the same content do.
+func diskUsage(root string, files map[string]fswalk.FileRecord, depth int) []DirUsage {
+	type dirHash struct{ dir, hash string }
+	seen := make(map[dirHash]bool)
+	dirs := make(map[string]*DirUsage)
+	for path, rec := range files {
+		hash := iphash.HashToString(rec.Sum)
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			u := dirs[dir]
+			if u == nil {
+				u = &DirUsage{Path: dir}
+				dirs[dir] = u
+			}
+			u.Files++
+			u.Raw += rec.Size
+			if !seen[dirHash{dir, hash}] {
+				seen[dirHash{dir, hash}] = true
+				u.Dedup += rec.Size
+			}
+			if dir == root || filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+
+	usage := make([]DirUsage, 0, len(dirs))
+	for dir, u := range dirs {
+		if depth >= 0 && dirDepth(root, dir) > depth {
+			continue
+		}
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Path < usage[j].Path })
+	return usage
+}
+
+// dirDepth is the number of levels dir lies below root.
+func dirDepth(root, dir string) int {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// reportDiskUsage prints the raw and deduplicated size of every listed directory.
+func (d *Deduplicator) reportDiskUsage() {
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Disk usage: raw, deduplicated, duplicate share"))
+	for _, u := range diskUsage(d.rootDir, d.fileMap, d.duDepth) {
+		share := 0.0
+		if u.Raw > 0 {
+			share = 100 * float64(u.Raw-u.Dedup) / float64(u.Raw)
+		}
+		fmt.Fprintf(d.out, "%12s %12s %5.1f%%  %s\n", formatSize(u.Raw), formatSize(u.Dedup), share, displayPath(u.Path))
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
+
+// runDiskUsage reports the disk usage of the scan saved in d.duIndex, without reading
+// the tree.
+func (d *Deduplicator) runDiskUsage() error {
+	ix := d.duIndex
+	log.Printf("Sizing the scan of %s:%s (%d files).", ix.Host, ix.Root, len(ix.Files))
+	d.rootDir = ix.Root
+	for _, f := range ix.Files {
+		d.fileMap[f.Path] = fswalk.FileRecord{Path: f.Path, Sum: f.Sum, Size: f.Size, Alloc: f.Size, ModTime: f.ModTime}
+	}
+	d.findDuplicates()
+	if d.format == "json" {
+		if err := d.writeJSONReport(d.out, nil); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		return nil
+	}
+	d.reportDiskUsage()
+	d.reportSummary()
+	return nil
+}
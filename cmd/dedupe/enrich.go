@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// describeGroup fills in the content type, extension consensus and modification
+// time range of the group hashString.
+func (d *Deduplicator) describeGroup(g *ReportGroup, hashString string) {
+	paths := d.fileByteMapDups[hashString]
+	counts := make(map[string]int)
+	for i, p := range paths {
+		counts[strings.ToLower(filepath.Ext(p))]++
+		mtime := d.fileMap[p].ModTime
+		if i == 0 || mtime.Before(g.OldestMTime) {
+			g.OldestMTime = mtime
+		}
+		if i == 0 || mtime.After(g.NewestMTime) {
+			g.NewestMTime = mtime
+		}
+	}
+	best := -1
+	for ext, n := range counts {
+		if n > best || (n == best && ext < g.Extension) {
+			g.Extension, best = ext, n
+		}
+	}
+	g.ExtensionsAgree = len(counts) == 1
+	if len(paths) > 0 {
+		g.ContentType = contentType(paths[0], g.Extension)
+	}
+}
+
+// contentType sniffs the MIME type of the file's first 512 bytes. Where that finds
+// nothing specific, or the file cannot be read (e.g. from a listing), the type
+// registered for ext is used instead.
+func contentType(path, ext string) string {
+	generic := "application/octet-stream"
+	sniffed := generic
+	if f, err := os.Open(path); err == nil {
+		buf := make([]byte, 512)
+		n, _ := io.ReadFull(f, buf)
+		f.Close()
+		if n > 0 {
+			sniffed = http.DetectContentType(buf[:n])
+		}
+	}
+	if sniffed == generic || strings.HasPrefix(sniffed, "text/plain") {
+		if byExt := mime.TypeByExtension(ext); byExt != "" {
+			return byExt
+		}
+	}
+	return sniffed
+}
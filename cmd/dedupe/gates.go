@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/actions"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// skipAll turns every planned action of a decision except the original's into a skip
+// for the given reason, so the group is still reported but never modified.
+func skipAll(decision policy.Decision, reason string) policy.Decision {
+	entries := make([]policy.Entry, len(decision.Entries))
+	for i, e := range decision.Entries {
+		if e.Path != decision.Original && e.Action != policy.ActionSkip {
+			e.Action = policy.ActionSkip
+			e.Rule = reason
+		}
+		entries[i] = e
+	}
+	decision.Entries = entries
+	return decision
+}
+
+// gateAge skips a group whose newest copy was modified within --only-older-than:
+// fresh duplicates are often work in progress.
+func (d *Deduplicator) gateAge(files []fswalk.FileRecord, decision policy.Decision) policy.Decision {
+	if d.minAge <= 0 {
+		return decision
+	}
+	var newest time.Time
+	for _, f := range files {
+		if f.ModTime.After(newest) {
+			newest = f.ModTime
+		}
+	}
+	age := d.rules.Now.Sub(newest)
+	if age >= d.minAge {
+		return decision
+	}
+	return skipAll(decision, fmt.Sprintf("newest copy modified %.1f days ago, within --only-older-than", age.Hours()/24))
+}
+
+// gateSpecialModes skips copies with the setuid, setgid or sticky bit, and links to an
+// original with one, which would give another name the original's privileges. Removing
+// an ordinary copy of a special original is left alone.
+func (d *Deduplicator) gateSpecialModes(files []fswalk.FileRecord, decision policy.Decision) policy.Decision {
+	if d.allowSpecial {
+		return decision
+	}
+	modes := make(map[string]os.FileMode, len(files))
+	for _, f := range files {
+		modes[f.Path] = f.Mode
+	}
+	special := modes[decision.Original]&actions.SpecialModes != 0
+	var entries []policy.Entry
+	for i, e := range decision.Entries {
+		if e.Path == decision.Original || e.Action == policy.ActionSkip {
+			continue
+		}
+		var reason string
+		switch {
+		case modes[e.Path]&actions.SpecialModes != 0:
+			reason = fmt.Sprintf("special permissions %s, see --allow-special-modes", modes[e.Path])
+		case special && e.Action != policy.ActionRemove:
+			reason = fmt.Sprintf("original has special permissions %s, see --allow-special-modes", modes[decision.Original])
+		default:
+			continue
+		}
+		if entries == nil {
+			entries = append([]policy.Entry(nil), decision.Entries...)
+		}
+		entries[i].Action = policy.ActionSkip
+		entries[i].Rule = reason
+	}
+	if entries != nil {
+		decision.Entries = entries
+	}
+	return decision
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/atomicfile"
+)
+
+// writeHeartbeat replaces the heartbeat file with the status of the run.
+func (d *Deduplicator) writeHeartbeat() error {
+	return atomicfile.Write(d.heartbeatPath, 0o644, func(w io.Writer) error {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d.serviceStatus())
+	})
+}
+
+// startHeartbeat writes the heartbeat file now and every interval after. The returned
+// function stops the writes and writes the file a last time, with the final phase of
+// the run; a monitor finding the file older than a few intervals while its phase is not
+// finished or failed has found a stalled or killed run.
+func (d *Deduplicator) startHeartbeat(ctx context.Context, every time.Duration) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	failed := false // Only the first failure is logged
+	beat := func() {
+		if err := d.writeHeartbeat(); err != nil && !failed {
+			failed = true
+			log.Printf("Warning: failed to write heartbeat file: %v", err)
+		}
+	}
+	beat()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				beat()
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+		beat()
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/actions"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// ImportResult is the outcome of the import command.
+type ImportResult struct {
+	Source       string       `json:"source"`
+	Dest         string       `json:"dest"`
+	Copied       []ImportFile `json:"copied"`
+	Linked       []ImportFile `json:"linked"`    // With --on-duplicate link
+	Skipped      []ImportFile `json:"skipped"`   // Content already in the destination
+	Conflicts    []string     `json:"conflicts"` // Destination path taken by other content
+	Failed       int          `json:"failed"`
+	CopiedBytes  int64        `json:"copied_bytes"`
+	SkippedBytes int64        `json:"skipped_bytes"` // Not copied: skipped or linked
+}
+
+// ImportFile is one source file and where it went.
+type ImportFile struct {
+	Source   string `json:"source"`
+	Dest     string `json:"dest"`
+	Existing string `json:"existing,omitempty"` // Destination file with the same content
+	Size     int64  `json:"size"`
+}
+
+// planImport decides for every source file whether it is copied, linked, skipped or in
+// conflict. Content is compared with the scanned destination and with the files copied
+// before it, so duplicates within the source are only copied once.
+func (d *Deduplicator) planImport(src map[string]fswalk.FileRecord) *ImportResult {
+	res := &ImportResult{
+		Source:    d.importSrc,
+		Dest:      d.rootDir,
+		Copied:    []ImportFile{},
+		Linked:    []ImportFile{},
+		Skipped:   []ImportFile{},
+		Conflicts: []string{},
+	}
+	present := make(map[string]string) // hash -> destination path
+	for _, path := range d.sortedPaths() {
+		h := iphash.HashToString(d.fileMap[path].Sum)
+		if _, ok := present[h]; !ok {
+			present[h] = path
+		}
+	}
+
+	paths := make([]string, 0, len(src))
+	for p := range src {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		rec := src[p]
+		rel, err := filepath.Rel(d.importSrc, p)
+		if err != nil {
+			continue
+		}
+		f := ImportFile{Source: p, Dest: filepath.Join(d.rootDir, rel), Size: rec.Size}
+		h := iphash.HashToString(rec.Sum)
+		existing, dup := present[h]
+		if there, ok := d.fileMap[f.Dest]; ok && iphash.HashToString(there.Sum) == h {
+			existing, dup = f.Dest, true
+		}
+		switch {
+		case dup && (!d.importLink || existing == f.Dest):
+			f.Existing = existing
+			res.Skipped = append(res.Skipped, f)
+			res.SkippedBytes += rec.Size
+		case d.destTaken(f.Dest):
+			res.Conflicts = append(res.Conflicts, f.Dest)
+		case dup:
+			f.Existing = existing
+			res.Linked = append(res.Linked, f)
+			res.SkippedBytes += rec.Size
+		default:
+			res.Copied = append(res.Copied, f)
+			res.CopiedBytes += rec.Size
+			present[h] = f.Dest
+		}
+	}
+	return res
+}
+
+// destTaken reports whether something already exists at a destination path.
+func (d *Deduplicator) destTaken(path string) bool {
+	if _, ok := d.fileMap[path]; ok {
+		return true
+	}
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// runImport hashes the source tree, plans the import against the scanned destination
+// and, with --apply, copies and links the files.
+func (d *Deduplicator) runImport(ctx context.Context, numWorkers int) error {
+	log.Printf("Hashing import source %s...", d.importSrc)
+	var found, hashed atomic.Uint64
+	src, _, err := fswalk.DigestAll(ctx, d.importSrc, d.hashFunc, numWorkers, d.walkOpts, &d.walkStats, &found, &hashed)
+	if err != nil {
+		return fmt.Errorf("failed to hash import source: %w", err)
+	}
+	res := d.planImport(src)
+	d.imported = res
+	if !d.apply {
+		return nil
+	}
+	for _, f := range res.Copied {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := actions.Ingest(f.Source, f.Dest); err != nil {
+			log.Printf("Import failed: %v", err)
+			res.Failed++
+		}
+	}
+	for _, f := range res.Linked {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := actions.IngestLink(f.Existing, f.Dest); err != nil {
+			log.Printf("Import failed: %v", err)
+			res.Failed++
+		}
+	}
+	if res.Failed > 0 {
+		return fmt.Errorf("%d files could not be imported", res.Failed)
+	}
+	return nil
+}
+
+// reportImport lists what the import copies, links, skips and refuses.
+func (d *Deduplicator) reportImport() {
+	res := d.imported
+	verb := "would be"
+	if d.apply {
+		verb = "were"
+	}
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, fmt.Sprintf("Import %s -> %s", res.Source, res.Dest)))
+	for _, f := range res.Copied {
+		fmt.Fprintf(d.out, "%s      %s -> %s\n", d.paint(ansiGreen, "COPY"), displayPath(f.Source), displayPath(f.Dest))
+	}
+	for _, f := range res.Linked {
+		fmt.Fprintf(d.out, "%s      %s -> %s\n", d.paint(ansiYellow, "LINK"), displayPath(f.Dest), displayPath(f.Existing))
+	}
+	for _, f := range res.Skipped {
+		fmt.Fprintf(d.out, "%s      %s (already at %s)\n", d.paint(ansiDim, "SKIP"), displayPath(f.Source), displayPath(f.Existing))
+	}
+	for _, p := range res.Conflicts {
+		fmt.Fprintf(d.out, "%s  %s exists with other content\n", d.paint(ansiRed, "CONFLICT"), displayPath(p))
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+	fmt.Fprintln(d.out, d.paint(ansiBold, fmt.Sprintf("%d files (%s) %s copied, %d linked, %d skipped as duplicates (%s), %d conflicts",
+		len(res.Copied), formatSize(res.CopiedBytes), verb, len(res.Linked), len(res.Skipped), formatSize(res.SkippedBytes), len(res.Conflicts))))
+}
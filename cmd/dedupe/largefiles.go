@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// largeFileSize is the size from which the progress line shows how far a file's
+// hashing has got.
+const largeFileSize = 256 << 20
+
+// largeFiles tracks the large files being hashed; it is the iphash.Observer of the
+// hash function.
+type largeFiles struct {
+	mu    sync.Mutex
+	files map[string]*largeFile
+}
+
+// largeFile is the hashing progress of one file.
+type largeFile struct {
+	size, done int64
+}
+
+func newLargeFiles() *largeFiles {
+	return &largeFiles{files: make(map[string]*largeFile)}
+}
+
+func (l *largeFiles) HashStarted(path string, size int64) {
+	l.mu.Lock()
+	l.files[path] = &largeFile{size: size}
+	l.mu.Unlock()
+}
+
+func (l *largeFiles) HashProgress(path string, done int64) {
+	l.mu.Lock()
+	if f, ok := l.files[path]; ok {
+		f.done = done
+	}
+	l.mu.Unlock()
+}
+
+func (l *largeFiles) HashDone(path string) {
+	l.mu.Lock()
+	delete(l.files, path)
+	l.mu.Unlock()
+}
+
+// status describes the large files being hashed, e.g. "disk.img 40% of 8.0 GiB",
+// in path order; empty when there are none.
+func (l *largeFiles) status() string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	paths := make([]string, 0, len(l.files))
+	for path := range l.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	parts := make([]string, len(paths))
+	for i, path := range paths {
+		f := l.files[path]
+		parts[i] = fmt.Sprintf("%s %d%% of %s", filepath.Base(path), f.done*100/f.size, formatSize(f.size))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// loadListing turns the --from-manifest listing into the file map. Listed digests are
+// trusted as they are, so those files are never opened; files listed without a digest
+// are read and hashed. A file that cannot be hashed is left out, like in a scan.
+func (d *Deduplicator) loadListing(ctx context.Context, numWorkers int) (map[string]fswalk.FileRecord, error) {
+	files := make(map[string]fswalk.FileRecord, len(d.listing))
+	var unhashed []fswalk.FileRecord
+	for _, rec := range d.listing {
+		if rec.Sum == nil {
+			unhashed = append(unhashed, rec)
+			continue
+		}
+		files[rec.Path] = rec
+	}
+	d.filesFoundCount.Store(uint64(len(d.listing)))
+	d.filesHashedCount.Store(uint64(len(files)))
+	if len(unhashed) > 0 {
+		log.Printf("Hashing %d of %d listed files that have no digest...", len(unhashed), len(d.listing))
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan fswalk.FileRecord)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rec := range work {
+				sum, err := d.hashFunc(rec.Path)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error hashing file %s: %v\n", rec.Path, err)
+					d.walkStats.HashErrors.Add(1)
+					continue
+				}
+				rec.Sum = sum
+				d.walkStats.HashedBytes.Add(uint64(rec.Size))
+				d.filesHashedCount.Add(1)
+				mu.Lock()
+				files[rec.Path] = rec
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, rec := range unhashed {
+		select {
+		case work <- rec:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return files, ctx.Err()
+}
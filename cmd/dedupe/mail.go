@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hooks"
+)
+
+// mailTopGroups is the number of duplicate groups listed in notification mails.
+const mailTopGroups = 10
+
+// defaultMailTemplate is the body of notification mails unless --mail-template is given.
+const defaultMailTemplate = `go-file-dedupe {{.Summary.Status}} on {{.Host}} for {{.Summary.Root}}
+{{if .Summary.Error}}
+Error: {{.Summary.Error}}
+{{end}}
+Started:          {{.Summary.Started.Format "2006-01-02 15:04:05"}}
+Finished:         {{.Summary.Finished.Format "2006-01-02 15:04:05"}}
+Files scanned:    {{.Summary.FilesScanned}}
+Duplicate groups: {{.Summary.DuplicateGroups}} ({{.Summary.DuplicateFiles}} duplicate files)
+Reclaimable:      {{size .Summary.ReclaimApparent}}
+Actions:          {{.Summary.ActionsApplied}} applied, {{.Summary.ActionsFailed}} failed
+Errors:           {{.Summary.HashErrors}} files could not be hashed
+{{with .Groups}}
+Largest duplicate groups:
+{{range .}}  {{size .Reclaimable | printf "%10s"}}  {{.Copies}} x {{size .Size}}  {{.Original}}
+{{end}}{{end}}`
+
+// MailData is what --mail-template templates are executed with.
+type MailData struct {
+	Summary RunSummary
+	Host    string
+	Groups  []MailGroup // The largest groups by reclaimable bytes, at most 10
+}
+
+// MailGroup is one duplicate group of a notification mail.
+type MailGroup struct {
+	Original    string
+	Copies      int
+	Size        int64 // Of one copy
+	Reclaimable int64 // Size times the copies beyond the original
+}
+
+// parseMailTemplate parses the body template from path, or the default one.
+func parseMailTemplate(path string) (*template.Template, error) {
+	text := defaultMailTemplate
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	return template.New("mail").Funcs(template.FuncMap{"size": formatBytes}).Parse(text)
+}
+
+// mailData collects the template data for a run summary.
+func (d *Deduplicator) mailData(s RunSummary) MailData {
+	host, _ := os.Hostname()
+	data := MailData{Summary: s, Host: host}
+	for _, hashString := range d.groupOrder {
+		if len(data.Groups) == mailTopGroups {
+			break
+		}
+		paths := d.fileByteMapDups[hashString]
+		rec := d.fileMap[paths[0]]
+		data.Groups = append(data.Groups, MailGroup{
+			Original:    displayPath(d.decisions[hashString].Original),
+			Copies:      len(paths),
+			Size:        rec.Size,
+			Reclaimable: rec.Size * int64(len(paths)-1),
+		})
+	}
+	return data
+}
+
+// sendMail mails the run summary when --mail-to is set and the trigger matches.
+// Failures are logged and never change the outcome of the run.
+func (d *Deduplicator) sendMail(s RunSummary) {
+	if d.mail == nil || !d.mail.Fires(s.Status == "success") {
+		return
+	}
+	var body strings.Builder
+	if err := d.mailTemplate.Execute(&body, d.mailData(s)); err != nil {
+		log.Printf("Failed to render the notification mail: %v", err)
+		return
+	}
+	subject := fmt.Sprintf("go-file-dedupe %s: %d duplicate groups, %s reclaimable in %s",
+		s.Status, s.DuplicateGroups, formatBytes(s.ReclaimApparent), s.Root)
+	if err := d.mail.Send(subject, body.String()); err != nil {
+		log.Printf("Notification mail failed: %v", err)
+	}
+}
+
+// newMail builds the notification mail settings from the flags; the SMTP password is
+// read from DEDUPE_SMTP_PASSWORD so it stays out of the process list.
+func newMail(to, from, server, user, on string) (*hooks.Mail, error) {
+	m := &hooks.Mail{Server: server, From: from, Username: user, Password: os.Getenv("DEDUPE_SMTP_PASSWORD"), On: on}
+	for _, addr := range strings.Split(to, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			m.To = append(m.To, addr)
+		}
+	}
+	if m.From == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			host = "localhost"
+		}
+		m.From = "go-file-dedupe@" + host
+	}
+	return m, m.Validate()
+}
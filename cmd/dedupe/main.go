@@ -0,0 +1,2134 @@
+// /home/nicky/src/go/go-file-dedupe/cmd/dedupe/main.go
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/actions"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/autotune"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/coord"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hashcache"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hooks"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/manifest"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/memwatch"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/scanindex"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/schema"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/sdnotify"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/signing"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/snapshot"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/throttle"
+)
+
+// --- Application Struct ---
+type Deduplicator struct {
+	// Configuration
+	rootDir  string
+	hashFunc fswalk.HashFunc
+	rules    *policy.Rules
+	filter   *policy.Filter  // --filter: groups it rejects are neither reported nor acted upon
+	excluded fswalk.InodeSet // --exclude-inodes: files never grouped or modified
+
+	caseInsensitive bool                     // A scan root is on a filesystem that ignores case in names
+	networkFS       bool                     // A scan root is on NFS/SMB/FUSE: inode numbers are not trusted
+	overlays        []fswalk.Overlay         // overlayfs mounts below the root: files in both a view and its layers count once
+	fsName          string                   // Filesystem types of the scan roots, e.g. ext4 or "ext4, nfs"
+	rootFS          map[string]fswalk.FSInfo // Filesystem of each scan root
+	walkOpts        fswalk.Options           // Walker behaviour (reparse points, ...)
+	strategies      *hashStrategies          // Per-extension hashing from the config; nil without
+	apply           bool                     // Execute planned actions instead of only reporting them
+	maxActions      int                      // Modify at most this many files per run; 0 for no limit
+	minAge          time.Duration            // Skip groups whose newest copy is younger (--only-older-than)
+	allowSpecial    bool                     // Act on setuid, setgid and sticky files (--allow-special-modes)
+	minConfidence   string                   // Groups below this confidence level are reported, not acted on
+	verifyBytes     bool                     // Compare the copies of every group byte by byte before planning
+	limiter         *throttle.Limiter        // --max-read-mib, shared by hashing and byte comparison; nil without
+	snapshotKind    string                   // --snapshot: hash a read-only btrfs or lvm snapshot of the root
+	snapshotSize    string                   // Copy-on-write space of an lvm snapshot, e.g. 1G
+	confirm         bool                     // Ask for typed confirmation before applying
+	groupCmd        *hooks.GroupCommand      // Optional --exec-per-group command
+	runHooks        []hooks.RunHook          // Notified with the run summary when the run ends
+	mail            *hooks.Mail              // --mail-to: mailed the run summary when the run ends
+	mailTemplate    *template.Template       // Body of the notification mail
+	notify          *sdnotify.Notifier       // systemd service notifications; nil outside systemd
+	board           *statusBoard             // Phase and last pass, served on the --control-socket
+	memStopped      atomic.Bool              // The memory watchdog stopped the run
+	large           *largeFiles              // Large files being hashed, for the progress line; may be nil
+	executor        *actions.Executor
+	format          string              // Report format: text, json or paths-only
+	pathSep         byte                // Ends each path of the paths-only format
+	color           bool                // Color the text report
+	topDirsN        int                 // Rank this many directories by duplicate bytes; 0 disables
+	maxGroupPaths   int                 // Text report: paths listed per group; 0 lists all
+	statsMode       bool                // stats command: report distributions instead of groups
+	duMode          bool                // du command: report directory sizes instead of groups
+	duDepth         int                 // du: deepest directory level listed; negative lists all
+	duIndex         *scanindex.Index    // du INDEX: size this saved scan instead of scanning
+	listing         []fswalk.FileRecord // --from-manifest: files to group instead of scanning
+	pruneMode       bool                // prune command: report backup generations that can go
+	chunksMode      bool                // chunks command: report large files sharing chunks
+	chunkMinSize    int64               // Smallest file the chunks command compares
+	chunkThreshold  float64             // Share of the smaller file two files must have in common
+	symlinks        *symlinkSet         // --symlinks: links found by the walk, grouped by target content
+	nearExts        map[string]bool     // --near-text: lower-case extensions of documents to fingerprint
+	nearDistance    int                 // Fingerprint bits two nearly identical documents may differ in
+	compareDocs     bool                // --compare-documents: group PDF and DOCX files by their text
+	caseCollide     bool                // --case-collisions: report paths that differ only in case
+	simulateRun     bool                // Report the modelled state after the planned actions
+	progressEvery   time.Duration       // Between progress updates; 0 disables them
+	progressTTY     bool                // msg is a terminal: rewrite the progress line in place
+	precount        bool                // Count files and bytes first for a percentage and ETA
+	tags            map[string]string   // --tag pairs copied into every machine-readable output
+	out             io.Writer           // Receives the report: stdout or the --output file
+	msg             io.Writer           // Progress and notices; stderr when stdout carries a JSON report
+
+	// Manifests
+	algo        string                    // Hash algorithm name, as in manifest column headers
+	known       map[string]manifest.Entry // audit command: the known-good manifest by path
+	manifestOut io.Writer                 // Receives a manifest of the scan when set
+	indexOut    io.Writer                 // index export: receives the scan index
+	parquetOut  io.Writer                 // Receives the file index as Parquet when set
+	baseline    *scanindex.Index          // index import: another machine's scan to compare with
+	importSrc   string                    // import command: tree copied into the root
+	importLink  bool                      // import: link duplicates to the existing copy instead of skipping them
+	target      string                    // unique command: receives one copy of every unique file
+	linkFarm    bool                      // unique: hard link instead of copying
+	cas         bool                      // unique: content-addressed layout plus manifest
+	mountpoint  string                    // mount command: where the planned tree is served
+	mountAll    bool                      // mount: also show files that would be removed
+	ociLayout   bool                      // oci command: the root is an image layout or content store
+
+	// Hash cache
+	cache        *hashcache.Cache // Digests kept between runs; nil without --cache
+	cachePath    string           // Where the cache is saved
+	dirIndex     bool             // --dir-index: take unchanged subtrees from the cache's directory index
+	scrubMode    bool             // scrub command: re-check cached digests instead of scanning
+	scrubPercent int              // Share of the cached files below the root checked per scrub
+	scrubAge     time.Duration    // Only scrub files not verified for this long
+
+	// Status written for monitors, also from inside the sandbox
+	metricsPath   string // --metrics-file
+	heartbeatPath string // --heartbeat-file
+	controlPath   string // --control-socket
+
+	// Results / State
+	fileMap         map[string]fswalk.FileRecord // path -> record (hash and metadata)
+	fileByteMap     map[string]string            // hash(string) -> first_path
+	fileByteMapDups map[string][]string          // hash(string) -> duplicate_paths
+	decisions       map[string]policy.Decision   // hash(string) -> policy decision
+	groupOrder      []string                     // duplicate group hashes in report order
+	audit           *manifest.Result             // Outcome of the audit command
+	scrubbed        *ScrubResult                 // Outcome of the scrub command
+	baselineCmp     *BaselineResult              // Outcome of index import
+	imported        *ImportResult                // Outcome of the import command
+	uniqued         *UniqueResult                // Outcome of the unique command
+	layerDups       *OCIResult                   // Outcome of the oci command
+	pruned          *PruneResult                 // Outcome of the prune command
+	chunked         *ChunkResult                 // Outcome of the chunks command
+	linked          *SymlinkResult               // Symlink groups and dangling links (--symlinks)
+	nearDups        *NearResult                  // Clusters of nearly identical documents (--near-text)
+	documents       *DocumentResult              // Documents with identical text (--compare-documents)
+	collisions      *CaseResult                  // Paths that differ only in case (--case-collisions)
+	verified        map[string]bool              // hash(string) -> copies compared byte by byte
+	discoveredPaths []string
+	walkStats       fswalk.Stats
+	started         time.Time
+	actionsDone     int
+	actionsFailed   int
+	linkLimited     int   // Duplicates kept as further originals because of the hard link limit
+	actionsDeferred int   // Planned operations left for a later run by --max-actions
+	reclaimed       int64 // Apparent size of the duplicates removed or linked
+	phases          phaseTimes
+
+	// Progress Counters (Atomic)
+	filesFoundCount  atomic.Uint64 // Use atomic types
+	filesHashedCount atomic.Uint64
+	totals           scanTotals // From the pre-count; used only by the progress line
+}
+
+// --- Constructor ---
+func NewDeduplicator(rootDir string, hashFunc fswalk.HashFunc, rules *policy.Rules) *Deduplicator {
+	return &Deduplicator{
+		rootDir:         rootDir,
+		hashFunc:        hashFunc,
+		rules:           rules,
+		executor:        &actions.Executor{},
+		minConfidence:   confFullHash,
+		format:          "text",
+		out:             os.Stdout,
+		progressEvery:   time.Second,
+		precount:        true,
+		msg:             os.Stdout,
+		fileMap:         make(map[string]fswalk.FileRecord), // Initialize maps
+		fileByteMap:     make(map[string]string),
+		fileByteMapDups: make(map[string][]string),
+		decisions:       make(map[string]policy.Decision),
+		verified:        make(map[string]bool),
+		discoveredPaths: []string{}, // Initialize slice
+		board:           newStatusBoard(),
+	}
+}
+
+// Run executes the main deduplication process.
+func (d *Deduplicator) Run(ctx context.Context, numWorkers int) error {
+	d.started = time.Now()
+	d.notify.Ready()
+	d.setPhase(phaseScanning, "Scanning %s", d.rootDir)
+	if d.scrubMode {
+		return d.runScrub(ctx, numWorkers)
+	}
+	if d.ociLayout {
+		return d.runOCI(ctx, numWorkers)
+	}
+	if d.duIndex != nil {
+		return d.runDiskUsage()
+	}
+	walkRoot := d.rootDir
+	if d.snapshotKind != "" {
+		snap, err := snapshot.Create(d.snapshotKind, d.rootDir, d.snapshotSize)
+		if err != nil {
+			return fmt.Errorf("failed to snapshot %s: %w", d.rootDir, err)
+		}
+		defer func() {
+			if err := snap.Remove(); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}()
+		walkRoot = snap.Dir
+		log.Printf("Scanning a read-only %s snapshot of the root at %s.", d.snapshotKind, walkRoot)
+	}
+	log.Println("Starting parallel file scan and hash calculation...")
+	var cacheHits uint64 // Before this run, for --watch passes sharing the cache
+	if d.cache != nil {
+		cacheHits = d.cache.Hits()
+	}
+
+	// --- Start Progress Reporter ---
+	// It is stopped as soon as hashing ends so it cannot overwrite reports or prompts.
+	progressCtx, stopProgress := context.WithCancel(ctx)
+	progressDone := make(chan struct{})
+	if d.progressEvery > 0 {
+		if d.progressTTY {
+			fmt.Fprint(d.msg, "\033[s") // Save cursor position
+		}
+		go func() {
+			d.startProgressReporter(progressCtx)
+			close(progressDone)
+		}()
+	} else {
+		close(progressDone)
+	}
+	countDone := make(chan struct{})
+	if d.progressEvery > 0 && d.precount && d.listing == nil {
+		countDone = d.startPrecount(progressCtx, walkRoot, numWorkers)
+	} else {
+		close(countDone)
+	}
+	statusDone := make(chan struct{})
+	go func() {
+		d.reportStatus(progressCtx)
+		close(statusDone)
+	}()
+
+	// Call DigestAll, passing the context and the hash function from the struct
+	d.phases = phaseTimes{workers: numWorkers}
+	hashStart := time.Now()
+	walkOpts := d.walkOpts
+	walkOpts.OnWalkDone = func() { d.phases.walk.Store(int64(time.Since(hashStart))) }
+	if d.symlinks != nil {
+		d.symlinks.paths = nil
+		walkOpts.OnSymlink = d.symlinks.add
+	}
+	var listed map[string]time.Time // --dir-index: directories read by the walk
+	var listedMu sync.Mutex
+	var fromIndex atomic.Uint64
+	if d.dirIndex && d.listing == nil {
+		listed = make(map[string]time.Time)
+		walkOpts.OnDirListed = func(dir string, info os.FileInfo) {
+			listedMu.Lock()
+			listed[dir] = info.ModTime()
+			listedMu.Unlock()
+		}
+		unchanged := d.cache.UnchangedDirs()
+		walkOpts.Unchanged = func(dir string) ([]fswalk.FileRecord, []string, bool) {
+			files, dirs, ok := unchanged(dir)
+			if ok {
+				fromIndex.Add(uint64(len(files)))
+			}
+			return files, dirs, ok
+		}
+	}
+	var returnedFileMap map[string]fswalk.FileRecord
+	var returnedDiscoveredPaths []string
+	var err error
+	if d.listing != nil {
+		returnedFileMap, err = d.loadListing(ctx, numWorkers)
+	} else {
+		returnedFileMap, returnedDiscoveredPaths, err = fswalk.DigestAll(
+			ctx,
+			walkRoot,
+			d.phases.timeHashing(d.hashFunc),
+			numWorkers,
+			walkOpts,
+			&d.walkStats,
+			&d.filesFoundCount,  // Pass pointer
+			&d.filesHashedCount, // Pass pointer
+		)
+	}
+	stopProgress()
+	<-progressDone
+	<-countDone
+	<-statusDone
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			log.Println("Operation cancelled.")
+			return err
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Println("Operation timed out.")
+			return err
+		}
+		if errors.Is(err, fswalk.ErrTooManyErrors) {
+			log.Printf("Aborting: %v; no duplicates are reported from an incomplete scan.", err)
+			return err
+		}
+		log.Printf("Error during file scanning/hashing: %v", err)
+		return fmt.Errorf("file scanning/hashing failed: %w", err)
+	}
+
+	if d.cache != nil {
+		log.Printf("Hash cache: %d of %d digests taken from the cache.", d.cache.Hits()-cacheHits+fromIndex.Load(), len(returnedFileMap))
+	}
+	if listed != nil {
+		if d.walkStats.Errors() > 0 || d.walkStats.PermErrors.Load() > 0 {
+			// A directory listed without an unreadable file would hide it from later runs.
+			d.cache.ClearDirs()
+			log.Printf("Directory index cleared: the scan could not read everything.")
+		} else {
+			d.cache.UpdateDirs(listed, returnedFileMap, returnedDiscoveredPaths)
+			log.Printf("Directory index: %d files in unchanged directories taken without listing them, %d directories listed.", fromIndex.Load(), len(listed))
+		}
+	}
+	if n := d.walkStats.Excluded.Load(); n > 0 {
+		log.Printf("Skipped %d files by extension, permissions or --only.", n)
+	}
+
+	// Store results in the struct fields
+	d.fileMap = returnedFileMap
+	d.discoveredPaths = returnedDiscoveredPaths
+	if d.strategies != nil {
+		if err := d.confirmQuick(ctx, numWorkers); err != nil {
+			log.Println("Operation cancelled.")
+			return err
+		}
+	}
+	if walkRoot != d.rootDir {
+		d.fromSnapshot(walkRoot)
+	}
+	d.phases.hash = time.Since(hashStart)
+	groupStart := time.Now()
+
+	log.Println("Hash calculation complete. Processing results for duplicates...")
+	d.setPhase(phaseGrouping, "Grouping %d hashed files", len(d.fileMap))
+	d.findDuplicates()
+	if d.verifyBytes {
+		if err := d.verifyGroups(ctx, numWorkers); err != nil {
+			log.Println("Operation cancelled.")
+			return err
+		}
+	}
+	d.planActions()
+	if d.symlinks != nil {
+		d.linked = d.groupSymlinks()
+	}
+	if len(d.nearExts) > 0 {
+		if d.nearDups, err = d.nearText(ctx, numWorkers); err != nil {
+			log.Println("Operation cancelled.")
+			return err
+		}
+	}
+	if d.compareDocs {
+		if d.documents, err = d.compareDocuments(ctx, numWorkers); err != nil {
+			log.Println("Operation cancelled.")
+			return err
+		}
+	}
+	if d.caseCollide {
+		if d.caseInsensitive {
+			log.Println("The root ignores case in names, so no two scanned paths can collide by case.")
+		}
+		d.collisions = d.caseCollisions()
+	}
+	d.phases.group = time.Since(groupStart)
+	if d.manifestOut != nil {
+		if err := manifest.Write(d.manifestOut, d.algo, d.rootDir, d.fileMap); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+	if d.parquetOut != nil {
+		if err := d.writeParquet(d.parquetOut); err != nil {
+			return fmt.Errorf("failed to write Parquet index: %w", err)
+		}
+	}
+	if d.indexOut != nil {
+		ix := scanindex.New(d.algo, d.rootDir, d.fileMap, d.started)
+		if err := ix.Write(d.indexOut); err != nil {
+			return fmt.Errorf("failed to write scan index: %w", err)
+		}
+	}
+	var auditErr error
+	if d.known != nil {
+		auditErr = d.runAudit()
+	}
+	if d.baseline != nil {
+		d.baselineCmp = d.compareBaseline()
+	}
+	if d.pruneMode {
+		d.pruned = d.pruneGenerations()
+	}
+	if d.chunksMode {
+		if d.chunked, err = d.findSimilarFiles(ctx, numWorkers); err != nil {
+			log.Println("Operation cancelled.")
+			return err
+		}
+	}
+	var cmdErr error // Of the import and unique commands
+	if d.importSrc != "" {
+		if cmdErr = d.runImport(ctx, numWorkers); d.imported == nil {
+			return cmdErr
+		}
+	}
+	if d.target != "" {
+		cmdErr = d.runUnique(ctx)
+	}
+
+	// Reporting
+	if d.format == "paths-only" {
+		if err := d.writePaths(d.out, d.pathSep); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	} else if d.format == "text" && d.audit != nil {
+		d.reportAudit()
+		d.reportSummary()
+	} else if d.format == "text" && d.uniqued != nil {
+		d.reportUnique()
+		d.reportSummary()
+	} else if d.format == "text" && d.imported != nil {
+		d.reportImport()
+		d.reportSummary()
+	} else if d.format == "text" && d.baselineCmp != nil {
+		d.reportBaseline()
+		d.reportSummary()
+	} else if d.format == "text" && (d.indexOut != nil || d.mountpoint != "") {
+		d.reportSummary()
+	} else if d.format == "text" && d.statsMode {
+		d.reportStats(d.scanStats(time.Now()))
+		d.reportSummary()
+	} else if d.format == "text" && d.chunked != nil {
+		d.reportChunks()
+		d.reportSummary()
+	} else if d.format == "text" && d.pruned != nil {
+		d.reportPrune()
+		d.reportSummary()
+	} else if d.format == "text" && d.duMode {
+		d.reportDiskUsage()
+		d.reportSummary()
+	} else if d.format == "text" {
+		d.reportFileMap()
+		d.reportDuplicates()
+		if d.linked != nil {
+			d.reportSymlinks()
+		}
+		if d.nearDups != nil {
+			d.reportNear()
+		}
+		if d.documents != nil {
+			d.reportDocuments()
+		}
+		if d.collisions != nil {
+			d.reportCaseCollisions()
+		}
+		if d.topDirsN > 0 {
+			d.reportTopDirs()
+		}
+		if !d.apply && len(d.groupOrder) > 0 {
+			d.reportWhatIf()
+		}
+		if d.simulateRun {
+			d.reportSimulation()
+		}
+		d.reportRoots()
+		d.reportSummary()
+	}
+
+	if d.groupCmd != nil {
+		d.runGroupCommands(ctx)
+	}
+	if d.mountpoint != "" {
+		if err := d.serveView(ctx); err != nil {
+			return fmt.Errorf("failed to mount: %w", err)
+		}
+	}
+	actErr := cmdErr
+	if d.apply && d.importSrc == "" && d.target == "" {
+		actErr = d.executeActions(ctx)
+	} else if !d.apply && d.known == nil && d.baseline == nil && d.indexOut == nil && d.mountpoint == "" {
+		log.Println("Report only: re-run with --apply to execute the planned actions.")
+	}
+	if actErr == nil {
+		actErr = auditErr
+	}
+	// The JSON report is written last so its summary includes the applied actions.
+	if d.format == "json" {
+		if err := d.writeJSONReport(d.out, actErr); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+	return actErr
+}
+
+// startProgressReporter runs in a goroutine to periodically display progress.
+// On a terminal the line is rewritten in place; elsewhere each update is a new line.
+func (d *Deduplicator) startProgressReporter(ctx context.Context) {
+	ticker := time.NewTicker(d.progressEvery)
+	defer ticker.Stop()
+	clear, end := "\033[u\033[K", "" // Restore cursor, clear line
+	if !d.progressTTY {
+		clear, end = "", "\n"
+	}
+
+	startTime := time.Now()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Read atomic counters
+			found := d.filesFoundCount.Load()
+			hashed := d.filesHashedCount.Load()
+			elapsed := time.Since(startTime).Round(time.Second)
+
+			// Print progress, overwriting previous line
+			line := fmt.Sprintf("Progress: Found %d files, Hashed %d files%s [%s]...", found, hashed, d.progressEstimate(elapsed), elapsed)
+			if large := d.large.status(); large != "" {
+				line += " Hashing " + large
+			}
+			fmt.Fprintf(d.msg, "%s%s%s", clear, line, end)
+
+		case <-ctx.Done():
+			// Context cancelled (operation finished or interrupted)
+			// Print final status
+			found := d.filesFoundCount.Load()
+			hashed := d.filesHashedCount.Load()
+			elapsed := time.Since(startTime).Round(time.Second)
+			fmt.Fprintf(d.msg, "%sProgress: Found %d files, Hashed %d files [%s]... Done\n", clear, found, hashed, elapsed)
+			return // Exit goroutine
+		}
+	}
+}
+
+// fromSnapshot renames the scanned paths below the snapshot to the same paths below
+// the live root, which every later step and report refers to.
+func (d *Deduplicator) fromSnapshot(snapRoot string) {
+	live := func(path string) string {
+		rel, err := filepath.Rel(snapRoot, path)
+		if err != nil {
+			return path
+		}
+		return filepath.Join(d.rootDir, rel)
+	}
+	files := make(map[string]fswalk.FileRecord, len(d.fileMap))
+	for path, rec := range d.fileMap {
+		rec.Path = live(path)
+		files[rec.Path] = rec
+	}
+	d.fileMap = files
+	for i, dir := range d.discoveredPaths {
+		d.discoveredPaths[i] = live(dir)
+	}
+}
+
+// reportStatus shows the hashing counters in the systemd status line until ctx is done.
+func (d *Deduplicator) reportStatus(ctx context.Context) {
+	if !d.notify.Enabled() {
+		return
+	}
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.notify.Status("Hashing %s: found %d files, hashed %d", d.rootDir, d.filesFoundCount.Load(), d.filesHashedCount.Load())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// findDuplicates processes the fileMap to populate duplicate information.
+// A path that is merely another spelling of a file already in its group (NFC vs NFD,
+// or a case variant on a case-insensitive filesystem) is dropped instead of counted.
+// Files are sharded by the first byte of their digest so every group lies within one
+// shard; the shards are grouped concurrently and merged afterwards.
+func (d *Deduplicator) findDuplicates() {
+	if len(d.overlays) > 0 {
+		d.dropOverlayCopies()
+	}
+	shards := make([]groupShard, shardCount())
+	excluded := 0
+	for path, rec := range d.fileMap {
+		if d.excluded[rec.Inode()] && rec.Ino != 0 {
+			excluded++
+			continue
+		}
+		i := 0
+		if len(rec.Sum) > 0 {
+			i = int(rec.Sum[0]) % len(shards)
+		}
+		shards[i].paths = append(shards[i].paths, path)
+	}
+	var wg sync.WaitGroup
+	for i := range shards {
+		wg.Add(1)
+		go func(s *groupShard) {
+			defer wg.Done()
+			d.groupShard(s)
+		}(&shards[i])
+	}
+	wg.Wait()
+
+	var found [][2]string // duplicate path, the group's first path
+	aliases := 0
+	for _, s := range shards {
+		for hashString, path := range s.first {
+			d.fileByteMap[hashString] = path
+		}
+		for hashString, paths := range s.dups {
+			d.fileByteMapDups[hashString] = paths
+		}
+		for _, path := range s.aliases {
+			delete(d.fileMap, path)
+		}
+		aliases += len(s.aliases)
+		found = append(found, s.found...)
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i][0] < found[j][0] })
+	for _, f := range found {
+		fmt.Fprintf(d.msg, "\rDUPLICATE [%s] == [%s]\n", displayPath(f[0]), displayPath(f[1]))
+	}
+	if aliases > 0 {
+		log.Printf("%d paths naming a file already reached through another path were counted once.", aliases)
+	}
+	if excluded > 0 {
+		log.Printf("%d files on the --exclude-inodes list left out of duplicate groups.", excluded)
+	}
+	if d.filter != nil {
+		d.filterGroups()
+	}
+	d.sortGroups()
+}
+
+// groupShard is the share of the scanned files grouped by one goroutine of findDuplicates.
+type groupShard struct {
+	paths   []string            // Input: the files whose digests fall into the shard
+	first   map[string]string   // hash(string) -> first_path
+	dups    map[string][]string // hash(string) -> duplicate_paths
+	aliases []string            // Paths naming a group member again, dropped from the fileMap
+	found   [][2]string         // Duplicate path and the first path of its group
+}
+
+// groupShard groups the paths of one shard in lexical order. It only reads the fileMap.
+func (d *Deduplicator) groupShard(s *groupShard) {
+	s.first = make(map[string]string)
+	s.dups = make(map[string][]string)
+	sort.Strings(s.paths)
+	for _, path := range s.paths {
+		hashString := hex.EncodeToString(d.fileMap[path].Sum)
+
+		orig, ok := s.first[hashString]
+		if !ok {
+			s.first[hashString] = path
+			continue
+		}
+		members := s.dups[hashString]
+		if len(members) == 0 {
+			members = []string{orig}
+		}
+		if d.isAlias(path, members) {
+			s.aliases = append(s.aliases, path)
+			continue
+		}
+		s.found = append(s.found, [2]string{path, orig})
+		s.dups[hashString] = append(members, path)
+	}
+}
+
+// filterGroups drops the duplicate groups the --filter expression rejects.
+func (d *Deduplicator) filterGroups() {
+	hashes := make([]string, 0, len(d.fileByteMapDups))
+	for hashString := range d.fileByteMapDups {
+		hashes = append(hashes, hashString)
+	}
+	keep := make([]bool, len(hashes))
+	parallelChunks(len(hashes), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			paths := d.fileByteMapDups[hashes[i]]
+			files := make([]fswalk.FileRecord, 0, len(paths))
+			for _, path := range paths {
+				files = append(files, d.fileMap[path])
+			}
+			keep[i] = d.filter.Match(files, d.rules.Now)
+		}
+	})
+	dropped := 0
+	for i, hashString := range hashes {
+		if !keep[i] {
+			delete(d.fileByteMapDups, hashString)
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		log.Printf("%d duplicate groups left out by --filter.", dropped)
+	}
+}
+
+// isAlias reports whether path names the same directory entry as one of the members,
+// either spelled differently or reached twice through another directory.
+func (d *Deduplicator) isAlias(path string, members []string) bool {
+	key := fswalk.PathKey(path, d.caseInsensitive)
+	rec := d.fileMap[path]
+	for _, m := range members {
+		other := d.fileMap[m]
+		if fswalk.PathKey(m, d.caseInsensitive) != key {
+			if d.revisited(rec, other) {
+				return true
+			}
+			continue
+		}
+		if rec.Ino == 0 || d.networkFS || (rec.Dev == other.Dev && rec.Ino == other.Ino) {
+			return true
+		}
+	}
+	return false
+}
+
+// revisited reports whether two records of different paths are the same file reached
+// twice, through a bind mount, a followed junction or overlapping roots. Only records
+// of one inode are compared on disk; without inode numbers only followed junctions can
+// revisit a file. Hard links are separate entries and stay in their group.
+func (d *Deduplicator) revisited(rec, other fswalk.FileRecord) bool {
+	if d.networkFS {
+		return false
+	}
+	if rec.Ino != 0 {
+		if rec.Inode() != other.Inode() {
+			return false
+		}
+	} else if !d.walkOpts.FollowReparsePoints {
+		return false
+	}
+	return fswalk.SameEntry(rec.Path, other.Path, d.caseInsensitive)
+}
+
+// planActions applies the policy rules to every duplicate group.
+func (d *Deduplicator) planActions() {
+	decisions := make([]policy.Decision, len(d.groupOrder))
+	parallelChunks(len(d.groupOrder), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			hashString := d.groupOrder[i]
+			paths := d.fileByteMapDups[hashString]
+			files := make([]fswalk.FileRecord, 0, len(paths))
+			for _, path := range paths {
+				files = append(files, d.fileMap[path])
+			}
+			decisions[i] = d.gateSpecialModes(files, d.gateAge(files, d.gateConfidence(hashString, d.rules.Apply(files))))
+		}
+	})
+	for i, hashString := range d.groupOrder {
+		d.decisions[hashString] = decisions[i]
+	}
+}
+
+// executeActions performs the remove/link operations of every planned decision.
+// Nothing is changed if the backup destination cannot hold every affected file.
+// Cancellation stops the run between two operations, never in the middle of one.
+func (d *Deduplicator) executeActions(ctx context.Context) error {
+	var ops []actions.Op
+	for _, hashString := range d.groupOrder {
+		decision := d.decisions[hashString]
+		ops = append(ops, actions.Plan(decision, d.fileMap)...)
+	}
+	if !d.executor.PreferReflink {
+		var promoted int
+		limit := func(original string) uint64 { return actions.LinkLimits[d.fsOf(original)] }
+		if ops, promoted = actions.SplitLinks(ops, limit); promoted > 0 {
+			log.Printf("Keeping %d duplicates as further originals so none exceeds its filesystem's hard link limit.", promoted)
+			d.linkLimited += promoted
+		}
+	}
+	if d.maxActions > 0 && len(ops) > d.maxActions {
+		// Groups are in report order, so the most reclaimable bytes are handled first.
+		d.actionsDeferred = len(ops) - d.maxActions
+		ops = ops[:d.maxActions]
+		log.Printf("Limiting this run to %d actions (--max-actions); %d planned actions are left for later runs.", d.maxActions, d.actionsDeferred)
+	}
+
+	var bytes int64
+	for _, op := range ops {
+		bytes += op.File.Size
+	}
+	d.setPhase(phaseApplying, "Applying %d actions (%s)", len(ops), formatSize(bytes))
+	if d.executor.Backup != nil {
+		if err := actions.Preflight(d.executor.Backup.Dir, bytes, len(ops)); err != nil {
+			return fmt.Errorf("backup preflight failed, no action taken: %w", err)
+		}
+	}
+	if d.confirm && len(ops) > 0 && !confirmActions(os.Stdin, d.msg, len(ops), bytes) {
+		return errors.New("actions not confirmed, no action taken")
+	}
+
+	for _, op := range ops {
+		if op.Action == policy.ActionLink && d.networkFS {
+			log.Println("WARNING: hard linking on a network filesystem; links may not be honoured by every client or server.")
+			break
+		}
+	}
+	checked := make(map[string]bool)
+	for _, op := range ops {
+		if op.Action != policy.ActionLink || d.executor.PreferReflink {
+			continue
+		}
+		if root := d.rootOf(op.File.Path); !checked[root] {
+			if err := actions.CheckLinkSupport(root); err != nil {
+				return fmt.Errorf("link actions planned but not possible, no action taken: %w", err)
+			}
+			checked[root] = true
+		}
+	}
+
+	var done, failed int
+	started := time.Now()                 // After the prompt, which is not part of the actions phase
+	successor := make(actions.Successors) // For originals that reached their hard link limit
+	for i, op := range ops {
+		if err := ctx.Err(); err != nil {
+			d.actionsDone, d.actionsFailed = done, failed
+			log.Printf("Stopping with %d actions left: %v", len(ops)-i, err)
+			return err
+		}
+		if op.Action == policy.ActionLink {
+			op.Original = successor.Of(op.Original)
+		}
+		if err := d.executor.Run(op); err != nil {
+			if errors.Is(err, actions.ErrLinkLimit) {
+				// The limit was lower than known: split the group here instead.
+				log.Printf("Original %s reached its hard link limit; %s stays and takes its place for the remaining duplicates.", op.Original.Path, op.File.Path)
+				successor.Replace(op.Original, op.File)
+				d.linkLimited++
+				continue
+			}
+			log.Printf("Action failed: %v", err)
+			failed++
+			continue
+		}
+		done++
+		d.reclaimed += op.File.Size
+	}
+	d.actionsDone, d.actionsFailed = done, failed
+	d.phases.actions = time.Since(started)
+	log.Printf("Actions complete: %d succeeded, %d failed in %s.", done, failed, d.phases.actions.Round(time.Millisecond))
+	if d.linkLimited > 0 {
+		log.Printf("%d duplicates kept as further originals because of the hard link limit.", d.linkLimited)
+	}
+	return nil
+}
+
+// runGroupCommands invokes the --exec-per-group command once per duplicate group,
+// or prints what would be run when not applying.
+func (d *Deduplicator) runGroupCommands(ctx context.Context) {
+	for _, hashString := range d.groupOrder {
+		decision := d.decisions[hashString]
+		var dups []string
+		for _, e := range decision.Entries {
+			if e.Path != decision.Original && e.Action != policy.ActionSkip {
+				dups = append(dups, e.Path)
+			}
+		}
+		if len(dups) == 0 {
+			continue
+		}
+		if !d.apply {
+			fmt.Fprintln(d.msg, "Would run:", d.groupCmd.Preview(decision.Original, dups))
+			continue
+		}
+		if err := d.groupCmd.Run(ctx, decision.Original, dups); err != nil {
+			log.Printf("Group command failed for %s: %v", decision.Original, err)
+		}
+	}
+}
+
+// reportFileMap prints the content of the fileMap (path -> hash).
+func (d *Deduplicator) reportFileMap() {
+	fmt.Fprintln(d.out, "\nDump FileMap (Path -> Hash)\n-------------------------")
+	count := 0
+	limit := 50 // Example limit
+
+	// Access struct field directly
+	fmt.Fprintf(d.out, "FileMap contains %d entries\n", len(d.fileMap))
+
+	for _, key := range d.sortedPaths() {
+		element := d.fileMap[key]
+		str := hex.EncodeToString(element.Sum)
+		fmt.Fprintln(d.out, "Hash:", str, ":", displayPath(key))
+		count++
+		if count >= limit {
+			fmt.Fprintln(d.out, "... (output limited to", limit, "entries)")
+			break
+		}
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
+
+// reportDuplicates prints the content of the fileByteMapDups (hash -> paths).
+func (d *Deduplicator) reportDuplicates() {
+	fmt.Fprintln(d.out, "\nDump FileMapDups (Hash -> Duplicate Paths)\n-------------------------")
+	if len(d.fileByteMapDups) == 0 {
+		fmt.Fprintln(d.out, "No duplicates found.")
+	} else {
+		// Groups are formatted concurrently and written in report order.
+		texts := make([]string, len(d.groupOrder))
+		parallelChunks(len(d.groupOrder), func(lo, hi int) {
+			for i := lo; i < hi; i++ {
+				texts[i] = d.formatGroup(d.groupOrder[i])
+			}
+		})
+		for _, text := range texts {
+			io.WriteString(d.out, text)
+		}
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
+
+// formatGroup renders one duplicate group of the text report.
+func (d *Deduplicator) formatGroup(hashString string) string {
+	var b strings.Builder
+	element := d.fileByteMapDups[hashString]
+	rec := d.groupRecord(hashString)
+	header := fmt.Sprintf("Group %s Hash |%s| %d x %s [%s]", iphash.GroupID(rec.Sum), hashString, len(element), formatSize(rec.Size), d.groupConfidence(hashString))
+	entries := d.decisions[hashString].Entries
+	more := ""
+	if n := d.maxGroupPaths; n > 0 && len(element) > n {
+		// Machine-readable formats always list every member.
+		more = fmt.Sprintf(" (+%d more)", len(element)-n)
+		element = element[:n]
+		if len(entries) > n {
+			entries = entries[:n]
+		}
+	}
+	fmt.Fprintf(&b, "%s: %q%s\n", d.paint(ansiBold+ansiCyan, header), element, more)
+	for _, e := range entries {
+		action := d.paint(actionColor(e.Action), fmt.Sprintf("%-6s", strings.ToUpper(e.Action.String())))
+		if e.Rule != "" {
+			fmt.Fprintf(&b, "  %s %s  %s\n", action, displayPath(e.Path), d.paint(ansiDim, "["+e.Rule+"]"))
+		} else {
+			fmt.Fprintf(&b, "  %s %s\n", action, displayPath(e.Path))
+		}
+	}
+	if more != "" {
+		fmt.Fprintf(&b, "  %s\n", d.paint(ansiDim, strings.TrimSpace(more)))
+	}
+	return b.String()
+}
+
+// reclaimable sums the apparent and allocated sizes of the files planned for removal or
+// linking, and counts the sparse ones among them. Only allocated bytes are freed on disk.
+func (d *Deduplicator) reclaimable() (apparent, allocated int64, sparse int) {
+	for _, decision := range d.decisions {
+		for _, e := range decision.Entries {
+			if e.Path == decision.Original || (e.Action != policy.ActionRemove && e.Action != policy.ActionLink && e.Action != policy.ActionReflink) {
+				continue
+			}
+			rec := d.fileMap[e.Path]
+			apparent += rec.Size
+			allocated += rec.Alloc
+			if rec.Sparse() {
+				sparse++
+			}
+		}
+	}
+	return apparent, allocated, sparse
+}
+
+// reportSummary prints the final statistics.
+func (d *Deduplicator) reportSummary() {
+	var scanned int64
+	for _, rec := range d.fileMap {
+		scanned += rec.Size
+	}
+	fmt.Fprintln(d.out, d.paint(ansiBold, fmt.Sprintf("%d  Files scanned and hashed (%s).", len(d.fileMap), formatSize(scanned))))
+	fmt.Fprintln(d.out, len(d.fileByteMap), " unique file content hashes found.")
+	fmt.Fprintln(d.out, len(d.discoveredPaths), " directories discovered (excluding root).")
+	if apparent, allocated, sparse := d.reclaimable(); apparent > 0 {
+		fmt.Fprintf(d.out, "%s  reclaimable by the planned actions (%s allocated on disk", d.paint(ansiBold+ansiGreen, formatSize(apparent)), formatSize(allocated))
+		if sparse > 0 {
+			fmt.Fprintf(d.out, ", %d sparse files", sparse)
+		}
+		fmt.Fprintln(d.out, ").")
+	}
+	fmt.Fprintf(d.out, "Time: %s.\n", d.phases.timings(d.walkStats.HashedBytes.Load()))
+	if n := d.walkStats.HashErrors.Load(); n > 0 {
+		fmt.Fprintln(d.out, n, " files could not be read and were left out.")
+	}
+	if n := d.walkStats.PermErrors.Load(); n > 0 {
+		fmt.Fprintln(d.out, n, " directories or files skipped: permission denied.")
+	}
+	if n := d.walkStats.Retries.Load(); n > 0 {
+		fmt.Fprintln(d.out, n, " reads retried after transient I/O errors.")
+	}
+	if n := d.walkStats.PseudoFS.Load(); n > 0 {
+		fmt.Fprintln(d.out, n, " virtual filesystems (/proc, /sys, ...) skipped.")
+	}
+	if n := d.walkStats.ExcludedDirs.Load(); n > 0 {
+		fmt.Fprintln(d.out, n, " directories left out of the scan.")
+	}
+	if n := d.walkStats.Special(); n > 0 {
+		st := &d.walkStats
+		fmt.Fprintf(d.out, "%d  special files skipped (%d symlinks, %d sockets, %d FIFOs, %d devices, %d other).\n",
+			n, st.Symlinks.Load(), st.Sockets.Load(), st.NamedPipes.Load(), st.Devices.Load(), st.Irregular.Load())
+	}
+	if n := d.walkStats.ReparsePoints.Load(); n > 0 {
+		fmt.Fprintln(d.out, n, " reparse points (junctions, links, placeholders) skipped.")
+	}
+}
+
+// // Keep global maps as they are used for processing and reporting
+// var FileByteMap map[string]string
+// var FileByteMapDups map[string][]string
+// var FileMap map[string]iphash.HashBytes
+// var discoveredPaths []string
+
+// networkWorkers caps the default worker count on network filesystems, where many
+// concurrent readers mostly add latency and server load.
+const networkWorkers = 4
+
+// statusInterval is how often the systemd status line is refreshed while hashing.
+const statusInterval = 5 * time.Second
+
+// flagWasSet reports whether the named flag was given on the command line.
+func flagWasSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeatable flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// writeSignature writes the armored signature of a report digest and closes f.
+func writeSignature(signer *signing.Signer, sum []byte, f *os.File) error {
+	sig, err := signer.SignHash(sum)
+	if err == nil {
+		_, err = f.Write(sig)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to sign report: %w", err)
+	}
+	return nil
+}
+
+// workerCount is the --workers value: a fixed number, or auto for a number adjusted
+// by an autotune.Tuner within a pool of n.
+type workerCount struct {
+	n    int
+	auto bool
+}
+
+// autoWorkers bounds the pool of --workers auto.
+const autoWorkers = 64
+
+// tuneInterval is how long --workers auto measures throughput before each adjustment.
+const tuneInterval = 2 * time.Second
+
+func (w *workerCount) String() string {
+	if w.auto {
+		return "auto"
+	}
+	return strconv.Itoa(w.n)
+}
+
+func (w *workerCount) Set(value string) error {
+	if value == "auto" {
+		w.auto, w.n = true, 4*runtime.NumCPU()
+		if w.n < 16 {
+			w.n = 16 // Network storage profits from many outstanding reads even on few CPUs
+		}
+		if w.n > autoWorkers {
+			w.n = autoWorkers
+		}
+		return nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("want a number or auto, got %q", value)
+	}
+	w.n, w.auto = n, false
+	return nil
+}
+
+// tagMap is a flag.Value collecting repeatable key=value pairs.
+type tagMap map[string]string
+
+func (m tagMap) String() string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m tagMap) Set(value string) error {
+	k, v, ok := strings.Cut(value, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("want key=value, got %q", value)
+	}
+	m[k] = v
+	return nil
+}
+
+// --- Define command-line flag ---
+var (
+	hashAlgorithm  = flag.String("algo", "blake3", "Hashing algorithm to use (blake3, sha256, or md5)")
+	configPath     = flag.String("config", "", "Path to a JSON config file with policy rules")
+	defaultAction  = flag.String("action", "remove", "Action for duplicates no rule matched (remove, link, reflink, keep or skip)")
+	keepOriginal   = flag.String("original", "first", "Which copy no rule matched is kept: first (path order), oldest, newest, shortest (path) or links (most hard links)")
+	preferReflink  = flag.Bool("prefer-reflink", false, "Perform link actions as copy-on-write clones (APFS, btrfs, XFS) where supported, hard links elsewhere")
+	execPerGroup   = flag.String("exec-per-group", "", "Command run for each duplicate group, e.g. 'cmd {original} {dups...}' (previewed unless --apply)")
+	applyActions   = flag.Bool("apply", false, "Execute the planned remove/link actions (default is report only)")
+	assumeYes      = flag.Bool("yes", false, "Do not ask for confirmation before applying actions on a terminal")
+	auditLogPath   = flag.String("audit-log", "", "Append a JSONL record of every remove/link operation to this file")
+	backupDir      = flag.String("backup-dir", "", "Copy every file into this directory before removing or relinking it")
+	backupDays     = flag.Int("backup-expire-days", 30, "Delete backup runs older than this many days (0 keeps them forever)")
+	followReparse  = flag.Bool("follow-reparse-points", false, "Windows: descend into junctions and read reparse-point files instead of skipping them")
+	networkSafe    = flag.Bool("network-safe", true, "On NFS/SMB/FUSE roots: distrust inode numbers, reduce workers and warn before hard linking")
+	scanPseudoFS   = flag.Bool("include-pseudo-fs", false, "Also walk virtual filesystems such as /proc, /sys, /dev and /run")
+	sidecars       = flag.Bool("sidecar", false, "Record removed or linked duplicates in a JSON file next to their original (ORIGINAL.dedupe.json)")
+	sameXattrs     = flag.Bool("require-same-xattrs", false, "Refuse to hard link duplicates whose extended attributes (ACLs, SELinux label) differ from the original's")
+	retries        = flag.Int("retries", 3, "Retry hashing a file this many times after a transient I/O error (EINTR, EAGAIN, NFS timeouts)")
+	retryDelay     = flag.Duration("retry-delay", 250*time.Millisecond, "Wait before the first retry; doubled for each further retry")
+	maxReadMiB     = flag.Int("max-read-mib", 0, "Read file content for hashing and for --verify-bytes at most this many MiB per second across all workers, e.g. to spare the link to a network share; 0 for no limit")
+	maxErrors      = flag.Int("max-errors", 0, "Abort the run once this many directories or files could not be read (0: no limit)")
+	failFast       = flag.Bool("fail-fast", false, "Abort the run on the first read error (same as --max-errors 1)")
+	skipPermErrors = flag.Bool("skip-perm-errors", false, "Only count permission-denied directories and files; they do not count toward --max-errors")
+	reportFormat   = flag.String("format", "text", "Report format: text, json (versioned, see --schema), or paths-only (the duplicates the plan removes or relinks, one per line)")
+	nullSep        = flag.Bool("null", false, "With --format paths-only, end each path with a NUL byte instead of a newline, for xargs -0")
+	printSchema    = flag.Bool("schema", false, "Print the JSON Schema of the JSON report, run summary and audit log, then exit")
+	rawBytes       = flag.Bool("bytes", false, "Show sizes in the text report as raw byte counts instead of KiB/MiB/GiB")
+	colorMode      = flag.String("color", "auto", "Color the text report: auto (terminals only, off with NO_COLOR), always or never")
+	outputPath     = flag.String("output", "", "Write the report (in --format) to this file; progress and logs stay on the terminal")
+	topDirsCount   = flag.Int("top-dirs", 0, "Rank the N directories holding the most duplicate bytes (direct and recursive)")
+	maxGroupPaths  = flag.Int("max-group-paths", 100, "List at most N paths per group in the text report, followed by a (+K more) marker; 0 lists all. JSON and paths-only reports always list every path")
+	simulate       = flag.Bool("simulate", false, "Report the modelled disk usage per filesystem and resulting link counts after the planned actions")
+	timeout        = flag.Duration("timeout", 0, "Stop the run gracefully after this long, e.g. 2h (0: no limit); exits with status 124")
+	progressEvery  = flag.Duration("progress-interval", time.Second, "Time between progress updates; 0 disables them")
+	noPrecount     = flag.Bool("no-precount", false, "Skip counting files and bytes before hashing; progress then shows no percentage or ETA")
+	manifestPath   = flag.String("manifest", "", "Known-good hashdeep manifest the audit command compares the tree against")
+	rootsFrom      = flag.String("roots-from", "", "Scan the directories listed in this file, one per line, instead of the working directory; the report root is their common parent")
+	rootsNull      = flag.Bool("roots-null", false, "Entries of --roots-from end with NUL bytes instead of newlines, as written by find -print0")
+	fromManifest   = flag.String("from-manifest", "", "Group the files of this CSV or JSON listing (path, size, mtime and optionally hash columns) instead of scanning; listed digests are trusted")
+	writeManifest  = flag.String("write-manifest", "", "Write a hashdeep manifest of the scanned files to this file, e.g. for a later audit")
+	exportParquet  = flag.String("export-parquet", "", "Write the file index (path, size, mtime, hash, group_id) to this Parquet file for analysis in DuckDB or Spark")
+	cachePath      = flag.String("cache", "", "Keep digests in this file between runs; files with unchanged size and modification time are not read again")
+	dirIndex       = flag.Bool("dir-index", false, "Also keep a Merkle index of directories in the --cache and take subtrees whose directories have unchanged modification times from it without listing them; files rewritten in place go unnoticed until their directory changes")
+	chunkMinMiB    = flag.Int("chunk-min-mib", 64, "chunks: only compare files of at least this many MiB")
+	chunkPercent   = flag.Int("chunk-similarity", 50, "chunks: report pairs sharing at least this percentage of the smaller file's content")
+	scrubPercent   = flag.Int("scrub-percent", 10, "scrub: re-read at most this percentage of the cached files, least recently verified first")
+	linkFarm       = flag.Bool("link-farm", false, "unique: hard link the unique files into the target instead of copying them (same filesystem only)")
+	mountAll       = flag.Bool("mount-all", false, "mount: also show the files the planned actions would remove (see the user.dedupe.* xattrs)")
+	casLayout      = flag.Bool("cas", false, "unique: store content as objects/ab/cdef... with a manifest.txt mapping every scanned path to its digest")
+	onDuplicate    = flag.String("on-duplicate", "skip", "import: skip source files whose content the destination holds, or link them to the existing copy")
+	duDepth        = flag.Int("du-depth", -1, "du: only list directories at most this many levels below the root (-1: all)")
+	verifySample   = flag.Int("verify-sample", 100, "cache verify: number of randomly chosen entries to re-hash")
+	scrubAge       = flag.Duration("scrub-age", 0, "scrub: only re-read files not verified for this long, e.g. 720h")
+	signKey        = flag.String("sign-key", "", "SSH private key used to write a detached signature of the --output file to FILE.sig (ssh-keygen -Y verify -n file)")
+	useSandbox     = flag.Bool("sandbox", false, "Linux only: confine the process with Landlock and seccomp to the paths the run needs")
+	hookExec       = flag.String("hook-exec", "", "Command run when the run ends, with the JSON summary on stdin")
+	minConfidence  = flag.String("min-confidence", confFullHash, "Only act on duplicate groups of at least this confidence: size-only, partial-hash, full-hash or byte-verified")
+	verifyBytes    = flag.Bool("verify-bytes", false, "Compare the copies of every duplicate group byte by byte before reporting them; their groups are byte-verified")
+	symlinks       = flag.Bool("symlinks", false, "Also report groups of symlinks pointing at identical content, and dangling symlinks; links are never acted on")
+	nearText       = flag.String("near-text", "", "Comma-separated extensions, e.g. .txt,.md, of documents to compare by text fingerprint and report in clusters of nearly identical ones; never acted on")
+	nearDistance   = flag.Int("near-distance", 3, "--near-text: fingerprint bits (0-15) in which two nearly identical documents may differ")
+	compareDocs    = flag.Bool("compare-documents", false, "Also report PDF and DOCX files whose bytes differ but whose extracted text is identical, for manual review; never acted on")
+	caseCollide    = flag.Bool("case-collisions", false, "Also report files and directories whose paths differ only in case, which would collide when copied to a case-insensitive filesystem; never acted on")
+	skipExec       = flag.Bool("skip-executables", false, "Leave files with any execute permission bit out of the scan")
+	regularPerms   = flag.Bool("only-regular-perms", false, "Only scan files without execute bits, setuid, setgid or sticky bits, and that are not world-writable")
+	overlayUpper   = flag.Bool("overlay-upper-only", false, "Of overlayfs mounts below the root, such as container filesystems, only scan the upper layers: skip their merged views, lower layers and work directories")
+	allowSpecial   = flag.Bool("allow-special-modes", false, "Allow actions on setuid, setgid and sticky files and links to originals with those bits, which are skipped by default")
+	onlyOlderThan  = flag.Int("only-older-than", 0, "Only act on duplicate groups whose newest copy was last modified more than this many days ago; younger groups are reported but skipped (0: no limit)")
+	maxActions     = flag.Int("max-actions", 0, "With --apply, modify at most this many files per run, groups with the most reclaimable bytes first (0: no limit)")
+	hostWorkers    = flag.Int("host-workers", 0, "Hashing workers shared by all runs on this host using the same --coord-dir, on top of --workers per run (0: no limit)")
+	coordDir       = flag.String("coord-dir", filepath.Join(os.TempDir(), "go-file-dedupe"), "Directory of the lock files through which concurrent runs share --host-workers")
+	watchEvery     = flag.Duration("watch", 0, "Scan again this long after each run ends, until interrupted; use with --cache so only new and changed files are read")
+	snapshotKind   = flag.String("snapshot", "", "Hash a read-only snapshot of the root, taken and removed by the run, for consistent results on a busy volume: btrfs or lvm (Linux, report only)")
+	snapshotSize   = flag.String("snapshot-size", "1G", "Copy-on-write space reserved for an lvm --snapshot, in lvcreate syntax")
+	excludeInodes  = flag.String("exclude-inodes", "", "File of DEV:INO lines (stat -c %d:%i) naming files that are never grouped as duplicates or modified")
+	groupFilter    = flag.String("filter", "", "Only report and act on duplicate groups matching this expression, e.g. 'size > 100MB && count >= 3 && !path(\"/master/**\")'")
+	mailTo         = flag.String("mail-to", "", "Comma-separated addresses mailed a summary with the largest groups when the run ends")
+	mailFrom       = flag.String("mail-from", "", "Sender of notification mails (default go-file-dedupe@HOSTNAME)")
+	smtpServer     = flag.String("smtp-server", "localhost:25", "SMTP server host:port for --mail-to; STARTTLS is used when offered")
+	smtpUser       = flag.String("smtp-user", "", "User for SMTP authentication; the password is read from DEDUPE_SMTP_PASSWORD")
+	mailOn         = flag.String("mail-on", hooks.OnAlways, "When to send --mail-to notifications: always, success or failure")
+	mailTemplate   = flag.String("mail-template", "", "text/template file for the notification mail body, executed with the summary, host and largest groups")
+	metricsFile    = flag.String("metrics-file", "", "Export run metrics here when the run ends: Prometheus text for a .prom file (e.g. in node_exporter's textfile directory), else one JSON summary line appended per run")
+	heartbeatFile  = flag.String("heartbeat-file", "", "Write the phase, progress and timestamp of the run as JSON to this file every --heartbeat-every, for monitors that detect stalled runs by its age")
+	heartbeatEvery = flag.Duration("heartbeat-every", 30*time.Second, "Interval of the --heartbeat-file writes")
+	warnHeapMiB    = flag.Int("warn-heap-mib", 0, "Warn when the heap in use passes this many MiB, return freed memory to the system and save the --cache as a checkpoint; 0 to disable")
+	maxHeapMiB     = flag.Int("max-heap-mib", 0, "Stop the run gracefully, as on Ctrl+C, when the heap in use passes this many MiB; 0 for no limit")
+	warnGoroutines = flag.Int("warn-goroutines", 0, "Warn when more than this many goroutines are running; 0 to disable")
+	controlSocket  = flag.String("control-socket", "", "Serve the phase, progress, last --watch pass and cache statistics of the run on this Unix socket; the status command reads them from it")
+	hookURL        = flag.String("hook-url", "", "Webhook URL that receives the JSON summary as a POST when the run ends")
+	keepMatching   stringList
+	onlySubtrees   stringList
+	excludeDevs    stringList
+	removeMatching stringList
+	importHashes   stringList
+	runTags        = tagMap{}
+	workers        = workerCount{n: runtime.NumCPU()}
+)
+
+// commands lists the subcommands; the empty command scans and reports duplicates.
+var commands = map[string]string{
+	"audit":  "compare the tree against --manifest: matched, moved, changed, new and missing files",
+	"du":     "[INDEX.gob] prints the raw and deduplicated size of every directory, of the root or of a scan saved by index export",
+	"cache":  "stats, prune (drop deleted files), verify (spot-check entries) or clear the --cache",
+	"index":  "export FILE saves the scan for another machine; import FILE compares the tree with such a scan",
+	"import": "SRC DEST copies SRC into DEST (with --apply), skipping or linking content DEST already holds",
+	"mount":  "MOUNTPOINT serves the tree as it would look after the planned actions, read-only over FUSE (experimental)",
+	"plan":   "diff OLD.json NEW.json lists the planned actions that appeared, disappeared or changed between two JSON reports",
+	"oci":    "DIR reports files stored more than once across the layers of the images in an OCI layout or containerd content store",
+	"chunks": "reports pairs of large files sharing most of their content in content-defined chunks (FastCDC), e.g. VM images or database dumps; changes nothing",
+	"prune":  "reports the backup generations below the root (rsnapshot's daily.0, ...) whose content newer ones all hold, with a plan removing them",
+	"scrub":  "re-hash part of the --cache and report files whose content changed unexpectedly (bit rot)",
+	"unique": "TARGET writes one copy, or with --link-farm a hard link, of every unique file below TARGET (with --apply)",
+	"stats":  "print size, extension and duplicate age distributions of the scan",
+	"status": "prints the phase, progress, last --watch pass and cache statistics of the run serving --control-socket",
+}
+
+func init() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+		names := make([]string, 0, len(commands))
+		for name := range commands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "  %-8s %s\n", name, commands[name])
+		}
+		fmt.Fprintln(out, "Without a command the scan root is reported and, with --apply, deduplicated.\n\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Var(&workers, "workers", "Number of concurrent hashing workers, or auto to adjust it to the measured throughput while hashing")
+	flag.Var(&onlySubtrees, "only", "Only scan the subtrees of the root matching this relative path, e.g. projects/*/src (repeatable); other directories are never read")
+	flag.Var(&excludeDevs, "exclude-device", "Never enter filesystems on this device, given as a path like /dev/sdb1 or a filesystem UUID, e.g. bind mounts of volumes below the root (repeatable)")
+	flag.Var(&keepMatching, "keep-matching", "Regex of paths to always keep within a duplicate group (repeatable, wins over --remove-matching)")
+	flag.Var(&removeMatching, "remove-matching", "Regex of paths to always remove within a duplicate group (repeatable)")
+	flag.Var(&importHashes, "import-hashes", "md5sum/sha256sum/b3sum file or hashdeep manifest whose digests are trusted for files not modified since it was written (repeatable)")
+	flag.Var(runTags, "tag", "key=value attached to the JSON report, run summary and audit records (repeatable)")
+}
+
+func main() {
+	command := ""
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		command = os.Args[1]
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		if _, ok := commands[command]; !ok {
+			fmt.Fprintf(os.Stderr, "Unknown command %q\n", command)
+			flag.Usage()
+			os.Exit(2)
+		}
+	}
+	// Operands of the command may precede or follow the flags.
+	var args []string
+	for len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		args = append(args, os.Args[1])
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+	flag.Parse() // Parse command-line flags
+	args = append(args, flag.Args()...)
+	if command == "index" && (len(args) != 2 || (args[0] != "export" && args[0] != "import")) {
+		log.Fatalf("Error: usage: index export FILE | index import FILE")
+	}
+	if command == "du" && len(args) > 1 {
+		log.Fatalf("Error: usage: du [INDEX.gob]")
+	}
+	if command == "cache" && (len(args) != 1 || !cacheVerbs[args[0]]) {
+		log.Fatalf("Error: usage: cache stats|prune|verify|clear --cache FILE")
+	}
+	if command == "import" && len(args) != 2 {
+		log.Fatalf("Error: usage: import SRC DEST")
+	}
+	if command == "unique" && len(args) != 1 {
+		log.Fatalf("Error: usage: unique TARGET")
+	}
+	if command == "mount" && len(args) != 1 {
+		log.Fatalf("Error: usage: mount MOUNTPOINT")
+	}
+	if command == "oci" && len(args) != 1 {
+		log.Fatalf("Error: usage: oci DIR")
+	}
+	if command == "plan" && (len(args) != 3 || args[0] != "diff") {
+		log.Fatalf("Error: usage: plan diff OLD.json NEW.json")
+	}
+	if *onDuplicate != "skip" && *onDuplicate != "link" {
+		log.Fatalf("Error: Unknown --on-duplicate %q (want skip or link)", *onDuplicate)
+	}
+	if command == "index" && filepath.Ext(args[1]) != ".gob" {
+		log.Fatalf("Error: unsupported index format %q: only .gob indexes can be written and read", filepath.Ext(args[1]))
+	}
+	if command != "" && command != "import" && command != "unique" && *applyActions {
+		log.Fatalf("Error: %s only reports; it cannot be combined with --apply", command)
+	}
+	if (command == "audit") != (*manifestPath != "") {
+		log.Fatalf("Error: the audit command and --manifest must be used together")
+	}
+	if *dirIndex && (*cachePath == "" || command == "scrub" || command == "cache") {
+		log.Fatalf("Error: --dir-index keeps its index in the --cache of a scan; set --cache and leave out the scrub and cache commands")
+	}
+	if *dirIndex && (*fromManifest != "" || *snapshotKind != "" || *symlinks) {
+		log.Fatalf("Error: --dir-index cannot be combined with --from-manifest, --snapshot or --symlinks")
+	}
+	if *dirIndex && *applyActions && !*verifyBytes {
+		log.Fatalf("Error: --dir-index misses files rewritten in place; with --apply it needs --verify-bytes")
+	}
+	if (command == "scrub" || command == "cache") && *cachePath == "" {
+		log.Fatalf("Error: %s works on the digests of --cache, which is not set", command)
+	}
+	if *onlyOlderThan < 0 {
+		log.Fatalf("Error: --only-older-than must not be negative, got %d", *onlyOlderThan)
+	}
+	if *scrubPercent < 1 || *scrubPercent > 100 {
+		log.Fatalf("Error: --scrub-percent must be between 1 and 100, got %d", *scrubPercent)
+	}
+	if *chunkPercent < 1 || *chunkPercent > 100 {
+		log.Fatalf("Error: --chunk-similarity must be between 1 and 100, got %d", *chunkPercent)
+	}
+	if *chunkMinMiB < 0 {
+		log.Fatalf("Error: --chunk-min-mib must not be negative, got %d", *chunkMinMiB)
+	}
+	if *printSchema {
+		os.Stdout.Write(schema.JSON)
+		return
+	}
+	if *reportFormat != "text" && *reportFormat != "json" && *reportFormat != "paths-only" {
+		log.Fatalf("Error: Unknown --format %q (want text, json or paths-only)", *reportFormat)
+	}
+	if command == "plan" {
+		if err := runPlanDiff(args[1], args[2], *reportFormat, os.Stdout); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+	if command == "status" {
+		if *controlSocket == "" {
+			log.Fatalf("Error: status reads a running process's --control-socket, which is not set")
+		}
+		if err := runStatusCommand(*controlSocket, *reportFormat, os.Stdout); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+	if *fromManifest != "" && command != "" && command != "stats" && command != "du" {
+		log.Fatalf("Error: --from-manifest can only be used for a scan, stats or du, not the %s command", command)
+	}
+	if *fromManifest != "" && *snapshotKind != "" {
+		log.Fatalf("Error: --from-manifest reads no tree to snapshot; it cannot be combined with --snapshot")
+	}
+	if *fromManifest != "" && (*skipExec || *regularPerms) {
+		log.Fatalf("Error: a --from-manifest listing has no permissions; it cannot be combined with --skip-executables or --only-regular-perms")
+	}
+	if *rootsFrom != "" && (command == "import" || command == "oci" || command == "prune" || command == "scrub" || command == "cache") {
+		log.Fatalf("Error: the %s command works on a single root; it cannot be combined with --roots-from", command)
+	}
+	if *rootsFrom != "" && (*fromManifest != "" || *snapshotKind != "") {
+		log.Fatalf("Error: --roots-from cannot be combined with --from-manifest or --snapshot")
+	}
+	if len(onlySubtrees) > 0 && (*fromManifest != "" || command == "import" || command == "oci" || command == "scrub" || command == "prune") {
+		log.Fatalf("Error: --only restricts the walk of the root; it cannot be combined with --from-manifest or the import, oci, scrub or prune command")
+	}
+	if len(excludeDevs) > 0 && *fromManifest != "" {
+		log.Fatalf("Error: --exclude-device applies to the walk of the root; it cannot be combined with --from-manifest")
+	}
+	if *overlayUpper && (*fromManifest != "" || command == "import" || command == "oci") {
+		log.Fatalf("Error: --overlay-upper-only applies to the walk of the root; it cannot be combined with --from-manifest or the import or oci command")
+	}
+	if *maxGroupPaths < 0 {
+		log.Fatalf("Error: --max-group-paths must not be negative")
+	}
+	if *rootsNull && *rootsFrom == "" {
+		log.Fatalf("Error: --roots-null needs --roots-from")
+	}
+	if *nearText != "" && command != "" {
+		log.Fatalf("Error: --near-text reports on a plain scan; it cannot be used with the %s command", command)
+	}
+	if *compareDocs && command != "" {
+		log.Fatalf("Error: --compare-documents reports on a plain scan; it cannot be used with the %s command", command)
+	}
+	if *caseCollide && command != "" {
+		log.Fatalf("Error: --case-collisions reports on a plain scan; it cannot be used with the %s command", command)
+	}
+	if *nearDistance < 0 || *nearDistance > 15 {
+		log.Fatalf("Error: --near-distance must be between 0 and 15, got %d", *nearDistance)
+	}
+	if *symlinks && (command != "" || *fromManifest != "" || *snapshotKind != "") {
+		log.Fatalf("Error: --symlinks groups the links found by a plain scan; it cannot be used with a command, --from-manifest or --snapshot")
+	}
+	if *reportFormat == "paths-only" && command != "" {
+		log.Fatalf("Error: --format paths-only lists the duplicates of a scan; it cannot be used with the %s command", command)
+	}
+
+	rules, err := policy.Compile(keepMatching, removeMatching)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	cfg := &Config{}
+	if *configPath != "" {
+		cfg, err = loadConfig(*configPath)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		for _, spec := range cfg.Rules {
+			if err := rules.Add(spec); err != nil {
+				log.Fatalf("Error: invalid rule in %s: %v", *configPath, err)
+			}
+		}
+	}
+	rules.Default, err = policy.ParseAction(*defaultAction)
+	if err != nil {
+		log.Fatalf("Error: Invalid --action: %v", err)
+	}
+	if rules.SelectOriginal, err = policy.ParseSelect(*keepOriginal); err != nil {
+		log.Fatalf("Error: Invalid --original: %v", err)
+	}
+	var filter *policy.Filter
+	if *groupFilter != "" {
+		if filter, err = policy.ParseFilter(*groupFilter); err != nil {
+			log.Fatalf("Error: Invalid --filter: %v", err)
+		}
+	}
+
+	// --- Validate number of workers ---
+	if workers.n < 1 {
+		log.Fatalf("Error: Number of workers must be at least 1, got %d", workers.n)
+	}
+	if *maxErrors < 0 {
+		log.Fatalf("Error: --max-errors must not be negative, got %d", *maxErrors)
+	}
+	if *progressEvery < 0 {
+		log.Fatalf("Error: --progress-interval must not be negative, got %s", *progressEvery)
+	}
+	if *watchEvery < 0 {
+		log.Fatalf("Error: --watch must not be negative, got %s", *watchEvery)
+	}
+	if *watchEvery > 0 && (command != "" || *outputPath != "" || *writeManifest != "" || *exportParquet != "") {
+		log.Fatalf("Error: --watch repeats plain scans; it cannot be combined with a command, --output, --write-manifest or --export-parquet")
+	}
+	if *snapshotKind != "" && *snapshotKind != snapshot.Btrfs && *snapshotKind != snapshot.LVM {
+		log.Fatalf("Error: Unknown --snapshot %q (want btrfs or lvm)", *snapshotKind)
+	}
+	if *snapshotKind != "" && (*applyActions || *useSandbox) {
+		// The live files may have changed since the snapshot was hashed.
+		log.Fatalf("Error: --snapshot only reports; it cannot be combined with --apply or --sandbox")
+	}
+	if *hostWorkers < 0 {
+		log.Fatalf("Error: --host-workers must not be negative, got %d", *hostWorkers)
+	}
+	if *maxActions < 0 {
+		log.Fatalf("Error: --max-actions must not be negative, got %d", *maxActions)
+	}
+	if confidenceRank(*minConfidence) < 0 {
+		log.Fatalf("Error: Unknown --min-confidence %q (want size-only, partial-hash, full-hash or byte-verified)", *minConfidence)
+	}
+	if *minConfidence == confByteVerified && !*verifyBytes {
+		log.Fatalf("Error: --min-confidence byte-verified requires --verify-bytes")
+	}
+	if *heartbeatEvery <= 0 {
+		log.Fatalf("Error: --heartbeat-every must be positive, got %s", *heartbeatEvery)
+	}
+	if *warnHeapMiB < 0 || *maxHeapMiB < 0 || *warnGoroutines < 0 {
+		log.Fatalf("Error: --warn-heap-mib, --max-heap-mib and --warn-goroutines must not be negative")
+	}
+	if *warnHeapMiB > 0 && *maxHeapMiB > 0 && *warnHeapMiB >= *maxHeapMiB {
+		log.Fatalf("Error: --warn-heap-mib (%d) must be below --max-heap-mib (%d)", *warnHeapMiB, *maxHeapMiB)
+	}
+	if *maxReadMiB < 0 {
+		log.Fatalf("Error: --max-read-mib must not be negative, got %d", *maxReadMiB)
+	}
+	if *retries < 0 {
+		log.Fatalf("Error: --retries must not be negative, got %d", *retries)
+	}
+	if workers.auto {
+		log.Printf("Using between 1 and %d hashing workers, adjusted to the measured throughput.", workers.n)
+	} else {
+		log.Printf("Using %d hashing workers.", workers.n)
+	}
+
+	// --- Select the hashing function based on the flag ---
+	algo := strings.ToLower(*hashAlgorithm)
+	switch algo {
+	case "blake3":
+		log.Println("Using BLAKE3 hashing algorithm.")
+	case "md5":
+		log.Println("Using MD5 hashing algorithm.")
+	case "sha256":
+		log.Println("Using SHA256 hashing algorithm.")
+	default:
+		log.Fatalf("Error: Invalid hashing algorithm '%s'. Please use 'blake3', 'sha256', or 'md5'.", *hashAlgorithm)
+	}
+	// Cancelled with the run's context below, so a file being hashed when the run is
+	// interrupted or times out is abandoned mid-read instead of read to the end.
+	hashCtx, stopHashing := context.WithCancel(context.Background())
+	defer stopHashing()
+	large := newLargeFiles()
+	var limiter *throttle.Limiter
+	if *maxReadMiB > 0 {
+		limiter = throttle.New(int64(*maxReadMiB) << 20)
+		log.Printf("Reading at most %d MiB/s of file content.", *maxReadMiB)
+	}
+	var selectedHashFunc fswalk.HashFunc = func(path string) (iphash.HashBytes, error) {
+		h, err := iphash.New(algo)
+		if err != nil {
+			return nil, err
+		}
+		if limiter != nil {
+			h = limiter.Hash(hashCtx, h)
+		}
+		return iphash.GetFileHashObserved(hashCtx, path, h, large, largeFileSize)
+	}
+	var budget *coord.Budget
+	if *hostWorkers > 0 {
+		// Opened before entering the sandbox, like the report file.
+		if budget, err = coord.Open(*coordDir, *hostWorkers); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer budget.Close()
+		log.Printf("Sharing %d hashing workers with other runs through %s.", *hostWorkers, *coordDir)
+		unlimited := selectedHashFunc
+		selectedHashFunc = func(path string) (iphash.HashBytes, error) {
+			release, err := budget.Acquire()
+			if err != nil {
+				return nil, err
+			}
+			defer release()
+			return unlimited(path)
+		}
+	}
+	var tuner *autotune.Tuner
+	if workers.auto {
+		// Starts low: too many readers hurt a single disk far more than too few.
+		tuner = autotune.New(2, workers.n)
+		selectedHashFunc = tuner.Wrap(selectedHashFunc)
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		log.Fatalf("Failed to get working directory: %v", err)
+	}
+	importSrc := ""
+	if command == "import" {
+		// The destination is scanned as the root; the source is hashed separately.
+		if importSrc, err = filepath.Abs(args[0]); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if workingDir, err = filepath.Abs(args[1]); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if *applyActions {
+			if err := os.MkdirAll(workingDir, 0o755); err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+		}
+	}
+	if command == "oci" {
+		if workingDir, err = filepath.Abs(args[0]); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	var roots []string
+	if *rootsFrom != "" {
+		if roots, err = readRoots(*rootsFrom, *rootsNull); err != nil {
+			log.Fatalf("Error: --roots-from: %v", err)
+		}
+		workingDir = commonDir(roots)
+		log.Printf("Scanning %d roots below %s.", len(roots), workingDir)
+	}
+
+	// --- Network filesystem safe mode ---
+	scanned := roots
+	if len(scanned) == 0 {
+		scanned = []string{workingDir}
+	}
+	rootFS := rootFilesystems(scanned)
+	networkFS := false
+	var fsNames []string
+	seenFS := make(map[string]bool)
+	for _, root := range scanned {
+		info, ok := rootFS[root]
+		if !ok {
+			continue
+		}
+		if info.Network && *networkSafe {
+			log.Printf("Scan root %s is on a network filesystem (%s): inode shortcuts disabled.", root, info.Name)
+			networkFS = true
+		}
+		if !seenFS[info.Name] {
+			seenFS[info.Name] = true
+			fsNames = append(fsNames, info.Name)
+		}
+	}
+	if networkFS {
+		if !flagWasSet("workers") && workers.n > networkWorkers {
+			workers.n = networkWorkers
+			log.Printf("Reducing to %d hashing workers; use --workers to override.", workers.n)
+		}
+	}
+
+	// --- Create Application Instance ---
+	app := NewDeduplicator(workingDir, selectedHashFunc, rules)
+	app.large = large
+	app.apply = *applyActions
+	app.filter = filter
+	if *excludeInodes != "" {
+		f, err := os.Open(*excludeInodes)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		app.excluded, err = fswalk.ReadInodeSet(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Error: %s: %v", *excludeInodes, err)
+		}
+		app.executor.Protected = app.excluded
+		log.Printf("Excluding %d inodes listed in %s.", len(app.excluded), *excludeInodes)
+	}
+	app.maxActions = *maxActions
+	app.minAge = time.Duration(*onlyOlderThan) * 24 * time.Hour
+	app.allowSpecial = *allowSpecial
+	if *symlinks {
+		app.symlinks = &symlinkSet{}
+	}
+	if *nearText != "" {
+		app.nearExts = make(map[string]bool)
+		for _, ext := range strings.Split(*nearText, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if !strings.HasPrefix(ext, ".") {
+				log.Fatalf("Error: --near-text extension %q must start with a dot", ext)
+			}
+			app.nearExts[ext] = true
+		}
+	}
+	app.nearDistance = *nearDistance
+	app.compareDocs = *compareDocs
+	app.caseCollide = *caseCollide
+	app.executor.AllowSpecialModes = *allowSpecial
+	app.minConfidence = *minConfidence
+	app.verifyBytes = *verifyBytes
+	app.limiter = limiter
+	app.snapshotKind = *snapshotKind
+	app.snapshotSize = *snapshotSize
+	app.fsName = strings.Join(fsNames, ", ")
+	app.rootFS = rootFS
+	app.format = *reportFormat
+	app.pathSep = '\n'
+	if *nullSep {
+		app.pathSep = 0
+	}
+	app.topDirsN = *topDirsCount
+	app.maxGroupPaths = *maxGroupPaths
+	app.statsMode = command == "stats"
+	app.duMode = command == "du"
+	app.pruneMode = command == "prune"
+	app.chunksMode = command == "chunks"
+	app.chunkMinSize = int64(*chunkMinMiB) << 20
+	app.chunkThreshold = float64(*chunkPercent) / 100
+	app.duDepth = *duDepth
+	app.simulateRun = *simulate
+	app.tags = runTags
+	app.importSrc = importSrc
+	app.importLink = *onDuplicate == "link"
+	if command == "unique" {
+		if app.target, err = filepath.Abs(args[0]); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		app.linkFarm = *linkFarm
+		app.cas = *casLayout
+	}
+	if command == "mount" {
+		app.mountpoint = args[0]
+		app.mountAll = *mountAll
+	}
+	app.ociLayout = command == "oci"
+	app.algo = algo
+	if *manifestPath != "" {
+		f, err := os.Open(*manifestPath)
+		if err != nil {
+			log.Fatalf("Error: Failed to open manifest: %v", err)
+		}
+		app.known, err = manifest.Read(f, app.algo, workingDir)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Error: %s: %v", *manifestPath, err)
+		}
+		log.Printf("Auditing against %d files listed in %s.", len(app.known), *manifestPath)
+	}
+	app.metricsPath = *metricsFile
+	app.heartbeatPath = *heartbeatFile
+	app.controlPath = *controlSocket
+	if *cachePath != "" {
+		if app.cache, err = hashcache.Load(*cachePath, app.algo); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		app.cachePath = *cachePath
+	}
+	if command == "cache" {
+		if err := runCacheCommand(args[0], app.cache, *cachePath, selectedHashFunc, *verifySample, app.format, os.Stdout); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		return
+	}
+	if len(importHashes) > 0 && app.cache == nil {
+		app.cache = hashcache.New(app.algo) // Only for this run
+	}
+	for _, path := range importHashes {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		sums, err := manifest.ReadChecksums(path, app.algo)
+		if err != nil {
+			log.Fatalf("Error: --import-hashes: %v", err)
+		}
+		n := app.cache.Import(sums, info.ModTime())
+		log.Printf("Imported %d of %d digests from %s.", n, len(sums), path)
+	}
+	if app.cache != nil {
+		app.hashFunc = app.cache.HashFunc(app.hashFunc)
+	}
+	if len(cfg.Extensions) > 0 {
+		if app.strategies, err = newHashStrategies(cfg.Extensions, app.algo); err != nil {
+			log.Fatalf("Error: %s: %v", *configPath, err)
+		}
+		app.walkOpts.Skip = app.strategies.skip
+		if app.strategies.usesQuick() {
+			// Quick digests are only meaningful within this run's comparison.
+			switch {
+			case command == "import" || command == "index":
+				log.Fatalf("Error: %s cannot use the quick strategy of %s", command, *configPath)
+			case *writeManifest != "" || *exportParquet != "" || *casLayout:
+				log.Fatalf("Error: --write-manifest, --export-parquet and --cas record digests and cannot use the quick strategy of %s", *configPath)
+			}
+			// Outside the cache, which must only hold full digests.
+			app.hashFunc = app.strategies.wrap(app.hashFunc)
+		}
+	}
+	if len(onlySubtrees) > 0 {
+		scope, err := newScopeFilter(workingDir, onlySubtrees)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		app.walkOpts.Skip = chainSkip(app.walkOpts.Skip, scope.skip)
+		app.walkOpts.SkipDir = scope.skipDir
+	}
+	if len(excludeDevs) > 0 {
+		excluded := fswalk.DeviceSet{}
+		for _, spec := range excludeDevs {
+			devs, err := fswalk.ResolveDevice(spec)
+			if err != nil {
+				log.Fatalf("Error: --exclude-device: %v", err)
+			}
+			for dev := range devs {
+				excluded[dev] = true
+			}
+		}
+		walked := roots
+		if len(walked) == 0 {
+			walked = []string{workingDir}
+		}
+		for _, root := range walked {
+			if excluded.Holds(root) {
+				log.Fatalf("Error: the scan root %s lies on a device excluded by --exclude-device", root)
+			}
+		}
+		app.walkOpts.SkipDir = chainSkipDir(app.walkOpts.SkipDir, excluded.Holds)
+	}
+	if *fromManifest == "" && command != "import" && command != "oci" {
+		walked := roots
+		if len(walked) == 0 {
+			walked = []string{workingDir}
+		}
+		app.overlays = overlaysIn(fswalk.Overlays(), walked)
+		if *overlayUpper {
+			skip := overlayLayerSkipper(app.overlays)
+			for _, root := range walked {
+				for dir := root; ; dir = filepath.Dir(dir) {
+					if skip(dir) {
+						log.Fatalf("Error: the scan root %s lies in %s, which --overlay-upper-only skips", root, dir)
+					}
+					if dir == filepath.Dir(dir) {
+						break
+					}
+				}
+			}
+			app.walkOpts.SkipDir = chainSkipDir(app.walkOpts.SkipDir, skip)
+			app.overlays = nil // No view is scanned next to its layers
+		}
+	}
+	if filter := (modeFilter{skipExecutables: *skipExec, regularOnly: *regularPerms}); filter.active() {
+		app.walkOpts.Skip = chainSkip(app.walkOpts.Skip, filter.skip)
+	}
+	if *dirIndex {
+		if app.walkOpts.Skip != nil || app.walkOpts.SkipDir != nil {
+			log.Fatalf("Error: --dir-index records whole directories; it cannot be combined with --only, --exclude-device, --overlay-upper-only, permission filters or strategies skipping extensions")
+		}
+		app.dirIndex = true
+	}
+	app.scrubMode = command == "scrub"
+	app.scrubPercent = *scrubPercent
+	app.scrubAge = *scrubAge
+	if app.scrubMode {
+		app.hashFunc = selectedHashFunc // Scrubbing must read every selected file
+	}
+	if command == "du" && len(args) == 1 {
+		f, err := os.Open(args[0])
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		app.duIndex, err = scanindex.Read(f, app.algo)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Error: %s: %v", args[0], err)
+		}
+	}
+	if *fromManifest != "" {
+		if app.listing, err = manifest.ReadListing(*fromManifest, app.algo); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		log.Printf("Grouping the %d files listed in %s instead of scanning.", len(app.listing), *fromManifest)
+	}
+	var indexFile *os.File
+	if command == "index" && args[0] == "import" {
+		f, err := os.Open(args[1])
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		app.baseline, err = scanindex.Read(f, app.algo)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Error: %s: %v", args[1], err)
+		}
+		log.Printf("Comparing with the scan of %s:%s (%d files).", app.baseline.Host, app.baseline.Root, len(app.baseline.Files))
+	} else if command == "index" {
+		// Opened before entering the sandbox, like the report file.
+		if indexFile, err = os.Create(args[1]); err != nil {
+			log.Fatalf("Error: Failed to create scan index: %v", err)
+		}
+		app.indexOut = indexFile
+	}
+	var manifestFile *os.File
+	if *writeManifest != "" {
+		// Opened before entering the sandbox, like the report file.
+		if manifestFile, err = os.Create(*writeManifest); err != nil {
+			log.Fatalf("Error: Failed to create manifest: %v", err)
+		}
+		app.manifestOut = manifestFile
+	}
+	var parquetFile *os.File
+	if *exportParquet != "" {
+		// Opened before entering the sandbox, like the report file.
+		if parquetFile, err = os.Create(*exportParquet); err != nil {
+			log.Fatalf("Error: Failed to create Parquet index: %v", err)
+		}
+		app.parquetOut = parquetFile
+	}
+	app.progressEvery = *progressEvery
+	app.precount = !*noPrecount
+	reportFile := os.Stdout
+	var signer *signing.Signer
+	var sigFile *os.File
+	reportHash := signing.NewHash()
+	if *signKey != "" {
+		if *outputPath == "" {
+			log.Fatalf("Error: --sign-key needs --output: only report files can be signed")
+		}
+		if signer, err = signing.LoadSigner(*signKey, []byte(os.Getenv("DEDUPE_SIGN_PASSPHRASE"))); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	if *outputPath != "" {
+		// Opened before entering the sandbox, which may not allow writing there.
+		if reportFile, err = os.Create(*outputPath); err != nil {
+			log.Fatalf("Error: Failed to create report file: %v", err)
+		}
+		app.out = reportFile
+		if signer != nil {
+			if sigFile, err = os.Create(*outputPath + ".sig"); err != nil {
+				log.Fatalf("Error: Failed to create signature file: %v", err)
+			}
+			// The report is digested as it is written, so it never has to be read back.
+			app.out = io.MultiWriter(reportFile, reportHash)
+		}
+	} else if app.format != "text" {
+		app.msg = os.Stderr
+	}
+	if f, ok := app.msg.(*os.File); ok {
+		app.progressTTY = isTerminal(f)
+	}
+	if app.color, err = useColor(*colorMode, reportFile); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	app.executor.DryRun = !*applyActions // Refused by the executor, whatever path reaches it
+	app.executor.PreferReflink = *preferReflink
+	app.executor.RequireSameXattrs = *sameXattrs
+	app.executor.Sidecars = *sidecars
+	app.walkOpts.FollowReparsePoints = *followReparse
+	app.walkOpts.IncludePseudoFS = *scanPseudoFS
+	app.walkOpts.Retries = *retries
+	app.walkOpts.RetryDelay = *retryDelay
+	app.walkOpts.MaxErrors = *maxErrors
+	if *failFast {
+		app.walkOpts.MaxErrors = 1
+	}
+	app.walkOpts.SkipPermErrors = *skipPermErrors
+	app.walkOpts.Roots = roots
+	app.networkFS = networkFS
+	for _, root := range app.scanRoots() {
+		if fswalk.IsCaseInsensitive(root) {
+			log.Printf("Scan root %s is on a case-insensitive filesystem.", root)
+			app.caseInsensitive = true
+		}
+	}
+	app.executor.Guard, err = actions.NewGuard(app.scanRoots()...)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	app.executor.Guard.CaseInsensitive = app.caseInsensitive
+	app.confirm = *applyActions && !*assumeYes && isTerminal(os.Stdin)
+	if *execPerGroup != "" {
+		app.groupCmd, err = hooks.ParseGroupCommand(*execPerGroup)
+		if err != nil {
+			log.Fatalf("Error: Invalid --exec-per-group: %v", err)
+		}
+		app.groupCmd.Stdout = app.msg
+	}
+	if *auditLogPath != "" {
+		app.executor.Audit, err = actions.OpenAuditLog(*auditLogPath)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		defer app.executor.Audit.Close()
+		app.executor.Audit.Tags = runTags
+	}
+	if *backupDir != "" && *applyActions {
+		if *backupDays > 0 {
+			n, err := actions.ExpireBackups(*backupDir, time.Duration(*backupDays)*24*time.Hour, time.Now())
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Expired %d backup runs older than %d days.", n, *backupDays)
+			}
+		}
+		app.executor.Backup = actions.NewBackup(*backupDir, time.Now())
+		log.Printf("Backing up affected files to %s", app.executor.Backup.Dir)
+	}
+	app.runHooks = cfg.Hooks
+	if *hookExec != "" {
+		app.runHooks = append(app.runHooks, hooks.RunHook{Command: *hookExec})
+	}
+	if *hookURL != "" {
+		app.runHooks = append(app.runHooks, hooks.RunHook{URL: *hookURL})
+	}
+	for _, h := range app.runHooks {
+		if err := h.Validate(); err != nil {
+			log.Fatalf("Error: Invalid run hook: %v", err)
+		}
+	}
+	if *mailTo != "" {
+		if app.mail, err = newMail(*mailTo, *mailFrom, *smtpServer, *smtpUser, *mailOn); err != nil {
+			log.Fatalf("Error: --mail-to: %v", err)
+		}
+		if app.mailTemplate, err = parseMailTemplate(*mailTemplate); err != nil {
+			log.Fatalf("Error: --mail-template: %v", err)
+		}
+	}
+
+	// Connected before entering the sandbox, which may forbid it.
+	if app.notify, err = sdnotify.New(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if *useSandbox {
+		if err := app.enterSandbox(); err != nil {
+			log.Fatalf("Error: Failed to enter sandbox: %v", err)
+		}
+		log.Println("Sandbox enabled.")
+	}
+
+	// --- Setup Context for Cancellation (e.g., on Ctrl+C) ---
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop() // Important: call stop to release resources when main exits
+	if *timeout > 0 {
+		// Expiry takes the same path as Ctrl+C: walkers stop and no further action starts.
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	if *warnHeapMiB > 0 || *maxHeapMiB > 0 || *warnGoroutines > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = app.watchMemory(ctx, memwatch.Limits{
+			WarnHeap:       uint64(*warnHeapMiB) << 20,
+			StopHeap:       uint64(*maxHeapMiB) << 20,
+			WarnGoroutines: *warnGoroutines,
+		})
+		defer cancel()
+	}
+	go app.notify.Watchdog(ctx)
+	if app.controlPath != "" {
+		go func() {
+			if err := app.serveControl(ctx, app.controlPath); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}()
+	}
+	stopHeartbeat := func() {}
+	if app.heartbeatPath != "" {
+		stopHeartbeat = app.startHeartbeat(ctx, *heartbeatEvery)
+	}
+	go func() {
+		<-ctx.Done()
+		stopHashing()
+	}()
+	if tuner != nil {
+		go tuner.Run(ctx, tuneInterval)
+	}
+	if budget != nil {
+		go func() {
+			<-ctx.Done()
+			budget.Stop() // Workers waiting for a slot give up
+		}()
+	}
+
+	// --- Run the Application ---
+	if *watchEvery > 0 {
+		err = app.watch(ctx, workers.n, *watchEvery)
+	} else {
+		err = app.Run(ctx, workers.n)
+	}
+	if tuner != nil {
+		log.Printf("Hashing workers settled at %d (--workers auto).", tuner.Limit())
+	}
+	if reportFile != os.Stdout {
+		if cerr := reportFile.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to write report file: %w", cerr)
+		}
+	}
+	if app.cachePath != "" {
+		// Also after a failed or interrupted run: every entry is valid on its own.
+		if cerr := app.cache.Save(*cachePath); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	if indexFile != nil {
+		if cerr := indexFile.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to write scan index: %w", cerr)
+		}
+	}
+	if manifestFile != nil {
+		if cerr := manifestFile.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to write manifest: %w", cerr)
+		}
+	}
+	if parquetFile != nil {
+		if cerr := parquetFile.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to write Parquet index: %w", cerr)
+		}
+	}
+	if sigFile != nil {
+		if serr := writeSignature(signer, reportHash.Sum(nil), sigFile); serr != nil && err == nil {
+			err = serr
+		} else if serr == nil {
+			log.Printf("Report signed with %s: %s.sig", signer.PublicKey(), *outputPath)
+		}
+	}
+	summary := app.summary(err)
+	if line, jerr := json.Marshal(summary); jerr == nil {
+		// One greppable line for log collectors, whatever the report format.
+		log.Printf("SUMMARY %s", line)
+	}
+	app.notifyHooks(summary)
+	app.sendMail(summary)
+	if app.metricsPath != "" {
+		if merr := writeMetrics(app.metricsPath, summary); merr != nil {
+			log.Printf("Failed to write metrics: %v", merr)
+		}
+	}
+	if err != nil {
+		app.setPhase(phaseFailed, "Failed: %v", err)
+	} else {
+		app.setPhase(phaseFinished, "Finished: %d duplicate groups, %s reclaimable, %d actions applied",
+			summary.DuplicateGroups, formatSize(summary.ReclaimApparent), summary.ActionsApplied)
+	}
+	stopHeartbeat()
+	app.notify.Stopping()
+
+	if err != nil {
+		if app.memStopped.Load() {
+			log.Printf("Application stopped: --max-heap-mib of %d MiB reached.", *maxHeapMiB)
+			os.Exit(1)
+		}
+		if errors.Is(err, context.Canceled) {
+			os.Exit(130) // Standard exit code for Ctrl+C
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Printf("Application stopped: --timeout of %s reached.", *timeout)
+			os.Exit(124) // Exit code of timeout(1)
+		}
+		log.Printf("Application failed: %v", err)
+		os.Exit(1)
+	}
+
+	log.Println("Application finished successfully.")
+}
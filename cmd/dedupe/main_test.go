@@ -0,0 +1,1692 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/actions"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hashcache"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/scanindex"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/schema"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/throttle"
+)
+
+// TestConfirmActions checks that only an explicit "yes" confirms.
+func TestConfirmActions(t *testing.T) {
+	cases := map[string]bool{"yes\n": true, "yes": true, "y\n": false, "\n": false, "": false}
+	for in, want := range cases {
+		if got := confirmActions(strings.NewReader(in), io.Discard, 3, 4096); got != want {
+			t.Errorf("confirmActions(%q) = %v, want %v", in, got, want)
+		}
+	}
+}
+
+// TestFormatBytes checks binary unit rendering.
+func TestFormatBytes(t *testing.T) {
+	cases := map[int64]string{0: "0 B", 1023: "1023 B", 1536: "1.5 KiB", 5 << 30: "5.0 GiB"}
+	for in, want := range cases {
+		if got := formatBytes(in); got != want {
+			t.Errorf("formatBytes(%d) = %s, want %s", in, got, want)
+		}
+	}
+}
+
+// TestFindDuplicatesOrder checks that groups are ordered by reclaimable bytes, then hash,
+// and that the first path in lexical order becomes the group's first member.
+func TestFindDuplicatesOrder(t *testing.T) {
+	d := NewDeduplicator("/r", nil, nil)
+	add := func(path string, sum byte, size int64) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: size}
+	}
+	add("/r/small/b", 1, 10)
+	add("/r/small/a", 1, 10)
+	add("/r/big/z", 2, 100)
+	add("/r/big/y", 2, 100)
+	add("/r/tie/a", 3, 10)
+	add("/r/tie/b", 3, 10)
+	add("/r/unique", 4, 1000)
+
+	for i := 0; i < 5; i++ {
+		d.fileByteMap = map[string]string{}
+		d.fileByteMapDups = map[string][]string{}
+		d.findDuplicates()
+		if got, want := strings.Join(d.groupOrder, ","), "02,01,03"; got != want {
+			t.Fatalf("Group order mismatch. Got: %v, Want: %v", got, want)
+		}
+		if got := d.fileByteMapDups["01"]; got[0] != "/r/small/a" || got[1] != "/r/small/b" {
+			t.Errorf("Member order mismatch. Got: %v", got)
+		}
+	}
+}
+
+// TestBuildReport checks that the JSON report carries the schema version and the planned groups.
+func TestBuildReport(t *testing.T) {
+	rules, err := policy.Compile(nil, nil)
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	d := NewDeduplicator("/r", nil, rules)
+	for _, path := range []string{"/r/b", "/r/a"} {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{7}, Size: 3}
+	}
+	d.findDuplicates()
+	d.planActions()
+
+	var buf bytes.Buffer
+	if err := d.writeJSONReport(&buf, nil); err != nil {
+		t.Fatalf("writeJSONReport returned an unexpected error: %v", err)
+	}
+	var r Report
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatalf("Report is not valid JSON: %v", err)
+	}
+	if r.SchemaVersion != schema.Version || r.Summary.SchemaVersion != schema.Version {
+		t.Errorf("Schema version mismatch. Got: %d/%d, Want: %d", r.SchemaVersion, r.Summary.SchemaVersion, schema.Version)
+	}
+	if len(r.Groups) != 1 || r.Groups[0].Original != "/r/a" || len(r.Groups[0].Files) != 2 || r.Groups[0].Files[1].Action != "remove" {
+		t.Errorf("Unexpected report groups: %+v", r.Groups)
+	}
+}
+
+// TestUseColor checks the --color modes and the NO_COLOR convention.
+func TestUseColor(t *testing.T) {
+	t.Setenv("NO_COLOR", "1")
+	for mode, want := range map[string]bool{"always": true, "never": false, "auto": false} {
+		if got, err := useColor(mode, os.Stdout); err != nil || got != want {
+			t.Errorf("useColor(%q) = %v, %v, want %v", mode, got, err, want)
+		}
+	}
+	if _, err := useColor("sometimes", os.Stdout); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+// TestTopDirs checks direct and recursive duplicate bytes per directory.
+func TestTopDirs(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator("/r", nil, rules)
+	add := func(path string, sum byte, size int64) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: size}
+	}
+	add("/r/a/keep", 1, 100)
+	add("/r/old/x/dup", 1, 100)
+	add("/r/old/dup", 2, 10)
+	add("/r/b", 2, 10)
+	d.findDuplicates()
+	d.planActions()
+
+	got := d.topDirs(2)
+	if len(got) != 2 {
+		t.Fatalf("Directory count mismatch. Got: %d, Want: 2", len(got))
+	}
+	if got[0].Path != "/r/old" || got[0].Recursive != 110 || got[0].Direct != 10 || got[0].Files != 2 {
+		t.Errorf("Unexpected first directory: %+v", got[0])
+	}
+	if got[1].Path != "/r/old/x" || got[1].Recursive != 100 {
+		t.Errorf("Unexpected second directory: %+v", got[1])
+	}
+}
+
+// TestRootStats checks that the files and duplicate groups of a scan of several roots
+// are attributed to their roots, telling groups within one root from shared ones.
+func TestRootStats(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator("/r", nil, rules)
+	d.walkOpts.Roots = []string{"/r/a", "/r/b"}
+	add := func(path string, sum byte, size int64) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: size}
+	}
+	add("/r/a/1", 1, 100)
+	add("/r/a/x/1", 1, 100)
+	add("/r/a/2", 2, 10)
+	add("/r/b/2", 2, 10)
+	add("/r/b/3", 3, 5)
+	d.findDuplicates()
+	d.planActions()
+
+	stats, cross := d.rootStats()
+	if len(stats) != 2 || cross != 1 {
+		t.Fatalf("Root stats mismatch. Got: %+v and %d shared groups, Want: 2 roots and 1 shared group", stats, cross)
+	}
+	a, b := stats[0], stats[1]
+	if a.Root != "/r/a" || a.Files != 3 || a.Bytes != 210 || a.ContainedGroups != 1 || a.CrossRootGroups != 1 {
+		t.Errorf("Unexpected first root: %+v", a)
+	}
+	if b.Root != "/r/b" || b.Files != 2 || b.Bytes != 15 || b.ContainedGroups != 0 || b.CrossRootGroups != 1 {
+		t.Errorf("Unexpected second root: %+v", b)
+	}
+	if a.DuplicateFiles+b.DuplicateFiles != 2 {
+		t.Errorf("Duplicate copies mismatch. Got: %d, Want: 2", a.DuplicateFiles+b.DuplicateFiles)
+	}
+}
+
+// TestDiffPlans checks that actions are told apart as appeared, disappeared, changed in
+// action or original, and unchanged.
+func TestDiffPlans(t *testing.T) {
+	old := map[string]PlannedAction{
+		"/r/same":  {Path: "/r/same", Action: "remove", Original: "/r/o"},
+		"/r/gone":  {Path: "/r/gone", Action: "remove", Original: "/r/o"},
+		"/r/relnk": {Path: "/r/relnk", Action: "remove", Original: "/r/o"},
+		"/r/moved": {Path: "/r/moved", Action: "link", Original: "/r/o"},
+	}
+	cur := map[string]PlannedAction{
+		"/r/same":  {Path: "/r/same", Action: "remove", Original: "/r/o"},
+		"/r/new":   {Path: "/r/new", Action: "remove", Original: "/r/o"},
+		"/r/relnk": {Path: "/r/relnk", Action: "link", Original: "/r/o"},
+		"/r/moved": {Path: "/r/moved", Action: "link", Original: "/r/o2"},
+	}
+	diff := diffPlans(old, cur)
+
+	if len(diff.Appeared) != 1 || diff.Appeared[0].Path != "/r/new" {
+		t.Errorf("Appeared mismatch. Got: %+v, Want: /r/new", diff.Appeared)
+	}
+	if len(diff.Disappeared) != 1 || diff.Disappeared[0].Path != "/r/gone" {
+		t.Errorf("Disappeared mismatch. Got: %+v, Want: /r/gone", diff.Disappeared)
+	}
+	if len(diff.Changed) != 2 || diff.Changed[0].New.Path != "/r/moved" || diff.Changed[1].Old.Action != "remove" {
+		t.Errorf("Changed mismatch. Got: %+v, Want: /r/moved and /r/relnk", diff.Changed)
+	}
+	if diff.Unchanged != 1 {
+		t.Errorf("Unchanged mismatch. Got: %d, Want: 1", diff.Unchanged)
+	}
+}
+
+// TestScanStats checks that files and duplicates land in the right buckets.
+func TestScanStats(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator("/r", nil, rules)
+	now := time.Now()
+	d.fileMap["/r/a.JPG"] = fswalk.FileRecord{Path: "/r/a.JPG", Sum: iphash.HashBytes{1}, Size: 5000, ModTime: now}
+	d.fileMap["/r/b.jpg"] = fswalk.FileRecord{Path: "/r/b.jpg", Sum: iphash.HashBytes{1}, Size: 5000, ModTime: now.Add(-48 * time.Hour)}
+	d.fileMap["/r/c"] = fswalk.FileRecord{Path: "/r/c", Sum: iphash.HashBytes{2}, ModTime: now}
+	d.findDuplicates()
+	d.planActions()
+
+	st := d.scanStats(now)
+	if r := st.Sizes[0]; r.Files != 1 || r.DupFiles != 0 {
+		t.Errorf("Unexpected empty bucket: %+v", r)
+	}
+	if r := st.Sizes[2]; r.Files != 2 || r.DupFiles != 1 || r.DupBytes != 5000 {
+		t.Errorf("Unexpected < 64 KiB bucket: %+v", r)
+	}
+	if r := st.Extensions[0]; r.Label != ".jpg" || r.Files != 2 {
+		t.Errorf("Unexpected extension row: %+v", r)
+	}
+	if r := st.DupAges[1]; r.DupFiles != 1 {
+		t.Errorf("Unexpected < 1 week bucket: %+v", r)
+	}
+}
+
+// TestWhatIf checks that existing links and other devices are accounted for.
+func TestWhatIf(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator("/r", nil, rules)
+	d.fsName = "ext4"
+	add := func(path string, dev, ino, nlink uint64) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{1}, Size: 100, Alloc: 100, Dev: dev, Ino: ino, Nlink: nlink}
+	}
+	add("/r/a", 1, 10, 2)
+	add("/r/b", 1, 10, 2) // Already a link to the original
+	add("/r/c", 1, 11, 1)
+	add("/r/d", 2, 12, 1) // Another device
+	d.findDuplicates()
+	d.planActions()
+
+	got := d.whatIf()
+	if s := got[0]; s.Strategy != "remove" || s.Files != 3 || s.Bytes != 200 {
+		t.Errorf("Unexpected remove savings: %+v", s)
+	}
+	if s := got[1]; s.Files != 2 || s.Bytes != 100 || s.CrossDevice != 1 {
+		t.Errorf("Unexpected link savings: %+v", s)
+	}
+	if s := got[2]; s.Supported || s.Bytes != 0 {
+		t.Errorf("Unexpected reflink savings on ext4: %+v", s)
+	}
+}
+
+// TestSimulate checks freed space and resulting link counts of planned links.
+func TestSimulate(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	rules.Default = policy.ActionLink
+	d := NewDeduplicator("/r", nil, rules)
+	add := func(path string, dev, ino uint64) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{1}, Size: 100, Alloc: 100, Dev: dev, Ino: ino, Nlink: 1}
+	}
+	add("/r/a", 1, 10)
+	add("/r/b", 1, 11)
+	add("/r/c", 2, 12)
+	d.findDuplicates()
+	d.planActions()
+
+	sim := d.simulate()
+	if sim.Failures != 1 {
+		t.Errorf("Expected failure count mismatch. Got: %d, Want: 1", sim.Failures)
+	}
+	if len(sim.Devices) != 2 || sim.Devices[0].Freed != 100 || sim.Devices[0].FilesAfter != 2 {
+		t.Errorf("Unexpected device states: %+v", sim.Devices)
+	}
+	if len(sim.Links) != 1 || sim.Links[0].Path != "/r/a" || sim.Links[0].After != 2 {
+		t.Errorf("Unexpected link states: %+v", sim.Links)
+	}
+}
+
+// TestTagMap checks parsing of repeatable --tag flags.
+func TestTagMap(t *testing.T) {
+	m := tagMap{}
+	for _, v := range []string{"host=a", "dataset=x=y", "host=b"} {
+		if err := m.Set(v); err != nil {
+			t.Fatalf("Set(%q) returned an unexpected error: %v", v, err)
+		}
+	}
+	if got, want := m.String(), "dataset=x=y,host=b"; got != want {
+		t.Errorf("Tags mismatch. Got: %v, Want: %v", got, want)
+	}
+	for _, v := range []string{"novalue", "=x"} {
+		if err := m.Set(v); err == nil {
+			t.Errorf("Set(%q) succeeded, want an error", v)
+		}
+	}
+}
+
+// TestScrubSelection checks that scrubbing picks the least recently verified files
+// below the root, within the age and percentage limits.
+func TestScrubSelection(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	d := NewDeduplicator("/r", nil, nil)
+	d.cache = hashcache.New("sha256")
+	for i, p := range []string{"/r/a", "/r/b", "/r/c", "/r/d", "/other/e"} {
+		d.cache.Put(p, hashcache.Entry{Verified: now.Add(-time.Duration(i) * 24 * time.Hour)})
+	}
+
+	d.scrubPercent = 50
+	got := d.scrubSelection(now)
+	if want := []string{"/r/d", "/r/c"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Selection mismatch. Got: %v, Want: %v", got, want)
+	}
+
+	d.scrubPercent, d.scrubAge = 100, 36*time.Hour
+	got = d.scrubSelection(now)
+	if want := []string{"/r/d", "/r/c"}; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Selection by age mismatch. Got: %v, Want: %v", got, want)
+	}
+}
+
+// TestCompareBaseline checks that local files are matched against an imported index by content.
+func TestCompareBaseline(t *testing.T) {
+	d := NewDeduplicator("/local", nil, nil)
+	d.fileMap["/local/copy"] = fswalk.FileRecord{Path: "/local/copy", Sum: iphash.HashBytes{1}, Size: 10}
+	d.fileMap["/local/new"] = fswalk.FileRecord{Path: "/local/new", Sum: iphash.HashBytes{2}, Size: 20}
+	d.baseline = scanindex.New("md5", "/remote", map[string]fswalk.FileRecord{
+		"/remote/a": {Sum: iphash.HashBytes{1}, Size: 10},
+		"/remote/b": {Sum: iphash.HashBytes{3}, Size: 30},
+	}, time.Now())
+
+	res := d.compareBaseline()
+	if len(res.Present) != 1 || res.Present[0].Path != "/local/copy" || res.Present[0].BaselinePaths[0] != "/remote/a" {
+		t.Errorf("Present files mismatch. Got: %+v", res.Present)
+	}
+	if res.PresentBytes != 10 || len(res.Absent) != 1 || res.Absent[0] != "/local/new" || res.Files != 2 {
+		t.Errorf("Baseline totals mismatch. Got: %+v", res)
+	}
+}
+
+// TestPlanImport checks that source files are skipped when the destination or an
+// earlier source file holds their content, and never overwrite other content.
+func TestPlanImport(t *testing.T) {
+	dest := t.TempDir()
+	d := NewDeduplicator(dest, nil, nil)
+	d.importSrc = "/src"
+	existing := filepath.Join(dest, "existing")
+	d.fileMap[existing] = fswalk.FileRecord{Path: existing, Sum: iphash.HashBytes{1}, Size: 1}
+	d.fileMap[filepath.Join(dest, "clash")] = fswalk.FileRecord{Sum: iphash.HashBytes{9}, Size: 1}
+	src := map[string]fswalk.FileRecord{
+		"/src/a":     {Sum: iphash.HashBytes{1}, Size: 1},
+		"/src/b":     {Sum: iphash.HashBytes{2}, Size: 2},
+		"/src/c":     {Sum: iphash.HashBytes{2}, Size: 2},
+		"/src/clash": {Sum: iphash.HashBytes{3}, Size: 3},
+	}
+
+	res := d.planImport(src)
+	if len(res.Copied) != 1 || res.Copied[0].Dest != filepath.Join(dest, "b") || res.CopiedBytes != 2 {
+		t.Errorf("Copied files mismatch. Got: %+v", res.Copied)
+	}
+	if len(res.Skipped) != 2 || res.Skipped[0].Existing != existing || res.Skipped[1].Existing != filepath.Join(dest, "b") {
+		t.Errorf("Skipped files mismatch. Got: %+v", res.Skipped)
+	}
+	if len(res.Conflicts) != 1 || res.Conflicts[0] != filepath.Join(dest, "clash") {
+		t.Errorf("Conflicts mismatch. Got: %v", res.Conflicts)
+	}
+
+	d.importLink = true
+	if res := d.planImport(src); len(res.Linked) != 2 || len(res.Skipped) != 0 {
+		t.Errorf("Linked files mismatch. Got: %+v", res.Linked)
+	}
+}
+
+// TestPlanUnique checks that exactly one copy of every content is chosen, at the
+// original's relative path, and that earlier output inside the root is ignored.
+func TestPlanUnique(t *testing.T) {
+	rules, _ := policy.Compile([]string{"^/r/b2/"}, nil)
+	d := NewDeduplicator("/r", nil, rules)
+	d.target = "/r/out"
+	for path, sum := range map[string]byte{"/r/b1/x": 1, "/r/b2/x": 1, "/r/b1/y": 2, "/r/out/b1/y": 2} {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: 10}
+	}
+	d.findDuplicates()
+	d.planActions()
+
+	res := d.planUnique()
+	var got []string
+	for _, f := range res.Files {
+		got = append(got, f.Source+">"+f.Dest)
+	}
+	want := []string{"/r/b1/y>/r/out/b1/y", "/r/b2/x>/r/out/b2/x"}
+	if strings.Join(got, " ") != strings.Join(want, " ") || res.Bytes != 20 {
+		t.Errorf("Unique files mismatch. Got: %v (%d bytes), Want: %v", got, res.Bytes, want)
+	}
+
+	d.cas = true
+	res = d.planUnique()
+	if want := "/r/out/objects/02"; len(res.Files) != 2 || res.Files[0].Dest != want {
+		t.Errorf("CAS object path mismatch. Got: %+v, Want: %s", res.Files, want)
+	}
+}
+
+// TestBuildView checks that the mounted view leaves out removed duplicates unless
+// asked to show everything, and annotates group members.
+func TestBuildView(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	rules.Default = policy.ActionRemove
+	d := NewDeduplicator("/r", nil, rules)
+	for _, p := range []string{"/r/a", "/r/sub/b"} {
+		d.fileMap[p] = fswalk.FileRecord{Path: p, Sum: iphash.HashBytes{1}, Size: 1}
+	}
+	d.findDuplicates()
+	d.planActions()
+
+	v := d.buildView(false)
+	if _, ok := v.File("sub/b"); ok {
+		t.Errorf("Removed duplicate sub/b is part of the view")
+	}
+	if f, ok := v.File("a"); !ok || f.Xattrs["user.dedupe.action"] != "keep" {
+		t.Errorf("Kept original mismatch. Got: %+v", f)
+	}
+	f, ok := d.buildView(true).File("sub/b")
+	if !ok || f.Xattrs["user.dedupe.action"] != "remove" || f.Xattrs["user.dedupe.original"] != "/r/a" {
+		t.Errorf("Annotated duplicate mismatch. Got: %+v", f)
+	}
+}
+
+// TestHashStrategies checks that extension overrides are matched by size and that files
+// sharing a quick digest are only grouped when their full content matches.
+func TestHashStrategies(t *testing.T) {
+	s, err := newHashStrategies([]ExtStrategy{
+		{Extensions: []string{".mkv"}, Strategy: strategyQuick, MinSize: 1000},
+		{Extensions: []string{".ISO"}, Strategy: strategySkip},
+	}, "sha256")
+	if err != nil {
+		t.Fatalf("newHashStrategies returned an unexpected error: %v", err)
+	}
+	for _, c := range []struct {
+		path string
+		size int64
+		want string
+	}{{"a.mkv", 999, strategyFull}, {"a.MKV", 1000, strategyQuick}, {"a.iso", 1, strategySkip}, {"a.txt", 1 << 30, strategyFull}} {
+		if got := s.strategy(c.path, c.size); got != c.want {
+			t.Errorf("Strategy of %s (%d bytes) mismatch. Got: %s, Want: %s", c.path, c.size, got, c.want)
+		}
+	}
+	if _, err := newHashStrategies([]ExtStrategy{{Extensions: []string{"mkv"}, Strategy: strategyQuick}}, "sha256"); err == nil {
+		t.Errorf("newHashStrategies accepted an extension without a dot")
+	}
+
+	// Three files that only differ outside the sampled ranges.
+	dir := t.TempDir()
+	d := NewDeduplicator(dir, nil, nil)
+	d.strategies = s
+	hash := s.wrap(iphash.GetFileHashSHA256bytes)
+	for i, name := range []string{"a.mkv", "b.mkv", "c.mkv"} {
+		data := make([]byte, 4*quickSample)
+		if name == "c.mkv" {
+			data[quickSample+1] = byte(i)
+		}
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+		sum, err := hash(path)
+		if err != nil {
+			t.Fatalf("quick hash returned an unexpected error: %v", err)
+		}
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: sum, Size: int64(len(data))}
+	}
+	if a, c := d.fileMap[filepath.Join(dir, "a.mkv")].Sum, d.fileMap[filepath.Join(dir, "c.mkv")].Sum; !bytes.Equal(a, c) {
+		t.Fatalf("Quick digests differ although the samples are equal")
+	}
+	if err := d.confirmQuick(context.Background(), 2); err != nil {
+		t.Fatalf("confirmQuick returned an unexpected error: %v", err)
+	}
+	d.findDuplicates()
+	if len(d.fileByteMapDups) != 1 {
+		t.Fatalf("Duplicate groups mismatch. Got: %v, Want: 1 group", d.fileByteMapDups)
+	}
+	for _, dups := range d.fileByteMapDups {
+		if want := []string{filepath.Join(dir, "a.mkv"), filepath.Join(dir, "b.mkv")}; strings.Join(dups, " ") != strings.Join(want, " ") {
+			t.Errorf("Confirmed duplicates mismatch. Got: %v, Want: %v", dups, want)
+		}
+	}
+}
+
+// TestConfirmQuickAgainstFull checks that a quick-hashed file is confirmed with a full
+// hash when a file of the same size was hashed in full, so the two copies still group.
+func TestConfirmQuickAgainstFull(t *testing.T) {
+	s, err := newHashStrategies([]ExtStrategy{{Extensions: []string{".mkv"}, Strategy: strategyQuick}}, "sha256")
+	if err != nil {
+		t.Fatalf("newHashStrategies returned an unexpected error: %v", err)
+	}
+	dir := t.TempDir()
+	d := NewDeduplicator(dir, nil, nil)
+	d.strategies = s
+	hash := s.wrap(iphash.GetFileHashSHA256bytes)
+	data := make([]byte, 4*quickSample)
+	data[quickSample+1] = 1
+	for _, name := range []string{"movie.mkv", "movie.bak"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+		sum, err := hash(path)
+		if err != nil {
+			t.Fatalf("hash returned an unexpected error: %v", err)
+		}
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: sum, Size: int64(len(data))}
+	}
+	if err := d.confirmQuick(context.Background(), 2); err != nil {
+		t.Fatalf("confirmQuick returned an unexpected error: %v", err)
+	}
+	d.findDuplicates()
+	if len(d.fileByteMapDups) != 1 {
+		t.Fatalf("Duplicate groups mismatch. Got: %v, Want: 1 group", d.fileByteMapDups)
+	}
+	if len(s.quick) != 0 {
+		t.Errorf("Quick digests left after confirming. Got: %v, Want: none", s.quick)
+	}
+}
+
+// TestWhatIfRoots checks that each copy is judged by the filesystem of its own scan
+// root: only copies on a reflink-capable root count towards reflink savings.
+func TestWhatIfRoots(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator("/", nil, rules)
+	d.walkOpts.Roots = []string{"/a", "/b"}
+	d.rootFS = map[string]fswalk.FSInfo{"/a": {Name: "btrfs"}, "/b": {Name: "ext4"}}
+	d.fsName = "btrfs, ext4"
+	for i, path := range []string{"/a/1", "/a/2", "/b/3"} {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{1}, Size: 100, Alloc: 100, Dev: 1, Ino: uint64(10 + i), Nlink: 1}
+	}
+	d.findDuplicates()
+	d.planActions()
+
+	if got := d.fsOf("/b/3"); got != "ext4" {
+		t.Errorf("Filesystem of /b/3 mismatch. Got: %s, Want: ext4", got)
+	}
+	if s := d.whatIf()[2]; !s.Supported || s.Files != 1 || s.Bytes != 100 {
+		t.Errorf("Unexpected reflink savings across btrfs and ext4 roots: %+v", s)
+	}
+}
+
+// TestReportSkippedGroup checks that a group whose every member matched a skip rule,
+// and so has no original, still reports the id and size of its content.
+func TestReportSkippedGroup(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	if err := rules.Add(policy.Spec{Name: "all", Action: "skip"}); err != nil {
+		t.Fatalf("Add returned an unexpected error: %v", err)
+	}
+	d := NewDeduplicator("/r", nil, rules)
+	for _, path := range []string{"/r/a", "/r/b"} {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{1, 2}, Size: 100}
+	}
+	d.findDuplicates()
+	d.planActions()
+
+	g := d.buildReport(nil).Groups[0]
+	if want := iphash.GroupID(iphash.HashBytes{1, 2}); g.ID != want || g.Size != 100 {
+		t.Errorf("Skipped group mismatch. Got: id %s, size %d, Want: id %s, size 100", g.ID, g.Size, want)
+	}
+	if text := d.formatGroup(d.groupOrder[0]); !strings.Contains(text, g.ID) {
+		t.Errorf("Text report lacks the group id %s: %q", g.ID, text)
+	}
+}
+
+// TestMaxActions checks that --max-actions stops after the given number of operations,
+// starting with the group that reclaims the most bytes.
+func TestMaxActions(t *testing.T) {
+	dir := t.TempDir()
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator(dir, iphash.GetFileHashMD5bytes, rules)
+	d.msg = io.Discard
+	d.maxActions = 2
+	for name, content := range map[string]string{"big1": "bigbigbig", "big2": "bigbigbig", "big3": "bigbigbig", "small1": "s", "small2": "s"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+		sum, _ := iphash.GetFileHashMD5bytes(path)
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: sum, Size: int64(len(content))}
+	}
+	d.findDuplicates()
+	d.planActions()
+	if err := d.executeActions(context.Background()); err != nil {
+		t.Fatalf("executeActions returned an unexpected error: %v", err)
+	}
+	if d.actionsDone != 2 || d.actionsDeferred != 1 {
+		t.Errorf("Action counts mismatch. Got: %d done, %d deferred, Want: 2 done, 1 deferred", d.actionsDone, d.actionsDeferred)
+	}
+	for _, name := range []string{"big2", "big3"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "small2")); err != nil {
+		t.Errorf("small2 was removed despite the limit: %v", err)
+	}
+}
+
+// TestReset checks that a --watch pass does not see the groups or counters of the one before.
+func TestReset(t *testing.T) {
+	dir := t.TempDir()
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator(dir, iphash.GetFileHashMD5bytes, rules)
+	d.msg, d.out, d.progressEvery = io.Discard, io.Discard, 0
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("same"), 0o644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+	}
+	if err := d.Run(context.Background(), 1); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	if err := os.Remove(filepath.Join(dir, "b")); err != nil {
+		t.Fatalf("Remove returned an unexpected error: %v", err)
+	}
+	d.reset()
+	if err := d.Run(context.Background(), 1); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	if len(d.fileMap) != 1 || len(d.fileByteMapDups) != 0 || d.filesHashedCount.Load() != 1 {
+		t.Errorf("Second pass mismatch. Got: %d files, %d groups, %d hashed, Want: 1 file, 0 groups, 1 hashed",
+			len(d.fileMap), len(d.fileByteMapDups), d.filesHashedCount.Load())
+	}
+}
+
+// TestFromSnapshot checks that paths hashed below a snapshot are reported below the live root.
+func TestFromSnapshot(t *testing.T) {
+	d := NewDeduplicator("/data", nil, nil)
+	d.fileMap["/data/.snap/a/x"] = fswalk.FileRecord{Path: "/data/.snap/a/x", Size: 1}
+	d.discoveredPaths = []string{"/data/.snap/a"}
+	d.fromSnapshot("/data/.snap")
+	if rec, ok := d.fileMap["/data/a/x"]; !ok || rec.Path != "/data/a/x" || len(d.fileMap) != 1 {
+		t.Errorf("Renamed files mismatch. Got: %+v", d.fileMap)
+	}
+	if d.discoveredPaths[0] != "/data/a" {
+		t.Errorf("Renamed directory mismatch. Got: %s, Want: /data/a", d.discoveredPaths[0])
+	}
+}
+
+// TestConfidence checks that unconfirmed quick digests are reported but not acted on, and
+// that --verify-bytes drops copies whose content differs despite an equal digest.
+func TestConfidence(t *testing.T) {
+	dir := t.TempDir()
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator(dir, iphash.GetFileHashMD5bytes, rules)
+	d.msg = io.Discard
+	d.strategies, _ = newHashStrategies(nil, "md5")
+	sum := iphash.HashBytes{1}
+	for name, content := range map[string]string{"a": "same", "b": "same", "c": "diff"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: sum, Size: 4}
+		d.strategies.quick[path] = true
+	}
+	hashString := iphash.HashToString(sum)
+	d.findDuplicates()
+	d.planActions()
+	if got := d.groupConfidence(hashString); got != confPartialHash {
+		t.Errorf("Confidence mismatch. Got: %s, Want: %s", got, confPartialHash)
+	}
+	if got := d.decisions[hashString].Paths(policy.ActionRemove); len(got) != 0 {
+		t.Errorf("Expected no removals below --min-confidence, got %v", got)
+	}
+
+	delete(d.strategies.quick, filepath.Join(dir, "a"))
+	delete(d.strategies.quick, filepath.Join(dir, "b"))
+	delete(d.strategies.quick, filepath.Join(dir, "c"))
+	if err := d.verifyGroups(context.Background(), 2); err != nil {
+		t.Fatalf("verifyGroups returned an unexpected error: %v", err)
+	}
+	d.planActions()
+	if want := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}; strings.Join(d.fileByteMapDups[hashString], " ") != strings.Join(want, " ") {
+		t.Errorf("Group mismatch. Got: %v, Want: %v", d.fileByteMapDups[hashString], want)
+	}
+	if got := d.groupConfidence(hashString); got != confByteVerified {
+		t.Errorf("Confidence mismatch. Got: %s, Want: %s", got, confByteVerified)
+	}
+	if want := []string{filepath.Join(dir, "b")}; strings.Join(d.decisions[hashString].Paths(policy.ActionRemove), " ") != strings.Join(want, " ") {
+		t.Errorf("Remove mismatch. Got: %v, Want: %v", d.decisions[hashString].Paths(policy.ActionRemove), want)
+	}
+}
+
+// TestSameContentThrottled checks that byte comparisons wait for the --max-read-mib
+// limiter, so a cancelled run does not read on while it is exhausted.
+func TestSameContentThrottled(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	for _, path := range []string{a, b} {
+		if err := os.WriteFile(path, []byte("same"), 0o644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+	}
+	if ok, err := sameContent(context.Background(), nil, a, b); err != nil || !ok {
+		t.Fatalf("sameContent mismatch. Got: %v (%v), Want: true", ok, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := sameContent(ctx, throttle.New(1), a, b); err != context.Canceled {
+		t.Errorf("sameContent error mismatch. Got: %v, Want: %v", err, context.Canceled)
+	}
+}
+
+// TestFindDuplicatesRevisit checks that a file reached through a second directory path
+// is not its own duplicate, while a hard link of it stays in the group.
+func TestFindDuplicatesRevisit(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0o755); err != nil {
+		t.Fatalf("Mkdir returned an unexpected error: %v", err)
+	}
+	file := filepath.Join(dir, "a", "f")
+	if err := os.WriteFile(file, []byte("same"), 0o644); err != nil {
+		t.Fatalf("WriteFile returned an unexpected error: %v", err)
+	}
+	if err := os.Symlink("a", filepath.Join(dir, "again")); err != nil {
+		t.Skipf("Symlink not supported: %v", err)
+	}
+	if err := os.Link(file, filepath.Join(dir, "a", "g")); err != nil {
+		t.Skipf("Link not supported: %v", err)
+	}
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator(dir, iphash.GetFileHashMD5bytes, rules)
+	d.msg = io.Discard
+	for _, path := range []string{file, filepath.Join(dir, "again", "f"), filepath.Join(dir, "a", "g")} {
+		rec, err := fswalk.StatRecord(path)
+		if err != nil {
+			t.Fatalf("StatRecord returned an unexpected error: %v", err)
+		}
+		rec.Sum = iphash.HashBytes{1}
+		d.fileMap[path] = rec
+	}
+	d.findDuplicates()
+	want := []string{file, filepath.Join(dir, "a", "g")}
+	if got := d.fileByteMapDups["01"]; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Group mismatch. Got: %v, Want: %v", got, want)
+	}
+}
+
+// TestEstimate checks the percentage and remaining time shown once the pre-count is known.
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		hashed, total uint64
+		elapsed       time.Duration
+		want          string
+	}{
+		{0, 4 << 30, time.Second, ", 0% of 4.0 GiB"},
+		{1 << 30, 4 << 30, time.Minute, ", 25% of 4.0 GiB, ETA 3m0s"},
+		{5 << 30, 4 << 30, time.Minute, ", 100% of 4.0 GiB"},
+		{0, 0, time.Minute, ""},
+	}
+	for _, tt := range tests {
+		if got := estimate(tt.hashed, tt.total, tt.elapsed); got != tt.want {
+			t.Errorf("estimate(%d, %d, %s) mismatch. Got: %q, Want: %q", tt.hashed, tt.total, tt.elapsed, got, tt.want)
+		}
+	}
+}
+
+// TestPhaseTimings checks the throughput and worker utilization derived from the phases.
+func TestPhaseTimings(t *testing.T) {
+	p := phaseTimes{hash: 2 * time.Second, group: time.Second, workers: 4}
+	p.walk.Store(int64(time.Second))
+	p.busy.Store(int64(6 * time.Second))
+	got := p.timings(100 << 20)
+	if got.WalkSeconds != 1 || got.HashSeconds != 2 || got.GroupSeconds != 1 {
+		t.Errorf("Phase mismatch. Got: %+v", got)
+	}
+	if got.Throughput != 50<<20 || got.Utilization != 0.75 {
+		t.Errorf("Throughput/utilization mismatch. Got: %v B/s, %v, Want: %v B/s, 0.75", got.Throughput, got.Utilization, 50<<20)
+	}
+	want := "walk 1s, hash 2s, group 1s; 100.0 MiB hashed at 50.0 MiB/s; workers: 4, 75% busy"
+	if got.String() != want {
+		t.Errorf("Text mismatch. Got: %q, Want: %q", got.String(), want)
+	}
+}
+
+// TestDiskUsage checks raw and deduplicated directory sizes and the depth limit.
+func TestDiskUsage(t *testing.T) {
+	rec := func(path string, size int64, sum byte) fswalk.FileRecord {
+		return fswalk.FileRecord{Path: path, Size: size, Sum: iphash.HashBytes{sum}}
+	}
+	files := map[string]fswalk.FileRecord{
+		"/r/a":     rec("/r/a", 10, 1),
+		"/r/x/b":   rec("/r/x/b", 10, 1),
+		"/r/x/c":   rec("/r/x/c", 5, 2),
+		"/r/x/y/d": rec("/r/x/y/d", 5, 2),
+	}
+	var got []string
+	for _, u := range diskUsage("/r", files, -1) {
+		got = append(got, fmt.Sprintf("%s %d %d %d", u.Path, u.Files, u.Raw, u.Dedup))
+	}
+	want := []string{"/r 4 30 15", "/r/x 3 20 15", "/r/x/y 1 5 5"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Usage mismatch. Got: %v, Want: %v", got, want)
+	}
+	if n := len(diskUsage("/r", files, 1)); n != 2 {
+		t.Errorf("Directories listed with depth 1 mismatch. Got: %d, Want: 2", n)
+	}
+}
+
+// TestPruneGenerations checks that only older generations whose content newer ones
+// all hold are prunable, and that the newest never is.
+func TestPruneGenerations(t *testing.T) {
+	root := t.TempDir()
+	d := NewDeduplicator(root, nil, nil)
+	now := time.Now()
+	content := map[string][]byte{
+		"daily.0": {1, 2},
+		"daily.1": {1},    // Held by daily.0
+		"daily.2": {1, 3}, // 3 is held by no newer generation
+		"daily.3": {2, 3}, // 2 by daily.0, 3 by daily.2
+	}
+	for i, name := range []string{"daily.0", "daily.1", "daily.2", "daily.3"} {
+		dir := filepath.Join(root, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Mkdir returned an unexpected error: %v", err)
+		}
+		mtime := now.Add(-time.Duration(i) * time.Hour)
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatalf("Chtimes returned an unexpected error: %v", err)
+		}
+		for j, sum := range content[name] {
+			p := filepath.Join(dir, fmt.Sprint(j))
+			d.fileMap[p] = fswalk.FileRecord{Path: p, Size: 1, Sum: iphash.HashBytes{sum}}
+		}
+	}
+
+	res := d.pruneGenerations()
+	var got []string
+	for _, g := range res.Generations {
+		got = append(got, fmt.Sprintf("%s %d %t", filepath.Base(g.Path), g.UniqueFiles, g.Prunable))
+	}
+	want := []string{"daily.0 2 false", "daily.1 0 true", "daily.2 1 false", "daily.3 0 true"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Generations mismatch. Got: %v, Want: %v", got, want)
+	}
+	wantPlan := []string{"rm -rf -- " + shellQuote(filepath.Join(root, "daily.3")), "rm -rf -- " + shellQuote(filepath.Join(root, "daily.1"))}
+	if strings.Join(res.Plan, ",") != strings.Join(wantPlan, ",") {
+		t.Errorf("Plan mismatch. Got: %v, Want: %v", res.Plan, wantPlan)
+	}
+	if got := shellQuote("it's"); got != `'it'\''s'` {
+		t.Errorf("shellQuote mismatch. Got: %s", got)
+	}
+
+	// A file the scan did not hash keeps daily.3; an empty generation is never prunable.
+	if err := os.WriteFile(filepath.Join(root, "daily.3", "unread"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	mtime := now.Add(-3 * time.Hour) // Restored after the write
+	if err := os.Chtimes(filepath.Join(root, "daily.3"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(root, "empty")
+	old := now.Add(-10 * time.Hour)
+	if err := os.Mkdir(empty, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(empty, old, old); err != nil {
+		t.Fatal(err)
+	}
+	res = d.pruneGenerations()
+	got = nil
+	for _, g := range res.Generations {
+		got = append(got, fmt.Sprintf("%s %d %t", filepath.Base(g.Path), g.Uncompared, g.Prunable))
+	}
+	want = []string{"daily.0 0 false", "daily.1 0 true", "daily.2 0 false", "daily.3 1 false", "empty 0 false"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Generations mismatch. Got: %v, Want: %v", got, want)
+	}
+	if len(res.Plan) != 1 {
+		t.Errorf("Plan mismatch. Got: %v, Want: daily.1 only", res.Plan)
+	}
+
+	// Nothing is planned after a walk that missed entries.
+	d.walkStats.PermErrors.Store(2)
+	if res = d.pruneGenerations(); len(res.Plan) != 0 || !strings.Contains(res.Refused, "2 permission errors") {
+		t.Errorf("Incomplete walk mismatch. Got: plan %v, refused %q", res.Plan, res.Refused)
+	}
+}
+
+// TestWritePaths checks that paths-only output lists only the duplicates the plan
+// removes, with the chosen separator.
+func TestWritePaths(t *testing.T) {
+	rules, err := policy.Compile([]string{"/keep/"}, nil)
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	d := NewDeduplicator("/r", nil, rules)
+	d.msg = io.Discard
+	for _, path := range []string{"/r/a", "/r/b", "/r/keep/c", "/r/unique"} {
+		sum := byte(1)
+		if path == "/r/unique" {
+			sum = 2
+		}
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: 3}
+	}
+	d.findDuplicates()
+	d.planActions()
+
+	var buf bytes.Buffer
+	if err := d.writePaths(&buf, 0); err != nil {
+		t.Fatalf("writePaths returned an unexpected error: %v", err)
+	}
+	if got, want := buf.String(), "/r/a\x00/r/b\x00"; got != want {
+		t.Errorf("Paths mismatch. Got: %q, Want: %q", got, want)
+	}
+}
+
+// TestCraftedNames checks that names with line breaks, escape sequences or invalid
+// UTF-8 neither split text report or paths-only lines nor lose bytes in the JSON report.
+func TestCraftedNames(t *testing.T) {
+	rules, err := policy.Compile(nil, nil)
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	d := NewDeduplicator("/r", nil, rules)
+	d.msg = io.Discard
+	crafted := []string{"/r/a\nb", "/r/\xff\x1b[2J", "/r/plain"}
+	for _, path := range crafted {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{1}, Size: 3}
+	}
+	d.findDuplicates()
+	d.planActions()
+
+	text := d.formatGroup(d.groupOrder[0])
+	if n := strings.Count(text, "\n"); n != 1+len(crafted) {
+		t.Errorf("Text report mismatch. Got %d lines, Want: %d:\n%s", n, 1+len(crafted), text)
+	}
+	if strings.Contains(text, "\x1b") || !utf8.ValidString(text) {
+		t.Errorf("Text report holds raw control bytes or invalid UTF-8: %q", text)
+	}
+
+	var buf bytes.Buffer
+	if err := d.writePaths(&buf, '\n'); err != nil {
+		t.Fatalf("writePaths returned an unexpected error: %v", err)
+	}
+	if strings.Contains(buf.String(), "a\nb") {
+		t.Errorf("paths-only output split a name across lines: %q", buf.String())
+	}
+
+	raw := map[string]bool{}
+	for _, f := range d.buildReport(nil).Groups[0].Files {
+		if f.PathBase64 != "" {
+			b, err := base64.StdEncoding.DecodeString(f.PathBase64)
+			if err != nil {
+				t.Fatalf("DecodeString returned an unexpected error: %v", err)
+			}
+			raw[string(b)] = true
+		}
+	}
+	if len(raw) != 1 || !raw["/r/\xff\x1b[2J"] {
+		t.Errorf("path_base64 mismatch. Got: %v, Want only the invalid UTF-8 name", raw)
+	}
+}
+
+// TestDescribeGroup checks the content type, extension consensus and time range of a group.
+func TestDescribeGroup(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDeduplicator(dir, nil, nil)
+	d.msg = io.Discard
+	png := []byte("\x89PNG\r\n\x1a\n0000")
+	for i, name := range []string{"a.png", "b.PNG", "c.bin"} {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, png, 0o644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+		mtime := time.Date(2024, 1, 1+i, 0, 0, 0, 0, time.UTC)
+		d.fileMap[p] = fswalk.FileRecord{Path: p, Sum: iphash.HashBytes{1}, Size: int64(len(png)), ModTime: mtime}
+	}
+	d.findDuplicates()
+
+	var g ReportGroup
+	d.describeGroup(&g, "01")
+	if g.ContentType != "image/png" || g.Extension != ".png" || g.ExtensionsAgree {
+		t.Errorf("Content mismatch. Got: %q %q %v, Want: image/png .png false", g.ContentType, g.Extension, g.ExtensionsAgree)
+	}
+	if g.OldestMTime.Day() != 1 || g.NewestMTime.Day() != 3 {
+		t.Errorf("Time range mismatch. Got: %v - %v", g.OldestMTime, g.NewestMTime)
+	}
+	if got := contentType(filepath.Join(dir, "missing.json"), ".json"); got != "application/json" {
+		t.Errorf("contentType of an unreadable file mismatch. Got: %q, Want: application/json", got)
+	}
+}
+
+// TestGateAge checks that --only-older-than skips groups with a recently modified copy
+// and leaves older groups to their planned actions.
+func TestGateAge(t *testing.T) {
+	rules, err := policy.Compile(nil, nil)
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	now := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	rules.Now = now
+	d := NewDeduplicator("/r", nil, rules)
+	d.msg = io.Discard
+	d.minAge = 7 * 24 * time.Hour
+	add := func(path string, sum byte, daysAgo int) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: 1, ModTime: now.AddDate(0, 0, -daysAgo)}
+	}
+	add("/r/old/a", 1, 30)
+	add("/r/old/b", 1, 10)
+	add("/r/new/a", 2, 30)
+	add("/r/new/b", 2, 2)
+	d.findDuplicates()
+	d.planActions()
+
+	if e := d.decisions["01"].Entries[1]; e.Action != policy.ActionRemove {
+		t.Errorf("Old group action mismatch. Got: %s, Want: remove", e.Action)
+	}
+	e := d.decisions["02"].Entries[1]
+	if e.Action != policy.ActionSkip || !strings.Contains(e.Rule, "--only-older-than") {
+		t.Errorf("Fresh group action mismatch. Got: %s (%s), Want: skip", e.Action, e.Rule)
+	}
+}
+
+// TestGateSpecialModes checks that setuid copies and links to a setgid original are
+// skipped, while removing an ordinary copy of it is kept.
+func TestGateSpecialModes(t *testing.T) {
+	rules, err := policy.Compile(nil, nil)
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	rules.Default = policy.ActionLink
+	d := NewDeduplicator("/r", nil, rules)
+	d.msg = io.Discard
+	add := func(path string, sum byte, mode os.FileMode) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: 1, Mode: mode}
+	}
+	add("/r/a/tool", 1, 0o755)
+	add("/r/b/tool", 1, 0o755|os.ModeSetuid)
+	add("/r/c/tool", 1, 0o755)
+	add("/r/a/sgid", 2, 0o755|os.ModeSetgid)
+	add("/r/b/sgid", 2, 0o755)
+	d.findDuplicates()
+	d.planActions()
+
+	want := []string{"keep", "skip", "link"}
+	var got []string
+	for _, e := range d.decisions["01"].Entries {
+		got = append(got, e.Action.String())
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Setuid group actions mismatch. Got: %v, Want: %v", got, want)
+	}
+	if e := d.decisions["02"].Entries[1]; e.Action != policy.ActionSkip || !strings.Contains(e.Rule, "--allow-special-modes") {
+		t.Errorf("Setgid original action mismatch. Got: %s (%s), Want: skip", e.Action, e.Rule)
+	}
+
+	d.allowSpecial = true
+	d.planActions()
+	if e := d.decisions["01"].Entries[1]; e.Action != policy.ActionLink {
+		t.Errorf("Allowed action mismatch. Got: %s, Want: link", e.Action)
+	}
+}
+
+// TestModeFilter checks which permission bits --skip-executables and
+// --only-regular-perms leave out, alone and chained with another Skip.
+func TestModeFilter(t *testing.T) {
+	dir := t.TempDir()
+	modes := map[string]os.FileMode{"plain": 0o644, "exec": 0o750, "shared": 0o666, "sticky": 0o644 | os.ModeSticky}
+	infos := make(map[string]os.FileInfo)
+	for name, mode := range modes {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		infos[name] = info
+	}
+	if infos["sticky"].Mode()&os.ModeSticky == 0 {
+		t.Skip("sticky bit not supported on files here")
+	}
+	skipped := func(skip func(string, os.FileInfo) bool) string {
+		var names []string
+		for _, name := range []string{"exec", "plain", "shared", "sticky"} {
+			if skip(name, infos[name]) {
+				names = append(names, name)
+			}
+		}
+		return strings.Join(names, ",")
+	}
+	if got := skipped(modeFilter{skipExecutables: true}.skip); got != "exec" {
+		t.Errorf("--skip-executables mismatch. Got: %s, Want: exec", got)
+	}
+	if got := skipped(modeFilter{regularOnly: true}.skip); got != "exec,shared,sticky" {
+		t.Errorf("--only-regular-perms mismatch. Got: %s, Want: exec,shared,sticky", got)
+	}
+	plain := func(path string, info os.FileInfo) bool { return path == "plain" }
+	if got := skipped(chainSkip(plain, modeFilter{skipExecutables: true}.skip)); got != "exec,plain" {
+		t.Errorf("Chained skip mismatch. Got: %s, Want: exec,plain", got)
+	}
+}
+
+// TestGroupSymlinks checks that links are grouped by the content of their targets,
+// scanned or not, that dangling links are listed and that links to directories are not.
+func TestGroupSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	a, c := write("a", "same"), write("c", "other")
+	write("b", "same")
+	d := NewDeduplicator(dir, iphash.GetFileHashSHA256bytes, nil)
+	d.msg = io.Discard
+	d.symlinks = &symlinkSet{}
+	sum, err := iphash.GetFileHashSHA256bytes(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.fileMap[a] = fswalk.FileRecord{Path: a, Sum: sum, Size: 4} // b is left to be hashed
+	for name, target := range map[string]string{"l1": a, "l2": "b", "l3": c, "l4": "missing", "l5": dir} {
+		path := filepath.Join(dir, name)
+		if err := os.Symlink(target, path); err != nil {
+			t.Skipf("symlinks unsupported: %v", err)
+		}
+		d.symlinks.add(path)
+	}
+	res := d.groupSymlinks()
+
+	if len(res.Groups) != 1 {
+		t.Fatalf("Group count mismatch. Got: %d, Want: 1", len(res.Groups))
+	}
+	g := res.Groups[0]
+	var got []string
+	for _, l := range g.Links {
+		got = append(got, filepath.Base(l.Path)+"->"+filepath.Base(l.Target))
+	}
+	if want := "l1->a,l2->b"; strings.Join(got, ",") != want || g.Size != 4 || g.Hash != iphash.HashToString(sum) {
+		t.Errorf("Group mismatch. Got: %v (%d bytes, %s), Want: %s (4 bytes)", got, g.Size, g.Hash, want)
+	}
+	if len(res.Dangling) != 1 || res.Dangling[0].Target != "missing" {
+		t.Errorf("Dangling links mismatch. Got: %+v, Want: l4 -> missing", res.Dangling)
+	}
+}
+
+// TestFindSimilarFiles checks that an edited copy of a file is reported with its share
+// of common chunks, and that unrelated and small files are not.
+func TestFindSimilarFiles(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 2<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	edited := append(append(append([]byte{}, data[:1<<20]...), "edited"...), data[1<<20:]...)
+	other := bytes.Repeat([]byte("unrelated content "), 100000)
+	d := NewDeduplicator(dir, nil, nil)
+	d.msg = io.Discard
+	d.chunkMinSize = 1 << 20
+	d.chunkThreshold = 0.5
+	for i, content := range [][]byte{data, edited, other, data[:1000]} {
+		path := filepath.Join(dir, fmt.Sprintf("f%d", i))
+		if err := os.WriteFile(path, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Size: int64(len(content)), Sum: iphash.HashBytes{byte(i)}}
+	}
+	res, err := d.findSimilarFiles(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("findSimilarFiles returned an unexpected error: %v", err)
+	}
+	if res.Files != 3 {
+		t.Errorf("Chunked file count mismatch. Got: %d, Want: 3", res.Files)
+	}
+	if len(res.Pairs) != 1 {
+		t.Fatalf("Pair count mismatch. Got: %+v, Want: f0 and f1", res.Pairs)
+	}
+	p := res.Pairs[0]
+	if filepath.Base(p.A) != "f0" || filepath.Base(p.B) != "f1" || p.Similarity < 0.8 || p.Similarity >= 1 {
+		t.Errorf("Pair mismatch. Got: %s and %s at %.2f, Want: f0 and f1 at 0.8 to 1", p.A, p.B, p.Similarity)
+	}
+}
+
+// TestClusterNear checks that documents within the distance are clustered
+// transitively, whichever block they agree on, and that distant ones are left out.
+func TestClusterNear(t *testing.T) {
+	paths := []string{"/r/a", "/r/b", "/r/c", "/r/far", "/r/high"}
+	fps := []uint64{
+		0,
+		0x7,                       // 3 bits from a
+		0x7 | 0x7<<40,             // 3 bits from b, 6 from a
+		^uint64(0),                // Far from everything
+		^uint64(0) &^ (0x3 << 62), // 2 bits from far, in the last block
+	}
+	res := clusterNear(paths, fps, 3)
+	if res.Files != 5 || len(res.Groups) != 2 {
+		t.Fatalf("Cluster count mismatch. Got: %+v, Want: 2 groups of 5 files", res)
+	}
+	if g := res.Groups[0]; strings.Join(g.Paths, ",") != "/r/a,/r/b,/r/c" || g.MaxDistance != 6 {
+		t.Errorf("First cluster mismatch. Got: %v (%d bits), Want: /r/a,/r/b,/r/c (6 bits)", g.Paths, g.MaxDistance)
+	}
+	if g := res.Groups[1]; strings.Join(g.Paths, ",") != "/r/far,/r/high" || g.MaxDistance != 2 {
+		t.Errorf("Second cluster mismatch. Got: %v (%d bits), Want: /r/far,/r/high (2 bits)", g.Paths, g.MaxDistance)
+	}
+}
+
+// TestCompareDocuments checks that DOCX files differing only in formatting are grouped
+// by their text, and that documents with other or no text are not.
+func TestCompareDocuments(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDeduplicator(dir, nil, nil)
+	d.msg = io.Discard
+	docs := map[string]string{
+		"a.docx":     `<w:p><w:r><w:t>Annual report, 2024.</w:t></w:r></w:p>`,
+		"b.docx":     `<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>ANNUAL</w:t></w:r><w:r><w:t xml:space="preserve"> report 2024</w:t></w:r></w:p>`,
+		"c.docx":     `<w:p><w:r><w:t>Annual report, 2023.</w:t></w:r></w:p>`,
+		"empty.docx": ``,
+	}
+	for i, name := range []string{"a.docx", "b.docx", "c.docx", "empty.docx"} {
+		path := filepath.Join(dir, name)
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, err := zw.Create("word/document.xml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(w, `<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>%s</w:body></w:document>`, docs[name])
+		zw.Close()
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Size: int64(buf.Len()), Sum: iphash.HashBytes{byte(i)}}
+	}
+	res, err := d.compareDocuments(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("compareDocuments returned an unexpected error: %v", err)
+	}
+	if res.Files != 4 || res.NoText != 1 || len(res.Groups) != 1 {
+		t.Fatalf("Result mismatch. Got: %+v, Want: 4 files, 1 without text, 1 group", res)
+	}
+	var got []string
+	for _, p := range res.Groups[0].Paths {
+		got = append(got, filepath.Base(p))
+	}
+	if strings.Join(got, ",") != "a.docx,b.docx" {
+		t.Errorf("Group mismatch. Got: %v, Want: [a.docx b.docx]", got)
+	}
+}
+
+// TestCaseCollisions checks that files and directories differing only in case are
+// grouped, that identical content is told apart from different content, and that
+// entries below colliding directories are not reported again.
+func TestCaseCollisions(t *testing.T) {
+	d := NewDeduplicator("/r", nil, nil)
+	rec := func(path, sum string) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Size: int64(len(sum)), Sum: []byte(sum)}
+	}
+	rec("/r/Readme.md", "same")
+	rec("/r/README.md", "same")
+	rec("/r/notes.txt", "one")
+	rec("/r/Notes.TXT", "two")
+	rec("/r/unique.txt", "one")
+	rec("/r/Docs/a.txt", "one")
+	rec("/r/docs/a.txt", "two")
+	d.discoveredPaths = []string{"/r/Docs", "/r/docs"}
+	res := d.caseCollisions()
+
+	want := []CaseGroup{
+		{Paths: []string{"/r/Docs", "/r/docs"}, Dirs: true},
+		{Paths: []string{"/r/Notes.TXT", "/r/notes.txt"}},
+		{Paths: []string{"/r/README.md", "/r/Readme.md"}, SameContent: true},
+	}
+	if len(res.Groups) != len(want) {
+		t.Fatalf("Group count mismatch. Got: %+v, Want: %+v", res.Groups, want)
+	}
+	for i, g := range res.Groups {
+		if strings.Join(g.Paths, ",") != strings.Join(want[i].Paths, ",") || g.Dirs != want[i].Dirs || g.SameContent != want[i].SameContent {
+			t.Errorf("Group %d mismatch. Got: %+v, Want: %+v", i, g, want[i])
+		}
+	}
+}
+
+// TestMailTemplate checks that the default mail body shows the outcome and the largest
+// groups in report order.
+func TestMailTemplate(t *testing.T) {
+	rules, err := policy.Compile(nil, nil)
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	d := NewDeduplicator("/r", nil, rules)
+	d.msg = io.Discard
+	add := func(path string, sum byte, size int64) {
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: size}
+	}
+	add("/r/big/a", 1, 2048)
+	add("/r/big/b", 1, 2048)
+	add("/r/small/a", 2, 10)
+	add("/r/small/b", 2, 10)
+	add("/r/small/c", 2, 10)
+	d.findDuplicates()
+	d.planActions()
+	tmpl, err := parseMailTemplate("")
+	if err != nil {
+		t.Fatalf("parseMailTemplate returned an unexpected error: %v", err)
+	}
+	var body strings.Builder
+	if err := tmpl.Execute(&body, d.mailData(d.summary(nil))); err != nil {
+		t.Fatalf("Execute returned an unexpected error: %v", err)
+	}
+	got := body.String()
+	for _, want := range []string{"go-file-dedupe success on ", "Duplicate groups: 2 (3 duplicate files)",
+		"   2.0 KiB  2 x 2.0 KiB  /r/big/a\n        20 B  3 x 10 B  /r/small/a\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Mail body lacks %q. Got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "Error:") {
+		t.Errorf("Mail body of a successful run mentions an error:\n%s", got)
+	}
+}
+
+// TestWriteMetrics checks the Prometheus textfile, with tags as escaped labels, and
+// that other paths collect one JSON line per run.
+func TestWriteMetrics(t *testing.T) {
+	dir := t.TempDir()
+	started := time.Date(2024, 5, 1, 2, 0, 0, 0, time.UTC)
+	s := RunSummary{Status: "success", Root: "/srv/\"nas\"", Tags: map[string]string{"site-id": "b1", "root": "ignored"},
+		Started: started, Finished: started.Add(90 * time.Second), DuplicateGroups: 3, Reclaimed: 4096}
+	prom := filepath.Join(dir, "dedupe.prom")
+	if err := writeMetrics(prom, s); err != nil {
+		t.Fatalf("writeMetrics returned an unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(prom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := `{root="/srv/\"nas\"",site_id="b1"}`
+	for _, want := range []string{
+		"# TYPE dedupe_duplicate_groups gauge\ndedupe_duplicate_groups" + labels + " 3\n",
+		"dedupe_last_run_duration_seconds" + labels + " 90\n",
+		"dedupe_last_run_success" + labels + " 1\n",
+		"dedupe_reclaimed_bytes" + labels + " 4096\n",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("Metrics lack %q. Got:\n%s", want, data)
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Temporary files left behind: %v", entries)
+	}
+
+	history := filepath.Join(dir, "runs.jsonl")
+	for i := 0; i < 2; i++ {
+		if err := writeMetrics(history, s); err != nil {
+			t.Fatalf("writeMetrics returned an unexpected error: %v", err)
+		}
+	}
+	data, err = os.ReadFile(history)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 2 || !strings.Contains(lines[1], `"reclaimed_bytes":4096`) {
+		t.Errorf("JSON history mismatch. Got:\n%s", data)
+	}
+}
+
+// TestSandboxMetricsFile checks that the sandbox of a report-only run allows writes to
+// the directory of the metrics file and nowhere else.
+func TestSandboxMetricsFile(t *testing.T) {
+	d := NewDeduplicator("/r", nil, nil)
+	d.metricsPath = filepath.Join("/var", "lib", "node_exporter", "dedupe.prom")
+	p, err := d.sandboxPolicy()
+	if err != nil {
+		t.Fatalf("sandboxPolicy returned an unexpected error: %v", err)
+	}
+	if strings.Join(p.Read, ",") != "/r" || strings.Join(p.Write, ",") != filepath.Join("/var", "lib", "node_exporter") {
+		t.Errorf("Sandbox policy mismatch. Got: read %v, write %v", p.Read, p.Write)
+	}
+}
+
+// TestReadRoots checks newline and NUL separated root lists, that nested and repeated
+// roots are dropped, that files are refused, and the common parent of the roots.
+func TestReadRoots(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"a/b", "a/b/c", "a/b c", "d"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	join := func(sep string, subs ...string) []byte {
+		var b strings.Builder
+		for _, sub := range subs {
+			b.WriteString(filepath.Join(dir, sub) + sep)
+		}
+		return []byte(b.String())
+	}
+	lists := map[string][]byte{
+		"lines": append(join("\r\n", "a/b c", "a/b/c", "a/b"), join("\n\n", "a/b c")...),
+		"nul":   join("\x00", "a/b/c", "a/b c", "a/b"),
+	}
+	want := filepath.Join(dir, "a/b") + " " + filepath.Join(dir, "a/b c")
+	for name, data := range lists {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		roots, err := readRoots(path, name == "nul")
+		if err != nil {
+			t.Fatalf("readRoots(%s) returned an unexpected error: %v", name, err)
+		}
+		if got := strings.Join(roots, " "); got != want {
+			t.Errorf("readRoots(%s) mismatch. Got: %s, Want: %s", name, got, want)
+		}
+		if got := commonDir(roots); got != filepath.Join(dir, "a") {
+			t.Errorf("commonDir mismatch. Got: %s, Want: %s", got, filepath.Join(dir, "a"))
+		}
+	}
+	if got := commonDir([]string{filepath.Join(dir, "a/b"), filepath.Join(dir, "d")}); got != dir {
+		t.Errorf("commonDir mismatch. Got: %s, Want: %s", got, dir)
+	}
+	files := filepath.Join(dir, "files")
+	if err := os.WriteFile(files, join("\n", "lines"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRoots(files, false); err == nil {
+		t.Errorf("readRoots accepted a file as a root")
+	}
+}
+
+// TestScanRootsConfinement checks that with several roots sharing only "/" the path
+// guard and the sandbox are confined to the roots, not to their common parent.
+func TestScanRootsConfinement(t *testing.T) {
+	listed := []string{"/srv/a", "/home/b"}
+	if got := commonDir(listed); got != "/" {
+		t.Fatalf("Common parent mismatch. Got: %s, Want: /", got)
+	}
+	d := NewDeduplicator(commonDir(listed), nil, nil)
+	d.walkOpts.Roots = listed
+	d.apply = true
+	p, err := d.sandboxPolicy()
+	if err != nil {
+		t.Fatalf("sandboxPolicy returned an unexpected error: %v", err)
+	}
+	if strings.Join(p.Read, ",") != "/srv/a,/home/b" || strings.Join(p.Write, ",") != "/srv/a,/home/b" {
+		t.Errorf("Sandbox policy mismatch. Got: read %v, write %v, Want: the two roots", p.Read, p.Write)
+	}
+
+	dir := t.TempDir()
+	for _, sub := range []string{"a", "b", "outside"} {
+		if err := os.Mkdir(filepath.Join(dir, sub), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, sub, "f"), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d = NewDeduplicator(dir, nil, nil)
+	d.walkOpts.Roots = []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	guard, err := actions.NewGuard(d.scanRoots()...)
+	if err != nil {
+		t.Fatalf("NewGuard returned an unexpected error: %v", err)
+	}
+	if err := guard.Check(filepath.Join(dir, "b", "f")); err != nil {
+		t.Errorf("Check refused a file in a root: %v", err)
+	}
+	if err := guard.Check(filepath.Join(dir, "outside", "f")); err == nil {
+		t.Errorf("Check accepted a file outside both roots")
+	}
+}
+
+// TestScopeFilter checks which directories --only patterns prune and which files they keep.
+func TestScopeFilter(t *testing.T) {
+	root := filepath.FromSlash("/r")
+	f, err := newScopeFilter(root, []string{"projects/*/src", "photos/"})
+	if err != nil {
+		t.Fatalf("newScopeFilter returned an unexpected error: %v", err)
+	}
+	dirs := map[string]bool{ // Path -> pruned
+		"projects":             false,
+		"projects/a":           false,
+		"projects/a/src":       false,
+		"projects/a/src/deep":  false,
+		"projects/a/build":     true,
+		"photos/2024":          false,
+		"music":                true,
+		"photosets":            true,
+		"projects/a/src2/deep": true,
+	}
+	for dir, want := range dirs {
+		if got := f.skipDir(filepath.Join(root, filepath.FromSlash(dir))); got != want {
+			t.Errorf("skipDir(%s) mismatch. Got: %v, Want: %v", dir, got, want)
+		}
+	}
+	files := map[string]bool{ // Path -> skipped
+		"top.txt":              true,
+		"projects/a/README":    true,
+		"projects/a/src/x.go":  false,
+		"photos/2024/img.jpg":  false,
+		"projects/a/build/out": true,
+	}
+	for file, want := range files {
+		if got := f.skip(filepath.Join(root, filepath.FromSlash(file)), nil); got != want {
+			t.Errorf("skip(%s) mismatch. Got: %v, Want: %v", file, got, want)
+		}
+	}
+	for _, bad := range []string{"../etc", "/abs", ".", "a/[b"} {
+		if _, err := newScopeFilter(root, []string{bad}); err == nil {
+			t.Errorf("newScopeFilter accepted %q", bad)
+		}
+	}
+}
+
+// TestDropOverlayCopies checks that files scanned through an overlay's merged view and
+// in the layer holding them count once, while a lower copy hidden by the upper layer and
+// real duplicates elsewhere are still grouped.
+func TestDropOverlayCopies(t *testing.T) {
+	root := t.TempDir()
+	o := fswalk.Overlay{
+		Mountpoint: filepath.Join(root, "merged"),
+		Upper:      filepath.Join(root, "upper"),
+		Lower:      []string{filepath.Join(root, "lower")},
+		Work:       filepath.Join(root, "work"),
+	}
+	for _, dir := range []string{o.Upper, o.Lower[0]} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("MkdirAll returned an unexpected error: %v", err)
+		}
+	}
+	// upper/c holds the visible c but is left out of the fileMap, as if not scanned.
+	if err := os.WriteFile(filepath.Join(o.Upper, "c"), []byte("c"), 0644); err != nil {
+		t.Fatalf("WriteFile returned an unexpected error: %v", err)
+	}
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator(root, nil, rules)
+	d.overlays = []fswalk.Overlay{o}
+	add := func(rel string, sum byte) {
+		path := filepath.Join(root, filepath.FromSlash(rel))
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{sum}, Size: 1}
+	}
+	add("merged/a", 1)
+	add("upper/a", 1)
+	add("merged/b", 2)
+	add("lower/b", 2)
+	add("merged/c", 3)
+	add("lower/c", 3)
+	add("other", 1)
+	d.findDuplicates()
+
+	var got []string
+	for path := range d.fileMap {
+		rel, _ := filepath.Rel(root, path)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	sort.Strings(got)
+	if strings.Join(got, " ") != "lower/c merged/a merged/b merged/c other" {
+		t.Errorf("Kept paths mismatch. Got: %v", got)
+	}
+	if n := len(d.fileByteMapDups); n != 2 {
+		t.Errorf("Duplicate group count mismatch. Got: %d, Want: 2", n)
+	}
+
+	skip := overlayLayerSkipper(d.overlays)
+	for dir, want := range map[string]bool{o.Mountpoint: true, o.Lower[0]: true, o.Work: true, o.Upper: false, root: false} {
+		if got := skip(dir); got != want {
+			t.Errorf("overlayLayerSkipper(%s) mismatch. Got: %v, Want: %v", dir, got, want)
+		}
+	}
+}
+
+// TestFormatGroupCap checks that the text report lists at most maxGroupPaths paths of a
+// group with a marker for the rest, while the JSON report keeps every path.
+func TestFormatGroupCap(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator("/r", nil, rules)
+	d.msg = io.Discard
+	d.maxGroupPaths = 5
+	for i := 0; i < 12; i++ {
+		path := fmt.Sprintf("/r/%02d", i)
+		d.fileMap[path] = fswalk.FileRecord{Path: path, Sum: iphash.HashBytes{1}, Size: 3}
+	}
+	d.findDuplicates()
+	d.planActions()
+
+	text := d.formatGroup(d.groupOrder[0])
+	if n := strings.Count(text, "\n"); n != 7 || !strings.Contains(text, "(+7 more)") || strings.Contains(text, "/r/05") {
+		t.Errorf("Capped text report mismatch:\n%s", text)
+	}
+	if n := len(d.buildReport(nil).Groups[0].Files); n != 12 {
+		t.Errorf("JSON report file count mismatch. Got: %d, Want: 12", n)
+	}
+}
+
+// TestControlSocket checks that the status command reads the phase, counters and last
+// pass of a process serving the control socket.
+func TestControlSocket(t *testing.T) {
+	rules, _ := policy.Compile(nil, nil)
+	d := NewDeduplicator("/r", nil, rules)
+	d.cache = hashcache.New("blake3")
+	d.filesFoundCount.Store(7)
+	d.setPhase(phaseWaiting, "Waiting: pass %d done", 2)
+	d.passDone(2, RunSummary{Status: "success", DuplicateGroups: 3})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	path := filepath.Join(t.TempDir(), "control.sock")
+	served := make(chan error, 1)
+	go func() { served <- d.serveControl(ctx, path) }()
+	var s ServiceStatus
+	var err error
+	for i := 0; i < 100; i++ {
+		if s, err = fetchStatus(path); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("fetchStatus returned an unexpected error: %v", err)
+	}
+	if s.Phase != phaseWaiting || s.FilesFound != 7 || s.Passes != 2 || s.LastRun == nil || s.LastRun.DuplicateGroups != 3 || s.Cache == nil {
+		t.Errorf("Status mismatch. Got: %+v", s)
+	}
+	var buf bytes.Buffer
+	writeStatusText(&buf, s, time.Now())
+	if !strings.Contains(buf.String(), "Phase: waiting") || !strings.Contains(buf.String(), "3 duplicate groups") {
+		t.Errorf("Status text mismatch:\n%s", buf.String())
+	}
+
+	d.controlPath = path
+	if p, err := d.sandboxPolicy(); err != nil || strings.Join(p.Write, ",") != filepath.Dir(path) {
+		t.Errorf("Sandbox write paths mismatch. Got: %v (%v), Want: %s", p.Write, err, filepath.Dir(path))
+	}
+
+	cancel()
+	if err := <-served; err != nil {
+		t.Errorf("serveControl returned an unexpected error: %v", err)
+	}
+	if _, err := fetchStatus(path); err == nil {
+		t.Errorf("fetchStatus succeeded after the server stopped")
+	}
+}
+
+// TestHeartbeat checks that the heartbeat file holds the current phase while the run
+// goes on and the final one once it is stopped, and that the sandbox lets it be written.
+func TestHeartbeat(t *testing.T) {
+	d := NewDeduplicator("/r", nil, nil)
+	d.setPhase(phaseScanning, "Scanning")
+	path := filepath.Join(t.TempDir(), "heartbeat.json")
+	read := func() ServiceStatus {
+		var s ServiceStatus
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("ReadFile returned an unexpected error: %v", err)
+		}
+		if err := json.Unmarshal(data, &s); err != nil {
+			t.Fatalf("Unmarshal returned an unexpected error: %v", err)
+		}
+		return s
+	}
+	d.heartbeatPath = path
+	stop := d.startHeartbeat(context.Background(), 10*time.Millisecond)
+	first := read()
+	if first.Phase != phaseScanning || first.Updated.IsZero() {
+		t.Errorf("First heartbeat mismatch. Got: %+v", first)
+	}
+	d.filesFoundCount.Store(5)
+	time.Sleep(50 * time.Millisecond)
+	if s := read(); s.FilesFound != 5 || !s.Updated.After(first.Updated) {
+		t.Errorf("Heartbeat not refreshed. Got: %+v", s)
+	}
+
+	d.setPhase(phaseFinished, "Finished")
+	stop()
+	if s := read(); s.Phase != phaseFinished {
+		t.Errorf("Final phase mismatch. Got: %s, Want: %s", s.Phase, phaseFinished)
+	}
+
+	p, err := d.sandboxPolicy()
+	if err != nil {
+		t.Fatalf("sandboxPolicy returned an unexpected error: %v", err)
+	}
+	if strings.Join(p.Write, ",") != filepath.Dir(path) {
+		t.Errorf("Sandbox write paths mismatch. Got: %v, Want: %s", p.Write, filepath.Dir(path))
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/memwatch"
+)
+
+// memCheckInterval is how often the memory watchdog samples the process.
+const memCheckInterval = 10 * time.Second
+
+// watchMemory starts the memory watchdog for the limits. The returned context is
+// cancelled when the heap passes limits.StopHeap, which stops the run the way Ctrl+C
+// does: walkers stop, no further action starts, and the report and cache are written.
+func (d *Deduplicator) watchMemory(ctx context.Context, limits memwatch.Limits) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	wd := &memwatch.Watchdog{
+		Limits: limits,
+		Warn:   d.memoryWarning,
+		Stop: func(s memwatch.Sample, msg string) {
+			log.Printf("Stopping gracefully: %s.", msg)
+			d.memStopped.Store(true)
+			cancel()
+		},
+	}
+	go wd.Run(ctx, memCheckInterval)
+	return ctx, cancel
+}
+
+// memoryWarning logs a passed warning threshold, returns freed memory to the operating
+// system and saves the hash cache as a checkpoint, so that an OOM kill that may follow
+// loses no hashing work.
+func (d *Deduplicator) memoryWarning(s memwatch.Sample, msg string) {
+	log.Printf("Warning: %s; %s obtained from the system.", msg, formatSize(int64(s.Sys)))
+	debug.FreeOSMemory()
+	if d.cachePath != "" {
+		if err := d.cache.Save(d.cachePath); err != nil {
+			log.Printf("Warning: %v", err)
+		} else {
+			log.Printf("Hash cache saved as a checkpoint: %s", displayPath(d.cachePath))
+		}
+	}
+}
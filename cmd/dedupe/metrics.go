@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/atomicfile"
+)
+
+// writeMetrics exports the run summary for monitoring. A path ending in .prom gets
+// the Prometheus text format, replaced atomically so node_exporter's textfile
+// collector never reads half a file. Any other path gets one JSON summary line
+// appended per run, a history for comparing runs.
+func writeMetrics(path string, s RunSummary) error {
+	if filepath.Ext(path) != ".prom" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return err
+		}
+		if err := json.NewEncoder(f).Encode(s); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return atomicfile.Write(path, 0o644, func(w io.Writer) error { return writePromMetrics(w, s) })
+}
+
+// writePromMetrics writes the summary as Prometheus gauges labelled with the root and
+// the --tag pairs.
+func writePromMetrics(w io.Writer, s RunSummary) error {
+	labels := promLabels(s, "")
+	success := 0
+	if s.Status == "success" {
+		success = 1
+	}
+	bw := bufio.NewWriter(w)
+	for _, m := range []struct {
+		name, help string
+		value      float64
+	}{
+		{"dedupe_last_run_timestamp_seconds", "End of the last run as a Unix time.", float64(s.Finished.UnixNano()) / 1e9},
+		{"dedupe_last_run_success", "Whether the last run succeeded (1) or failed or was cancelled (0).", float64(success)},
+		{"dedupe_last_run_duration_seconds", "Duration of the last run.", s.Finished.Sub(s.Started).Seconds()},
+		{"dedupe_files_scanned", "Files scanned by the last run.", float64(s.FilesScanned)},
+		{"dedupe_bytes_hashed", "Bytes read and hashed by the last run.", float64(s.Timings.BytesHashed)},
+		{"dedupe_duplicate_groups", "Duplicate groups found by the last run.", float64(s.DuplicateGroups)},
+		{"dedupe_duplicate_files", "Duplicate copies beyond each group's original.", float64(s.DuplicateFiles)},
+		{"dedupe_reclaimable_bytes", "Apparent bytes the planned actions would free.", float64(s.ReclaimApparent)},
+		{"dedupe_reclaimed_bytes", "Apparent size of the duplicates the last run removed or linked.", float64(s.Reclaimed)},
+		{"dedupe_actions_applied", "Actions applied by the last run.", float64(s.ActionsApplied)},
+		{"dedupe_actions_failed", "Actions that failed in the last run.", float64(s.ActionsFailed)},
+		{"dedupe_hash_errors", "Files the last run could not hash.", float64(s.HashErrors)},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n%s%s %g\n", m.name, m.help, m.name, m.name, labels, m.value)
+	}
+	if len(s.Roots) == 0 {
+		return bw.Flush()
+	}
+	fmt.Fprintf(bw, "# HELP dedupe_cross_root_groups Duplicate groups with copies in more than one root.\n# TYPE dedupe_cross_root_groups gauge\ndedupe_cross_root_groups%s %d\n", labels, s.CrossRootGroups)
+	for _, m := range []struct {
+		name, help string
+		value      func(RootStats) float64
+	}{
+		{"dedupe_root_files", "Files scanned in one of several roots.", func(r RootStats) float64 { return float64(r.Files) }},
+		{"dedupe_root_bytes", "Bytes of the files scanned in one of several roots.", func(r RootStats) float64 { return float64(r.Bytes) }},
+		{"dedupe_root_contained_groups", "Duplicate groups with every copy in the root.", func(r RootStats) float64 { return float64(r.ContainedGroups) }},
+		{"dedupe_root_cross_root_groups", "Duplicate groups with copies in the root and in another one.", func(r RootStats) float64 { return float64(r.CrossRootGroups) }},
+		{"dedupe_root_duplicate_files", "Duplicate copies in the root beyond their group's original.", func(r RootStats) float64 { return float64(r.DuplicateFiles) }},
+		{"dedupe_root_reclaimable_bytes", "Apparent bytes the planned actions would free in the root.", func(r RootStats) float64 { return float64(r.Reclaimable) }},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s gauge\n", m.name, m.help, m.name)
+		for _, r := range s.Roots {
+			fmt.Fprintf(bw, "%s%s %g\n", m.name, promLabels(s, r.Root), m.value(r))
+		}
+	}
+	return bw.Flush()
+}
+
+// promLabels formats the label set of every metric. Tag keys are turned into valid
+// label names; a tag named root is overridden by the scan root. A non-empty scanRoot
+// adds the scan_root label of the per-root metrics.
+func promLabels(s RunSummary, scanRoot string) string {
+	set := map[string]string{}
+	for k, v := range s.Tags {
+		set[promLabelName(k)] = v
+	}
+	set["root"] = s.Root
+	if scanRoot != "" {
+		set["scan_root"] = scanRoot
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(set[name])
+		pairs[i] = fmt.Sprintf(`%s="%s"`, name, v)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// promLabelName replaces the characters Prometheus does not allow in label names.
+func promLabelName(key string) string {
+	b := []byte(key)
+	for i, c := range b {
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/actions"
+)
+
+// modeFilter leaves files out of the scan by their permission bits, for software trees
+// where executables of different packages must never be merged.
+type modeFilter struct {
+	skipExecutables bool // --skip-executables: any execute bit
+	regularOnly     bool // --only-regular-perms: also special bits and world-writable files
+}
+
+// active reports whether the filter leaves anything out.
+func (f modeFilter) active() bool {
+	return f.skipExecutables || f.regularOnly
+}
+
+// skip is the walker's Options.Skip. A world-writable file is left out under
+// --only-regular-perms because anyone could change every name of it once linked.
+func (f modeFilter) skip(path string, info os.FileInfo) bool {
+	mode := info.Mode()
+	if (f.skipExecutables || f.regularOnly) && mode.Perm()&0o111 != 0 {
+		return true
+	}
+	return f.regularOnly && (mode&actions.SpecialModes != 0 || mode.Perm()&0o002 != 0)
+}
+
+// chainSkip returns a Skip function leaving out what either a or b leaves out; either
+// may be nil.
+func chainSkip(a, b func(string, os.FileInfo) bool) func(string, os.FileInfo) bool {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return func(path string, info os.FileInfo) bool {
+		return a(path, info) || b(path, info)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fuseview"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// buildView lays out the scan root as it would look after the planned actions: files
+// that would be removed are left out unless all is set. Members of duplicate groups
+// carry user.dedupe.* extended attributes naming their group, action and original.
+func (d *Deduplicator) buildView(all bool) *fuseview.View {
+	planned := make(map[string]policy.Entry)
+	originals := make(map[string]string)
+	for _, hashString := range d.groupOrder {
+		decision := d.decisions[hashString]
+		for _, e := range decision.Entries {
+			planned[e.Path] = e
+			originals[e.Path] = decision.Original
+		}
+	}
+
+	v := fuseview.New()
+	for _, dir := range d.discoveredPaths {
+		if rel, err := filepath.Rel(d.rootDir, dir); err == nil {
+			v.AddDir(filepath.ToSlash(rel))
+		}
+	}
+	for _, path := range d.sortedPaths() {
+		rel, err := filepath.Rel(d.rootDir, path)
+		if err != nil {
+			continue
+		}
+		rec := d.fileMap[path]
+		f := fuseview.File{Source: path, Size: rec.Size, ModTime: rec.ModTime, Mode: rec.Mode, Uid: rec.Uid, Gid: rec.Gid}
+		if e, ok := planned[path]; ok {
+			if e.Action == policy.ActionRemove && !all {
+				continue
+			}
+			f.Xattrs = map[string]string{
+				"user.dedupe.group":    iphash.GroupID(rec.Sum),
+				"user.dedupe.action":   e.Action.String(),
+				"user.dedupe.original": originals[path],
+			}
+		}
+		v.AddFile(filepath.ToSlash(rel), f)
+	}
+	return v
+}
+
+// serveView mounts the planned view at the mount point until interrupted.
+func (d *Deduplicator) serveView(ctx context.Context) error {
+	log.Printf("Serving the planned tree read-only at %s; press Ctrl+C or unmount it to stop.", d.mountpoint)
+	return fuseview.Mount(ctx, d.buildView(d.mountAll), d.mountpoint, d.rootDir)
+}
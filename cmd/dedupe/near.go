@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/doctext"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/simhash"
+)
+
+// maxNearTextSize is the largest file fingerprinted for --near-text; bigger files are
+// rarely documents.
+const maxNearTextSize = 16 << 20
+
+// NearResult is the outcome of --near-text: clusters of documents whose text is
+// nearly identical. It is only reported; no action is ever planned from it.
+type NearResult struct {
+	Files  int         `json:"files"` // Distinct contents fingerprinted
+	Groups []NearGroup `json:"groups"`
+}
+
+// NearGroup is a cluster of documents, each within --near-distance of another member.
+type NearGroup struct {
+	Paths       []string `json:"paths"`        // One per distinct content, in path order
+	MaxDistance int      `json:"max_distance"` // Largest fingerprint distance between two members
+}
+
+// nearText fingerprints one copy of every distinct content with a --near-text
+// extension and clusters those within nearDistance bits of each other. Exact
+// duplicates are fingerprinted once, as they are already grouped.
+func (d *Deduplicator) nearText(ctx context.Context, numWorkers int) (*NearResult, error) {
+	paths := d.distinctPaths(func(path string, rec fswalk.FileRecord) bool {
+		return d.nearExts[strings.ToLower(filepath.Ext(path))] && rec.Size <= maxNearTextSize
+	})
+	log.Printf("Fingerprinting the text of %d documents...", len(paths))
+
+	fps := make([]uint64, len(paths))
+	ok := make([]bool, len(paths))
+	err := forEachWorker(ctx, len(paths), numWorkers, func(i int) {
+		fp, err := fingerprintFile(paths[i])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error reading text of %s: %v\n", paths[i], err)
+			return
+		}
+		fps[i], ok[i] = fp, true
+	})
+	if err != nil {
+		return nil, err
+	}
+	var docs []string
+	var sums []uint64
+	for i, path := range paths {
+		if ok[i] {
+			docs = append(docs, path)
+			sums = append(sums, fps[i])
+		}
+	}
+	return clusterNear(docs, sums, d.nearDistance), nil
+}
+
+// fingerprintFile returns the simhash of the text of the file at path, extracted
+// first from PDF and DOCX documents.
+func fingerprintFile(path string) (uint64, error) {
+	if doctext.Supported(path) {
+		text, err := doctext.Extract(path)
+		if err != nil {
+			return 0, err
+		}
+		return simhash.Fingerprint(strings.NewReader(text))
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return simhash.Fingerprint(f)
+}
+
+// clusterNear groups the documents whose fingerprints differ in at most maxDist bits,
+// transitively. Candidates are found by splitting fingerprints into maxDist+1 blocks:
+// two fingerprints within maxDist bits agree completely on at least one of them.
+func clusterNear(paths []string, fps []uint64, maxDist int) *NearResult {
+	res := &NearResult{Files: len(paths), Groups: []NearGroup{}}
+	parent := make([]int, len(paths))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	blocks := maxDist + 1
+	width := 64 / blocks
+	for b := 0; b < blocks; b++ {
+		shift := uint(b * width)
+		mask := uint64(1)<<uint(width) - 1
+		if b == blocks-1 {
+			mask = ^uint64(0) >> shift // The last block takes the remaining bits
+		}
+		buckets := make(map[uint64][]int)
+		for i, fp := range fps {
+			key := fp >> shift & mask
+			buckets[key] = append(buckets[key], i)
+		}
+		for _, idx := range buckets {
+			for x := 0; x < len(idx); x++ {
+				for y := x + 1; y < len(idx); y++ {
+					if simhash.Distance(fps[idx[x]], fps[idx[y]]) <= maxDist {
+						parent[find(idx[y])] = find(idx[x])
+					}
+				}
+			}
+		}
+	}
+	members := make(map[int][]int)
+	for i := range paths {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+	for _, idx := range members {
+		if len(idx) < 2 {
+			continue
+		}
+		g := NearGroup{}
+		for x, i := range idx {
+			g.Paths = append(g.Paths, paths[i])
+			for _, j := range idx[x+1:] {
+				if dist := simhash.Distance(fps[i], fps[j]); dist > g.MaxDistance {
+					g.MaxDistance = dist
+				}
+			}
+		}
+		sort.Strings(g.Paths)
+		res.Groups = append(res.Groups, g)
+	}
+	sort.Slice(res.Groups, func(i, j int) bool { return res.Groups[i].Paths[0] < res.Groups[j].Paths[0] })
+	return res
+}
+
+// reportNear prints the clusters of nearly identical documents.
+func (d *Deduplicator) reportNear() {
+	res := d.nearDups
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Nearly identical documents (report only)"))
+	for _, g := range res.Groups {
+		fmt.Fprintf(d.out, "%d documents, up to %d bits apart:\n", len(g.Paths), g.MaxDistance)
+		for _, p := range g.Paths {
+			fmt.Fprintf(d.out, "  %s\n", displayPath(p))
+		}
+	}
+	if len(res.Groups) == 0 {
+		fmt.Fprintf(d.out, "None of the %d documents compared are nearly identical.\n", res.Files)
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
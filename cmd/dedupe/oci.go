@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/ocilayout"
+)
+
+// OCIResult is the outcome of the oci command: files stored more than once across the
+// layers of the images in a layout or content store.
+type OCIResult struct {
+	Images int                `json:"images"`
+	Layers []*ocilayout.Layer `json:"layers"`
+	Files  int                `json:"files"`  // Regular files in all readable layers
+	Groups []OCIGroup         `json:"groups"` // Most wasted bytes first
+	Wasted int64              `json:"wasted_bytes"`
+}
+
+// OCIGroup is content stored in several layer entries.
+type OCIGroup struct {
+	Hash   string    `json:"hash"`
+	Size   int64     `json:"size"`
+	Wasted int64     `json:"wasted_bytes"` // Size times the copies beyond the first
+	Images []string  `json:"images"`       // Images holding any copy
+	Copies []OCICopy `json:"copies"`
+}
+
+// OCICopy is one layer entry of an OCIGroup.
+type OCICopy struct {
+	Layer string `json:"layer"`
+	Path  string `json:"path"`
+}
+
+// runOCI hashes the files of every layer below the root and reports duplicate content.
+// Each layer blob is read once, however many images share it, so only content that is
+// really stored twice is counted.
+func (d *Deduplicator) runOCI(ctx context.Context, numWorkers int) error {
+	store, err := ocilayout.Open(d.rootDir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Reading %d layers of %d images...", len(store.Layers), store.Images)
+	files, err := store.Files(ctx, d.algo, numWorkers)
+	if err != nil {
+		log.Println("Operation cancelled.")
+		return err
+	}
+	d.layerDups = groupLayerFiles(store, files)
+	for _, l := range store.Layers {
+		if l.Error != "" {
+			log.Printf("Warning: skipped layer %s: %s", l.Digest, l.Error)
+		}
+	}
+	if d.format == "json" {
+		if err := d.writeJSONReport(d.out, nil); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+		return nil
+	}
+	d.reportOCI()
+	return nil
+}
+
+// groupLayerFiles groups the layer files by content.
+func groupLayerFiles(store *ocilayout.Store, files []ocilayout.File) *OCIResult {
+	res := &OCIResult{Images: store.Images, Layers: store.Layers, Files: len(files), Groups: []OCIGroup{}}
+	images := make(map[string][]string)
+	for _, l := range store.Layers {
+		images[l.Digest] = l.Images
+	}
+	byHash := make(map[string][]ocilayout.File)
+	for _, f := range files {
+		if f.Size == 0 {
+			continue // Empty files share no storage
+		}
+		h := iphash.HashToString(f.Sum)
+		byHash[h] = append(byHash[h], f)
+	}
+	for h, fs := range byHash {
+		if len(fs) < 2 {
+			continue
+		}
+		sort.Slice(fs, func(i, j int) bool {
+			if fs[i].Layer != fs[j].Layer {
+				return fs[i].Layer < fs[j].Layer
+			}
+			return fs[i].Path < fs[j].Path
+		})
+		g := OCIGroup{Hash: h, Size: fs[0].Size, Wasted: fs[0].Size * int64(len(fs)-1)}
+		seen := make(map[string]bool)
+		for _, f := range fs {
+			g.Copies = append(g.Copies, OCICopy{Layer: f.Layer, Path: f.Path})
+			for _, img := range images[f.Layer] {
+				if !seen[img] {
+					seen[img] = true
+					g.Images = append(g.Images, img)
+				}
+			}
+		}
+		sort.Strings(g.Images)
+		res.Groups = append(res.Groups, g)
+		res.Wasted += g.Wasted
+	}
+	sort.Slice(res.Groups, func(i, j int) bool {
+		if res.Groups[i].Wasted != res.Groups[j].Wasted {
+			return res.Groups[i].Wasted > res.Groups[j].Wasted
+		}
+		return res.Groups[i].Hash < res.Groups[j].Hash
+	})
+	return res
+}
+
+// reportOCI prints the duplicate groups across layers and the totals.
+func (d *Deduplicator) reportOCI() {
+	res := d.layerDups
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Duplicates across image layers"))
+	for _, g := range res.Groups {
+		fmt.Fprintf(d.out, "%s, %d copies, %s wasted (%s)\n", formatSize(g.Size), len(g.Copies),
+			formatSize(g.Wasted), strings.Join(g.Images, ", "))
+		for _, c := range g.Copies {
+			fmt.Fprintf(d.out, "  %s  /%s\n", ocilayout.ShortDigest(c.Layer), displayPath(c.Path))
+		}
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+	skipped := 0
+	for _, l := range res.Layers {
+		if l.Error != "" {
+			skipped++
+		}
+	}
+	fmt.Fprintln(d.out, d.paint(ansiBold, fmt.Sprintf("%d images, %d layers (%d unreadable), %d files: %d duplicate groups, %s wasted",
+		res.Images, len(res.Layers), skipped, res.Files, len(res.Groups), formatSize(res.Wasted))))
+}
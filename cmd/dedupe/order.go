@@ -0,0 +1,60 @@
+package main
+
+import "sort"
+
+// sortedPaths returns the scanned paths in lexical order, so every pass over the
+// results sees them in the same order from run to run.
+func (d *Deduplicator) sortedPaths() []string {
+	paths := make([]string, 0, len(d.fileMap))
+	for path := range d.fileMap {
+		paths = append(paths, path)
+	}
+	sortStrings(paths)
+	return paths
+}
+
+// groupWaste is the number of bytes held by the extra copies of a duplicate group.
+func (d *Deduplicator) groupWaste(hashString string) int64 {
+	paths := d.fileByteMapDups[hashString]
+	if len(paths) == 0 {
+		return 0
+	}
+	return d.fileMap[paths[0]].Size * int64(len(paths)-1)
+}
+
+// sortGroups fixes the report order of the duplicate groups: most reclaimable bytes
+// first, then by hash. Member paths are sorted within each group.
+func (d *Deduplicator) sortGroups() {
+	d.groupOrder = d.groupOrder[:0]
+	for hashString := range d.fileByteMapDups {
+		d.groupOrder = append(d.groupOrder, hashString)
+	}
+	waste := make([]int64, len(d.groupOrder))
+	parallelChunks(len(d.groupOrder), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			sort.Strings(d.fileByteMapDups[d.groupOrder[i]])
+			waste[i] = d.groupWaste(d.groupOrder[i])
+		}
+	})
+	sort.Sort(byWaste{d.groupOrder, waste})
+}
+
+// byWaste orders group hashes by their precomputed waste, largest first, then by hash.
+type byWaste struct {
+	hashes []string
+	waste  []int64
+}
+
+func (b byWaste) Len() int { return len(b.hashes) }
+
+func (b byWaste) Less(i, j int) bool {
+	if b.waste[i] != b.waste[j] {
+		return b.waste[i] > b.waste[j]
+	}
+	return b.hashes[i] < b.hashes[j]
+}
+
+func (b byWaste) Swap(i, j int) {
+	b.hashes[i], b.hashes[j] = b.hashes[j], b.hashes[i]
+	b.waste[i], b.waste[j] = b.waste[j], b.waste[i]
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// overlaysIn returns the overlayfs mounts whose merged view or layers lie within one of
+// the scanned roots, with symlinks in their paths resolved: Docker, for one, lists its
+// lower layers through the short links of overlay2/l.
+func overlaysIn(overlays []fswalk.Overlay, roots []string) []fswalk.Overlay {
+	resolve := func(path string) string {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			return resolved
+		}
+		return path
+	}
+	within := func(path string) bool {
+		for _, root := range roots {
+			if isWithin(path, root) {
+				return true
+			}
+		}
+		return false
+	}
+	var found []fswalk.Overlay
+	for _, o := range overlays {
+		o.Mountpoint = resolve(o.Mountpoint)
+		if o.Upper != "" {
+			o.Upper = resolve(o.Upper)
+		}
+		if o.Work != "" {
+			o.Work = resolve(o.Work)
+		}
+		lower := make([]string, len(o.Lower))
+		for i, dir := range o.Lower {
+			lower[i] = resolve(dir)
+		}
+		o.Lower = lower
+		relevant := within(o.Mountpoint)
+		for _, layer := range o.Layers() {
+			relevant = relevant || within(layer)
+		}
+		if relevant {
+			found = append(found, o)
+		}
+	}
+	return found
+}
+
+// dropOverlayCopies removes from the fileMap the layer copies of files that were also
+// scanned through an overlay's merged view: both paths name the same stored file, which
+// would otherwise be reported as a duplicate of itself. The merged path is kept, since
+// changes made through it are what overlayfs supports. A layer copy is only dropped when
+// it is the topmost one holding the file and its digest matches the view's.
+func (d *Deduplicator) dropOverlayCopies() {
+	dropped := 0
+	for _, o := range d.overlays {
+		layers := o.Layers()
+		for path, rec := range d.fileMap {
+			if path == o.Mountpoint || !isWithin(path, o.Mountpoint) {
+				continue
+			}
+			rel, err := filepath.Rel(o.Mountpoint, path)
+			if err != nil {
+				continue
+			}
+			for _, layer := range layers {
+				stored := filepath.Join(layer, rel)
+				backing, ok := d.fileMap[stored]
+				if !ok {
+					if _, err := os.Lstat(stored); err == nil {
+						break // Held by a layer that was not scanned
+					}
+					continue
+				}
+				if backing.Size == rec.Size && bytes.Equal(backing.Sum, rec.Sum) {
+					delete(d.fileMap, stored)
+					dropped++
+				}
+				break
+			}
+		}
+	}
+	if dropped > 0 {
+		log.Printf("%d files seen both through an overlay mount and in its layers were counted once.", dropped)
+	}
+}
+
+// overlayLayerSkipper returns the walker's SkipDir for --overlay-upper-only: it leaves
+// out the merged views, lower layers and work directories of overlays, so only the
+// files written in their upper layers are scanned. A directory serving as the upper
+// layer of any overlay is always entered.
+func overlayLayerSkipper(overlays []fswalk.Overlay) func(string) bool {
+	upper := make(map[string]bool)
+	skip := make(map[string]bool)
+	for _, o := range overlays {
+		if o.Upper != "" {
+			upper[o.Upper] = true
+		}
+		skip[o.Mountpoint] = true
+		for _, dir := range o.Lower {
+			skip[dir] = true
+		}
+		if o.Work != "" {
+			skip[o.Work] = true
+		}
+	}
+	for dir := range upper {
+		delete(skip, dir)
+	}
+	return func(path string) bool {
+		return skip[path]
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// minChunk is the smallest number of items handed to a goroutine by parallelChunks;
+// smaller inputs are processed with fewer goroutines, down to one.
+const minChunk = 4096
+
+// shardCount is the number of shards the grouping and reporting passes are split into.
+func shardCount() int {
+	return runtime.GOMAXPROCS(0)
+}
+
+// parallelChunks splits n items into contiguous ranges and calls fn for each range
+// concurrently, returning when all calls have. fn must only write state owned by its
+// range.
+func parallelChunks(n int, fn func(lo, hi int)) {
+	k := shardCount()
+	if c := (n + minChunk - 1) / minChunk; c < k {
+		k = c
+	}
+	if k <= 1 {
+		fn(0, n)
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < k; i++ {
+		wg.Add(1)
+		go func(lo, hi int) {
+			defer wg.Done()
+			fn(lo, hi)
+		}(i*n/k, (i+1)*n/k)
+	}
+	wg.Wait()
+}
+
+// sortStrings sorts s in lexical order, sorting chunks concurrently and merging them.
+func sortStrings(s []string) {
+	k := shardCount()
+	if c := len(s) / minChunk; c < k {
+		k = c
+	}
+	if k <= 1 {
+		sort.Strings(s)
+		return
+	}
+	bounds := make([]int, k+1)
+	for i := range bounds {
+		bounds[i] = i * len(s) / k
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < k; i++ {
+		wg.Add(1)
+		go func(part []string) {
+			defer wg.Done()
+			sort.Strings(part)
+		}(s[bounds[i]:bounds[i+1]])
+	}
+	wg.Wait()
+
+	// Merge neighbouring runs pairwise until one run is left.
+	src, dst := s, make([]string, len(s))
+	for len(bounds) > 2 {
+		var next []int
+		for i := 0; i+1 < len(bounds); i += 2 {
+			next = append(next, bounds[i])
+			if i+2 >= len(bounds) {
+				copy(dst[bounds[i]:bounds[i+1]], src[bounds[i]:bounds[i+1]])
+				continue
+			}
+			wg.Add(1)
+			go func(lo, mid, hi int) {
+				defer wg.Done()
+				mergeStrings(dst[lo:hi], src[lo:mid], src[mid:hi])
+			}(bounds[i], bounds[i+1], bounds[i+2])
+		}
+		wg.Wait()
+		bounds = append(next, len(s))
+		src, dst = dst, src
+	}
+	if &src[0] != &s[0] {
+		copy(s, src)
+	}
+}
+
+// mergeStrings merges the sorted slices a and b into dst.
+func mergeStrings(dst, a, b []string) {
+	i, j := 0, 0
+	for k := range dst {
+		if j >= len(b) || (i < len(a) && a[i] <= b[j]) {
+			dst[k] = a[i]
+			i++
+		} else {
+			dst[k] = b[j]
+			j++
+		}
+	}
+}
+
+// forEachWorker calls fn for every index below n on numWorkers goroutines, for passes
+// that read files and so are bound by I/O rather than CPU. It stops handing out
+// indexes when ctx is cancelled and returns ctx.Err() once all calls have returned.
+func forEachWorker(ctx context.Context, n, numWorkers int, fn func(i int)) error {
+	var wg sync.WaitGroup
+	work := make(chan int)
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				fn(i)
+			}
+		}()
+	}
+feed:
+	for i := 0; i < n; i++ {
+		select {
+		case work <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return ctx.Err()
+}
+
+// distinctPaths returns one path, the first in order, per distinct content among the
+// scanned files keep accepts, in path order.
+func (d *Deduplicator) distinctPaths(keep func(path string, rec fswalk.FileRecord) bool) []string {
+	byHash := make(map[string]string)
+	for path, rec := range d.fileMap {
+		if !keep(path, rec) {
+			continue
+		}
+		h := iphash.HashToString(rec.Sum)
+		if p, ok := byHash[h]; !ok || path < p {
+			byHash[h] = path
+		}
+	}
+	paths := make([]string, 0, len(byHash))
+	for _, path := range byHash {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
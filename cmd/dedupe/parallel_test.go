@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// TestSortStrings checks that the chunked sort agrees with sort.Strings for inputs
+// split into several runs, including an odd number of them.
+func TestSortStrings(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 10, 3*minChunk + 7, 8 * minChunk} {
+		s := make([]string, n)
+		for i := range s {
+			s[i] = fmt.Sprintf("/r/%x", rnd.Int63())
+		}
+		want := append([]string(nil), s...)
+		sort.Strings(want)
+		sortStrings(s)
+		for i := range s {
+			if s[i] != want[i] {
+				t.Fatalf("sortStrings(%d) mismatch at %d. Got: %s, Want: %s", n, i, s[i], want[i])
+			}
+		}
+	}
+}
+
+// TestParallelChunks checks that every item is visited exactly once.
+func TestParallelChunks(t *testing.T) {
+	n := 5*minChunk + 3
+	seen := make([]int, n)
+	parallelChunks(n, func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			seen[i]++
+		}
+	})
+	for i, c := range seen {
+		if c != 1 {
+			t.Fatalf("Item %d visited %d times", i, c)
+		}
+	}
+}
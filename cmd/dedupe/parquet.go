@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/parquet"
+)
+
+// parquetColumns are the columns of the --export-parquet file index.
+var parquetColumns = []parquet.Column{
+	{Name: "path", Kind: parquet.String}, // Invalid UTF-8 replaced, as in the JSON report
+	{Name: "size", Kind: parquet.Int64},
+	{Name: "mtime", Kind: parquet.Timestamp},
+	{Name: "hash", Kind: parquet.String, Optional: true},        // Null for files never hashed, e.g. of a unique size
+	{Name: "group_id", Kind: parquet.String, Optional: true},    // Null for files outside duplicate groups
+	{Name: "path_base64", Kind: parquet.String, Optional: true}, // Exact bytes of a path that is not valid UTF-8
+}
+
+// writeParquet writes every scanned file as one row of a Parquet table, sorted by
+// path. The group_id matches the id of the file's group in the JSON report.
+func (d *Deduplicator) writeParquet(w io.Writer) error {
+	groups := make(map[string]string) // path -> group id
+	for hashString, decision := range d.decisions {
+		id := iphash.GroupID(d.groupRecord(hashString).Sum)
+		if decision.Original != "" {
+			groups[decision.Original] = id
+		}
+		for _, e := range decision.Entries {
+			groups[e.Path] = id
+		}
+	}
+	paths := make([]string, 0, len(d.fileMap))
+	for path := range d.fileMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	pw := parquet.NewWriter(w, parquetColumns)
+	for _, path := range paths {
+		rec := d.fileMap[path]
+		var hash, group, raw interface{}
+		if len(rec.Sum) > 0 {
+			hash = iphash.HashToString(rec.Sum)
+		}
+		if id, ok := groups[path]; ok {
+			group = id
+		}
+		if b64 := rawPath(path); b64 != "" {
+			raw = b64
+		}
+		if err := pw.Write([]interface{}{strings.ToValidUTF8(path, "\uFFFD"), rec.Size, rec.ModTime, hash, group, raw}); err != nil {
+			return err
+		}
+	}
+	return pw.Close()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// RootStats is the share of one root in a scan of several (--roots-from). Duplicate
+// groups are told apart by whether all their copies lie within the root or some lie in
+// another one.
+type RootStats struct {
+	Root            string `json:"root"`
+	Files           int    `json:"files"`
+	Bytes           int64  `json:"bytes"`
+	ContainedGroups int    `json:"contained_groups"`           // Duplicate groups with every copy in this root
+	CrossRootGroups int    `json:"cross_root_groups"`          // Duplicate groups with copies here and in another root
+	DuplicateFiles  int    `json:"duplicate_files"`            // Copies here other than their group's original
+	Reclaimable     int64  `json:"reclaimable_bytes_apparent"` // Freed here by the planned actions
+}
+
+// rootStats splits the results by scan root when several were walked. cross counts the
+// duplicate groups spanning more than one root; stats is nil for a single root.
+func (d *Deduplicator) rootStats() (stats []RootStats, cross int) {
+	roots := d.walkOpts.Roots
+	if len(roots) < 2 {
+		return nil, 0
+	}
+	index := make(map[string]int, len(roots))
+	stats = make([]RootStats, len(roots))
+	for i, root := range roots {
+		index[root] = i
+		stats[i].Root = root
+	}
+	// Roots never lie below one another, so the first one found going up is the only one.
+	rootOf := func(path string) int {
+		for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+			if i, ok := index[dir]; ok {
+				return i
+			}
+			if filepath.Dir(dir) == dir {
+				return -1
+			}
+		}
+	}
+	for path, rec := range d.fileMap {
+		if i := rootOf(path); i >= 0 {
+			stats[i].Files++
+			stats[i].Bytes += rec.Size
+		}
+	}
+	for hashString, paths := range d.fileByteMapDups {
+		original := paths[0]
+		decision, decided := d.decisions[hashString]
+		if decided {
+			original = decision.Original
+		}
+		in := make(map[int]bool)
+		for _, path := range paths {
+			i := rootOf(path)
+			if i < 0 {
+				continue
+			}
+			in[i] = true
+			if path != original {
+				stats[i].DuplicateFiles++
+			}
+		}
+		for i := range in {
+			if len(in) > 1 {
+				stats[i].CrossRootGroups++
+			} else {
+				stats[i].ContainedGroups++
+			}
+		}
+		if len(in) > 1 {
+			cross++
+		}
+		for _, e := range decision.Entries {
+			if e.Path == decision.Original || (e.Action != policy.ActionRemove && e.Action != policy.ActionLink && e.Action != policy.ActionReflink) {
+				continue
+			}
+			if i := rootOf(e.Path); i >= 0 {
+				stats[i].Reclaimable += d.fileMap[e.Path].Size
+			}
+		}
+	}
+	return stats, cross
+}
+
+// reportRoots prints the results of every root of a scan of several.
+func (d *Deduplicator) reportRoots() {
+	stats, cross := d.rootStats()
+	if stats == nil {
+		return
+	}
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Per root"))
+	for _, s := range stats {
+		fmt.Fprintf(d.out, "%s\n  %d files (%s), %d duplicate groups within the root, %d shared with other roots, %d duplicate copies, %s reclaimable\n",
+			d.paint(ansiBold, displayPath(s.Root)), s.Files, formatSize(s.Bytes), s.ContainedGroups, s.CrossRootGroups, s.DuplicateFiles, formatSize(s.Reclaimable))
+	}
+	fmt.Fprintf(d.out, "All %d roots: %d of %d duplicate groups span more than one root.\n", len(stats), cross, len(d.fileByteMapDups))
+	fmt.Fprintln(d.out, "-------------------------")
+}
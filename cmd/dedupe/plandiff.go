@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/schema"
+)
+
+// PlannedAction is one change a JSON report plans: a copy to remove, or to replace by
+// a link or reflink to its group's original.
+type PlannedAction struct {
+	Path     string `json:"path"`
+	Action   string `json:"action"` // remove, link or reflink
+	Original string `json:"original"`
+	Size     int64  `json:"size"`
+}
+
+// PlanChange is a copy both plans act on, but differently.
+type PlanChange struct {
+	Old PlannedAction `json:"old"`
+	New PlannedAction `json:"new"`
+}
+
+// PlanDiff is the outcome of plan diff: the planned actions that appeared, disappeared
+// or changed between two JSON reports, each in path order.
+type PlanDiff struct {
+	Old         string          `json:"old"`
+	New         string          `json:"new"`
+	Appeared    []PlannedAction `json:"appeared"`
+	Disappeared []PlannedAction `json:"disappeared"`
+	Changed     []PlanChange    `json:"changed"`
+	Unchanged   int             `json:"unchanged"`
+}
+
+// readPlan loads the planned actions of the JSON report at path, by the copy they act on.
+func readPlan(path string) (map[string]PlannedAction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r Report
+	if err := json.NewDecoder(f).Decode(&r); err != nil {
+		return nil, fmt.Errorf("%s is not a JSON report: %w", path, err)
+	}
+	if r.SchemaVersion != schema.Version {
+		return nil, fmt.Errorf("%s has schema version %d, want %d", path, r.SchemaVersion, schema.Version)
+	}
+	plan := make(map[string]PlannedAction)
+	for _, g := range r.Groups {
+		for _, f := range g.Files {
+			if f.Action == "remove" || f.Action == "link" || f.Action == "reflink" {
+				plan[f.Path] = PlannedAction{Path: f.Path, Action: f.Action, Original: g.Original, Size: g.Size}
+			}
+		}
+	}
+	return plan, nil
+}
+
+// diffPlans compares two plans. An action changed when the same copy gets another
+// action or another original.
+func diffPlans(old, cur map[string]PlannedAction) PlanDiff {
+	diff := PlanDiff{Appeared: []PlannedAction{}, Disappeared: []PlannedAction{}, Changed: []PlanChange{}}
+	for path, a := range cur {
+		o, ok := old[path]
+		switch {
+		case !ok:
+			diff.Appeared = append(diff.Appeared, a)
+		case o.Action != a.Action || o.Original != a.Original:
+			diff.Changed = append(diff.Changed, PlanChange{Old: o, New: a})
+		default:
+			diff.Unchanged++
+		}
+	}
+	for path, o := range old {
+		if _, ok := cur[path]; !ok {
+			diff.Disappeared = append(diff.Disappeared, o)
+		}
+	}
+	sort.Slice(diff.Appeared, func(i, j int) bool { return diff.Appeared[i].Path < diff.Appeared[j].Path })
+	sort.Slice(diff.Disappeared, func(i, j int) bool { return diff.Disappeared[i].Path < diff.Disappeared[j].Path })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].New.Path < diff.Changed[j].New.Path })
+	return diff
+}
+
+// runPlanDiff prints the difference between the plans of the JSON reports at oldPath
+// and newPath, as text or JSON, so recurring cleanups only need the changes reviewed.
+func runPlanDiff(oldPath, newPath, format string, out io.Writer) error {
+	old, err := readPlan(oldPath)
+	if err != nil {
+		return err
+	}
+	cur, err := readPlan(newPath)
+	if err != nil {
+		return err
+	}
+	diff := diffPlans(old, cur)
+	diff.Old, diff.New = oldPath, newPath
+	if format == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	}
+	line := func(mark string, a PlannedAction) {
+		fmt.Fprintf(out, "%s %-7s %10s  %s  (original %s)\n", mark, a.Action, formatSize(a.Size), displayPath(a.Path), displayPath(a.Original))
+	}
+	for _, a := range diff.Appeared {
+		line("+", a)
+	}
+	for _, a := range diff.Disappeared {
+		line("-", a)
+	}
+	for _, c := range diff.Changed {
+		line("~", c.New)
+		fmt.Fprintf(out, "  was %s (original %s)\n", c.Old.Action, displayPath(c.Old.Original))
+	}
+	fmt.Fprintf(out, "%d actions appeared, %d disappeared, %d changed, %d unchanged\n",
+		len(diff.Appeared), len(diff.Disappeared), len(diff.Changed), diff.Unchanged)
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// scanTotals holds the number and size of the files a scan will hash, as counted by
+// the metadata-only pre-pass; counted is set once the pre-pass has finished.
+type scanTotals struct {
+	counted atomic.Bool
+	files   atomic.Uint64
+	bytes   atomic.Uint64
+}
+
+// reset forgets the totals of an earlier run.
+func (t *scanTotals) reset() {
+	t.counted.Store(false)
+	t.files.Store(0)
+	t.bytes.Store(0)
+}
+
+// startPrecount counts the files below root in the background while they are hashed,
+// so the progress line can show a percentage and an estimated time remaining once the
+// count is known. The returned channel is closed when the count has finished or ctx
+// is done.
+func (d *Deduplicator) startPrecount(ctx context.Context, root string, numWorkers int) chan struct{} {
+	d.totals.reset()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		files, bytes, err := fswalk.Count(ctx, root, numWorkers, d.walkOpts)
+		if err != nil {
+			return
+		}
+		d.totals.files.Store(files)
+		d.totals.bytes.Store(bytes)
+		d.totals.counted.Store(true)
+	}()
+	return done
+}
+
+// progressEstimate describes how far hashing has got, e.g. ", 30% of 4.0 GiB, ETA
+// 2m10s", or returns "" while the pre-count has not finished.
+func (d *Deduplicator) progressEstimate(elapsed time.Duration) string {
+	if !d.totals.counted.Load() {
+		return ""
+	}
+	return estimate(d.walkStats.HashedBytes.Load(), d.totals.bytes.Load(), elapsed)
+}
+
+// estimate describes the share of total bytes hashed after elapsed, and the time
+// the rest takes at the same rate. Files that appeared after the count can push the
+// hashed bytes past the total; the share then stays at 100%.
+func estimate(hashed, total uint64, elapsed time.Duration) string {
+	if total == 0 {
+		return ""
+	}
+	if hashed > total {
+		hashed = total
+	}
+	s := fmt.Sprintf(", %d%% of %s", hashed*100/total, formatBytes(int64(total)))
+	if hashed > 0 && hashed < total {
+		eta := time.Duration(float64(elapsed) * float64(total-hashed) / float64(hashed))
+		s += ", ETA " + eta.Round(time.Second).String()
+	}
+	return s
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hooks"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// PruneResult is the outcome of the prune command: the backup generations below the
+// root, newest first, and the commands removing those that can go.
+type PruneResult struct {
+	Generations []Generation `json:"generations"`
+	Plan        []string     `json:"plan"`              // Shell commands, oldest generation first
+	Refused     string       `json:"refused,omitempty"` // Why no plan is given although generations are prunable
+}
+
+// Generation is one backup generation: a directory directly below the root, such as
+// rsnapshot's daily.0 or a dated snapshot directory.
+type Generation struct {
+	Path        string    `json:"path"`
+	Time        time.Time `json:"time"` // Modification time of the directory, which orders the generations
+	Files       int       `json:"files"`
+	Bytes       int64     `json:"bytes"`
+	UniqueFiles int       `json:"unique_files"` // Files whose content no newer generation holds
+	UniqueBytes int64     `json:"unique_bytes"`
+	Uncompared  int       `json:"uncompared"` // Entries not hashed: unreadable, skipped, excluded, special or symlinks
+	Prunable    bool      `json:"prunable"`
+}
+
+// pruneGenerations finds the generations whose every file is also held, by content,
+// by a newer generation. Removing all of them loses nothing: the content of each is
+// kept by a newer generation that is either kept or, being prunable itself, has its
+// content in a newer one again. The newest generation is never prunable, and neither
+// is an empty one or one holding anything the scan did not compare. No plan is given
+// when the walk had read errors or left anything out, since the files it missed may be
+// the only copies.
+func (d *Deduplicator) pruneGenerations() *PruneResult {
+	entries, err := os.ReadDir(d.rootDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading %s: %v\n", d.rootDir, err)
+	}
+	var gens []*Generation
+	byName := make(map[string]*Generation)
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		g := &Generation{Path: filepath.Join(d.rootDir, e.Name()), Time: info.ModTime()}
+		gens = append(gens, g)
+		byName[e.Name()] = g
+	}
+	// rsnapshot touches interval.0 when it completes, so directory times order
+	// rotated generations too; ties keep daily.0 before daily.1.
+	sort.Slice(gens, func(i, j int) bool {
+		if !gens[i].Time.Equal(gens[j].Time) {
+			return gens[i].Time.After(gens[j].Time)
+		}
+		return gens[i].Path < gens[j].Path
+	})
+
+	members := make(map[*Generation][]fswalk.FileRecord)
+	for path, rec := range d.fileMap {
+		rel, err := filepath.Rel(d.rootDir, path)
+		if err != nil {
+			continue
+		}
+		name, _, found := strings.Cut(rel, string(filepath.Separator))
+		g := byName[name]
+		if !found || g == nil {
+			continue // A file directly below the root belongs to no generation
+		}
+		g.Files++
+		g.Bytes += rec.Size
+		members[g] = append(members[g], rec)
+	}
+
+	res := &PruneResult{Generations: []Generation{}, Plan: []string{}}
+	newer := make(map[string]bool)
+	for i, g := range gens {
+		for _, rec := range members[g] {
+			if !newer[iphash.HashToString(rec.Sum)] {
+				g.UniqueFiles++
+				g.UniqueBytes += rec.Size
+			}
+		}
+		for _, rec := range members[g] {
+			newer[iphash.HashToString(rec.Sum)] = true
+		}
+		g.Uncompared = d.uncompared(g.Path)
+		g.Prunable = i > 0 && g.Files > 0 && g.UniqueFiles == 0 && g.Uncompared == 0
+		res.Generations = append(res.Generations, *g)
+	}
+	if res.Refused = d.walkIncomplete(); res.Refused != "" {
+		return res
+	}
+	for i := len(gens) - 1; i >= 0; i-- {
+		if gens[i].Prunable {
+			res.Plan = append(res.Plan, "rm -rf -- "+shellQuote(gens[i].Path))
+		}
+	}
+	return res
+}
+
+// uncompared counts the entries below dir that are not in the fileMap: files that
+// could not be read or were left out, special files, symlinks, and directories that
+// could not be listed.
+func (d *Deduplicator) uncompared(dir string) int {
+	n := 0
+	filepath.WalkDir(dir, func(path string, e os.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			n++
+		case e.IsDir():
+		default:
+			if _, ok := d.fileMap[path]; !ok {
+				n++
+			}
+		}
+		return nil
+	})
+	return n
+}
+
+// walkIncomplete describes what the walk missed or left out, or returns "" when it
+// hashed every entry it met.
+func (d *Deduplicator) walkIncomplete() string {
+	st := &d.walkStats
+	var missed []string
+	for _, c := range []struct {
+		n    uint64
+		what string
+	}{
+		{st.Errors(), "read errors"},
+		{st.PermErrors.Load(), "permission errors"},
+		{st.Special(), "special files or symlinks"},
+		{st.Excluded.Load() + st.ExcludedDirs.Load(), "excluded entries"},
+	} {
+		if c.n > 0 {
+			missed = append(missed, fmt.Sprintf("%d %s", c.n, c.what))
+		}
+	}
+	return strings.Join(missed, ", ")
+}
+
+// shellQuote quotes s for a POSIX shell. Names that are not printable get the $'...'
+// quoting of hooks.ShellQuote so the plan stays one command per line.
+func shellQuote(s string) string {
+	if !fswalk.PrintableName(s) {
+		return hooks.ShellQuote(s)
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// reportPrune lists the generations and the plan removing the prunable ones.
+func (d *Deduplicator) reportPrune() {
+	res := d.pruned
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Backup generations, newest first"))
+	for _, g := range res.Generations {
+		verdict := "keep"
+		if g.Prunable {
+			verdict = d.paint(ansiGreen, "prune")
+		}
+		fmt.Fprintf(d.out, "%-5s  %s  %6d files (%s), %d unique (%s)  %s\n", verdict, g.Time.Format("2006-01-02 15:04"),
+			g.Files, formatSize(g.Bytes), g.UniqueFiles, formatSize(g.UniqueBytes), displayPath(g.Path))
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+	if res.Refused != "" {
+		fmt.Fprintf(d.out, "No prune plan: the scan was incomplete (%s), so the generations may hold files it never compared.\n", res.Refused)
+		return
+	}
+	if len(res.Plan) == 0 {
+		fmt.Fprintln(d.out, "No generation can be pruned: each holds content no newer generation has.")
+		return
+	}
+	fmt.Fprintf(d.out, "%s\n", d.paint(ansiBold, fmt.Sprintf("Prune plan (%d generations; review before running):", len(res.Plan))))
+	for _, cmd := range res.Plan {
+		fmt.Fprintln(d.out, cmd)
+	}
+}
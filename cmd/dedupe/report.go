@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/actions"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/manifest"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/schema"
+)
+
+// Report is the JSON report written with --format json. Its fields are part of the
+// versioned schema printed by --schema.
+type Report struct {
+	SchemaVersion int              `json:"schema_version"`
+	Root          string           `json:"root"`
+	Groups        []ReportGroup    `json:"groups"`
+	TopDirs       []DirWaste       `json:"top_directories,omitempty"` // With --top-dirs
+	Stats         *ScanStats       `json:"stats,omitempty"`           // From the stats command
+	DiskUsage     []DirUsage       `json:"disk_usage,omitempty"`      // From the du command
+	WhatIf        []Savings        `json:"what_if,omitempty"`         // Without --apply
+	Simulation    *Simulation      `json:"simulation,omitempty"`      // With --simulate
+	Audit         *manifest.Result `json:"audit,omitempty"`           // From the audit command
+	Scrub         *ScrubResult     `json:"scrub,omitempty"`           // From the scrub command
+	Baseline      *BaselineResult  `json:"baseline,omitempty"`        // From index import
+	Import        *ImportResult    `json:"import,omitempty"`          // From the import command
+	Unique        *UniqueResult    `json:"unique,omitempty"`          // From the unique command
+	OCI           *OCIResult       `json:"oci,omitempty"`             // From the oci command
+	Prune         *PruneResult     `json:"prune,omitempty"`           // From the prune command
+	Chunks        *ChunkResult     `json:"chunks,omitempty"`          // From the chunks command
+	Symlinks      *SymlinkResult   `json:"symlinks,omitempty"`        // With --symlinks
+	NearText      *NearResult      `json:"near_text,omitempty"`       // With --near-text
+	Documents     *DocumentResult  `json:"documents,omitempty"`       // With --compare-documents
+	CaseCollide   *CaseResult      `json:"case_collisions,omitempty"` // With --case-collisions
+	Summary       RunSummary       `json:"summary"`
+}
+
+// ReportGroup is one duplicate group of the JSON report.
+type ReportGroup struct {
+	ID         string       `json:"id"`
+	Hash       string       `json:"hash"`
+	Size       int64        `json:"size"`
+	Confidence string       `json:"confidence"` // size-only, partial-hash, full-hash or byte-verified
+	Original   string       `json:"original"`
+	Files      []ReportFile `json:"files"`
+
+	OriginalBase64 string `json:"original_base64,omitempty"` // Exact bytes of an Original that is not valid UTF-8
+
+	// Details of the content and members, so consumers need not open or stat them.
+	ContentType     string    `json:"content_type"`
+	Extension       string    `json:"extension"`        // Most common lower-case extension, "" for none
+	ExtensionsAgree bool      `json:"extensions_agree"` // Every copy has that extension
+	OldestMTime     time.Time `json:"oldest_mtime"`
+	NewestMTime     time.Time `json:"newest_mtime"`
+}
+
+// ReportFile is one copy within a ReportGroup and the action planned for it.
+type ReportFile struct {
+	Path       string `json:"path"`
+	PathBase64 string `json:"path_base64,omitempty"` // Exact bytes of a Path that is not valid UTF-8
+	Action     string `json:"action"`
+	Rule       string `json:"rule,omitempty"`
+}
+
+// rawPath returns the base64 encoding of a path that is not valid UTF-8, which JSON
+// strings can only hold with replacement characters, and "" for any other path.
+func rawPath(p string) string {
+	if utf8.ValidString(p) {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString([]byte(p))
+}
+
+// displayPath returns p as the text report prints it: unchanged when printable, else
+// quoted with Go escapes, so crafted names can neither break report lines nor send
+// escape sequences to the terminal.
+func displayPath(p string) string {
+	if fswalk.PrintableName(p) {
+		return p
+	}
+	return strconv.Quote(p)
+}
+
+// groupRecord returns the first member of a duplicate group, whose digest and size
+// stand for the group's. The original cannot: it is empty when every member matched
+// a skip rule.
+func (d *Deduplicator) groupRecord(hashString string) fswalk.FileRecord {
+	return d.fileMap[d.fileByteMapDups[hashString][0]]
+}
+
+// buildReport assembles the JSON report from the planned decisions, in report order.
+func (d *Deduplicator) buildReport(runErr error) Report {
+	r := Report{
+		SchemaVersion: schema.Version,
+		Root:          d.rootDir,
+		Groups:        make([]ReportGroup, len(d.groupOrder)),
+		Summary:       d.summary(runErr),
+	}
+	parallelChunks(len(d.groupOrder), func(lo, hi int) {
+		for i := lo; i < hi; i++ {
+			hashString := d.groupOrder[i]
+			decision := d.decisions[hashString]
+			rec := d.groupRecord(hashString)
+			g := ReportGroup{
+				ID:         iphash.GroupID(rec.Sum),
+				Hash:       hashString,
+				Size:       rec.Size,
+				Confidence: d.groupConfidence(hashString),
+				Original:   decision.Original,
+
+				OriginalBase64: rawPath(decision.Original),
+			}
+			d.describeGroup(&g, hashString)
+			for _, e := range decision.Entries {
+				g.Files = append(g.Files, ReportFile{Path: e.Path, PathBase64: rawPath(e.Path), Action: e.Action.String(), Rule: e.Rule})
+			}
+			r.Groups[i] = g
+		}
+	})
+	if d.topDirsN > 0 {
+		r.TopDirs = d.topDirs(d.topDirsN)
+	}
+	if !d.apply {
+		r.WhatIf = d.whatIf()
+	}
+	if d.simulateRun {
+		sim := d.simulate()
+		r.Simulation = &sim
+	}
+	r.Audit = d.audit
+	r.Scrub = d.scrubbed
+	r.Baseline = d.baselineCmp
+	r.Import = d.imported
+	r.Unique = d.uniqued
+	r.OCI = d.layerDups
+	r.Prune = d.pruned
+	r.Chunks = d.chunked
+	r.Symlinks = d.linked
+	r.NearText = d.nearDups
+	r.Documents = d.documents
+	r.CaseCollide = d.collisions
+	if d.statsMode {
+		st := d.scanStats(time.Now())
+		r.Stats = &st
+	}
+	if d.duMode {
+		r.DiskUsage = diskUsage(d.rootDir, d.fileMap, d.duDepth)
+	}
+	return r
+}
+
+// writePaths writes the path of every duplicate the plan removes or replaces, in
+// report order, each followed by sep. Originals and kept or skipped copies are left
+// out, so the list can be handed to other deletion tools. Paths containing sep would
+// read back as several paths and are left out with a warning.
+func (d *Deduplicator) writePaths(w io.Writer, sep byte) error {
+	bw := bufio.NewWriter(w)
+	unlisted := 0
+	for _, hashString := range d.groupOrder {
+		for _, op := range actions.Plan(d.decisions[hashString], d.fileMap) {
+			if strings.IndexByte(op.File.Path, sep) >= 0 {
+				unlisted++
+				continue
+			}
+			bw.WriteString(op.File.Path)
+			bw.WriteByte(sep)
+		}
+	}
+	if unlisted > 0 {
+		log.Printf("Warning: %d paths containing line breaks left out of the list; use --null to include them.", unlisted)
+	}
+	return bw.Flush()
+}
+
+// writeJSONReport writes the JSON report to w.
+func (d *Deduplicator) writeJSONReport(w io.Writer, runErr error) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d.buildReport(runErr))
+}
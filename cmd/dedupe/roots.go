@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// readRoots reads the scan roots listed in path for --roots-from, one per line or, with
+// nul, each ended by a NUL byte as find -print0 writes them. Relative roots are taken
+// relative to the working directory. Every root must be a directory; roots lying
+// below another listed root are dropped, since that one's walk covers them.
+func readRoots(path string, nul bool) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sep := []byte{'\n'}
+	if nul {
+		sep = []byte{0}
+	}
+	var roots []string
+	for _, line := range bytes.Split(data, sep) {
+		if !nul {
+			line = bytes.TrimSuffix(line, []byte{'\r'})
+		}
+		if len(line) == 0 {
+			continue
+		}
+		root, err := filepath.Abs(string(line))
+		if err != nil {
+			return nil, err
+		}
+		info, err := os.Stat(root)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("%s is not a directory", root)
+		}
+		roots = append(roots, root)
+	}
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("%s lists no roots", path)
+	}
+	return outermostDirs(roots), nil
+}
+
+// outermostDirs returns the sorted directories of dirs that do not lie below another
+// one, without repeats.
+func outermostDirs(dirs []string) []string {
+	// Sorted component by component, so every directory follows right after the
+	// ones it lies below: "/a/b", "/a/b/c", "/a/b c".
+	key := func(dir string) string { return strings.ReplaceAll(dir, string(filepath.Separator), "\x00") }
+	sort.Slice(dirs, func(i, j int) bool { return key(dirs[i]) < key(dirs[j]) })
+	var kept []string
+	for _, dir := range dirs {
+		if n := len(kept); n > 0 && isWithin(dir, kept[n-1]) {
+			continue
+		}
+		kept = append(kept, dir)
+	}
+	return kept
+}
+
+// scanRoots returns the directories the run was asked to scan: the --roots-from
+// entries, or else the root. Actions and the sandbox are confined to these; the common
+// parent of several roots only names the report root, and may be as wide as "/".
+func (d *Deduplicator) scanRoots() []string {
+	if len(d.walkOpts.Roots) > 0 {
+		return append([]string(nil), d.walkOpts.Roots...)
+	}
+	return []string{d.rootDir}
+}
+
+// rootFilesystems identifies the filesystem of every scan root. Roots that cannot be
+// identified are left out with a warning.
+func rootFilesystems(roots []string) map[string]fswalk.FSInfo {
+	infos := make(map[string]fswalk.FSInfo, len(roots))
+	for _, root := range roots {
+		info, err := fswalk.FilesystemType(root)
+		if err != nil {
+			log.Printf("Warning: cannot identify filesystem of %s: %v", root, err)
+			continue
+		}
+		infos[root] = info
+	}
+	return infos
+}
+
+// rootOf returns the scan root path lies below, or the root when it lies below none.
+func (d *Deduplicator) rootOf(path string) string {
+	for _, root := range d.walkOpts.Roots {
+		if isWithin(path, root) {
+			return root
+		}
+	}
+	return d.rootDir
+}
+
+// fsOf returns the filesystem type of the scan root holding path. Without a type
+// identified for that root, it is the one of the run.
+func (d *Deduplicator) fsOf(path string) string {
+	if info, ok := d.rootFS[d.rootOf(path)]; ok {
+		return info.Name
+	}
+	return d.fsName
+}
+
+// isWithin reports whether path is dir or lies below it.
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// commonDir returns the deepest directory that holds every one of dirs, which serves
+// as the scan root when several roots are walked.
+func commonDir(dirs []string) string {
+	common := dirs[0]
+	for _, dir := range dirs[1:] {
+		for !isWithin(dir, common) {
+			parent := filepath.Dir(common)
+			if parent == common {
+				break
+			}
+			common = parent
+		}
+	}
+	return common
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/sandbox"
+)
+
+// enterSandbox confines the process to read access on the scan roots and, when applying,
+// write access to the roots and the backup directory. Files opened before this point
+// (config, audit log) remain usable.
+func (d *Deduplicator) enterSandbox() error {
+	p, err := d.sandboxPolicy()
+	if err != nil {
+		return err
+	}
+	return sandbox.Restrict(p)
+}
+
+// sandboxPolicy lists the paths the run needs, creating the directories it will write
+// to. It fails for features that cannot work inside the sandbox.
+func (d *Deduplicator) sandboxPolicy() (sandbox.Policy, error) {
+	if d.groupCmd != nil {
+		return sandbox.Policy{}, errors.New("--exec-per-group cannot run inside the sandbox")
+	}
+	if d.mountpoint != "" {
+		return sandbox.Policy{}, errors.New("mount cannot run inside the sandbox, which forbids mounting")
+	}
+	for _, h := range d.runHooks {
+		if h.Command != "" {
+			return sandbox.Policy{}, errors.New("command hooks cannot run inside the sandbox, use webhooks instead")
+		}
+	}
+
+	p := sandbox.Policy{Read: d.scanRoots()}
+	if d.importSrc != "" {
+		p.Read = append(p.Read, d.importSrc)
+	}
+	if d.cachePath != "" {
+		// The cache is replaced through a temporary file next to it.
+		p.Write = append(p.Write, filepath.Dir(d.cachePath))
+	}
+	if d.metricsPath != "" {
+		// Written when the run ends, a .prom file through a temporary file next to it.
+		p.Write = append(p.Write, filepath.Dir(d.metricsPath))
+	}
+	if d.heartbeatPath != "" {
+		p.Write = append(p.Write, filepath.Dir(d.heartbeatPath))
+	}
+	if d.controlPath != "" {
+		// Binding the socket creates it, and a stale one is removed first.
+		p.Write = append(p.Write, filepath.Dir(d.controlPath))
+	}
+	if d.apply && d.target != "" {
+		if err := os.MkdirAll(d.target, 0o755); err != nil {
+			return sandbox.Policy{}, err
+		}
+		p.Write = append(p.Write, d.target)
+	}
+	if d.apply {
+		p.Write = append(p.Write, d.scanRoots()...)
+		if d.executor.Backup != nil {
+			if err := os.MkdirAll(d.executor.Backup.Dir, 0o700); err != nil {
+				return sandbox.Policy{}, err
+			}
+			p.Write = append(p.Write, d.executor.Backup.Dir)
+		}
+	}
+	return p, nil
+}
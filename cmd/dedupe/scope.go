@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// scopeFilter restricts the walk to the subtrees of the root matching --only patterns.
+// A pattern is a path relative to the root whose components may use filepath.Match
+// wildcards, e.g. projects/*/src. Directories off the way to every pattern are never
+// read.
+type scopeFilter struct {
+	root     string
+	patterns [][]string // Components of each pattern
+}
+
+// newScopeFilter parses the --only patterns for a scan of root.
+func newScopeFilter(root string, only []string) (*scopeFilter, error) {
+	f := &scopeFilter{root: root}
+	sep := string(filepath.Separator)
+	for _, p := range only {
+		clean := filepath.Clean(filepath.FromSlash(p))
+		if filepath.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, ".."+sep) {
+			return nil, fmt.Errorf("--only %q must name subtrees below the root", p)
+		}
+		parts := strings.Split(clean, sep)
+		for _, part := range parts {
+			if _, err := filepath.Match(part, ""); err != nil {
+				return nil, fmt.Errorf("--only %q: %v", p, err)
+			}
+		}
+		f.patterns = append(f.patterns, parts)
+	}
+	return f, nil
+}
+
+// match reports whether path lies inside a subtree matching a pattern, or is the
+// root or a directory on the way to one.
+func (f *scopeFilter) match(path string) (inside, onPath bool) {
+	rel, err := filepath.Rel(f.root, path)
+	if err != nil || !isWithin(path, f.root) {
+		return false, false
+	}
+	var parts []string
+	if rel != "." {
+		parts = strings.Split(rel, string(filepath.Separator))
+	}
+	for _, pat := range f.patterns {
+		n := len(parts)
+		if n > len(pat) {
+			n = len(pat)
+		}
+		matched := true
+		for i := 0; i < n && matched; i++ {
+			matched, _ = filepath.Match(pat[i], parts[i])
+		}
+		if !matched {
+			continue
+		}
+		if len(parts) >= len(pat) {
+			return true, true
+		}
+		onPath = true
+	}
+	return false, onPath
+}
+
+// skipDir is the walker's Options.SkipDir: it prunes directories that neither lie in
+// a matching subtree nor lead to one.
+func (f *scopeFilter) skipDir(path string) bool {
+	_, onPath := f.match(path)
+	return !onPath
+}
+
+// skip is the walker's Options.Skip: it leaves out the files of directories that only
+// lead to a matching subtree, such as those directly in the root.
+func (f *scopeFilter) skip(path string, info os.FileInfo) bool {
+	inside, _ := f.match(path)
+	return !inside
+}
+
+// chainSkipDir returns a SkipDir function leaving out what either a or b leaves out;
+// either may be nil.
+func chainSkipDir(a, b func(string) bool) func(string) bool {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	return func(path string) bool {
+		return a(path) || b(path)
+	}
+}
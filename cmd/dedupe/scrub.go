@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/hashcache"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// ScrubResult is the outcome of the scrub command.
+type ScrubResult struct {
+	Checked  int             `json:"checked"`
+	Verified int             `json:"verified"` // Content still matches the cached digest
+	Modified int             `json:"modified"` // Size or modification time changed: re-cached
+	Missing  int             `json:"missing"`  // No longer exists
+	Errors   int             `json:"errors"`   // Could not be read
+	Corrupt  []ScrubMismatch `json:"corrupt"`  // Unchanged metadata but different content
+}
+
+// ScrubMismatch is a file whose content no longer matches its cached digest although
+// its size and modification time did not change: suspected bit rot.
+type ScrubMismatch struct {
+	Path         string    `json:"path"`
+	Expected     string    `json:"expected"`
+	Actual       string    `json:"actual"`
+	LastVerified time.Time `json:"last_verified"`
+}
+
+// scrubSelection picks the cached files below the root to re-read: those not verified
+// for at least age, least recently verified first, at most percent of all cached files
+// below the root. Successive runs therefore rotate through the whole cache.
+func (d *Deduplicator) scrubSelection(now time.Time) []string {
+	prefix := strings.TrimSuffix(d.rootDir, string(filepath.Separator)) + string(filepath.Separator)
+	var under []string
+	verified := make(map[string]time.Time)
+	for _, p := range d.cache.Paths() {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		under = append(under, p)
+		e, _ := d.cache.Get(p)
+		verified[p] = e.Verified
+	}
+	var due []string
+	for _, p := range under {
+		if !verified[p].After(now.Add(-d.scrubAge)) {
+			due = append(due, p)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return verified[due[i]].Before(verified[due[j]]) })
+	limit := int(math.Ceil(float64(len(under)) * float64(d.scrubPercent) / 100))
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due
+}
+
+// runScrub re-hashes the selected cached files and compares them with their cached
+// digests. It fails when any file is suspected to be corrupt.
+func (d *Deduplicator) runScrub(ctx context.Context, numWorkers int) error {
+	paths := d.scrubSelection(time.Now())
+	log.Printf("Scrubbing %d of %d cached files...", len(paths), d.cache.Len())
+
+	res := &ScrubResult{Corrupt: []ScrubMismatch{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan string)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				d.scrubFile(p, res, &mu)
+			}
+		}()
+	}
+feed:
+	for _, p := range paths {
+		select {
+		case work <- p:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	sort.Slice(res.Corrupt, func(i, j int) bool { return res.Corrupt[i].Path < res.Corrupt[j].Path })
+	d.scrubbed = res
+
+	var err error
+	if ctx.Err() != nil {
+		log.Println("Operation cancelled.")
+		err = ctx.Err()
+	} else if len(res.Corrupt) > 0 {
+		err = fmt.Errorf("scrub found %d files with unexpected content", len(res.Corrupt))
+	}
+	if d.format == "json" {
+		if werr := d.writeJSONReport(d.out, err); werr != nil {
+			return fmt.Errorf("failed to write report: %w", werr)
+		}
+	} else {
+		d.reportScrub()
+	}
+	return err
+}
+
+// scrubFile checks one cached file and records the outcome in res.
+func (d *Deduplicator) scrubFile(path string, res *ScrubResult, mu *sync.Mutex) {
+	e, _ := d.cache.Get(path)
+	info, err := os.Stat(path)
+	var sum iphash.HashBytes
+	if err == nil {
+		sum, err = d.hashFunc(path)
+	}
+	now := time.Now()
+
+	mu.Lock()
+	defer mu.Unlock()
+	res.Checked++
+	switch {
+	case os.IsNotExist(err):
+		res.Missing++
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "Error hashing file %s: %v\n", path, err)
+		res.Errors++
+	case !e.Fresh(info):
+		// Legitimately rewritten since it was cached.
+		res.Modified++
+		d.cache.Put(path, hashcache.Entry{Size: info.Size(), ModTime: info.ModTime(), Sum: sum, Verified: now})
+	case iphash.HashToString(sum) != iphash.HashToString(e.Sum):
+		// The cached digest stays: it is the last known good content.
+		res.Corrupt = append(res.Corrupt, ScrubMismatch{
+			Path:         path,
+			Expected:     iphash.HashToString(e.Sum),
+			Actual:       iphash.HashToString(sum),
+			LastVerified: e.Verified,
+		})
+	default:
+		res.Verified++
+		e.Verified = now
+		d.cache.Put(path, e)
+	}
+}
+
+// reportScrub prints suspected corruption and the scrub totals.
+func (d *Deduplicator) reportScrub() {
+	res := d.scrubbed
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Scrub"))
+	for _, m := range res.Corrupt {
+		fmt.Fprintf(d.out, "%s  %s (expected %s, got %s; last verified %s)\n", d.paint(ansiRed, "CORRUPT"),
+			displayPath(m.Path), m.Expected, m.Actual, m.LastVerified.Format(time.RFC3339))
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+	fmt.Fprintln(d.out, d.paint(ansiBold, fmt.Sprintf("%d checked: %d verified, %d corrupt, %d modified, %d missing, %d unreadable",
+		res.Checked, res.Verified, len(res.Corrupt), res.Modified, res.Missing, res.Errors)))
+}
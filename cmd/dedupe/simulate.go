@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/actions"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// Simulation models the filesystems after the planned actions without touching them.
+type Simulation struct {
+	Devices  []DeviceState `json:"devices"`
+	Links    []LinkState   `json:"links"`             // Originals that would gain hard links, most first
+	Failures int           `json:"expected_failures"` // Links that would cross devices
+}
+
+// DeviceState is the projected usage of one filesystem.
+type DeviceState struct {
+	Device      uint64 `json:"device"`
+	Path        string `json:"path"` // A scanned directory on the device
+	FilesBefore int    `json:"files_before"`
+	FilesAfter  int    `json:"files_after"`
+	Freed       int64  `json:"bytes_freed"`
+	FreeBefore  uint64 `json:"free_bytes_before"` // Zero where free space cannot be queried
+	FreeAfter   uint64 `json:"free_bytes_after"`
+}
+
+// LinkState is the projected link count of an original that duplicates are linked to.
+type LinkState struct {
+	Path   string `json:"path"`
+	Before uint64 `json:"nlink_before"`
+	After  uint64 `json:"nlink_after"`
+}
+
+// simulate applies the planned operations to a model of the scanned inodes. A file's
+// data is freed once its last name is removed or replaced; a link adds a name to the
+// original; a clone adds an independent file sharing the original's blocks.
+func (d *Deduplicator) simulate() Simulation {
+	var sim Simulation
+	devices := make(map[uint64]*DeviceState)
+	for _, path := range d.sortedPaths() {
+		rec := d.fileMap[path]
+		dev := devices[rec.Dev]
+		if dev == nil {
+			dev = &DeviceState{Device: rec.Dev, Path: filepath.Dir(path)}
+			devices[rec.Dev] = dev
+		}
+		dev.FilesBefore++
+		dev.FilesAfter++
+	}
+
+	names := make(map[inodeKey]uint64) // Remaining names of each inode
+	links := make(map[string]*LinkState)
+	dropName := func(path string) {
+		file := d.fileMap[path]
+		k := d.inodeOf(file)
+		if _, ok := names[k]; !ok {
+			names[k] = file.Nlink
+			if names[k] == 0 || k.path != "" {
+				names[k] = 1
+			}
+		}
+		names[k]--
+		if names[k] == 0 {
+			devices[file.Dev].Freed += file.Alloc
+		}
+	}
+	for _, hashString := range d.groupOrder {
+		decision := d.decisions[hashString]
+		original := d.fileMap[decision.Original]
+		for _, e := range decision.Entries {
+			if e.Path == decision.Original {
+				continue
+			}
+			file := d.fileMap[e.Path]
+			action := e.Action
+			if action == policy.ActionLink && d.executor.PreferReflink && reflinkFilesystems[d.fsOf(e.Path)] {
+				action = policy.ActionReflink
+			}
+			switch action {
+			case policy.ActionRemove:
+				dropName(e.Path)
+				devices[file.Dev].FilesAfter--
+			case policy.ActionLink, policy.ActionReflink:
+				if file.Dev != original.Dev {
+					sim.Failures++
+					continue
+				}
+				if d.inodeOf(file) == d.inodeOf(original) {
+					continue // Already the same file
+				}
+				dropName(e.Path)
+				if action == policy.ActionLink {
+					l := links[original.Path]
+					if l == nil {
+						l = &LinkState{Path: original.Path, Before: original.Nlink, After: original.Nlink}
+						links[original.Path] = l
+					}
+					l.After++
+				}
+			}
+		}
+	}
+
+	for _, dev := range devices {
+		if free, err := actions.FreeSpace(dev.Path); err == nil {
+			dev.FreeBefore = free
+			dev.FreeAfter = free + uint64(dev.Freed)
+		}
+		sim.Devices = append(sim.Devices, *dev)
+	}
+	sort.Slice(sim.Devices, func(i, j int) bool { return sim.Devices[i].Device < sim.Devices[j].Device })
+	for _, l := range links {
+		sim.Links = append(sim.Links, *l)
+	}
+	sort.Slice(sim.Links, func(i, j int) bool {
+		if sim.Links[i].After != sim.Links[j].After {
+			return sim.Links[i].After > sim.Links[j].After
+		}
+		return sim.Links[i].Path < sim.Links[j].Path
+	})
+	return sim
+}
+
+// reportSimulation prints the projected state of each filesystem and the originals
+// with the most resulting hard links.
+func (d *Deduplicator) reportSimulation() {
+	sim := d.simulate()
+	fmt.Fprintln(d.out, "\nSimulated state after the planned actions\n-------------------------")
+	for _, dev := range sim.Devices {
+		fmt.Fprintf(d.out, "device %d (%s): %d -> %d files, %s freed", dev.Device, displayPath(dev.Path), dev.FilesBefore, dev.FilesAfter, formatSize(dev.Freed))
+		if dev.FreeBefore > 0 {
+			fmt.Fprintf(d.out, ", free space %s -> %s", formatSize(int64(dev.FreeBefore)), formatSize(int64(dev.FreeAfter)))
+		}
+		fmt.Fprintln(d.out)
+	}
+	const shown = 10
+	for i, l := range sim.Links {
+		if i == shown {
+			fmt.Fprintf(d.out, "... %d more originals gain links\n", len(sim.Links)-shown)
+			break
+		}
+		fmt.Fprintf(d.out, "nlink %d -> %d  %s\n", l.Before, l.After, displayPath(l.Path))
+	}
+	if sim.Failures > 0 {
+		fmt.Fprintf(d.out, "%d links would fail: duplicate and original are on different devices\n", sim.Failures)
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScanStats are the distributions printed by the stats command.
+type ScanStats struct {
+	Sizes      []StatRow `json:"size_buckets"`
+	Extensions []StatRow `json:"extensions"` // By bytes, largest first, at most maxExtensions
+	DupAges    []StatRow `json:"duplicate_ages"`
+}
+
+// StatRow counts all scanned files and the duplicate copies among them in one bucket.
+// Every copy except a group's original counts as a duplicate.
+type StatRow struct {
+	Label    string `json:"label"`
+	Files    int    `json:"files"`
+	Bytes    int64  `json:"bytes"`
+	DupFiles int    `json:"duplicate_files"`
+	DupBytes int64  `json:"duplicate_bytes"`
+}
+
+// maxExtensions caps the extension breakdown; the rest is summed as "(other)".
+const maxExtensions = 20
+
+// sizeBuckets are the upper bounds (exclusive) of the size histogram.
+var sizeBuckets = []struct {
+	label string
+	limit int64
+}{
+	{"empty", 1}, {"< 4 KiB", 4 << 10}, {"< 64 KiB", 64 << 10}, {"< 1 MiB", 1 << 20},
+	{"< 16 MiB", 16 << 20}, {"< 256 MiB", 256 << 20}, {"< 4 GiB", 4 << 30}, {">= 4 GiB", 1<<63 - 1},
+}
+
+// ageBuckets are the upper bounds (exclusive) of the modification age histogram.
+var ageBuckets = []struct {
+	label string
+	limit time.Duration
+}{
+	{"< 1 day", 24 * time.Hour}, {"< 1 week", 7 * 24 * time.Hour}, {"< 30 days", 30 * 24 * time.Hour},
+	{"< 1 year", 365 * 24 * time.Hour}, {"< 5 years", 5 * 365 * 24 * time.Hour}, {">= 5 years", 1<<63 - 1},
+}
+
+// add counts one file of the given size into r.
+func (r *StatRow) add(size int64, dup bool) {
+	r.Files++
+	r.Bytes += size
+	if dup {
+		r.DupFiles++
+		r.DupBytes += size
+	}
+}
+
+// scanStats computes the distributions over every scanned file.
+func (d *Deduplicator) scanStats(now time.Time) ScanStats {
+	dups := make(map[string]bool)
+	for _, decision := range d.decisions {
+		for _, e := range decision.Entries {
+			if e.Path != decision.Original {
+				dups[e.Path] = true
+			}
+		}
+	}
+
+	var st ScanStats
+	for _, b := range sizeBuckets {
+		st.Sizes = append(st.Sizes, StatRow{Label: b.label})
+	}
+	for _, b := range ageBuckets {
+		st.DupAges = append(st.DupAges, StatRow{Label: b.label})
+	}
+	exts := make(map[string]*StatRow)
+	for path, rec := range d.fileMap {
+		dup := dups[path]
+		for i, b := range sizeBuckets {
+			if rec.Size < b.limit {
+				st.Sizes[i].add(rec.Size, dup)
+				break
+			}
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if ext == "" {
+			ext = "(none)"
+		}
+		if exts[ext] == nil {
+			exts[ext] = &StatRow{Label: ext}
+		}
+		exts[ext].add(rec.Size, dup)
+		if dup {
+			age := now.Sub(rec.ModTime)
+			for i, b := range ageBuckets {
+				if age < b.limit {
+					st.DupAges[i].add(rec.Size, true)
+					break
+				}
+			}
+		}
+	}
+
+	for _, r := range exts {
+		st.Extensions = append(st.Extensions, *r)
+	}
+	sort.Slice(st.Extensions, func(i, j int) bool {
+		a, b := st.Extensions[i], st.Extensions[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Label < b.Label
+	})
+	if len(st.Extensions) > maxExtensions {
+		other := StatRow{Label: "(other)"}
+		for _, r := range st.Extensions[maxExtensions:] {
+			other.Files += r.Files
+			other.Bytes += r.Bytes
+			other.DupFiles += r.DupFiles
+			other.DupBytes += r.DupBytes
+		}
+		st.Extensions = append(st.Extensions[:maxExtensions], other)
+	}
+	return st
+}
+
+// reportStats prints the distributions as tables. The last column is the duplicate
+// share of each bucket's bytes, or for the age table the bucket's share of all duplicates.
+func (d *Deduplicator) reportStats(st ScanStats) {
+	var dupTotal int64
+	for _, r := range st.DupAges {
+		dupTotal += r.DupBytes
+	}
+	table := func(title string, rows []StatRow, total int64) {
+		fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, title))
+		fmt.Fprintf(d.out, "%-12s %9s %12s %9s %12s %7s\n", "", "files", "size", "dups", "dup size", "dup %")
+		for _, r := range rows {
+			ratio, of := 0.0, r.Bytes
+			if total > 0 {
+				of = total
+			}
+			if of > 0 {
+				ratio = 100 * float64(r.DupBytes) / float64(of)
+			}
+			fmt.Fprintf(d.out, "%-12s %9d %12s %9d %12s %6.1f%%\n", r.Label, r.Files, formatSize(r.Bytes), r.DupFiles, formatSize(r.DupBytes), ratio)
+		}
+	}
+	table("File sizes", st.Sizes, 0)
+	table("Extensions", st.Extensions, 0)
+	table("Age of duplicates (last modification)", st.DupAges, dupTotal)
+	fmt.Fprintln(d.out, "-------------------------")
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// Hashing strategies an ExtStrategy can select.
+const (
+	strategyFull  = "full"
+	strategyQuick = "quick"
+	strategySkip  = "skip"
+)
+
+// quickSample is the length of each of the three samples read for a quick digest.
+const quickSample = 1 << 20
+
+// ExtStrategy overrides how files with the given extensions are hashed, e.g. videos
+// sampled above 1 GiB or disk images skipped. The first entry matching a file's
+// extension and size decides; files no entry matches are hashed in full.
+type ExtStrategy struct {
+	Extensions []string `json:"extensions"`           // Including the dot, e.g. ".mkv"; case-insensitive
+	Strategy   string   `json:"strategy"`             // full, quick or skip
+	MinSize    int64    `json:"min_size,omitempty"`   // Only files at least this many bytes large
+	NoConfirm  bool     `json:"no_confirm,omitempty"` // Quick: leave candidates unconfirmed (partial-hash groups)
+}
+
+// hashStrategies applies the ExtStrategy entries of the config to the walk and hashing.
+type hashStrategies struct {
+	specs []ExtStrategy   // Extensions lower-cased
+	algo  string          // For quick digests
+	full  fswalk.HashFunc // Hashes files in full; set by wrap
+
+	mu    sync.Mutex
+	quick map[string]bool // Paths given a quick digest
+}
+
+// newHashStrategies validates the config entries.
+func newHashStrategies(specs []ExtStrategy, algo string) (*hashStrategies, error) {
+	s := &hashStrategies{algo: algo, quick: make(map[string]bool)}
+	for i, spec := range specs {
+		switch spec.Strategy {
+		case strategyFull, strategyQuick, strategySkip:
+		default:
+			return nil, fmt.Errorf("extensions entry %d: unknown strategy %q (use full, quick or skip)", i+1, spec.Strategy)
+		}
+		if len(spec.Extensions) == 0 {
+			return nil, fmt.Errorf("extensions entry %d: no extensions listed", i+1)
+		}
+		exts := make([]string, len(spec.Extensions))
+		for j, ext := range spec.Extensions {
+			if !strings.HasPrefix(ext, ".") {
+				return nil, fmt.Errorf("extensions entry %d: %q must start with a dot", i+1, ext)
+			}
+			exts[j] = strings.ToLower(ext)
+		}
+		spec.Extensions = exts
+		s.specs = append(s.specs, spec)
+	}
+	return s, nil
+}
+
+// match returns the entry deciding how a file of the given path and size is hashed,
+// or nil when it is hashed in full by default.
+func (s *hashStrategies) match(path string, size int64) *ExtStrategy {
+	ext := strings.ToLower(filepath.Ext(path))
+	for i, spec := range s.specs {
+		if size < spec.MinSize {
+			continue
+		}
+		for _, e := range spec.Extensions {
+			if e == ext {
+				return &s.specs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// strategy returns how a file of the given path and size is hashed.
+func (s *hashStrategies) strategy(path string, size int64) string {
+	if spec := s.match(path, size); spec != nil {
+		return spec.Strategy
+	}
+	return strategyFull
+}
+
+// usesQuick reports whether any entry selects quick digests.
+func (s *hashStrategies) usesQuick() bool {
+	for _, spec := range s.specs {
+		if spec.Strategy == strategyQuick {
+			return true
+		}
+	}
+	return false
+}
+
+// skip is the walker's Options.Skip.
+func (s *hashStrategies) skip(path string, info os.FileInfo) bool {
+	return s.strategy(path, info.Size()) == strategySkip
+}
+
+// wrap returns a HashFunc that gives files selected for quick hashing a sample digest
+// and hashes all others with full.
+func (s *hashStrategies) wrap(full fswalk.HashFunc) fswalk.HashFunc {
+	s.full = full
+	return func(path string) (iphash.HashBytes, error) {
+		info, err := os.Stat(path)
+		if err != nil || s.strategy(path, info.Size()) != strategyQuick {
+			return full(path)
+		}
+		h, err := iphash.New(s.algo)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := iphash.GetFileSampleHash(path, h, quickSample)
+		if err == nil {
+			s.mu.Lock()
+			s.quick[path] = true
+			s.mu.Unlock()
+		}
+		return sum, err
+	}
+}
+
+// confirmQuick hashes in full every quick-hashed file that could duplicate another:
+// one that shares its digest with another quick-hashed file, or whose size a file
+// hashed in full shares, since the two kinds of digest never compare equal. Only a
+// file whose samples differ from those of every other quick-hashed file of its size,
+// and whose size no fully hashed file has, keeps its quick digest, as do the files of
+// entries with NoConfirm.
+func (d *Deduplicator) confirmQuick(ctx context.Context, numWorkers int) error {
+	s := d.strategies
+	fullSizes := make(map[int64]bool)
+	for path, rec := range d.fileMap {
+		if !s.quick[path] {
+			fullSizes[rec.Size] = true
+		}
+	}
+	byHash := make(map[string][]string)
+	var paths []string
+	for path := range s.quick {
+		if rec, ok := d.fileMap[path]; ok {
+			if spec := s.match(path, rec.Size); spec != nil && spec.NoConfirm {
+				continue
+			}
+			if fullSizes[rec.Size] {
+				paths = append(paths, path)
+				continue
+			}
+			h := iphash.HashToString(rec.Sum)
+			byHash[h] = append(byHash[h], path)
+		}
+	}
+	for _, ps := range byHash {
+		if len(ps) > 1 {
+			paths = append(paths, ps...)
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	log.Printf("Confirming %d quick-hashed candidates with a full hash...", len(paths))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan string)
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range work {
+				sum, err := s.full(p)
+				mu.Lock()
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error hashing file %s: %v\n", p, err)
+					d.walkStats.HashErrors.Add(1)
+					delete(d.fileMap, p)
+				} else {
+					rec := d.fileMap[p]
+					rec.Sum = sum
+					d.fileMap[p] = rec
+					delete(s.quick, p)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, p := range paths {
+		select {
+		case work <- p:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return ctx.Err()
+}
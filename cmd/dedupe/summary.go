@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/schema"
+)
+
+// RunSummary is the JSON document passed to run hooks on stdin or as a webhook body,
+// and the summary section of the JSON report.
+type RunSummary struct {
+	SchemaVersion   int               `json:"schema_version"`
+	Status          string            `json:"status"` // success, failure or cancelled
+	Error           string            `json:"error,omitempty"`
+	Root            string            `json:"root"`
+	Tags            map[string]string `json:"tags,omitempty"`
+	Started         time.Time         `json:"started"`
+	Finished        time.Time         `json:"finished"`
+	FilesScanned    int               `json:"files_scanned"`
+	UniqueHashes    int               `json:"unique_hashes"`
+	DuplicateGroups int               `json:"duplicate_groups"`
+	DuplicateFiles  int               `json:"duplicate_files"`
+	Directories     int               `json:"directories"`
+	SpecialFiles    uint64            `json:"special_files_skipped"`
+	HashErrors      uint64            `json:"hash_errors"`
+	PermErrors      uint64            `json:"permission_errors_skipped"`
+	ReclaimApparent int64             `json:"reclaimable_bytes_apparent"`
+	ReclaimAlloc    int64             `json:"reclaimable_bytes_allocated"`
+	ActionsApplied  int               `json:"actions_applied"`
+	ActionsFailed   int               `json:"actions_failed"`
+	ActionsDeferred int               `json:"actions_deferred,omitempty"` // Left for later runs by --max-actions
+	Reclaimed       int64             `json:"reclaimed_bytes"`            // Apparent size of the duplicates removed or linked
+	Timings         PhaseTimings      `json:"timings"`
+	CrossRootGroups int               `json:"cross_root_groups,omitempty"` // Duplicate groups spanning several roots
+	Roots           []RootStats       `json:"roots,omitempty"`             // Per root, when several were scanned
+}
+
+// summary collects the outcome of a run.
+func (d *Deduplicator) summary(runErr error) RunSummary {
+	s := RunSummary{
+		SchemaVersion:   schema.Version,
+		Status:          "success",
+		Root:            d.rootDir,
+		Tags:            d.tags,
+		Started:         d.started,
+		Finished:        time.Now(),
+		FilesScanned:    len(d.fileMap),
+		UniqueHashes:    len(d.fileByteMap),
+		DuplicateGroups: len(d.fileByteMapDups),
+		Directories:     len(d.discoveredPaths),
+		SpecialFiles:    d.walkStats.Special(),
+		HashErrors:      d.walkStats.HashErrors.Load(),
+		PermErrors:      d.walkStats.PermErrors.Load(),
+		ActionsApplied:  d.actionsDone,
+		ActionsFailed:   d.actionsFailed,
+		ActionsDeferred: d.actionsDeferred,
+		Reclaimed:       d.reclaimed,
+		Timings:         d.phases.timings(d.walkStats.HashedBytes.Load()),
+	}
+	s.ReclaimApparent, s.ReclaimAlloc, _ = d.reclaimable()
+	s.Roots, s.CrossRootGroups = d.rootStats()
+	for _, paths := range d.fileByteMapDups {
+		s.DuplicateFiles += len(paths) - 1
+	}
+	if runErr != nil {
+		s.Status = "failure"
+		if errors.Is(runErr, context.Canceled) || errors.Is(runErr, context.DeadlineExceeded) {
+			s.Status = "cancelled"
+		}
+		s.Error = runErr.Error()
+	}
+	return s
+}
+
+// notifyHooks passes the run summary to every configured hook whose trigger matches.
+// Hook failures are logged but never change the outcome of the run.
+func (d *Deduplicator) notifyHooks(s RunSummary) {
+	if len(d.runHooks) == 0 {
+		return
+	}
+	payload, err := json.Marshal(s)
+	if err != nil {
+		log.Printf("Failed to encode run summary: %v", err)
+		return
+	}
+	success := s.Status == "success"
+	for _, h := range d.runHooks {
+		if !h.Fires(success) {
+			continue
+		}
+		// The run context may already be cancelled; hooks still deserve a chance to report that.
+		if err := h.Notify(context.Background(), payload); err != nil {
+			log.Printf("Run hook failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// SymlinkResult is the outcome of --symlinks: symbolic links grouped by the content
+// they point at, and links whose target does not exist.
+type SymlinkResult struct {
+	Groups   []SymlinkGroup `json:"groups"`
+	Dangling []Symlink      `json:"dangling"`
+}
+
+// SymlinkGroup is a set of links whose targets hold identical content, whether or not
+// they resolve to the same file.
+type SymlinkGroup struct {
+	Hash  string    `json:"hash"`
+	Size  int64     `json:"size"`
+	Links []Symlink `json:"links"`
+}
+
+// Symlink is one symbolic link and its target as stored in the link.
+type Symlink struct {
+	Path   string `json:"path"`
+	Target string `json:"target"`
+}
+
+// symlinkSet collects the symbolic links found by the walk.
+type symlinkSet struct {
+	mu    sync.Mutex
+	paths []string
+}
+
+// add is the walker's Options.OnSymlink.
+func (s *symlinkSet) add(path string) {
+	s.mu.Lock()
+	s.paths = append(s.paths, path)
+	s.mu.Unlock()
+}
+
+// groupSymlinks resolves the links found by the walk and groups those pointing at
+// regular files by content. Targets hashed during the scan reuse its digest; others,
+// e.g. outside the root, are hashed here. Links to directories are ignored.
+func (d *Deduplicator) groupSymlinks() *SymlinkResult {
+	res := &SymlinkResult{Groups: []SymlinkGroup{}, Dangling: []Symlink{}}
+	byHash := make(map[string]*SymlinkGroup)
+	paths := d.symlinks.paths
+	sort.Strings(paths)
+	for _, path := range paths {
+		target, err := os.Readlink(path)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		link := Symlink{Path: path, Target: target}
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			res.Dangling = append(res.Dangling, link)
+			continue
+		}
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		if !info.Mode().IsRegular() {
+			continue
+		}
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		sum := d.fileMap[resolved].Sum
+		if sum == nil {
+			if sum, err = d.hashFunc(resolved); err != nil {
+				log.Printf("Warning: failed to hash the target of %s: %v", path, err)
+				continue
+			}
+		}
+		h := iphash.HashToString(sum)
+		g := byHash[h]
+		if g == nil {
+			g = &SymlinkGroup{Hash: h, Size: info.Size()}
+			byHash[h] = g
+		}
+		g.Links = append(g.Links, link)
+	}
+	for _, g := range byHash {
+		if len(g.Links) > 1 {
+			res.Groups = append(res.Groups, *g)
+		}
+	}
+	// Links are sorted, so groups come in the order of their first link.
+	sort.Slice(res.Groups, func(i, j int) bool { return res.Groups[i].Links[0].Path < res.Groups[j].Links[0].Path })
+	return res
+}
+
+// reportSymlinks prints the symlink groups and dangling links.
+func (d *Deduplicator) reportSymlinks() {
+	res := d.linked
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Symlinks pointing at identical content"))
+	for _, g := range res.Groups {
+		fmt.Fprintf(d.out, "Content %s (%s):\n", g.Hash, formatSize(g.Size))
+		for _, l := range g.Links {
+			fmt.Fprintf(d.out, "  %s -> %s\n", displayPath(l.Path), displayPath(l.Target))
+		}
+	}
+	if len(res.Groups) == 0 {
+		fmt.Fprintln(d.out, "No two symlinks point at identical content.")
+	}
+	if len(res.Dangling) > 0 {
+		fmt.Fprintf(d.out, "%s\n", d.paint(ansiBold, fmt.Sprintf("Dangling symlinks (%d):", len(res.Dangling))))
+		for _, l := range res.Dangling {
+			fmt.Fprintf(d.out, "  %s -> %s\n", displayPath(l.Path), displayPath(l.Target))
+		}
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// phaseTimes records where the time of a run went. Walking and hashing overlap: the
+// walk ends once every directory is listed, hashing once the last file is digested.
+type phaseTimes struct {
+	walk    atomic.Int64 // Nanoseconds; set from the walker's goroutine
+	hash    time.Duration
+	group   time.Duration // Grouping, byte verification and planning
+	actions time.Duration
+	busy    atomic.Int64 // Nanoseconds spent in the hash function, summed over workers
+	workers int
+}
+
+// PhaseTimings is the timing breakdown in the run summary.
+type PhaseTimings struct {
+	WalkSeconds    float64 `json:"walk_seconds"`
+	HashSeconds    float64 `json:"hash_seconds"`
+	GroupSeconds   float64 `json:"group_seconds"`
+	ActionsSeconds float64 `json:"actions_seconds"`
+	BytesHashed    uint64  `json:"bytes_hashed"`
+	Throughput     float64 `json:"bytes_per_second"`
+	Workers        int     `json:"workers"`
+	Utilization    float64 `json:"worker_utilization"` // Share of the workers' hashing time spent in the hash function
+}
+
+// timeHashing wraps hash to add the time spent in it to the busy time.
+func (p *phaseTimes) timeHashing(hash fswalk.HashFunc) fswalk.HashFunc {
+	return func(path string) (iphash.HashBytes, error) {
+		started := time.Now()
+		defer func() { p.busy.Add(int64(time.Since(started))) }()
+		return hash(path)
+	}
+}
+
+// timings summarizes the phases; bytes is the total size of the files hashed.
+func (p *phaseTimes) timings(bytes uint64) PhaseTimings {
+	t := PhaseTimings{
+		WalkSeconds:    time.Duration(p.walk.Load()).Seconds(),
+		HashSeconds:    p.hash.Seconds(),
+		GroupSeconds:   p.group.Seconds(),
+		ActionsSeconds: p.actions.Seconds(),
+		BytesHashed:    bytes,
+		Workers:        p.workers,
+	}
+	if p.hash > 0 {
+		t.Throughput = float64(bytes) / p.hash.Seconds()
+		if p.workers > 0 {
+			t.Utilization = float64(p.busy.Load()) / float64(p.hash) / float64(p.workers)
+			if t.Utilization > 1 {
+				t.Utilization = 1 // Timer granularity
+			}
+		}
+	}
+	return t
+}
+
+// String renders the breakdown for the text summary. Actions are left out until they
+// have run: the text summary is printed before them.
+func (t PhaseTimings) String() string {
+	sec := func(s float64) time.Duration {
+		return time.Duration(s * float64(time.Second)).Round(time.Millisecond)
+	}
+	phases := fmt.Sprintf("walk %s, hash %s, group %s", sec(t.WalkSeconds), sec(t.HashSeconds), sec(t.GroupSeconds))
+	if t.ActionsSeconds > 0 {
+		phases += fmt.Sprintf(", actions %s", sec(t.ActionsSeconds))
+	}
+	return fmt.Sprintf("%s; %s hashed at %s/s; workers: %d, %.0f%% busy",
+		phases, formatBytes(int64(t.BytesHashed)), formatBytes(int64(t.Throughput)), t.Workers, t.Utilization*100)
+}
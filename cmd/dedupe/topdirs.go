@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// DirWaste is the number of duplicate bytes found in one directory: the extra copies
+// in the directory itself (direct) and anywhere below it (recursive).
+type DirWaste struct {
+	Path      string `json:"path"`
+	Direct    int64  `json:"direct_bytes"`
+	Recursive int64  `json:"recursive_bytes"`
+	Files     int    `json:"files"` // Duplicate copies below the directory
+}
+
+// topDirs ranks the directories below the root by recursive duplicate bytes, largest
+// first, and returns at most n. Every copy except a group's original counts as waste.
+func (d *Deduplicator) topDirs(n int) []DirWaste {
+	dirs := make(map[string]*DirWaste)
+	for _, hashString := range d.groupOrder {
+		decision := d.decisions[hashString]
+		for _, e := range decision.Entries {
+			if e.Path == decision.Original {
+				continue
+			}
+			size := d.fileMap[e.Path].Size
+			dir := filepath.Dir(e.Path)
+			for direct := true; ; direct = false {
+				w := dirs[dir]
+				if w == nil {
+					w = &DirWaste{Path: dir}
+					dirs[dir] = w
+				}
+				if direct {
+					w.Direct += size
+				}
+				w.Recursive += size
+				w.Files++
+				parent := filepath.Dir(dir)
+				if dir == d.rootDir || parent == dir {
+					break
+				}
+				dir = parent
+			}
+		}
+	}
+	delete(dirs, d.rootDir) // Always holds everything
+
+	ranked := make([]DirWaste, 0, len(dirs))
+	for _, w := range dirs {
+		ranked = append(ranked, *w)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Recursive != ranked[j].Recursive {
+			return ranked[i].Recursive > ranked[j].Recursive
+		}
+		return ranked[i].Path < ranked[j].Path
+	})
+	if len(ranked) > n {
+		ranked = ranked[:n]
+	}
+	return ranked
+}
+
+// reportTopDirs prints the directories holding the most duplicate bytes.
+func (d *Deduplicator) reportTopDirs() {
+	fmt.Fprintln(d.out, "\nTop directories by duplicate bytes\n-------------------------")
+	ranked := d.topDirs(d.topDirsN)
+	if len(ranked) == 0 {
+		fmt.Fprintln(d.out, "No duplicates below the root.")
+	}
+	var total int64
+	for _, hashString := range d.groupOrder {
+		total += d.groupWaste(hashString)
+	}
+	for _, w := range ranked {
+		share := 100 * float64(w.Recursive) / float64(total)
+		fmt.Fprintf(d.out, "%5.1f%%  %10s  (%s directly, %d files)  %s\n",
+			share, formatSize(w.Recursive), formatSize(w.Direct), w.Files, d.paint(ansiBold, displayPath(w.Path)))
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
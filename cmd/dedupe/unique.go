@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/actions"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/manifest"
+)
+
+// UniqueResult is the outcome of the unique command.
+type UniqueResult struct {
+	Target  string       `json:"target"`
+	Linked  bool         `json:"linked"` // Hard link farm instead of copies
+	CAS     bool         `json:"cas"`    // Content-addressed objects/ layout
+	Files   []ImportFile `json:"files"`
+	Bytes   int64        `json:"bytes"`
+	Present int          `json:"present"` // Already in the target from an earlier run
+	Failed  int          `json:"failed"`
+}
+
+// planUnique picks one file per unique content: the kept original of each
+// duplicate group, or the only copy. Each goes to its path relative to the root below
+// the target, so the target mirrors the layout of the chosen copies, or with --cas to
+// objects/<first two hex digits>/<rest of the digest>.
+func (d *Deduplicator) planUnique() *UniqueResult {
+	res := &UniqueResult{Target: d.target, Linked: d.linkFarm, CAS: d.cas, Files: []ImportFile{}}
+	targetPrefix := d.target + string(filepath.Separator)
+	for _, path := range d.sortedPaths() {
+		if strings.HasPrefix(path, targetPrefix) {
+			continue // Output of an earlier run inside the root
+		}
+		rec := d.fileMap[path]
+		h := fmt.Sprintf("%x", rec.Sum)
+		if decision, ok := d.decisions[h]; ok && decision.Original != path {
+			continue
+		}
+		rel, err := filepath.Rel(d.rootDir, path)
+		if err != nil {
+			continue
+		}
+		if d.cas {
+			rel = filepath.Join("objects", h[:2], h[2:])
+		}
+		res.Files = append(res.Files, ImportFile{Source: path, Dest: filepath.Join(d.target, rel), Size: rec.Size})
+		res.Bytes += rec.Size
+	}
+	return res
+}
+
+// runUnique plans the consolidation and, with --apply, materializes it.
+func (d *Deduplicator) runUnique(ctx context.Context) error {
+	res := d.planUnique()
+	d.uniqued = res
+	if !d.apply {
+		return nil
+	}
+	for _, f := range res.Files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := os.Lstat(f.Dest); err == nil {
+			res.Present++
+			continue
+		}
+		var err error
+		if d.linkFarm {
+			err = actions.IngestLink(f.Source, f.Dest)
+		} else {
+			err = actions.Ingest(f.Source, f.Dest)
+		}
+		if err != nil {
+			log.Printf("Consolidation failed: %v", err)
+			res.Failed++
+		}
+	}
+	if res.Failed > 0 {
+		return fmt.Errorf("%d files could not be written", res.Failed)
+	}
+	if d.cas {
+		return d.writeCASManifest()
+	}
+	return nil
+}
+
+// writeCASManifest maps every scanned path, duplicates included, to its digest and
+// thereby to its object, in a hashdeep manifest next to objects/.
+func (d *Deduplicator) writeCASManifest() error {
+	targetPrefix := d.target + string(filepath.Separator)
+	files := make(map[string]fswalk.FileRecord, len(d.fileMap))
+	for path, rec := range d.fileMap {
+		if !strings.HasPrefix(path, targetPrefix) {
+			files[path] = rec
+		}
+	}
+	f, err := os.Create(filepath.Join(d.target, "manifest.txt"))
+	if err != nil {
+		return fmt.Errorf("failed to create CAS manifest: %w", err)
+	}
+	if err := manifest.Write(f, d.algo, d.rootDir, files); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write CAS manifest: %w", err)
+	}
+	return f.Close()
+}
+
+// reportUnique prints the consolidation totals.
+func (d *Deduplicator) reportUnique() {
+	res := d.uniqued
+	how, verb := "copies", "would be written"
+	if res.Linked {
+		how = "hard links"
+	}
+	if res.CAS {
+		how += " in objects/ with manifest.txt"
+	}
+	if d.apply {
+		verb = "written"
+	}
+	fmt.Fprintf(d.out, "\n%s\n-------------------------\n", d.paint(ansiBold, "Unique files in "+res.Target))
+	fmt.Fprintf(d.out, "%d unique files (%s) %s as %s", len(res.Files), formatSize(res.Bytes), verb, how)
+	if res.Present > 0 {
+		fmt.Fprintf(d.out, ", %d already present", res.Present)
+	}
+	if res.Failed > 0 {
+		fmt.Fprintf(d.out, ", %s", d.paint(ansiRed, fmt.Sprintf("%d failed", res.Failed)))
+	}
+	fmt.Fprintln(d.out)
+	fmt.Fprintln(d.out, "-------------------------")
+}
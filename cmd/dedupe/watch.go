@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// watch repeats the run every interval until ctx is done, as a polling watcher that
+// works on any filesystem, including NFS and SMB. With a hash cache a pass only reads
+// files added or changed since an earlier one; the rest costs a stat each. A failed
+// pass is logged and the next one is still made. Interruption while waiting for the
+// next pass ends the watch without error.
+func (d *Deduplicator) watch(ctx context.Context, numWorkers int, every time.Duration) error {
+	for pass := 1; ; pass++ {
+		err := d.Run(ctx, numWorkers)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.cachePath != "" {
+			// Saved after every pass so a killed watcher loses at most one pass.
+			if cerr := d.cache.Save(d.cachePath); cerr != nil {
+				log.Printf("Warning: %v", cerr)
+			}
+		}
+		summary := d.summary(err)
+		d.passDone(pass, summary)
+		if line, jerr := json.Marshal(summary); jerr == nil {
+			log.Printf("SUMMARY %s", line)
+		}
+		if err != nil {
+			log.Printf("Pass %d failed: %v", pass, err)
+		}
+		d.setPhase(phaseWaiting, "Waiting: pass %d done, next at %s", pass, time.Now().Add(every).Format(time.Kitchen))
+		log.Printf("Pass %d done; scanning again in %s.", pass, every)
+		select {
+		case <-time.After(every):
+		case <-ctx.Done():
+			return nil
+		}
+		d.reset()
+	}
+}
+
+// reset drops the results of a run so the next --watch pass starts afresh.
+func (d *Deduplicator) reset() {
+	d.fileMap = make(map[string]fswalk.FileRecord)
+	d.fileByteMap = make(map[string]string)
+	d.fileByteMapDups = make(map[string][]string)
+	d.decisions = make(map[string]policy.Decision)
+	d.verified = make(map[string]bool)
+	d.groupOrder = nil
+	d.discoveredPaths = []string{}
+	d.walkStats.Reset()
+	d.filesFoundCount.Store(0)
+	d.filesHashedCount.Store(0)
+	d.actionsDone, d.actionsFailed, d.linkLimited, d.actionsDeferred = 0, 0, 0, 0
+	d.reclaimed = 0
+	d.rules.Now = time.Now() // Age conditions are relative to each pass
+	if d.strategies != nil {
+		d.strategies.quick = make(map[string]bool)
+	}
+}
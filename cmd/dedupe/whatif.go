@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// Savings is the projected outcome of applying one strategy to every duplicate copy.
+type Savings struct {
+	Strategy    string `json:"strategy"` // remove, link or reflink
+	Files       int    `json:"files"`    // Copies the strategy would replace
+	Bytes       int64  `json:"bytes"`    // Allocated bytes freed
+	CrossDevice int    `json:"cross_device"`
+	Supported   bool   `json:"supported"` // False when no scan root's filesystem can do it
+}
+
+// reflinkFilesystems support copy-on-write clones between files.
+var reflinkFilesystems = map[string]bool{"btrfs": true, "xfs": true, "apfs": true, "bcachefs": true, "zfs": true, "ocfs2": true}
+
+// inodeKey identifies a file's data; paths without inode information get their own key.
+type inodeKey struct {
+	dev, ino uint64
+	path     string
+}
+
+// whatIf projects the savings of removing, hard linking and reflinking every copy
+// except each group's original. Links and clones cannot cross devices, and a copy
+// whose inode is also the original's or has names outside the group frees nothing.
+func (d *Deduplicator) whatIf() []Savings {
+	remove := Savings{Strategy: "remove", Supported: true}
+	link := Savings{Strategy: "link", Supported: true}
+	reflink := Savings{Strategy: "reflink"}
+	for _, root := range d.scanRoots() {
+		reflink.Supported = reflink.Supported || reflinkFilesystems[d.fsOf(root)]
+	}
+
+	for _, hashString := range d.groupOrder {
+		paths := d.fileByteMapDups[hashString]
+		original := d.fileMap[d.decisions[hashString].Original]
+		origKey := d.inodeOf(original)
+
+		names := make(map[inodeKey]int)
+		recs := make(map[inodeKey]fswalk.FileRecord)
+		for _, p := range paths {
+			rec := d.fileMap[p]
+			if rec.Path == original.Path {
+				continue
+			}
+			k := d.inodeOf(rec)
+			names[k]++
+			recs[k] = rec
+		}
+		for k, n := range names {
+			rec := recs[k]
+			freed := rec.Alloc
+			if k == origKey || (rec.Nlink > uint64(n) && k.path == "") {
+				freed = 0 // The data stays reachable through another name
+			}
+			remove.Files += n
+			remove.Bytes += freed
+			if rec.Dev != original.Dev && k.path == "" {
+				link.CrossDevice += n
+				reflink.CrossDevice += n
+				continue
+			}
+			link.Files += n
+			link.Bytes += freed
+			if reflinkFilesystems[d.fsOf(rec.Path)] {
+				reflink.Files += n
+				reflink.Bytes += freed
+			}
+		}
+	}
+	return []Savings{remove, link, reflink}
+}
+
+// inodeOf returns the key of rec's data. Inode numbers are not trusted on network filesystems.
+func (d *Deduplicator) inodeOf(rec fswalk.FileRecord) inodeKey {
+	if rec.Ino == 0 || d.networkFS {
+		return inodeKey{path: rec.Path}
+	}
+	return inodeKey{dev: rec.Dev, ino: rec.Ino}
+}
+
+// reportWhatIf prints the projected savings of each strategy.
+func (d *Deduplicator) reportWhatIf() {
+	fmt.Fprintln(d.out, "\nWhat-if savings per strategy\n-------------------------")
+	for _, s := range d.whatIf() {
+		line := fmt.Sprintf("%-8s %12s  (%d files", s.Strategy, formatSize(s.Bytes), s.Files)
+		if s.CrossDevice > 0 {
+			line += fmt.Sprintf(", %d on another device than their original", s.CrossDevice)
+		}
+		line += ")"
+		if !s.Supported {
+			line += fmt.Sprintf("  not supported on %s", d.fsName)
+		}
+		fmt.Fprintln(d.out, line)
+	}
+	fmt.Fprintln(d.out, "-------------------------")
+}
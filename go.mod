@@ -0,0 +1,13 @@
+module github.com/nicky-ayoub/go-file-dedupe
+
+go 1.18
+
+require (
+	github.com/hanwen/go-fuse/v2 v2.7.2
+	github.com/zeebo/blake3 v0.2.3
+	golang.org/x/crypto v0.21.0
+	golang.org/x/sys v0.30.0
+	golang.org/x/text v0.14.0
+)
+
+require github.com/klauspost/cpuid/v2 v2.0.12 // indirect
@@ -0,0 +1,274 @@
+// Package actions applies the decisions made by the policy engine to the filesystem.
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// Op is a single filesystem change derived from a policy decision.
+type Op struct {
+	Action   policy.Action
+	File     fswalk.FileRecord // The duplicate being changed
+	Original fswalk.FileRecord // The kept copy of the same content
+	Rule     string            // Rule that selected the action
+
+	// DryRun ops are checked but never performed: Execute refuses them with ErrDryRun
+	// before any call that could change the filesystem.
+	DryRun bool
+
+	// Attrs are the extended attributes (ACLs, SELinux label, ...) of File, read by the
+	// Executor just before the operation. A reflink keeps them; a hard link or removal
+	// loses them, so they are written to the audit log.
+	Attrs Xattrs
+}
+
+// SpecialModes are the permission bits that make replacing or removing a file a
+// security decision: a hard link to a setuid original would be setuid too.
+const SpecialModes = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+
+// ErrDryRun is returned by Execute for an Op marked DryRun.
+var ErrDryRun = errors.New("dry run: the filesystem is not changed")
+
+// Plan turns a group decision into the operations that modify the filesystem.
+// Kept and skipped files produce no operation. files supplies the scanned metadata by path.
+func Plan(d policy.Decision, files map[string]fswalk.FileRecord) []Op {
+	var ops []Op
+	for _, e := range d.Entries {
+		if e.Action != policy.ActionRemove && e.Action != policy.ActionLink && e.Action != policy.ActionReflink {
+			continue
+		}
+		ops = append(ops, Op{Action: e.Action, File: files[e.Path], Original: files[d.Original], Rule: e.Rule})
+	}
+	return ops
+}
+
+// Executor performs operations, recording each one in an optional audit log
+// and copying each affected file into an optional backup first.
+// When a Guard is set, both files of an operation must pass it before anything is touched.
+type Executor struct {
+	Audit  *AuditLog
+	Backup *Backup
+	Guard  *Guard
+
+	// DryRun marks every operation DryRun. Run then performs only the read-only checks
+	// (guard, protected inodes, extended attributes) and returns their outcome; nothing
+	// is backed up, changed, recorded in a sidecar or audited.
+	DryRun bool
+
+	// PreferReflink performs link operations as copy-on-write clones where the
+	// filesystem supports them, falling back to hard links elsewhere.
+	PreferReflink bool
+
+	// RequireSameXattrs refuses to hard link a duplicate whose extended attributes differ
+	// from the original's, instead of only warning. A hard link shares the original's
+	// attributes, so the duplicate's own ACLs or security label would be lost.
+	RequireSameXattrs bool
+
+	// Sidecars records every completed operation in a JSON file next to the original
+	// (see SidecarSuffix), listing the duplicates that were removed or linked to it.
+	Sidecars bool
+
+	// AllowSpecialModes permits operations on duplicates with SpecialModes and links to
+	// originals with them; by default they are refused.
+	AllowSpecialModes bool
+
+	// Protected files are never modified: an operation is refused when the duplicate or
+	// the original currently has one of these device/inode pairs.
+	Protected fswalk.InodeSet
+}
+
+// Run executes op and records the outcome.
+func (x *Executor) Run(op Op) error {
+	op.DryRun = op.DryRun || x.DryRun
+	var err error
+	if x.Guard != nil {
+		if err = x.Guard.Check(op.File.Path); err == nil {
+			err = x.Guard.Check(op.Original.Path)
+		}
+		if err != nil {
+			err = fmt.Errorf("refusing to %s %s: %w", op.Action, op.File.Path, err)
+		}
+	}
+	if err == nil && len(x.Protected) > 0 {
+		err = x.checkProtected(op)
+	}
+	if err == nil && !x.AllowSpecialModes {
+		err = checkSpecialModes(op)
+	}
+	if err == nil {
+		if op.Attrs, err = readXattrs(op.File.Path); err != nil {
+			err = fmt.Errorf("refusing to %s %s: %w", op.Action, op.File.Path, err)
+		}
+	}
+	if op.DryRun {
+		if err == nil {
+			err = x.checkLinkXattrs(op)
+		}
+		return err
+	}
+	if err == nil && x.Backup != nil {
+		err = x.Backup.Save(op.File.Path)
+	}
+	if err == nil {
+		if x.PreferReflink && op.Action == policy.ActionLink {
+			clone := op
+			clone.Action = policy.ActionReflink
+			if err = Execute(clone); err == nil || !isCloneUnsupported(err) {
+				op = clone
+			} else if err = x.checkLinkXattrs(op); err == nil {
+				err = Execute(op)
+			}
+		} else if err = x.checkLinkXattrs(op); err == nil {
+			err = Execute(op)
+		}
+	}
+	if err == nil && x.Sidecars {
+		// The operation itself succeeded; a missing sidecar is only worth a warning.
+		if serr := writeSidecar(op); serr != nil {
+			log.Printf("Warning: %v", serr)
+		}
+	}
+	if x.Audit != nil {
+		if aerr := x.Audit.Record(op, err); aerr != nil {
+			// An operation that cannot be audited must not go unnoticed.
+			return fmt.Errorf("%v (audit log: %w)", err, aerr)
+		}
+	}
+	return err
+}
+
+// checkProtected refuses op if either file is on the protected list now, whatever it
+// was when scanned.
+func (x *Executor) checkProtected(op Op) error {
+	for _, path := range []string{op.File.Path, op.Original.Path} {
+		rec, err := fswalk.StatRecord(path)
+		if err != nil {
+			return fmt.Errorf("refusing to %s %s: %w", op.Action, op.File.Path, err)
+		}
+		if x.Protected[rec.Inode()] {
+			return fmt.Errorf("refusing to %s %s: %s (inode %s) is protected", op.Action, op.File.Path, path, rec.Inode())
+		}
+	}
+	return nil
+}
+
+// checkSpecialModes refuses op if the duplicate currently has one of SpecialModes, or
+// if it would become another name or clone of an original that has.
+func checkSpecialModes(op Op) error {
+	info, err := os.Lstat(op.File.Path)
+	if err != nil {
+		return fmt.Errorf("refusing to %s %s: %w", op.Action, op.File.Path, err)
+	}
+	if m := info.Mode() & SpecialModes; m != 0 {
+		return fmt.Errorf("refusing to %s %s: it has special permissions (%s)", op.Action, op.File.Path, info.Mode())
+	}
+	if op.Action == policy.ActionRemove {
+		return nil
+	}
+	orig, err := os.Lstat(op.Original.Path)
+	if err != nil {
+		return fmt.Errorf("refusing to %s %s: %w", op.Action, op.File.Path, err)
+	}
+	if orig.Mode()&SpecialModes != 0 {
+		return fmt.Errorf("refusing to %s %s: original %s has special permissions (%s)", op.Action, op.File.Path, op.Original.Path, orig.Mode())
+	}
+	return nil
+}
+
+// checkLinkXattrs compares the duplicate's extended attributes with the original's
+// before a hard link replaces them.
+func (x *Executor) checkLinkXattrs(op Op) error {
+	if op.Action != policy.ActionLink {
+		return nil
+	}
+	origAttrs, err := readXattrs(op.Original.Path)
+	if err != nil {
+		return fmt.Errorf("refusing to %s %s: %w", op.Action, op.File.Path, err)
+	}
+	diff := op.Attrs.Diff(origAttrs)
+	if len(diff) == 0 {
+		return nil
+	}
+	if x.RequireSameXattrs {
+		return fmt.Errorf("refusing to link %s: extended attributes differ from %s: %v", op.File.Path, op.Original.Path, diff)
+	}
+	log.Printf("WARNING: %s has different extended attributes than %s %v; a hard link keeps only the original's.", op.File.Path, op.Original.Path, diff)
+	return nil
+}
+
+// Execute performs one operation. The original must still exist, otherwise nothing is
+// touched; a DryRun op is refused before anything is looked at.
+func Execute(op Op) error {
+	path, original := op.File.Path, op.Original.Path
+	if op.DryRun {
+		return fmt.Errorf("refusing to %s %s: %w", op.Action, path, ErrDryRun)
+	}
+	if original == "" || original == path {
+		return fmt.Errorf("refusing to %s %s: no separate original", op.Action, path)
+	}
+	origInfo, err := os.Lstat(original)
+	if err != nil {
+		return fmt.Errorf("refusing to %s %s: original unavailable: %w", op.Action, path, err)
+	}
+	// Differently normalized or cased names can reach the same file; acting on it
+	// would destroy the only copy or link it onto itself.
+	if info, err := os.Lstat(path); err == nil && os.SameFile(origInfo, info) {
+		return fmt.Errorf("refusing to %s %s: it is the same file as %s", op.Action, path, original)
+	}
+
+	switch op.Action {
+	case policy.ActionRemove:
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	case policy.ActionLink:
+		return replaceWithLink(original, path)
+	case policy.ActionReflink:
+		return replaceWithClone(original, path, op.Attrs)
+	default:
+		return fmt.Errorf("unsupported action %s for %s", op.Action, path)
+	}
+	return nil
+}
+
+// replaceWithLink atomically replaces path with a hard link to original.
+// The link is created under a temporary name first so path is never missing.
+func replaceWithLink(original, path string) error {
+	tmp := path + ".dedupe-tmp"
+	if err := os.Link(original, tmp); err != nil {
+		if isTooManyLinks(err) {
+			return fmt.Errorf("failed to link %s to %s: %w", path, original, ErrLinkLimit)
+		}
+		return fmt.Errorf("failed to link %s to %s: %w", path, original, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s with link: %w", path, err)
+	}
+	return nil
+}
+
+// replaceWithClone atomically replaces path with a copy-on-write clone of original.
+// Unlike a hard link the two files stay independent when either is modified later,
+// and the clone carries path's previous extended attributes.
+func replaceWithClone(original, path string, attrs Xattrs) error {
+	tmp := path + ".dedupe-tmp"
+	if err := cloneFile(original, tmp); err != nil {
+		return fmt.Errorf("failed to clone %s to %s: %w", original, path, err)
+	}
+	if err := writeXattrs(tmp, attrs); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to preserve attributes of %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace %s with clone: %w", path, err)
+	}
+	return nil
+}
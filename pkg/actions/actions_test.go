@@ -0,0 +1,353 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// writeFile creates a file with the given content inside dir.
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatalf("Failed to create %s: %v", path, err)
+	}
+	return path
+}
+
+// TestExecutorLinkAudited checks that a link replaces the duplicate and is written to the audit log.
+func TestExecutorLinkAudited(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeFile(t, dir, "orig", "same")
+	dup := writeFile(t, dir, "dup", "same")
+
+	audit, err := OpenAuditLog(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenAuditLog returned an unexpected error: %v", err)
+	}
+	x := &Executor{Audit: audit}
+	op := Op{Action: policy.ActionLink, File: fswalk.FileRecord{Path: dup, Size: 4}, Original: fswalk.FileRecord{Path: orig}}
+	if err := x.Run(op); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	audit.Close()
+
+	a, _ := os.Stat(orig)
+	b, _ := os.Stat(dup)
+	if !os.SameFile(a, b) {
+		t.Errorf("Expected %s to be a hard link to %s", dup, orig)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	var rec auditRecord
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &rec); err != nil {
+		t.Fatalf("Audit log is not a single JSON record: %v", err)
+	}
+	if rec.Action != "link" || rec.Path != dup || rec.Result != "ok" || rec.Rule != "default" {
+		t.Errorf("Unexpected audit record: %+v", rec)
+	}
+}
+
+// TestExecuteMissingOriginal checks that nothing is removed when the original is gone.
+func TestExecuteMissingOriginal(t *testing.T) {
+	dir := t.TempDir()
+	dup := writeFile(t, dir, "dup", "same")
+	op := Op{Action: policy.ActionRemove, File: fswalk.FileRecord{Path: dup}, Original: fswalk.FileRecord{Path: filepath.Join(dir, "gone")}}
+	if err := Execute(op); err == nil {
+		t.Fatal("Expected an error for a missing original, but got nil")
+	}
+	if _, err := os.Stat(dup); err != nil {
+		t.Errorf("Duplicate was touched: %v", err)
+	}
+}
+
+// TestExecutorBackup checks that a removed file is copied into the backup first and old runs expire.
+func TestExecutorBackup(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeFile(t, dir, "orig", "same")
+	dup := writeFile(t, dir, "dup", "same")
+	backupRoot := filepath.Join(dir, "backup")
+
+	now := time.Now()
+	old := NewBackup(backupRoot, now.AddDate(0, 0, -10))
+	if err := os.MkdirAll(old.Dir, 0o700); err != nil {
+		t.Fatalf("Failed to create old backup: %v", err)
+	}
+
+	x := &Executor{Backup: NewBackup(backupRoot, now)}
+	op := Op{Action: policy.ActionRemove, File: fswalk.FileRecord{Path: dup}, Original: fswalk.FileRecord{Path: orig}}
+	if err := x.Run(op); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	abs, _ := filepath.Abs(dup)
+	data, err := os.ReadFile(filepath.Join(x.Backup.Dir, abs))
+	if err != nil || string(data) != "same" {
+		t.Errorf("Backup copy missing or wrong: %q, %v", data, err)
+	}
+
+	n, err := ExpireBackups(backupRoot, 7*24*time.Hour, now)
+	if err != nil || n != 1 {
+		t.Errorf("Expected one expired run, got %d, %v", n, err)
+	}
+	if _, err := os.Stat(x.Backup.Dir); err != nil {
+		t.Errorf("Current backup run was expired: %v", err)
+	}
+}
+
+// TestExecutorDryRun checks that a dry-run executor or op leaves every file, backup
+// and audit log untouched while still running the guard.
+func TestExecutorDryRun(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeFile(t, dir, "orig", "same")
+	dup := writeFile(t, dir, "dup", "same")
+	auditPath := filepath.Join(dir, "audit.jsonl")
+	audit, err := OpenAuditLog(auditPath)
+	if err != nil {
+		t.Fatalf("OpenAuditLog returned an unexpected error: %v", err)
+	}
+	defer audit.Close()
+
+	x := &Executor{DryRun: true, Audit: audit, Backup: NewBackup(filepath.Join(dir, "backup"), time.Now())}
+	for _, action := range []policy.Action{policy.ActionRemove, policy.ActionLink, policy.ActionReflink} {
+		op := Op{Action: action, File: fswalk.FileRecord{Path: dup}, Original: fswalk.FileRecord{Path: orig}}
+		if err := x.Run(op); err != nil {
+			t.Errorf("Run(%s) returned an unexpected error: %v", action, err)
+		}
+		op.DryRun = true
+		if err := Execute(op); !errors.Is(err, ErrDryRun) {
+			t.Errorf("Execute(%s) of a dry-run op mismatch. Got: %v, Want: %v", action, err, ErrDryRun)
+		}
+	}
+	if data, err := os.ReadFile(dup); err != nil || string(data) != "same" {
+		t.Errorf("Duplicate changed by a dry run: %q, %v", data, err)
+	}
+	if _, err := os.Stat(x.Backup.Dir); !os.IsNotExist(err) {
+		t.Errorf("Dry run created a backup: %v", err)
+	}
+	if info, err := os.Stat(auditPath); err == nil && info.Size() > 0 {
+		t.Errorf("Dry run wrote %d bytes to the audit log", info.Size())
+	}
+
+	guard, err := NewGuard(dir)
+	if err != nil {
+		t.Fatalf("NewGuard returned an unexpected error: %v", err)
+	}
+	x = &Executor{DryRun: true, Guard: guard}
+	outside := Op{Action: policy.ActionRemove, File: fswalk.FileRecord{Path: "/etc/passwd"}, Original: fswalk.FileRecord{Path: orig}}
+	if err := x.Run(outside); err == nil {
+		t.Errorf("Dry run accepted a file outside the root")
+	}
+}
+
+// TestGuardOutsideRoot checks that a symlinked directory cannot redirect an operation outside the root.
+func TestGuardOutsideRoot(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	orig := writeFile(t, root, "orig", "same")
+	writeFile(t, outside, "victim", "same")
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	g, err := NewGuard(root)
+	if err != nil {
+		t.Fatalf("NewGuard returned an unexpected error: %v", err)
+	}
+	if err := g.Check(orig); err != nil {
+		t.Errorf("Expected %s to pass the guard: %v", orig, err)
+	}
+
+	victim := filepath.Join(root, "escape", "victim")
+	x := &Executor{Guard: g}
+	op := Op{Action: policy.ActionRemove, File: fswalk.FileRecord{Path: victim}, Original: fswalk.FileRecord{Path: orig}}
+	if err := x.Run(op); err == nil {
+		t.Fatal("Expected the guard to refuse a path outside the root, but got nil")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "victim")); err != nil {
+		t.Errorf("File outside the root was touched: %v", err)
+	}
+}
+
+// TestExecutorPreferReflink checks that a preferred clone falls back to a hard link where unsupported.
+func TestExecutorPreferReflink(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeFile(t, dir, "orig", "same")
+	dup := writeFile(t, dir, "dup", "same")
+
+	x := &Executor{PreferReflink: true}
+	op := Op{Action: policy.ActionLink, File: fswalk.FileRecord{Path: dup}, Original: fswalk.FileRecord{Path: orig}}
+	if err := x.Run(op); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(dup)
+	if err != nil || string(data) != "same" {
+		t.Errorf("Duplicate content lost: %q, %v", data, err)
+	}
+	if _, err := os.Stat(dup + ".dedupe-tmp"); !os.IsNotExist(err) {
+		t.Errorf("Temporary file left behind: %v", err)
+	}
+}
+
+// TestXattrsDiff checks that changed, missing and extra attributes are all reported.
+func TestXattrsDiff(t *testing.T) {
+	a := Xattrs{"user.same": []byte("1"), "user.changed": []byte("a"), "user.only-a": nil}
+	b := Xattrs{"user.same": []byte("1"), "user.changed": []byte("b"), "user.only-b": nil}
+	got := strings.Join(a.Diff(b), ",")
+	if want := "user.changed,user.only-a,user.only-b"; got != want {
+		t.Errorf("Diff mismatch. Got: %v, Want: %v", got, want)
+	}
+}
+
+// TestExecutorRequireSameXattrs checks that a link is refused when the duplicate's attributes differ.
+func TestExecutorRequireSameXattrs(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeFile(t, dir, "orig", "same")
+	dup := writeFile(t, dir, "dup", "same")
+	if err := writeXattrs(dup, Xattrs{"user.label": []byte("dup")}); err != nil {
+		t.Skipf("user xattrs unsupported here: %v", err)
+	}
+	if attrs, _ := readXattrs(dup); len(attrs) == 0 {
+		t.Skip("extended attributes unsupported on this platform")
+	}
+
+	x := &Executor{RequireSameXattrs: true}
+	op := Op{Action: policy.ActionLink, File: fswalk.FileRecord{Path: dup}, Original: fswalk.FileRecord{Path: orig}}
+	if err := x.Run(op); err == nil {
+		t.Fatal("Run succeeded although the extended attributes differ")
+	}
+	a, _ := os.Stat(orig)
+	b, _ := os.Stat(dup)
+	if os.SameFile(a, b) {
+		t.Errorf("Expected %s to be left untouched", dup)
+	}
+}
+
+// TestExecutorSidecars checks that completed operations accumulate in the original's sidecar.
+func TestExecutorSidecars(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeFile(t, dir, "orig", "same")
+	x := &Executor{Sidecars: true}
+	for _, name := range []string{"dup1", "dup2"} {
+		dup := writeFile(t, dir, name, "same")
+		op := Op{Action: policy.ActionRemove, File: fswalk.FileRecord{Path: dup, Size: 4}, Original: fswalk.FileRecord{Path: orig}}
+		if err := x.Run(op); err != nil {
+			t.Fatalf("Run returned an unexpected error: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(orig + SidecarSuffix)
+	if err != nil {
+		t.Fatalf("Failed to read sidecar: %v", err)
+	}
+	var sc Sidecar
+	if err := json.Unmarshal(data, &sc); err != nil {
+		t.Fatalf("Sidecar is not valid JSON: %v", err)
+	}
+	if sc.Original != orig || len(sc.Duplicates) != 2 || sc.Duplicates[1].Path != filepath.Join(dir, "dup2") || sc.Duplicates[0].Action != "remove" {
+		t.Errorf("Unexpected sidecar: %+v", sc)
+	}
+}
+
+// TestExecutorProtected checks that a file on the protected inode list is never removed.
+func TestExecutorProtected(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeFile(t, dir, "orig", "same")
+	dup := writeFile(t, dir, "dup", "same")
+	rec, err := fswalk.StatRecord(dup)
+	if err != nil {
+		t.Fatalf("StatRecord returned an unexpected error: %v", err)
+	}
+	if rec.Ino == 0 {
+		t.Skip("no inode numbers on this platform")
+	}
+	x := &Executor{Protected: fswalk.InodeSet{rec.Inode(): true}}
+	op := Op{Action: policy.ActionRemove, File: fswalk.FileRecord{Path: dup}, Original: fswalk.FileRecord{Path: orig}}
+	if err := x.Run(op); err == nil {
+		t.Errorf("Run removed a protected file")
+	}
+	if _, err := os.Stat(dup); err != nil {
+		t.Errorf("Protected file is gone: %v", err)
+	}
+}
+
+// TestExecutorSpecialModes checks that setuid duplicates and links to setgid originals
+// are refused unless AllowSpecialModes is set, while removals next to them are not.
+func TestExecutorSpecialModes(t *testing.T) {
+	dir := t.TempDir()
+	orig := writeFile(t, dir, "orig", "same")
+	dup := writeFile(t, dir, "dup", "same")
+	if err := os.Chmod(dup, 0o755|os.ModeSetuid); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(dup); err != nil || info.Mode()&os.ModeSetuid == 0 {
+		t.Skip("setuid bit not supported here")
+	}
+	x := &Executor{}
+	op := Op{Action: policy.ActionRemove, File: fswalk.FileRecord{Path: dup}, Original: fswalk.FileRecord{Path: orig}}
+	if err := x.Run(op); err == nil {
+		t.Fatal("Run removed a setuid duplicate")
+	}
+
+	if err := os.Chmod(dup, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(orig, 0o755|os.ModeSetgid); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(orig); err != nil || info.Mode()&os.ModeSetgid == 0 {
+		t.Skip("setgid bit not supported here")
+	}
+	op.Action = policy.ActionLink
+	if err := x.Run(op); err == nil {
+		t.Fatal("Run linked a duplicate to a setgid original")
+	}
+	op.Action = policy.ActionRemove
+	if err := x.Run(op); err != nil {
+		t.Fatalf("Run returned an unexpected error: %v", err)
+	}
+	if _, err := os.Stat(dup); !os.IsNotExist(err) {
+		t.Errorf("Expected %s to be removed", dup)
+	}
+}
+
+// TestSplitLinks checks that a group exceeding the link limit gets a further original
+// taken from its duplicates, and that removals are left alone.
+func TestSplitLinks(t *testing.T) {
+	orig := fswalk.FileRecord{Path: "/r/orig", Nlink: 2}
+	var ops []Op
+	for _, name := range []string{"d1", "d2", "d3", "d4"} {
+		ops = append(ops, Op{Action: policy.ActionLink, File: fswalk.FileRecord{Path: "/r/" + name, Nlink: 1}, Original: orig})
+	}
+	ops = append(ops, Op{Action: policy.ActionRemove, File: fswalk.FileRecord{Path: "/r/d5"}, Original: orig})
+
+	got, promoted := SplitLinks(ops, func(string) uint64 { return 3 })
+	if promoted != 1 {
+		t.Errorf("Promoted count mismatch. Got: %d, Want: 1", promoted)
+	}
+	var pairs []string
+	for _, op := range got {
+		pairs = append(pairs, op.Action.String()+" "+op.File.Path+"->"+op.Original.Path)
+	}
+	want := "link /r/d1->/r/orig,link /r/d3->/r/d2,link /r/d4->/r/d2,remove /r/d5->/r/orig"
+	if strings.Join(pairs, ",") != want {
+		t.Errorf("SplitLinks mismatch. Got: %s, Want: %s", strings.Join(pairs, ","), want)
+	}
+
+	s := make(Successors)
+	s.Replace(orig, fswalk.FileRecord{Path: "/r/d2"})
+	s.Replace(fswalk.FileRecord{Path: "/r/d2"}, fswalk.FileRecord{Path: "/r/d4"})
+	if got := s.Of(orig).Path; got != "/r/d4" {
+		t.Errorf("Successor mismatch. Got: %s, Want: /r/d4", got)
+	}
+}
@@ -0,0 +1,95 @@
+package actions
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/schema"
+)
+
+// AuditLog is an append-only JSONL record of every destructive operation.
+// The file is opened with O_APPEND and never truncated; each record is synced before
+// the next operation starts so a crash cannot lose the trail of what was done.
+type AuditLog struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+
+	// Tags are copied into every record, e.g. host or dataset names.
+	Tags map[string]string
+}
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	SchemaVersion  int               `json:"schema_version"`
+	Time           time.Time         `json:"time"`
+	Action         string            `json:"action"`
+	Path           string            `json:"path"`
+	Original       string            `json:"original"`
+	Hash           string            `json:"hash"`
+	Group          string            `json:"group"` // Stable duplicate group ID
+	Size           int64             `json:"size"`
+	Device         uint64            `json:"device"`
+	Inode          uint64            `json:"inode"`
+	OriginalDevice uint64            `json:"original_device"`
+	OriginalInode  uint64            `json:"original_inode"`
+	Xattrs         Xattrs            `json:"xattrs,omitempty"` // Duplicate's attributes before the operation, base64 values
+	Rule           string            `json:"rule"`             // "default" when no rule matched
+	Result         string            `json:"result"`           // ok or error
+	Error          string            `json:"error,omitempty"`
+	Tags           map[string]string `json:"tags,omitempty"`
+}
+
+// OpenAuditLog opens (creating if needed) the audit log at path for appending.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &AuditLog{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Record appends the outcome of op.
+func (a *AuditLog) Record(op Op, opErr error) error {
+	rec := auditRecord{
+		SchemaVersion:  schema.Version,
+		Time:           time.Now().UTC(),
+		Action:         op.Action.String(),
+		Path:           op.File.Path,
+		Original:       op.Original.Path,
+		Hash:           iphash.HashToString(op.File.Sum),
+		Group:          iphash.GroupID(op.File.Sum),
+		Size:           op.File.Size,
+		Device:         op.File.Dev,
+		Inode:          op.File.Ino,
+		OriginalDevice: op.Original.Dev,
+		OriginalInode:  op.Original.Ino,
+		Xattrs:         op.Attrs,
+		Rule:           op.Rule,
+		Result:         "ok",
+		Tags:           a.Tags,
+	}
+	if rec.Rule == "" {
+		rec.Rule = "default"
+	}
+	if opErr != nil {
+		rec.Result = "error"
+		rec.Error = opErr.Error()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.enc.Encode(rec); err != nil {
+		return fmt.Errorf("failed to write audit record: %w", err)
+	}
+	return a.f.Sync()
+}
+
+// Close closes the underlying file.
+func (a *AuditLog) Close() error {
+	return a.f.Close()
+}
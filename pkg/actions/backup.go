@@ -0,0 +1,103 @@
+package actions
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// backupStamp names the per-run directory inside the backup root.
+const backupStamp = "20060102T150405Z"
+
+// Backup copies files into a per-run directory before they are removed or relinked.
+// The absolute path of every file is mirrored below the run directory.
+type Backup struct {
+	Dir string
+}
+
+// NewBackup returns a Backup writing into a fresh run directory below root.
+func NewBackup(root string, now time.Time) *Backup {
+	return &Backup{Dir: filepath.Join(root, now.UTC().Format(backupStamp))}
+}
+
+// Save copies path into the backup, preserving its mode and modification time.
+func (b *Backup) Save(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	rel := strings.TrimPrefix(abs, filepath.VolumeName(abs))
+	dest := filepath.Join(b.Dir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o700); err != nil {
+		return fmt.Errorf("failed to create backup directory for %s: %w", path, err)
+	}
+	if err := copyFile(path, dest); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+	// The audit log records the attributes too, so a partial copy is not fatal.
+	if err := copyXattrs(path, dest); err != nil {
+		log.Printf("Warning: backup of %s lacks some attributes: %v", path, err)
+	}
+	return nil
+}
+
+// copyFile copies src to dest and syncs it, so the copy is durable before src is touched.
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(dest, info.ModTime(), info.ModTime())
+}
+
+// ExpireBackups deletes run directories below root that are older than maxAge.
+// Only directories named like a run stamp are considered, so unrelated content is never removed.
+func ExpireBackups(root string, maxAge time.Duration, now time.Time) (int, error) {
+	entries, err := os.ReadDir(root)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read backup directory %s: %w", root, err)
+	}
+	removed := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		stamp, err := time.Parse(backupStamp, e.Name())
+		if err != nil || now.Sub(stamp) <= maxAge {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(root, e.Name())); err != nil {
+			return removed, fmt.Errorf("failed to expire backup %s: %w", e.Name(), err)
+		}
+		removed++
+	}
+	return removed, nil
+}
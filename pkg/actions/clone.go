@@ -0,0 +1,19 @@
+package actions
+
+import (
+	"errors"
+	"syscall"
+)
+
+// ErrReflinkUnsupported is returned where the platform has no clone primitive.
+var ErrReflinkUnsupported = errors.New("reflinks are not supported on this platform")
+
+// isCloneUnsupported reports whether a clone failed because the filesystem or platform
+// cannot clone (rather than because of a problem with the particular files).
+func isCloneUnsupported(err error) bool {
+	return errors.Is(err, ErrReflinkUnsupported) ||
+		errors.Is(err, syscall.ENOTSUP) ||
+		errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, syscall.EXDEV) ||
+		errors.Is(err, syscall.EINVAL)
+}
@@ -0,0 +1,8 @@
+package actions
+
+import "golang.org/x/sys/unix"
+
+// cloneFile creates dst as an APFS clone of src with clonefile(2).
+func cloneFile(src, dst string) error {
+	return unix.Clonefile(src, dst, unix.CLONE_NOFOLLOW)
+}
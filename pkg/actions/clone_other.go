@@ -0,0 +1,8 @@
+//go:build !darwin && !linux
+
+package actions
+
+// cloneFile is not available on this platform.
+func cloneFile(src, dst string) error {
+	return ErrReflinkUnsupported
+}
@@ -0,0 +1,74 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// Guard refuses operations on paths that resolve outside the declared scan roots.
+// Symlinks in the parent directories are resolved at check time, so a link planted in
+// the scanned tree cannot redirect a remove or link to files elsewhere.
+type Guard struct {
+	roots []string
+
+	// CaseInsensitive makes root containment ignore case, for roots on such filesystems.
+	CaseInsensitive bool
+}
+
+// NewGuard resolves the given roots once.
+func NewGuard(roots ...string) (*Guard, error) {
+	g := &Guard{}
+	for _, root := range roots {
+		resolved, err := resolve(root)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve root %s: %w", root, err)
+		}
+		g.roots = append(g.roots, resolved)
+	}
+	return g, nil
+}
+
+// Check returns an error unless path is a regular file (not a symlink) inside one of the roots.
+func (g *Guard) Check(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is no longer a regular file (%s)", path, info.Mode().Type())
+	}
+	dir, err := resolve(filepath.Dir(path))
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	resolved := filepath.Join(dir, filepath.Base(path))
+	key := fswalk.PathKey(resolved, g.CaseInsensitive)
+	for _, root := range g.roots {
+		if within(fswalk.PathKey(root, g.CaseInsensitive), key) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s resolves to %s, outside the scan roots", path, resolved)
+}
+
+// resolve returns the absolute path with all symlinks evaluated.
+func resolve(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
+
+// within reports whether path is root or below it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,37 @@
+package actions
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Ingest copies src to dest, creating dest's parent directories. An existing dest is
+// never overwritten and a partial copy is removed.
+func Ingest(src, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", dest, err)
+	}
+	if err := copyFile(src, dest); err != nil {
+		if !os.IsExist(err) {
+			os.Remove(dest)
+		}
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	if err := copyXattrs(src, dest); err != nil {
+		log.Printf("Warning: copy of %s lacks some attributes: %v", src, err)
+	}
+	return nil
+}
+
+// IngestLink creates dest as another name of existing, creating dest's parent directories.
+func IngestLink(existing, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", dest, err)
+	}
+	if err := os.Link(existing, dest); err != nil {
+		return fmt.Errorf("failed to link %s: %w", dest, err)
+	}
+	return nil
+}
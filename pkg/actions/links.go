@@ -0,0 +1,77 @@
+package actions
+
+import (
+	"errors"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/policy"
+)
+
+// ErrLinkLimit is returned when the original already has the maximum number of hard
+// links the filesystem allows (1023 on NTFS, 65000 on ext4).
+var ErrLinkLimit = errors.New("hard link limit of the original reached")
+
+// LinkLimits are the maximum numbers of names of one file, by fswalk.FSInfo name, on
+// filesystems a large duplicate group can exhaust. Local Windows volumes are named
+// "local"; only NTFS and ReFS support hard links there, both up to 1023.
+var LinkLimits = map[string]uint64{"ext4": 65000, "btrfs": 65535, "local": 1023}
+
+// SplitLinks rewrites the link operations of ops so that no original gets more names
+// than limit returns for it, 0 meaning no limit. Once an original is full, the next
+// duplicate to be linked to it is left in place and becomes the original of the
+// following ones. It returns the new operations and how many duplicates were kept as
+// further originals.
+func SplitLinks(ops []Op, limit func(original string) uint64) ([]Op, int) {
+	names := make(map[string]uint64) // Path of an original -> names it will have
+	successor := make(Successors)
+	var split []Op
+	promoted := 0
+	for _, op := range ops {
+		if op.Action != policy.ActionLink {
+			split = append(split, op)
+			continue
+		}
+		op.Original = successor.Of(op.Original)
+		n, ok := names[op.Original.Path]
+		if !ok {
+			n = nlink(op.Original)
+		}
+		if max := limit(op.Original.Path); max > 0 && n >= max {
+			successor.Replace(op.Original, op.File)
+			names[op.File.Path] = nlink(op.File)
+			promoted++
+			continue
+		}
+		names[op.Original.Path] = n + 1
+		split = append(split, op)
+	}
+	return split, promoted
+}
+
+// Successors tracks originals that were replaced by one of their duplicates because
+// they reached their link limit. The zero value is not usable; create it with make.
+type Successors map[string]fswalk.FileRecord
+
+// Replace makes next the original of the duplicates still to be linked to original.
+func (s Successors) Replace(original, next fswalk.FileRecord) {
+	s[original.Path] = next
+}
+
+// Of returns the original that currently stands in for original.
+func (s Successors) Of(original fswalk.FileRecord) fswalk.FileRecord {
+	for {
+		next, ok := s[original.Path]
+		if !ok {
+			return original
+		}
+		original = next
+	}
+}
+
+// nlink is the number of names of the file, at least its own.
+func nlink(rec fswalk.FileRecord) uint64 {
+	if rec.Nlink == 0 {
+		return 1
+	}
+	return rec.Nlink
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+
+package actions
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isTooManyLinks reports whether err means the link count limit was hit.
+func isTooManyLinks(err error) bool {
+	return errors.Is(err, syscall.EMLINK)
+}
+
+// CheckLinkSupport assumes hard links are available; unsupported filesystems
+// report it per operation.
+func CheckLinkSupport(path string) error {
+	return nil
+}
@@ -0,0 +1,50 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const errorTooManyLinks = syscall.Errno(1142) // ERROR_TOO_MANY_LINKS
+
+// isTooManyLinks reports whether err means the link count limit was hit.
+func isTooManyLinks(err error) bool {
+	return errors.Is(err, errorTooManyLinks)
+}
+
+var (
+	kernel32                  = syscall.NewLazyDLL("kernel32.dll")
+	procGetVolumePathNameW    = kernel32.NewProc("GetVolumePathNameW")
+	procGetVolumeInformationW = kernel32.NewProc("GetVolumeInformationW")
+)
+
+// CheckLinkSupport returns an error unless the volume holding path supports hard links.
+// Only NTFS (and ReFS) do; FAT and exFAT volumes would fail every link operation.
+func CheckLinkSupport(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	p, err := syscall.UTF16PtrFromString(abs)
+	if err != nil {
+		return err
+	}
+	volume := make([]uint16, syscall.MAX_PATH+1)
+	if r, _, e := procGetVolumePathNameW.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&volume[0])), uintptr(len(volume))); r == 0 {
+		return fmt.Errorf("failed to find volume of %s: %w", path, e)
+	}
+	fsName := make([]uint16, syscall.MAX_PATH+1)
+	if r, _, e := procGetVolumeInformationW.Call(uintptr(unsafe.Pointer(&volume[0])), 0, 0, 0, 0, 0,
+		uintptr(unsafe.Pointer(&fsName[0])), uintptr(len(fsName))); r == 0 {
+		return fmt.Errorf("failed to query volume %s: %w", syscall.UTF16ToString(volume), e)
+	}
+	switch name := syscall.UTF16ToString(fsName); name {
+	case "NTFS", "ReFS":
+		return nil
+	default:
+		return fmt.Errorf("volume %s is %s, which does not support hard links", syscall.UTF16ToString(volume), name)
+	}
+}
@@ -0,0 +1,90 @@
+package actions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/atomicfile"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/schema"
+)
+
+// SidecarSuffix is appended to an original's path to name its sidecar file.
+const SidecarSuffix = ".dedupe.json"
+
+// Sidecar lists the duplicates that were removed or linked to an original, so it can
+// later be told where copies used to live. It accumulates over successive runs.
+type Sidecar struct {
+	SchemaVersion int            `json:"schema_version"`
+	Original      string         `json:"original"`
+	Hash          string         `json:"hash"`
+	Group         string         `json:"group"`
+	Duplicates    []SidecarEntry `json:"duplicates"`
+}
+
+// SidecarEntry is one former duplicate of the original.
+type SidecarEntry struct {
+	Path    string    `json:"path"`
+	Action  string    `json:"action"`
+	Time    time.Time `json:"time"` // When the action was taken
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Mode    string    `json:"mode"`
+	Uid     uint32    `json:"uid"`
+	Gid     uint32    `json:"gid"`
+	Owner   string    `json:"owner,omitempty"` // User name of Uid where it resolves
+}
+
+// writeSidecar adds the duplicate of a completed op to its original's sidecar. The
+// file is replaced atomically, so a crash leaves the previous version.
+func writeSidecar(op Op) error {
+	path := op.Original.Path + SidecarSuffix
+	sc := Sidecar{
+		SchemaVersion: schema.Version,
+		Original:      op.Original.Path,
+		Hash:          iphash.HashToString(op.Original.Sum),
+		Group:         iphash.GroupID(op.Original.Sum),
+	}
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &sc); err != nil {
+			return fmt.Errorf("failed to read sidecar %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read sidecar %s: %w", path, err)
+	}
+	sc.SchemaVersion = schema.Version
+
+	e := SidecarEntry{
+		Path:    op.File.Path,
+		Action:  op.Action.String(),
+		Time:    time.Now().UTC(),
+		Size:    op.File.Size,
+		ModTime: op.File.ModTime,
+		Mode:    op.File.Mode.String(),
+		Uid:     op.File.Uid,
+		Gid:     op.File.Gid,
+	}
+	if u, err := user.LookupId(strconv.FormatUint(uint64(op.File.Uid), 10)); err == nil {
+		e.Owner = u.Username
+	}
+	sc.Duplicates = append(sc.Duplicates, e)
+
+	data, err := json.MarshalIndent(sc, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = atomicfile.Write(path, 0o600, func(w io.Writer) error {
+		_, err := w.Write(append(data, '\n'))
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write sidecar %s: %w", path, err)
+	}
+	return nil
+}
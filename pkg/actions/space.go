@@ -0,0 +1,49 @@
+package actions
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// spaceHeadroom is kept free on the destination on top of what the operations need,
+// so a preflight that passes by a handful of bytes cannot still end in ENOSPC.
+const spaceHeadroom = 64 << 20
+
+// Preflight verifies that the filesystem holding dir can take bytes more data in files
+// more files. It fails fast so that a run never stops half way with a full disk.
+func Preflight(dir string, bytes int64, files int) error {
+	probe := existingParent(dir)
+	free, inodes, err := diskFree(probe)
+	if err != nil {
+		return fmt.Errorf("cannot check free space on %s: %w", probe, err)
+	}
+	if need := uint64(bytes) + spaceHeadroom; free < need {
+		return fmt.Errorf("not enough space on %s: %d bytes free, %d bytes needed (including %d bytes headroom)", probe, free, need, spaceHeadroom)
+	}
+	// inodes is zero on filesystems that allocate them dynamically.
+	if inodes > 0 && inodes < uint64(files) {
+		return fmt.Errorf("not enough inodes on %s: %d free, %d needed", probe, inodes, files)
+	}
+	return nil
+}
+
+// FreeSpace returns the bytes available to an unprivileged user on the filesystem holding path.
+func FreeSpace(path string) (uint64, error) {
+	free, _, err := diskFree(path)
+	return free, err
+}
+
+// existingParent returns dir or its nearest existing ancestor.
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package actions
+
+import "errors"
+
+// diskFree is not implemented on this platform.
+func diskFree(path string) (bytes, inodes uint64, err error) {
+	return 0, 0, errors.New("free space check not supported on this platform")
+}
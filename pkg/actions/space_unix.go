@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package actions
+
+import "syscall"
+
+// diskFree returns the bytes and inodes available to an unprivileged user on the filesystem holding path.
+func diskFree(path string) (bytes, inodes uint64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Ffree), nil
+}
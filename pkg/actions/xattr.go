@@ -0,0 +1,37 @@
+package actions
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Xattrs maps extended attribute names to their values. On Linux this includes
+// POSIX ACLs (system.posix_acl_*) and SELinux labels (security.selinux).
+type Xattrs map[string][]byte
+
+// Diff returns the sorted names of the attributes that differ between a and b.
+func (a Xattrs) Diff(b Xattrs) []string {
+	var names []string
+	for name, v := range a {
+		if w, ok := b[name]; !ok || !bytes.Equal(v, w) {
+			names = append(names, name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// copyXattrs sets every extended attribute of src on dst. Attributes that cannot be
+// set, e.g. security labels without privileges, are collected into the error.
+func copyXattrs(src, dst string) error {
+	attrs, err := readXattrs(src)
+	if err != nil || len(attrs) == 0 {
+		return err
+	}
+	return writeXattrs(dst, attrs)
+}
@@ -0,0 +1,13 @@
+//go:build !(linux || darwin || freebsd || netbsd)
+
+package actions
+
+// readXattrs reports no attributes where extended attributes are not supported.
+func readXattrs(path string) (Xattrs, error) {
+	return nil, nil
+}
+
+// writeXattrs is a no-op where extended attributes are not supported.
+func writeXattrs(path string, attrs Xattrs) error {
+	return nil
+}
@@ -0,0 +1,61 @@
+//go:build linux || darwin || freebsd || netbsd
+
+package actions
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// readXattrs returns the extended attributes of path without following a final symlink.
+// A filesystem without attribute support yields no attributes and no error.
+func readXattrs(path string) (Xattrs, error) {
+	size, err := unix.Llistxattr(path, nil)
+	if err != nil {
+		if errors.Is(err, unix.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list attributes of %s: %w", path, err)
+	}
+	if size == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(path, buf); err != nil {
+		return nil, fmt.Errorf("failed to list attributes of %s: %w", path, err)
+	}
+
+	attrs := make(Xattrs)
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+		n, err := unix.Lgetxattr(path, string(name), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read attribute %s of %s: %w", name, path, err)
+		}
+		value := make([]byte, n)
+		if n, err = unix.Lgetxattr(path, string(name), value); err != nil {
+			return nil, fmt.Errorf("failed to read attribute %s of %s: %w", name, path, err)
+		}
+		attrs[string(name)] = value[:n]
+	}
+	return attrs, nil
+}
+
+// writeXattrs sets attrs on path, continuing past attributes that cannot be set.
+func writeXattrs(path string, attrs Xattrs) error {
+	var failed []string
+	for name, value := range attrs {
+		if err := unix.Lsetxattr(path, name, value, 0); err != nil {
+			failed = append(failed, fmt.Sprintf("%s (%v)", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to set attributes on %s: %v", path, failed)
+	}
+	return nil
+}
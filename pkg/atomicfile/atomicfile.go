@@ -0,0 +1,35 @@
+// Package atomicfile replaces files in one step, so readers of a metrics, heartbeat,
+// sidecar or cache file see either its old or its new content, never half of one, and
+// a crash mid-write leaves the old file in place.
+package atomicfile
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Write replaces the file at path with what write produces, giving it the permissions
+// perm. The content is written to a temporary file next to it, flushed to disk and
+// renamed into place; on failure the temporary file is removed and path is untouched.
+func Write(path string, perm os.FileMode, write func(io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".dedupe-"+filepath.Base(path)+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // Fails harmlessly once renamed
+	err = write(tmp)
+	if err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,48 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// TestWrite checks that a file is replaced with the new content and permissions, and
+// that a failed write leaves the old content and no temporary file behind.
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state")
+	if err := os.WriteFile(path, []byte("old"), 0o600); err != nil {
+		t.Fatalf("WriteFile returned an unexpected error: %v", err)
+	}
+	err := Write(path, 0o644, func(w io.Writer) error {
+		_, err := io.WriteString(w, "new")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Write returned an unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("Content mismatch. Got: %q, Want: %q", data, "new")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat returned an unexpected error: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o644 {
+		t.Errorf("Permissions mismatch. Got: %v, Want: %v", info.Mode().Perm(), os.FileMode(0o644))
+	}
+
+	failed := errors.New("encoding failed")
+	if err := Write(path, 0o644, func(w io.Writer) error { return failed }); err != failed {
+		t.Errorf("Write error mismatch. Got: %v, Want: %v", err, failed)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("Content after a failed write mismatch. Got: %q, Want: %q", data, "new")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,156 @@
+// Package autotune adjusts the number of hashing workers while a scan runs, following
+// the measured throughput: more workers help on network storage and RAID arrays,
+// while a single disk or a CPU-bound algorithm is slowed down by too many.
+package autotune
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// fileCost is the work counted per file on top of its bytes, so that scans of many
+// small files are measured by files per second rather than by their few bytes.
+const fileCost = 64 << 10
+
+// tolerance is the relative change of throughput below which a window counts as flat.
+const tolerance = 0.05
+
+// Tuner limits how many goroutines hash at the same time and moves the limit towards
+// the highest throughput by hill climbing: the limit keeps moving in one direction
+// while throughput improves and turns around when it does not.
+type Tuner struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int // Goroutines allowed to hash at once
+	max    int
+	active int
+	dir    int // +1 or -1: direction of the last change
+
+	// Measurements of the current window.
+	work    int64         // Bytes plus fileCost per file hashed
+	files   int64         // Files hashed
+	latency time.Duration // Summed time spent hashing them
+
+	// Outcome of the previous window.
+	prevRate    float64
+	prevLatency time.Duration
+}
+
+// New returns a Tuner allowing start goroutines at first and never more than max.
+func New(start, max int) *Tuner {
+	if start > max {
+		start = max
+	}
+	if start < 1 {
+		start = 1
+	}
+	t := &Tuner{limit: start, max: max, dir: 1}
+	t.cond = sync.NewCond(&t.mu)
+	return t
+}
+
+// Limit returns the current number of goroutines allowed to hash at once.
+func (t *Tuner) Limit() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.limit
+}
+
+// Wrap returns a HashFunc that waits for the tuner's permission before calling hash
+// and measures the call.
+func (t *Tuner) Wrap(hash fswalk.HashFunc) fswalk.HashFunc {
+	return func(path string) (iphash.HashBytes, error) {
+		t.mu.Lock()
+		for t.active >= t.limit {
+			t.cond.Wait()
+		}
+		t.active++
+		t.mu.Unlock()
+
+		started := time.Now()
+		sum, err := hash(path)
+		took := time.Since(started)
+		var size int64
+		if err == nil {
+			if info, statErr := os.Stat(path); statErr == nil {
+				size = info.Size()
+			}
+		}
+
+		t.mu.Lock()
+		t.active--
+		if err == nil {
+			t.work += size + fileCost
+			t.files++
+			t.latency += took
+		}
+		t.cond.Signal()
+		t.mu.Unlock()
+		return sum, err
+	}
+}
+
+// Run adjusts the limit once per interval until ctx is done. Afterwards every waiting
+// goroutine is let through, so a cancelled scan is not held up by the limit.
+func (t *Tuner) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.mu.Lock()
+			t.adjust()
+			t.cond.Broadcast()
+			t.mu.Unlock()
+		case <-ctx.Done():
+			t.mu.Lock()
+			t.limit = t.max
+			t.cond.Broadcast()
+			t.mu.Unlock()
+			return
+		}
+	}
+}
+
+// adjust ends a measurement window and moves the limit. Windows in which nothing
+// was hashed, e.g. while the walk has not yet found files, leave it alone.
+func (t *Tuner) adjust() {
+	if t.files == 0 {
+		return
+	}
+	rate := float64(t.work)
+	latency := t.latency / time.Duration(t.files)
+	switch {
+	case t.prevRate == 0:
+		// First window: keep climbing.
+	case rate > t.prevRate*(1+tolerance):
+		// Better: continue in the same direction.
+	case rate < t.prevRate*(1-tolerance):
+		t.dir = -t.dir
+	case latency > t.prevLatency+t.prevLatency/5:
+		// Flat throughput but slower files: the extra workers only queue up.
+		t.dir = -1
+	default:
+		// Flat: fewer workers for the same throughput are the better choice.
+		t.dir = -t.dir
+	}
+	t.prevRate, t.prevLatency = rate, latency
+	t.work, t.files, t.latency = 0, 0, 0
+
+	step := t.limit / 4
+	if step < 1 {
+		step = 1
+	}
+	t.limit += t.dir * step
+	if t.limit < 1 {
+		t.limit = 1
+	}
+	if t.limit > t.max {
+		t.limit = t.max
+	}
+}
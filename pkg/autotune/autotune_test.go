@@ -0,0 +1,71 @@
+package autotune
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// TestWrapLimit checks that no more goroutines hash at once than the limit allows.
+func TestWrapLimit(t *testing.T) {
+	tu := New(2, 8)
+	var running, peak atomic.Int32
+	hash := tu.Wrap(func(path string) (iphash.HashBytes, error) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return nil, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hash("/nonexistent")
+		}()
+	}
+	wg.Wait()
+	if peak.Load() != 2 {
+		t.Errorf("Concurrency mismatch. Got: %d, Want: 2", peak.Load())
+	}
+}
+
+// TestAdjust checks that the limit climbs while throughput improves, turns around when
+// it drops, and stays within its bounds.
+func TestAdjust(t *testing.T) {
+	tu := New(4, 6)
+	window := func(work int64) {
+		tu.work, tu.files, tu.latency = work, 1, time.Millisecond
+		tu.adjust()
+	}
+	window(100)
+	if tu.limit != 5 {
+		t.Fatalf("Limit after the first window mismatch. Got: %d, Want: 5", tu.limit)
+	}
+	window(200)
+	if tu.limit != 6 {
+		t.Fatalf("Limit after an improvement mismatch. Got: %d, Want: 6", tu.limit)
+	}
+	window(300)
+	if tu.limit != 6 {
+		t.Fatalf("Limit exceeded the maximum. Got: %d, Want: 6", tu.limit)
+	}
+	window(100)
+	if tu.limit != 5 {
+		t.Fatalf("Limit after a drop mismatch. Got: %d, Want: 5", tu.limit)
+	}
+	tu.files = 0
+	tu.adjust()
+	if tu.limit != 5 {
+		t.Errorf("An idle window changed the limit to %d", tu.limit)
+	}
+}
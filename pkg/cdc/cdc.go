@@ -0,0 +1,133 @@
+// Package cdc splits files into content-defined chunks with FastCDC, so content
+// shared between two files is found even when it sits at different offsets.
+package cdc
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/bits"
+	"os"
+)
+
+// Params bound the chunk sizes. Avg must be a power of two.
+type Params struct {
+	Min, Avg, Max int
+}
+
+// DefaultParams suit large files such as disk images and database dumps.
+var DefaultParams = Params{Min: 16 << 10, Avg: 64 << 10, Max: 256 << 10}
+
+// Chunk is one content-defined chunk: its SHA-256 digest and length.
+type Chunk struct {
+	Sum  [sha256.Size]byte
+	Size int
+}
+
+// gear holds a pseudo-random value per byte for the rolling hash. It is generated
+// from a fixed seed so chunk boundaries are the same in every run.
+var gear [256]uint64
+
+func init() {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range gear {
+		// splitmix64
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// masks returns the boundary masks used before and after the average size. Following
+// FastCDC's normalized chunking the first is harder and the second easier to match,
+// which narrows the spread of chunk sizes around Avg. The masks take the high bits of
+// the gear hash, which depend on the most recent bytes.
+func (p Params) masks() (small, large uint64) {
+	n := bits.TrailingZeros(uint(p.Avg))
+	return ^uint64(0) << (64 - n - 2), ^uint64(0) << (64 - n + 2)
+}
+
+func (p Params) validate() error {
+	if p.Min <= 0 || p.Avg <= p.Min || p.Max <= p.Avg || p.Avg&(p.Avg-1) != 0 || p.Avg < 64 {
+		return errors.New("cdc: chunk sizes must satisfy 0 < Min < Avg < Max with Avg a power of two of at least 64")
+	}
+	return nil
+}
+
+// cut returns the length of the chunk at the start of data. data holds at least Max
+// bytes unless the input ends within them.
+func (p Params) cut(data []byte, small, large uint64) int {
+	n := len(data)
+	if n <= p.Min {
+		return n
+	}
+	if n > p.Max {
+		n = p.Max
+	}
+	normal := p.Avg
+	if normal > n {
+		normal = n
+	}
+	var fp uint64
+	i := p.Min
+	for ; i < normal; i++ {
+		fp = fp<<1 + gear[data[i]]
+		if fp&small == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		fp = fp<<1 + gear[data[i]]
+		if fp&large == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
+
+// Split reads r to the end and calls fn with the data of every chunk in order. The
+// slice is only valid during the call.
+func Split(r io.Reader, p Params, fn func(data []byte) error) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	small, large := p.masks()
+	buf := make([]byte, 2*p.Max)
+	n, eof := 0, false
+	for {
+		if !eof && n < p.Max {
+			m, err := io.ReadFull(r, buf[n:])
+			n += m
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return err
+			}
+		}
+		if n == 0 {
+			return nil
+		}
+		c := p.cut(buf[:n], small, large)
+		if err := fn(buf[:c]); err != nil {
+			return err
+		}
+		n = copy(buf, buf[c:n])
+	}
+}
+
+// FileChunks returns the chunks of the file at path.
+func FileChunks(path string, p Params) ([]Chunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var chunks []Chunk
+	err = Split(f, p, func(data []byte) error {
+		chunks = append(chunks, Chunk{Sum: sha256.Sum256(data), Size: len(data)})
+		return nil
+	})
+	return chunks, err
+}
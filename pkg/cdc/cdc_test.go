@@ -0,0 +1,54 @@
+package cdc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"math/rand"
+	"testing"
+)
+
+// TestSplit checks that chunks cover the input within the size bounds, and that an
+// insertion only changes the chunks around it.
+func TestSplit(t *testing.T) {
+	p := Params{Min: 1 << 10, Avg: 4 << 10, Max: 16 << 10}
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(data)
+	chunks := func(data []byte) map[[sha256.Size]byte]bool {
+		sums := make(map[[sha256.Size]byte]bool)
+		total, count := 0, 0
+		err := Split(bytes.NewReader(data), p, func(c []byte) error {
+			if len(c) > p.Max || (len(c) < p.Min && total+len(c) != len(data)) {
+				t.Errorf("Chunk size %d outside [%d, %d]", len(c), p.Min, p.Max)
+			}
+			sums[sha256.Sum256(c)] = true
+			total += len(c)
+			count++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Split returned an unexpected error: %v", err)
+		}
+		if total != len(data) {
+			t.Errorf("Chunk total mismatch. Got: %d, Want: %d", total, len(data))
+		}
+		if avg := total / count; avg < p.Min || avg > p.Max/2 {
+			t.Errorf("Average chunk size %d far from %d", avg, p.Avg)
+		}
+		return sums
+	}
+	a := chunks(data)
+	edited := append(append(append([]byte{}, data[:500000]...), "inserted"...), data[500000:]...)
+	b := chunks(edited)
+	shared := 0
+	for sum := range b {
+		if a[sum] {
+			shared++
+		}
+	}
+	if shared < len(a)-3 {
+		t.Errorf("Shared chunks mismatch. Got: %d of %d, Want: all but at most 3", shared, len(a))
+	}
+	if err := Split(bytes.NewReader(data), Params{Min: 10, Avg: 100, Max: 1000}, nil); err == nil {
+		t.Errorf("Split accepted an average that is not a power of two")
+	}
+}
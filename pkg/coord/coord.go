@@ -0,0 +1,101 @@
+// Package coord shares a host-wide budget of hashing workers between runs of the tool
+// working on different roots at the same time.
+package coord
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ErrStopped is returned by Acquire once Stop was called.
+var ErrStopped = errors.New("worker budget stopped")
+
+// pollInterval is how long Acquire waits before trying again when every slot is held.
+const pollInterval = 50 * time.Millisecond
+
+// Budget is a pool of worker slots kept as lock files in a directory shared by every
+// participating process. Holding a slot means holding the lock on its file; the
+// operating system drops the lock when a process exits, so a crashed run never keeps
+// slots from the others.
+type Budget struct {
+	slots []*os.File
+	free  chan int // Slots no goroutine of this process holds
+
+	stopOnce sync.Once
+	stopped  chan struct{}
+}
+
+// Open joins the budget of n slots in dir, creating the directory and slot files as
+// needed. All processes sharing dir must use the same n.
+func Open(dir string, n int) (*Budget, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("worker budget must be at least 1, got %d", n)
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		return nil, fmt.Errorf("failed to create coordination directory: %w", err)
+	}
+	b := &Budget{free: make(chan int, n), stopped: make(chan struct{})}
+	for i := 0; i < n; i++ {
+		f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("slot-%d.lock", i)), os.O_RDWR|os.O_CREATE, 0o666)
+		if err != nil {
+			b.Close()
+			return nil, fmt.Errorf("failed to open worker slot: %w", err)
+		}
+		b.slots = append(b.slots, f)
+		b.free <- i
+	}
+	return b, nil
+}
+
+// Acquire blocks until a slot is free host-wide and returns the function releasing it.
+func (b *Budget) Acquire() (release func(), err error) {
+	for {
+		for tries := len(b.slots); tries > 0; tries-- {
+			var i int
+			select {
+			case i = <-b.free:
+			case <-b.stopped:
+				return nil, ErrStopped
+			}
+			ok, err := tryLock(b.slots[i])
+			if err != nil {
+				b.free <- i
+				return nil, fmt.Errorf("failed to lock worker slot: %w", err)
+			}
+			if ok {
+				return func() {
+					unlock(b.slots[i])
+					b.free <- i
+				}, nil
+			}
+			b.free <- i // Held by another process
+		}
+		select {
+		case <-time.After(pollInterval):
+		case <-b.stopped:
+			return nil, ErrStopped
+		}
+	}
+}
+
+// Stop makes waiting and future Acquire calls fail with ErrStopped, e.g. when the run
+// is cancelled. Slots already held stay held until released.
+func (b *Budget) Stop() {
+	b.stopOnce.Do(func() { close(b.stopped) })
+}
+
+// Close stops the budget and closes the slot files, releasing any locks still held.
+func (b *Budget) Close() error {
+	b.Stop()
+	var first error
+	for _, f := range b.slots {
+		if err := f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -0,0 +1,52 @@
+package coord
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestBudget checks that a slot held by one participant blocks the other until it is
+// released, and that Stop ends a wait.
+func TestBudget(t *testing.T) {
+	dir := t.TempDir()
+	a, err := Open(dir, 1)
+	if err != nil {
+		t.Fatalf("Open returned an unexpected error: %v", err)
+	}
+	defer a.Close()
+	b, err := Open(dir, 1)
+	if err != nil {
+		t.Fatalf("Open returned an unexpected error: %v", err)
+	}
+	defer b.Close()
+
+	release, err := a.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire returned an unexpected error: %v", err)
+	}
+	got := make(chan error, 1)
+	go func() {
+		rel, err := b.Acquire()
+		if err == nil {
+			rel()
+		}
+		got <- err
+	}()
+	select {
+	case err := <-got:
+		t.Fatalf("Acquire returned while the only slot was held: %v", err)
+	case <-time.After(3 * pollInterval):
+	}
+	release()
+	if err := <-got; err != nil {
+		t.Errorf("Acquire after release returned an unexpected error: %v", err)
+	}
+
+	release, _ = a.Acquire()
+	defer release()
+	b.Stop()
+	if _, err := b.Acquire(); !errors.Is(err, ErrStopped) {
+		t.Errorf("Acquire after Stop mismatch. Got: %v, Want: %v", err, ErrStopped)
+	}
+}
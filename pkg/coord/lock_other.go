@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly && !windows
+
+package coord
+
+import (
+	"errors"
+	"os"
+)
+
+func tryLock(f *os.File) (ok bool, err error) {
+	return false, errors.New("not supported on this platform")
+}
+
+func unlock(f *os.File) {}
@@ -0,0 +1,94 @@
+// Package doctext extracts the text of PDF and DOCX documents, well enough to tell
+// whether two files hold the same words. Layout, fonts and metadata are ignored.
+package doctext
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// maxDocumentSize bounds the documents read, as PDFs are parsed in memory.
+const maxDocumentSize = 64 << 20
+
+// ErrUnsupported is returned for files that are neither PDF nor DOCX.
+var ErrUnsupported = errors.New("not a PDF or DOCX document")
+
+// Supported reports whether Extract handles files with the extension of path.
+func Supported(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf", ".docx":
+		return true
+	}
+	return false
+}
+
+// Extract returns the text of the PDF or DOCX document at path, chosen by extension.
+// Word and line breaks are not reliable in PDF text, so callers should compare text
+// with whitespace removed.
+func Extract(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return pdfText(path)
+	case ".docx":
+		return docxText(path)
+	}
+	return "", ErrUnsupported
+}
+
+// docxText returns the text runs of the main document part, one line per paragraph.
+func docxText(path string) (string, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return "", err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.Name != "word/document.xml" {
+			continue
+		}
+		if f.UncompressedSize64 > maxDocumentSize {
+			return "", fmt.Errorf("%s: document part larger than %d bytes", path, maxDocumentSize)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		return wordText(rc)
+	}
+	return "", fmt.Errorf("%s: no word/document.xml part", path)
+}
+
+// wordText collects the character data of w:t elements, ending a line at every w:p.
+func wordText(r io.Reader) (string, error) {
+	dec := xml.NewDecoder(r)
+	var b strings.Builder
+	inText := false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return b.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			inText = t.Name.Local == "t"
+		case xml.EndElement:
+			inText = false
+			if t.Name.Local == "p" {
+				b.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				b.Write(t)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package doctext
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePDF writes a one-page PDF showing content, Flate-compressed if asked.
+func writePDF(t *testing.T, path, content string, compress bool) {
+	data, filter := []byte(content), ""
+	if compress {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data, filter = buf.Bytes(), " /Filter /FlateDecode"
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\n")
+	fmt.Fprintf(&b, "4 0 obj\n<< /Length %d%s >>\nstream\n", len(data), filter)
+	b.Write(data)
+	b.WriteString("\nendstream\nendobj\n%%EOF\n")
+	if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestExtract checks the text of PDF content streams, compressed or not, with
+// escapes, hex strings and kerned arrays, and of DOCX paragraphs.
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	pdf := filepath.Join(dir, "a.pdf")
+	writePDF(t, pdf, "BT /F1 12 Tf 72 712 Td [(Quar)-20(terly)] TJ (report \\(draft\\)) Tj <4f4B> Tj ET\n(not shown) Tj", true)
+	got, err := Extract(pdf)
+	if err != nil {
+		t.Fatalf("Extract returned an unexpected error: %v", err)
+	}
+	if want := "Quar terly report (draft) OK "; got != want {
+		t.Errorf("PDF text mismatch. Got: %q, Want: %q", got, want)
+	}
+	plain := filepath.Join(dir, "b.PDF")
+	writePDF(t, plain, "BT (Hello) Tj ET", false)
+	if got, err := Extract(plain); err != nil || got != "Hello " {
+		t.Errorf("Uncompressed PDF text mismatch. Got: %q (%v), Want: %q", got, err, "Hello ")
+	}
+
+	docx := filepath.Join(dir, "c.docx")
+	f, err := os.Create(docx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("word/document.xml")
+	w.Write([]byte(`<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>` +
+		`<w:p><w:r><w:t>First</w:t></w:r><w:r><w:t xml:space="preserve"> line</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>Second &amp; last</w:t></w:r></w:p></w:body></w:document>`))
+	zw.Close()
+	f.Close()
+	if got, err := Extract(docx); err != nil || got != "First line\nSecond & last\n" {
+		t.Errorf("DOCX text mismatch. Got: %q (%v)", got, err)
+	}
+
+	if _, err := Extract(filepath.Join(dir, "notes.txt")); err != ErrUnsupported {
+		t.Errorf("Extract error mismatch. Got: %v, Want: %v", err, ErrUnsupported)
+	}
+	if Supported("x.txt") || !Supported("X.DOCX") {
+		t.Errorf("Supported mismatch for x.txt or X.DOCX")
+	}
+	if _, err := Extract(filepath.Join(dir, "missing.pdf")); err == nil {
+		t.Errorf("Extract succeeded for a missing file")
+	}
+}
+
+// TestPDFStreamsLimit checks that the decoded size limit covers all streams of a
+// document together, not each stream on its own.
+func TestPDFStreamsLimit(t *testing.T) {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	for i := 0; i < 8; i++ {
+		var buf bytes.Buffer
+		zw := zlib.NewWriter(&buf)
+		zw.Write(append([]byte("BT (x) Tj ET "), make([]byte, 1000)...))
+		zw.Close()
+		fmt.Fprintf(&b, "%d 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", i+1, buf.Len())
+		b.Write(buf.Bytes())
+		b.WriteString("\nendstream\nendobj\n")
+	}
+	shown := 0
+	if err := pdfStreams(b.Bytes(), 1<<20, func([]byte) { shown++ }); err != nil || shown != 8 {
+		t.Errorf("pdfStreams within the limit mismatch. Got: %d streams (%v), Want: 8", shown, err)
+	}
+	shown = 0
+	if err := pdfStreams(b.Bytes(), 5000, func([]byte) { shown++ }); err == nil || shown != 4 {
+		t.Errorf("pdfStreams beyond the limit mismatch. Got: %d streams (%v), Want: 4 and an error", shown, err)
+	}
+}
@@ -0,0 +1,250 @@
+package doctext
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// pdfText returns the strings shown by the text objects of every uncompressed or
+// Flate-compressed stream of the PDF at path. Strings are decoded as single bytes, so
+// text in fonts with two-byte codes comes out as the same codes each time rather than
+// as readable text; that is enough to compare re-saved copies of one document.
+// Encrypted and image-only PDFs yield little or no text, and PDFs whose streams decode
+// to more than maxDocumentSize bytes in total an error.
+func pdfText(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, maxDocumentSize+1))
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxDocumentSize {
+		return "", fmt.Errorf("%s: larger than %d bytes", path, maxDocumentSize)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", fmt.Errorf("%s: not a PDF file", path)
+	}
+	var b strings.Builder
+	if err := pdfStreams(data, maxDocumentSize, func(content []byte) { showText(&b, content) }); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return b.String(), nil
+}
+
+// pdfStreams calls show with the decoded data of every stream without a filter or with
+// only FlateDecode, one stream at a time. Streams with other filters, such as images,
+// are skipped. It fails once the streams decode to more than limit bytes together, so
+// a document cannot get around the size limit with many small inflating streams.
+func pdfStreams(data []byte, limit int, show func([]byte)) error {
+	total := 0
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], []byte("stream"))
+		if i < 0 {
+			return nil
+		}
+		start := pos + i
+		pos = start + len("stream")
+		if start >= 3 && bytes.HasSuffix(data[:start], []byte("end")) {
+			continue // "endstream"
+		}
+		dictEnd := bytes.LastIndex(data[:start], []byte(">>"))
+		if dictEnd < 0 || len(bytes.TrimSpace(data[dictEnd+2:start])) != 0 {
+			continue
+		}
+		dictStart := bytes.LastIndex(data[:dictEnd], []byte("obj"))
+		if dictStart < 0 {
+			continue
+		}
+		dict := data[dictStart:dictEnd]
+		body := pos
+		if body < len(data) && data[body] == '\r' {
+			body++
+		}
+		if body < len(data) && data[body] == '\n' {
+			body++
+		}
+		end := bytes.Index(data[body:], []byte("endstream"))
+		if end < 0 {
+			return nil
+		}
+		raw := data[body : body+end]
+		pos = body + end + len("endstream")
+		if !bytes.Contains(dict, []byte("/Filter")) {
+			if total += len(raw); total > limit {
+				return fmt.Errorf("streams decode to more than %d bytes", limit)
+			}
+			show(raw)
+			continue
+		}
+		if bytes.Count(dict, []byte("Decode")) != 1 || !bytes.Contains(dict, []byte("/FlateDecode")) {
+			continue
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			continue
+		}
+		// A truncated or slightly damaged stream still gives its leading text.
+		decoded, _ := io.ReadAll(io.LimitReader(zr, int64(limit-total)+1))
+		zr.Close()
+		if total += len(decoded); total > limit {
+			return fmt.Errorf("streams decode to more than %d bytes", limit)
+		}
+		show(decoded)
+	}
+}
+
+// showText appends to b the strings between BT and ET operators of a content stream,
+// each followed by a space.
+func showText(b *strings.Builder, content []byte) {
+	inText := false
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		switch {
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '(':
+			s, n := literalString(content[i:])
+			if inText {
+				b.WriteString(s)
+				b.WriteByte(' ')
+			}
+			i += n - 1
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			s, n := hexString(content[i:])
+			if inText {
+				b.WriteString(s)
+				b.WriteByte(' ')
+			}
+			i += n - 1
+		case isOperator(content, i, "BT"):
+			inText = true
+		case isOperator(content, i, "ET"):
+			inText = false
+		}
+	}
+}
+
+// isOperator reports whether the operator op stands alone at content[i:].
+func isOperator(content []byte, i int, op string) bool {
+	if !bytes.HasPrefix(content[i:], []byte(op)) {
+		return false
+	}
+	before := i == 0 || isDelimiter(content[i-1])
+	after := i+len(op) == len(content) || isDelimiter(content[i+len(op)])
+	return before && after
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte(" \t\r\n\f\x00()<>[]{}/%", c) >= 0
+}
+
+// literalString decodes the (...) string at the start of s and returns it with the
+// number of bytes it took, including the parentheses.
+func literalString(s []byte) (string, int) {
+	var out []byte
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return latin1(out), i + 1
+			}
+		case '\\':
+			i++
+			if i == len(s) {
+				return latin1(out), i
+			}
+			switch e := s[i]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				if e == '\r' && i+1 < len(s) && s[i+1] == '\n' {
+					i++
+				}
+				continue // Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v := 0
+					for n := 0; n < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7'; n++ {
+						v = v*8 + int(s[i]-'0')
+						i++
+					}
+					i--
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return latin1(out), len(s)
+}
+
+// hexString decodes the <...> string at the start of s and returns it with the
+// number of bytes it took.
+func hexString(s []byte) (string, int) {
+	end := bytes.IndexByte(s, '>')
+	if end < 0 {
+		end = len(s) - 1
+	}
+	var digits []byte
+	for _, c := range s[1:end] {
+		if v := unhex(c); v >= 0 {
+			digits = append(digits, byte(v))
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, 0)
+	}
+	out := make([]byte, len(digits)/2)
+	for i := range out {
+		out[i] = digits[2*i]<<4 | digits[2*i+1]
+	}
+	return latin1(out), end + 1
+}
+
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c-'a') + 10
+	case c >= 'A' && c <= 'F':
+		return int(c-'A') + 10
+	}
+	return -1
+}
+
+// latin1 converts bytes to a string rune by rune, so every byte stays one character.
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
@@ -0,0 +1,110 @@
+package fswalk
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Count walks root like DigestAll, reading only metadata, and returns the number and
+// total size of the regular files DigestAll would hash. Unreadable directories and
+// entries are left out silently; the totals only serve as an estimate, e.g. for the
+// percentage and remaining time of a progress display.
+func Count(ctx context.Context, root string, numWorkers int, opts Options) (files, bytes uint64, err error) {
+	var mu sync.Mutex
+	cond := sync.NewCond(&mu)
+	queue := opts.roots(root) // Directories not yet read
+	pending := len(queue)     // Directories queued or being read
+
+	var wg sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mu.Lock()
+				for len(queue) == 0 && pending > 0 && ctx.Err() == nil {
+					cond.Wait()
+				}
+				if len(queue) == 0 || ctx.Err() != nil {
+					mu.Unlock()
+					return
+				}
+				dir := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				mu.Unlock()
+
+				subdirs, n, size := countDir(dir, opts)
+
+				mu.Lock()
+				files += n
+				bytes += size
+				queue = append(queue, subdirs...)
+				pending += len(subdirs) - 1
+				cond.Broadcast()
+				mu.Unlock()
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			mu.Lock()
+			cond.Broadcast() // Wake waiting workers so they notice the cancellation
+			mu.Unlock()
+		case <-done:
+		}
+	}()
+	wg.Wait()
+	close(done)
+	return files, bytes, ctx.Err()
+}
+
+// countDir reads one directory for Count: its subdirectories to walk and the number
+// and size of the regular files in it that would be hashed.
+func countDir(dir string, opts Options) (subdirs []string, files, bytes uint64) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, 0
+	}
+	var dirDev uint64
+	haveDirDev := false
+	if !opts.IncludePseudoFS {
+		if info, err := os.Lstat(dir); err == nil {
+			dirDev, haveDirDev = deviceOf(info)
+		}
+	}
+	for _, entry := range entries {
+		fullPath := filepath.Join(dir, entry.Name())
+		isDir, isRegular := entry.IsDir(), entry.Type().IsRegular()
+		var info os.FileInfo
+		if isReparsePoint(entry) {
+			if !opts.FollowReparsePoints {
+				continue
+			}
+			if info, err = os.Stat(fullPath); err != nil {
+				continue
+			}
+			isDir, isRegular = info.IsDir(), info.Mode().IsRegular()
+		}
+		switch {
+		case isDir:
+			if (opts.IncludePseudoFS || !isPseudoDir(fullPath, entry, dirDev, haveDirDev)) && (opts.SkipDir == nil || !opts.SkipDir(fullPath)) {
+				subdirs = append(subdirs, fullPath)
+			}
+		case isRegular:
+			if info == nil {
+				if info, err = entry.Info(); err != nil {
+					continue
+				}
+			}
+			if opts.Skip == nil || !opts.Skip(fullPath, info) {
+				files++
+				bytes += uint64(info.Size())
+			}
+		}
+	}
+	return subdirs, files, bytes
+}
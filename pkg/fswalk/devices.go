@@ -0,0 +1,54 @@
+package fswalk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DeviceSet holds device numbers as reported in FileRecord.Dev, e.g. of filesystems
+// a scan must leave alone.
+type DeviceSet map[uint64]bool
+
+// ResolveDevice returns the device numbers of the filesystems on spec: a block device
+// such as /dev/sdb1 or /dev/mapper/vg-data, or a filesystem UUID, optionally written
+// UUID=... as in fstab. Besides the device's own number, every mount of it counts,
+// since btrfs and bind mounts report other numbers for the files they hold.
+func ResolveDevice(spec string) (DeviceSet, error) {
+	path := spec
+	if uuid := strings.TrimPrefix(spec, "UUID="); uuid != spec || !strings.ContainsRune(spec, filepath.Separator) {
+		var err error
+		if path, err = uuidPath(uuid); err != nil {
+			return nil, err
+		}
+	}
+	dev, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(dev)
+	if err != nil {
+		return nil, err
+	}
+	rdev, ok := rdevOf(info)
+	if !ok || info.Mode()&os.ModeDevice == 0 {
+		return nil, fmt.Errorf("%s is not a device", spec)
+	}
+	set := DeviceSet{rdev: true}
+	for _, d := range mountDevices(dev) {
+		set[d] = true
+	}
+	return set, nil
+}
+
+// Holds reports whether path itself lies on one of the devices. A path that cannot
+// be examined does not.
+func (s DeviceSet) Holds(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	dev, ok := deviceOf(info)
+	return ok && s[dev]
+}
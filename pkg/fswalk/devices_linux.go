@@ -0,0 +1,154 @@
+package fswalk
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// mountEntry is one line of /proc/self/mountinfo.
+type mountEntry struct {
+	dev        uint64 // Device number the mount reports for its files
+	mountpoint string
+	fstype     string
+	source     string
+	superOpts  string // Per-superblock options, e.g. overlayfs' lowerdir=...
+}
+
+// readMountInfo returns the mounts visible to the process.
+func readMountInfo() []mountEntry {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	return parseMountInfo(f)
+}
+
+// parseMountInfo reads mountinfo lines such as
+// "36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue".
+func parseMountInfo(r io.Reader) []mountEntry {
+	var mounts []mountEntry
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 5 || sep+3 >= len(fields) {
+			continue
+		}
+		major, minor, ok := strings.Cut(fields[2], ":")
+		maj, err1 := strconv.ParseUint(major, 10, 32)
+		mnr, err2 := strconv.ParseUint(minor, 10, 32)
+		if !ok || err1 != nil || err2 != nil {
+			continue
+		}
+		mounts = append(mounts, mountEntry{
+			dev:        unix.Mkdev(uint32(maj), uint32(mnr)),
+			mountpoint: unescapeMountInfo(fields[4]),
+			fstype:     fields[sep+1],
+			source:     unescapeMountInfo(fields[sep+2]),
+			superOpts:  unescapeMountInfo(fields[sep+3]),
+		})
+	}
+	return mounts
+}
+
+// unescapeMountInfo decodes the octal escapes (\040 for a space, ...) of mountinfo fields.
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// uuidPath returns the device node udev links to a filesystem UUID.
+func uuidPath(uuid string) (string, error) {
+	return filepath.Join("/dev/disk/by-uuid", uuid), nil
+}
+
+// mountDevices returns the device numbers the mounts of dev report for their files.
+func mountDevices(dev string) []uint64 {
+	return devicesOf(readMountInfo(), dev, func(source string) string {
+		if resolved, err := filepath.EvalSymlinks(source); err == nil {
+			return resolved
+		}
+		return source
+	})
+}
+
+// devicesOf returns the device numbers of the mounts whose source resolves to dev.
+func devicesOf(mounts []mountEntry, dev string, resolve func(string) string) []uint64 {
+	var devs []uint64
+	for _, m := range mounts {
+		if resolve(m.source) == dev {
+			devs = append(devs, m.dev)
+		}
+	}
+	return devs
+}
+
+// Overlays returns the overlayfs mounts visible to the process, with their layers.
+func Overlays() []Overlay {
+	var overlays []Overlay
+	for _, m := range readMountInfo() {
+		if m.fstype == "overlay" {
+			overlays = append(overlays, parseOverlay(m.mountpoint, m.superOpts))
+		}
+	}
+	return overlays
+}
+
+// parseOverlay reads the layers of an overlayfs mount from its superblock options,
+// e.g. "rw,lowerdir=/l1:/l2,upperdir=/u,workdir=/w". Colons within a lower
+// directory are escaped with a backslash.
+func parseOverlay(mountpoint, opts string) Overlay {
+	o := Overlay{Mountpoint: mountpoint}
+	for _, opt := range strings.Split(opts, ",") {
+		key, value, _ := strings.Cut(opt, "=")
+		switch key {
+		case "upperdir":
+			o.Upper = value
+		case "workdir":
+			o.Work = value
+		case "lowerdir":
+			var dir strings.Builder
+			for i := 0; i <= len(value); i++ {
+				switch {
+				case i == len(value) || value[i] == ':':
+					if dir.Len() > 0 {
+						o.Lower = append(o.Lower, dir.String())
+					}
+					dir.Reset()
+				case value[i] == '\\' && i+1 < len(value):
+					i++
+					dir.WriteByte(value[i])
+				default:
+					dir.WriteByte(value[i])
+				}
+			}
+		}
+	}
+	return o
+}
@@ -0,0 +1,72 @@
+package fswalk
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// TestParseMountInfo checks that every mount of a device is found by its resolved
+// source, including btrfs subvolumes with their own device numbers.
+func TestParseMountInfo(t *testing.T) {
+	info := `22 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda2 rw
+36 22 0:45 /@home /home rw,relatime shared:2 - btrfs /dev/sdb1 rw,subvol=/@home
+37 22 0:46 /@data /data rw - btrfs /dev/disk/by-label/data rw
+38 22 8:17 / /mnt rw - vfat /dev/sdb10 rw
+`
+	resolve := func(source string) string {
+		return strings.Replace(source, "/dev/disk/by-label/data", "/dev/sdb1", 1)
+	}
+	got := devicesOf(parseMountInfo(strings.NewReader(info)), "/dev/sdb1", resolve)
+	want := []uint64{unix.Mkdev(0, 45), unix.Mkdev(0, 46)}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("devicesOf mismatch. Got: %v, Want: %v", got, want)
+	}
+}
+
+// TestParseOverlay checks that the layers of an overlayfs mount are read from
+// mountinfo, with escaped spaces and colons in the layer paths.
+func TestParseOverlay(t *testing.T) {
+	info := `22 1 8:2 / / rw,relatime shared:1 - ext4 /dev/sda2 rw
+41 22 0:52 / /var/lib/docker/overlay2/abc/merged rw,relatime - overlay overlay rw,lowerdir=/l/A:/l/my\040layer:/l/c\134:d,upperdir=/var/lib/docker/overlay2/abc/diff,workdir=/var/lib/docker/overlay2/abc/work
+`
+	mounts := parseMountInfo(strings.NewReader(info))
+	if len(mounts) != 2 || mounts[1].fstype != "overlay" {
+		t.Fatalf("parseMountInfo mismatch. Got: %+v", mounts)
+	}
+	got := parseOverlay(mounts[1].mountpoint, mounts[1].superOpts)
+	want := Overlay{
+		Mountpoint: "/var/lib/docker/overlay2/abc/merged",
+		Upper:      "/var/lib/docker/overlay2/abc/diff",
+		Lower:      []string{"/l/A", "/l/my layer", "/l/c:d"},
+		Work:       "/var/lib/docker/overlay2/abc/work",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseOverlay mismatch. Got: %+v, Want: %+v", got, want)
+	}
+}
+
+// TestDeviceSet checks Holds against the device of a directory, and that a regular
+// file is refused as a device.
+func TestDeviceSet(t *testing.T) {
+	dir := t.TempDir()
+	info, err := os.Lstat(dir)
+	if err != nil {
+		t.Fatalf("Lstat returned an unexpected error: %v", err)
+	}
+	dev, _ := deviceOf(info)
+	if !(DeviceSet{dev: true}).Holds(dir) || (DeviceSet{dev + 1: true}).Holds(dir) {
+		t.Errorf("Holds mismatch for device %d", dev)
+	}
+	file := filepath.Join(dir, "f")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("WriteFile returned an unexpected error: %v", err)
+	}
+	if _, err := ResolveDevice(file); err == nil {
+		t.Errorf("ResolveDevice accepted a regular file")
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package fswalk
+
+import "errors"
+
+// uuidPath is unavailable without udev's /dev/disk/by-uuid links.
+func uuidPath(uuid string) (string, error) {
+	return "", errors.New("filesystem UUIDs can only be resolved on Linux; give the device path")
+}
+
+// mountDevices finds no further device numbers: outside Linux, files report the
+// number of the device they are stored on.
+func mountDevices(dev string) []uint64 {
+	return nil
+}
+
+// Overlays finds no mounts: overlayfs only exists on Linux.
+func Overlays() []Overlay {
+	return nil
+}
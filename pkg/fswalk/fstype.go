@@ -0,0 +1,8 @@
+package fswalk
+
+// FSInfo describes the filesystem holding a path.
+type FSInfo struct {
+	Name    string // Filesystem type, e.g. ext4, nfs, smbfs
+	Network bool   // Remote or FUSE-backed: inode numbers and link semantics are unreliable
+	Pseudo  bool   // Virtual kernel filesystem (proc, sysfs, ...): never worth walking
+}
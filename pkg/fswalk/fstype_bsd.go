@@ -0,0 +1,34 @@
+//go:build darwin || freebsd
+
+package fswalk
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// networkFSNames are the Fstypename values of remote and FUSE filesystems.
+var networkFSNames = []string{"nfs", "smbfs", "afpfs", "webdav", "cifs", "fusefs", "macfuse", "osxfuse"}
+
+// pseudoFSNames are virtual filesystems that are never worth walking.
+var pseudoFSNames = map[string]bool{"devfs": true, "procfs": true, "linprocfs": true, "linsysfs": true, "fdescfs": true, "autofs": true}
+
+// pseudoPaths are skipped by path as well.
+var pseudoPaths = map[string]bool{"/dev": true, "/proc": true, "/System/Volumes/VM": true}
+
+// FilesystemType identifies the filesystem holding path.
+func FilesystemType(path string) (FSInfo, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return FSInfo{}, err
+	}
+	name := unix.ByteSliceToString(st.Fstypename[:])
+	info := FSInfo{Name: name, Pseudo: pseudoFSNames[name]}
+	for _, n := range networkFSNames {
+		if name == n || strings.HasPrefix(name, n+".") {
+			info.Network = true
+		}
+	}
+	return info, nil
+}
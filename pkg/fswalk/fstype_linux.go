@@ -0,0 +1,64 @@
+package fswalk
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// linuxFSTypes maps statfs f_type magic numbers to names. Only types the tool
+// treats specially are listed; others are reported by number.
+var linuxFSTypes = map[int64]FSInfo{
+	0x6969:     {Name: "nfs", Network: true},
+	0x517b:     {Name: "smb", Network: true},
+	0xff534d42: {Name: "cifs", Network: true},
+	0xfe534d42: {Name: "smb2", Network: true},
+	0x65735546: {Name: "fuse", Network: true},
+	0x00c36400: {Name: "ceph", Network: true},
+	0x01021997: {Name: "9p", Network: true},
+	0x5346414f: {Name: "afs", Network: true},
+	0x47504653: {Name: "gpfs", Network: true},
+	0x0bd00bd0: {Name: "lustre", Network: true},
+	0xef53:     {Name: "ext4"},
+	0x9123683e: {Name: "btrfs"},
+	0x58465342: {Name: "xfs"},
+	0x2fc12fc1: {Name: "zfs"},
+	0x01021994: {Name: "tmpfs"},
+	0x794c7630: {Name: "overlayfs"},
+	0x9fa0:     {Name: "proc", Pseudo: true},
+	0x62656572: {Name: "sysfs", Pseudo: true},
+	0x1cd1:     {Name: "devpts", Pseudo: true},
+	0x27e0eb:   {Name: "cgroup", Pseudo: true},
+	0x63677270: {Name: "cgroup2", Pseudo: true},
+	0x64626720: {Name: "debugfs", Pseudo: true},
+	0x73636673: {Name: "securityfs", Pseudo: true},
+	0x74726163: {Name: "tracefs", Pseudo: true},
+	0xcafe4a11: {Name: "bpf", Pseudo: true},
+	0x6165676c: {Name: "pstore", Pseudo: true},
+	0x62656570: {Name: "configfs", Pseudo: true},
+	0x19800202: {Name: "mqueue", Pseudo: true},
+	0x958458f6: {Name: "hugetlbfs", Pseudo: true},
+	0x0187:     {Name: "autofs", Pseudo: true},
+	0x42494e4d: {Name: "binfmt_misc", Pseudo: true},
+	0x65735543: {Name: "fusectl", Pseudo: true},
+	0xde5e81e4: {Name: "efivarfs", Pseudo: true},
+	0xf97cff8c: {Name: "selinuxfs", Pseudo: true},
+	0x6e736673: {Name: "nsfs", Pseudo: true},
+	0x67596969: {Name: "rpc_pipefs", Pseudo: true},
+}
+
+// pseudoPaths are skipped by path as well, since /dev and /run are tmpfs mounts
+// that cannot be told apart from ordinary ones by their type.
+var pseudoPaths = map[string]bool{"/proc": true, "/sys": true, "/dev": true, "/run": true}
+
+// FilesystemType identifies the filesystem holding path.
+func FilesystemType(path string) (FSInfo, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return FSInfo{}, err
+	}
+	if info, ok := linuxFSTypes[int64(st.Type)]; ok {
+		return info, nil
+	}
+	return FSInfo{Name: fmt.Sprintf("0x%x", st.Type)}, nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package fswalk
+
+// FilesystemType cannot identify filesystems on this platform.
+func FilesystemType(path string) (FSInfo, error) {
+	return FSInfo{Name: "unknown"}, nil
+}
+
+// pseudoPaths is empty: there are no virtual filesystems to skip here.
+var pseudoPaths = map[string]bool{}
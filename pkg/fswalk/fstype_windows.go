@@ -0,0 +1,32 @@
+package fswalk
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// FilesystemType identifies the kind of volume holding path. UNC paths and
+// mapped network drives are reported as network filesystems.
+func FilesystemType(path string) (FSInfo, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return FSInfo{}, err
+	}
+	volume := filepath.VolumeName(abs)
+	if strings.HasPrefix(volume, `\\`) {
+		return FSInfo{Name: "unc", Network: true}, nil
+	}
+	root, err := windows.UTF16PtrFromString(volume + `\`)
+	if err != nil {
+		return FSInfo{}, err
+	}
+	if windows.GetDriveType(root) == windows.DRIVE_REMOTE {
+		return FSInfo{Name: "remote", Network: true}, nil
+	}
+	return FSInfo{Name: "local"}, nil
+}
+
+// pseudoPaths is empty: there are no virtual filesystems to skip here.
+var pseudoPaths = map[string]bool{}
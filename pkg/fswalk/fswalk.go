@@ -0,0 +1,499 @@
+// /home/nicky/src/go/go-file-dedupe/pkg/fswalk/fswalk.go
+package fswalk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash" // Make sure this import path is correct
+)
+
+// HashFunc defines the signature for functions that can hash a file.
+// It matches the signatures of GetFileHashMD5bytes and GetFileHashSHA256bytes.
+// Exported so it can be used by the caller (main.go).
+type HashFunc func(filePath string) (iphash.HashBytes, error)
+
+// FileRecord is a hashed file together with the metadata gathered while walking.
+type FileRecord struct {
+	Path    string
+	Sum     iphash.HashBytes
+	Size    int64
+	Alloc   int64 // Bytes allocated on disk; below Size for sparse files, Size where unknown
+	ModTime time.Time
+	Mode    os.FileMode
+	Uid     uint32 // Owner; zero where the platform has no numeric owner
+	Gid     uint32
+	Dev     uint64 // Device and inode identify the file; zero where unsupported
+	Ino     uint64
+	Nlink   uint64
+}
+
+// newRecord fills a FileRecord from the walker's stat information.
+func newRecord(path string, info os.FileInfo) FileRecord {
+	rec := FileRecord{
+		Path:    path,
+		Size:    info.Size(),
+		Alloc:   info.Size(),
+		ModTime: info.ModTime(),
+		Mode:    info.Mode(),
+	}
+	fillSys(&rec, info)
+	return rec
+}
+
+// Sparse reports whether the file has holes: fewer bytes allocated than its apparent size.
+// Holes read as zeros, so a sparse file hashes the same as a fully written copy.
+func (r FileRecord) Sparse() bool {
+	return r.Alloc < r.Size
+}
+
+// A result is the product of reading and summing a file.
+type result struct {
+	rec FileRecord
+	err error
+}
+
+// digester reads file records from files and sends digests of the corresponding
+// files on c until either files or done is closed.
+func digester(ctx context.Context, files <-chan FileRecord, c chan<- result, hashFile HashFunc) {
+	for rec := range files {
+		data, err := hashFile(rec.Path)
+		rec.Sum = data
+		select {
+		case c <- result{rec, err}:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Options tune the walk. The zero value is the default behaviour.
+type Options struct {
+	// FollowReparsePoints descends into Windows junctions and reads reparse-point files
+	// instead of skipping them.
+	FollowReparsePoints bool
+
+	// IncludePseudoFS walks virtual filesystems such as /proc and /sys, which are
+	// skipped by default because reading kernel pseudo-files can hang or never end.
+	IncludePseudoFS bool
+
+	// Retries is how often a file is hashed again after a transient I/O error
+	// (EINTR, EAGAIN, NFS timeouts, ...) before it is reported as failed.
+	Retries    int
+	RetryDelay time.Duration // Wait before the first retry, doubled for each further one
+
+	// MaxErrors aborts the walk with ErrTooManyErrors once this many directories or
+	// files could not be read. Zero means no limit.
+	MaxErrors int
+
+	// SkipPermErrors only counts unreadable directories and files (EACCES/EPERM) instead
+	// of warning about each one, and leaves them out of MaxErrors. Home-directory scans
+	// always meet a few of these; combined with MaxErrors 1 any other error is still fatal.
+	SkipPermErrors bool
+
+	// Skip leaves out regular files for which it returns true: they are neither hashed
+	// nor returned, only counted in Stats.Excluded.
+	Skip func(path string, info os.FileInfo) bool
+
+	// SkipDir leaves out directories below the roots for which it returns true: they
+	// are not read at all, only counted in Stats.ExcludedDirs.
+	SkipDir func(path string) bool
+
+	// OnSymlink, when set, is called with the path of every symbolic link found. Links
+	// are still not followed and are counted in Stats.Symlinks. It may be called from
+	// several goroutines at once.
+	OnSymlink func(path string)
+
+	// OnError, when set, is called with every read error counted in Stats, e.g. to
+	// collect them for a report. It may be called from several goroutines at once.
+	OnError func(path string, err error)
+
+	// OnWalkDone, when set, is called once every directory has been listed; files
+	// found last may still be hashing. It lets callers time the walk on its own.
+	OnWalkDone func()
+
+	// Roots, when set, are the directories walked instead of the root passed to
+	// DigestAll or Count. They should not lie below one another.
+	Roots []string
+
+	// Unchanged, when set, is asked about every directory before DigestAll reads it.
+	// When it returns true with the records, digests included, of every file below the
+	// directory and the paths of the directories below it, those are returned as if
+	// walked and hashed and the directory is not read.
+	Unchanged func(dir string) (files []FileRecord, dirs []string, ok bool)
+
+	// OnDirListed, when set, is called with every directory DigestAll reads and its
+	// stat information, taken before it was read. It may be called from several
+	// goroutines at once.
+	OnDirListed func(dir string, info os.FileInfo)
+}
+
+// roots returns the directories a walk of root starts from.
+func (o Options) roots(root string) []string {
+	if len(o.Roots) > 0 {
+		return append([]string(nil), o.Roots...)
+	}
+	return []string{root}
+}
+
+// ErrTooManyErrors is returned by DigestAll when Options.MaxErrors was reached. The
+// partial results are incomplete in a way that would hide duplicates, so callers
+// should not report them.
+var ErrTooManyErrors = errors.New("too many read errors")
+
+// Stats counts the entries a walk skipped, by reason, and the bytes it hashed.
+type Stats struct {
+	ReparsePoints atomic.Uint64
+	PseudoFS      atomic.Uint64 // Virtual filesystem mount points
+	Retries       atomic.Uint64 // Hash attempts repeated after a transient error
+	HashErrors    atomic.Uint64 // Files dropped because they could not be hashed
+	DirErrors     atomic.Uint64 // Directories or entries that could not be read
+	PermErrors    atomic.Uint64 // Permission errors skipped under SkipPermErrors
+	Excluded      atomic.Uint64 // Regular files left out by Options.Skip
+	ExcludedDirs  atomic.Uint64 // Directories left out by Options.SkipDir
+	HashedBytes   atomic.Uint64 // Total size of the files hashed so far
+
+	// Non-regular files, which are never hashed.
+	Symlinks   atomic.Uint64
+	Sockets    atomic.Uint64
+	NamedPipes atomic.Uint64
+	Devices    atomic.Uint64 // Character and block device nodes
+	Irregular  atomic.Uint64 // Anything else, e.g. Solaris doors or unknown types
+}
+
+// Reset zeroes every counter, e.g. before the walk is repeated.
+func (s *Stats) Reset() {
+	for _, c := range []*atomic.Uint64{
+		&s.ReparsePoints, &s.PseudoFS, &s.Retries, &s.HashErrors, &s.DirErrors, &s.PermErrors, &s.Excluded, &s.ExcludedDirs, &s.HashedBytes,
+		&s.Symlinks, &s.Sockets, &s.NamedPipes, &s.Devices, &s.Irregular,
+	} {
+		c.Store(0)
+	}
+}
+
+// Errors returns the total number of read errors.
+func (s *Stats) Errors() uint64 {
+	return s.HashErrors.Load() + s.DirErrors.Load()
+}
+
+// countSpecial records a skipped non-regular, non-directory entry of the given type.
+func (s *Stats) countSpecial(mode os.FileMode) {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		s.Symlinks.Add(1)
+	case mode&os.ModeSocket != 0:
+		s.Sockets.Add(1)
+	case mode&os.ModeNamedPipe != 0:
+		s.NamedPipes.Add(1)
+	case mode&os.ModeDevice != 0:
+		s.Devices.Add(1)
+	default:
+		s.Irregular.Add(1)
+	}
+}
+
+// Special returns the total number of skipped non-regular files.
+func (s *Stats) Special() uint64 {
+	return s.Symlinks.Load() + s.Sockets.Load() + s.NamedPipes.Load() + s.Devices.Load() + s.Irregular.Load()
+}
+
+// isPseudoDir reports whether the directory at path is a virtual filesystem.
+// The filesystem type is only queried at mount points, where the device changes.
+func isPseudoDir(path string, entry os.DirEntry, parentDev uint64, haveParentDev bool) bool {
+	if pseudoPaths[path] {
+		return true
+	}
+	if !haveParentDev {
+		return false
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	if dev, ok := deviceOf(info); !ok || dev == parentDev {
+		return false
+	}
+	fs, err := FilesystemType(path)
+	return err == nil && fs.Pseudo
+}
+
+// DigestAll reads all the files in the file tree rooted at root, calculates their digests in parallel,
+// and returns a map from file path to FileRecord, a slice of discovered directory paths, and any error encountered during the walk.
+func DigestAll(
+	ctx context.Context,
+	root string,
+	hasher HashFunc,
+	numWorkers int,
+	opts Options,
+	stats *Stats,
+	filesFound *atomic.Uint64, // Pointer to counter
+	filesHashed *atomic.Uint64, // Pointer to counter
+) (map[string]FileRecord, []string, error) {
+	// Read errors beyond opts.MaxErrors cancel the whole walk.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var abortErr error
+	var abortOnce sync.Once
+	countError := func(counter *atomic.Uint64, err error, format string, path string) {
+		if opts.SkipPermErrors && errors.Is(err, fs.ErrPermission) {
+			stats.PermErrors.Add(1)
+			return
+		}
+		fmt.Fprintf(os.Stderr, format, path, err)
+		if opts.OnError != nil {
+			opts.OnError(path, err)
+		}
+		counter.Add(1)
+		if opts.MaxErrors > 0 && stats.Errors() >= uint64(opts.MaxErrors) {
+			abortOnce.Do(func() {
+				abortErr = fmt.Errorf("%w: %d directories or files could not be read", ErrTooManyErrors, stats.Errors())
+				cancel()
+			})
+		}
+	}
+
+	// --- Parallel Directory Traversal ---
+	var walkWg sync.WaitGroup
+	dirsToWalk := make(chan string, numWorkers)    // Buffered channel for directories to walk
+	filePaths := make(chan FileRecord, numWorkers) // Channel for discovered files
+	dirPaths := make(chan string, numWorkers)      // Channel for discovered directory paths
+
+	roots := opts.roots(root)
+	c := make(chan result) // Digests, from the digesters or taken unchanged by the walkers
+
+	// Start a pool of directory walkers, counting 1 for each root directory
+	walkWg.Add(len(roots))
+	go func() { // This single goroutine will spawn the workers
+		for i := 0; i < numWorkers; i++ {
+			go func() {
+				// Per-file counts are batched; they are flushed before each directory is
+				// marked done, so they are exact once the walk ends.
+				found := tally{shared: filesFound}
+				excluded := tally{shared: &stats.Excluded}
+				defer found.flush()
+				defer excluded.flush()
+				for dir := range dirsToWalk {
+					if opts.Unchanged != nil {
+						if files, dirs, ok := opts.Unchanged(dir); ok {
+							for _, sub := range dirs {
+								select {
+								case dirPaths <- sub:
+								case <-ctx.Done():
+									return
+								}
+							}
+							for _, rec := range files {
+								found.inc()
+								select {
+								case c <- result{rec: rec}:
+								case <-ctx.Done():
+									return
+								}
+							}
+							found.flush()
+							walkWg.Done()
+							continue
+						}
+					}
+
+					var dirInfo os.FileInfo
+					if !opts.IncludePseudoFS || opts.OnDirListed != nil {
+						// Before listing, so a change made meanwhile shows in the next walk.
+						dirInfo, _ = os.Lstat(dir)
+					}
+					entries, err := os.ReadDir(dir)
+					if err != nil {
+						countError(&stats.DirErrors, err, "Warning: Error reading directory %s: %v\n", dir)
+						walkWg.Done() // Decrement counter on error
+						continue
+					}
+					if opts.OnDirListed != nil && dirInfo != nil {
+						opts.OnDirListed(dir, dirInfo)
+					}
+
+					var dirDev uint64
+					haveDirDev := false
+					if !opts.IncludePseudoFS && dirInfo != nil {
+						dirDev, haveDirDev = deviceOf(dirInfo)
+					}
+
+					for _, entry := range entries {
+						fullPath := filepath.Join(dir, entry.Name())
+
+						isDir, isRegular := entry.IsDir(), entry.Type().IsRegular()
+						var target os.FileInfo // Set when a followed reparse point was resolved
+						if isReparsePoint(entry) {
+							if !opts.FollowReparsePoints {
+								stats.ReparsePoints.Add(1)
+								continue
+							}
+							if target, err = os.Stat(fullPath); err == nil {
+								isDir, isRegular = target.IsDir(), target.Mode().IsRegular()
+							}
+						}
+
+						if isDir {
+							if !opts.IncludePseudoFS && isPseudoDir(fullPath, entry, dirDev, haveDirDev) {
+								stats.PseudoFS.Add(1)
+								continue
+							}
+							if opts.SkipDir != nil && opts.SkipDir(fullPath) {
+								stats.ExcludedDirs.Add(1)
+								continue
+							}
+							select {
+							case dirPaths <- fullPath:
+							case <-ctx.Done():
+								return
+							}
+							walkWg.Add(1) // Add to the waitgroup before sending to the channel
+							// Enqueue from a separate goroutine: every walker may be blocked
+							// here at once with a full buffer, which would deadlock the pool.
+							go func(dir string) {
+								select {
+								case dirsToWalk <- dir:
+								case <-ctx.Done():
+									walkWg.Done() // Must decrement if we fail to send
+								}
+							}(fullPath)
+						} else if isRegular {
+							info := target
+							if info == nil {
+								if info, err = entry.Info(); err != nil {
+									countError(&stats.DirErrors, err, "Warning: Error reading file info %s: %v\n", fullPath)
+									continue
+								}
+							}
+							if opts.Skip != nil && opts.Skip(fullPath, info) {
+								excluded.inc()
+								continue
+							}
+							found.inc()
+							select {
+							case filePaths <- newRecord(fullPath, info):
+							case <-ctx.Done():
+								return
+							}
+						} else if target != nil {
+							stats.countSpecial(target.Mode())
+						} else {
+							stats.countSpecial(entry.Type())
+							if opts.OnSymlink != nil && entry.Type()&os.ModeSymlink != 0 {
+								opts.OnSymlink(fullPath)
+							}
+						}
+					}
+					found.flush()
+					excluded.flush()
+					walkWg.Done() // Done with this directory
+				}
+			}()
+		}
+	}()
+
+	// Seed the process with the root directories, from a goroutine since there may be
+	// more of them than the buffer holds before the digesters start.
+	go func() {
+		for i, dir := range roots {
+			select {
+			case dirsToWalk <- dir:
+			case <-ctx.Done():
+				walkWg.Add(i - len(roots)) // Never sent
+				return
+			}
+		}
+	}()
+
+	// --- Hashing Worker Pool (Digesters) ---
+	hasher = withRetry(ctx, hasher, opts, stats)
+	var wg sync.WaitGroup
+
+	// Start digesters
+	wg.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			digester(ctx, filePaths, c, hasher)
+		}()
+	}
+
+	// Closer goroutine: Waits for all directory walking to complete,
+	// then closes the filePaths channel to signal digesters to stop.
+	go func() {
+		walkWg.Wait()
+		if opts.OnWalkDone != nil {
+			opts.OnWalkDone()
+		}
+		close(dirsToWalk)
+		close(filePaths)
+		wg.Wait()
+		close(dirPaths)
+		close(c) // Close results channel after digesters are done.
+	}()
+
+	// Consume results: Collect hashes into the map and handle errors.
+	// Also consume directory paths concurrently.
+	m := make(map[string]FileRecord)
+	hashed := tally{shared: filesHashed}
+	hashedBytes := tally{shared: &stats.HashedBytes}
+	defer hashed.flush()
+	defer hashedBytes.flush()
+	discoveredDirs := []string{}
+	var finalWalkErr error // To store the error from filepath.Walk
+
+	// Use a loop and select to consume from multiple channels until all are closed
+	dirPathsClosed := false
+	resultsClosed := false
+
+	for !dirPathsClosed || !resultsClosed {
+		select {
+		case dirPath, ok := <-dirPaths:
+			if !ok {
+				dirPathsClosed = true
+			} else {
+				discoveredDirs = append(discoveredDirs, dirPath)
+			}
+		case r, ok := <-c:
+			if !ok {
+				resultsClosed = true
+			} else {
+				if r.err != nil && ctx.Err() != nil {
+					continue // Abandoned because the walk was cancelled, not unreadable
+				}
+				if r.err != nil {
+					countError(&stats.HashErrors, r.err, "Error hashing file %s: %v\n", r.rec.Path)
+				}
+				// Only add successfully hashed files
+				if r.err == nil {
+					hashed.inc()
+					hashedBytes.add(uint64(r.rec.Size))
+					m[r.rec.Path] = r.rec
+				}
+			}
+		// --- Add check for context cancellation in the main loop ---
+		case <-ctx.Done():
+			// If context is cancelled while waiting for results,
+			// return immediately with the context error.
+			// We might have partial results in 'm' and 'discoveredDirs'.
+			// Depending on requirements, you might choose to return them or nil.
+			// Returning the context error signals cancellation clearly.
+			if abortErr != nil {
+				return m, discoveredDirs, abortErr
+			}
+			return m, discoveredDirs, ctx.Err() // Return partial results and context error
+		}
+	}
+
+	if finalWalkErr != nil {
+		return m, discoveredDirs, finalWalkErr
+	}
+
+	return m, discoveredDirs, nil
+}
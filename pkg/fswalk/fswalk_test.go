@@ -0,0 +1,284 @@
+package fswalk
+
+import (
+	"context"
+	"errors"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+// TestDigestAllSpecialFiles checks that symlinks and sockets are counted and not hashed,
+// and that symlinks are passed to OnSymlink.
+func TestDigestAllSpecialFiles(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatalf("WriteFile returned an unexpected error: %v", err)
+	}
+	if err := os.Symlink(file, filepath.Join(dir, "link")); err != nil {
+		t.Skipf("symlinks unsupported: %v", err)
+	}
+	wantSockets := uint64(1)
+	l, err := net.Listen("unix", filepath.Join(dir, "sock"))
+	if err != nil {
+		wantSockets = 0
+	} else {
+		defer l.Close()
+	}
+
+	var stats Stats
+	var found, hashed atomic.Uint64
+	var links []string // Only one link, so no locking
+	opts := Options{OnSymlink: func(path string) { links = append(links, path) }}
+	files, _, err := DigestAll(context.Background(), dir, iphash.GetFileHashSHA256bytes, 2, opts, &stats, &found, &hashed)
+	if err != nil {
+		t.Fatalf("DigestAll returned an unexpected error: %v", err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Hashed file count mismatch. Got: %d, Want: 1", len(files))
+	}
+	if got := stats.Symlinks.Load(); got != 1 {
+		t.Errorf("Symlink count mismatch. Got: %d, Want: 1", got)
+	}
+	if len(links) != 1 || links[0] != filepath.Join(dir, "link") {
+		t.Errorf("OnSymlink paths mismatch. Got: %v, Want: [%s]", links, filepath.Join(dir, "link"))
+	}
+	if got := stats.Sockets.Load(); got != wantSockets {
+		t.Errorf("Socket count mismatch. Got: %d, Want: %d", got, wantSockets)
+	}
+	if got := stats.Special(); got != 1+wantSockets {
+		t.Errorf("Special file total mismatch. Got: %d, Want: %d", got, 1+wantSockets)
+	}
+}
+
+// TestWithRetry checks that transient errors are retried and permanent ones are not.
+func TestWithRetry(t *testing.T) {
+	calls := 0
+	flaky := func(path string) (iphash.HashBytes, error) {
+		calls++
+		if calls < 3 {
+			return nil, &os.PathError{Op: "read", Path: path, Err: syscall.EIO}
+		}
+		return iphash.HashBytes{1}, nil
+	}
+	var stats Stats
+	hash := withRetry(context.Background(), flaky, Options{Retries: 2}, &stats)
+	if _, err := hash("f"); err != nil {
+		t.Fatalf("Retried hash returned an unexpected error: %v", err)
+	}
+	if got := stats.Retries.Load(); got != 2 {
+		t.Errorf("Retry count mismatch. Got: %d, Want: 2", got)
+	}
+
+	calls = 0
+	missing := func(path string) (iphash.HashBytes, error) {
+		calls++
+		return nil, os.ErrNotExist
+	}
+	if _, err := withRetry(context.Background(), missing, Options{Retries: 2}, &stats)("f"); err == nil {
+		t.Fatal("Expected an error for a missing file")
+	}
+	if calls != 1 {
+		t.Errorf("Permanent error was retried. Got: %d calls, Want: 1", calls)
+	}
+}
+
+// TestDigestAllMaxErrors checks that the walk aborts once the error limit is reached.
+func TestDigestAllMaxErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+	}
+	failing := func(path string) (iphash.HashBytes, error) {
+		return nil, os.ErrPermission
+	}
+
+	var stats Stats
+	var found, hashed atomic.Uint64
+	_, _, err := DigestAll(context.Background(), dir, failing, 1, Options{MaxErrors: 1}, &stats, &found, &hashed)
+	if !errors.Is(err, ErrTooManyErrors) {
+		t.Errorf("DigestAll error mismatch. Got: %v, Want: %v", err, ErrTooManyErrors)
+	}
+}
+
+// TestDigestAllSkipPermErrors checks that permission errors are counted but do not abort the walk.
+func TestDigestAllSkipPermErrors(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a"), []byte("a"), 0644); err != nil {
+		t.Fatalf("WriteFile returned an unexpected error: %v", err)
+	}
+	denied := func(path string) (iphash.HashBytes, error) {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+	}
+
+	var stats Stats
+	var found, hashed atomic.Uint64
+	opts := Options{MaxErrors: 1, SkipPermErrors: true}
+	if _, _, err := DigestAll(context.Background(), dir, denied, 1, opts, &stats, &found, &hashed); err != nil {
+		t.Fatalf("DigestAll returned an unexpected error: %v", err)
+	}
+	if got := stats.PermErrors.Load(); got != 1 {
+		t.Errorf("Permission error count mismatch. Got: %d, Want: 1", got)
+	}
+}
+
+// TestDigestAllSkip checks that files rejected by Options.Skip are neither hashed nor returned.
+func TestDigestAllSkip(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.iso"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+	}
+	var stats Stats
+	var found, hashed atomic.Uint64
+	opts := Options{Skip: func(path string, info os.FileInfo) bool { return filepath.Ext(path) == ".iso" }}
+	m, _, err := DigestAll(context.Background(), dir, iphash.GetFileHashMD5bytes, 1, opts, &stats, &found, &hashed)
+	if err != nil {
+		t.Fatalf("DigestAll returned an unexpected error: %v", err)
+	}
+	if _, ok := m[filepath.Join(dir, "b.iso")]; ok || len(m) != 1 || stats.Excluded.Load() != 1 {
+		t.Errorf("Skipped file mismatch. Got: %d files, %d excluded, Want: 1 file, 1 excluded", len(m), stats.Excluded.Load())
+	}
+}
+
+// TestDigestAllRoots checks that Options.Roots walks only the listed directories,
+// more of them than there are workers, and that Count agrees.
+func TestDigestAllRoots(t *testing.T) {
+	dir := t.TempDir()
+	var roots []string
+	for _, sub := range []string{"r1", "r2", "r3/deep", "r4", "other"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatalf("MkdirAll returned an unexpected error: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, sub, "f"), []byte(sub), 0644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+		if sub != "other" {
+			roots = append(roots, filepath.Join(dir, sub))
+		}
+	}
+	var stats Stats
+	var found, hashed atomic.Uint64
+	opts := Options{Roots: roots}
+	m, _, err := DigestAll(context.Background(), dir, iphash.GetFileHashMD5bytes, 1, opts, &stats, &found, &hashed)
+	if err != nil {
+		t.Fatalf("DigestAll returned an unexpected error: %v", err)
+	}
+	if _, ok := m[filepath.Join(dir, "other", "f")]; ok || len(m) != len(roots) {
+		t.Errorf("Roots walk mismatch. Got: %d files, Want: %d, none from other", len(m), len(roots))
+	}
+	files, _, err := Count(context.Background(), dir, 2, opts)
+	if err != nil {
+		t.Fatalf("Count returned an unexpected error: %v", err)
+	}
+	if files != uint64(len(roots)) {
+		t.Errorf("Count mismatch. Got: %d, Want: %d", files, len(roots))
+	}
+}
+
+// TestDigestAllSkipDir checks that directories rejected by Options.SkipDir are not
+// walked by DigestAll or Count, and are counted.
+func TestDigestAllSkipDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"keep", "prune/below"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatalf("MkdirAll returned an unexpected error: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, sub, "f"), []byte(sub), 0644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+	}
+	var stats Stats
+	var found, hashed atomic.Uint64
+	opts := Options{SkipDir: func(path string) bool { return filepath.Base(path) == "prune" }}
+	m, _, err := DigestAll(context.Background(), dir, iphash.GetFileHashMD5bytes, 1, opts, &stats, &found, &hashed)
+	if err != nil {
+		t.Fatalf("DigestAll returned an unexpected error: %v", err)
+	}
+	if _, ok := m[filepath.Join(dir, "keep", "f")]; !ok || len(m) != 1 || stats.ExcludedDirs.Load() != 1 {
+		t.Errorf("SkipDir mismatch. Got: %d files, %d excluded directories, Want: keep/f, 1", len(m), stats.ExcludedDirs.Load())
+	}
+	if files, _, _ := Count(context.Background(), dir, 1, opts); files != 1 {
+		t.Errorf("Count mismatch. Got: %d, Want: 1", files)
+	}
+}
+
+// TestDigestAllCounts checks that the batched progress counters are exact once the walk returns.
+func TestDigestAllCounts(t *testing.T) {
+	dir := t.TempDir()
+	n := 0
+	for _, sub := range []string{"x", "y", "y/z"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatalf("MkdirAll returned an unexpected error: %v", err)
+		}
+		for i := 0; i < tallyBatch+5; i++ {
+			if err := os.WriteFile(filepath.Join(dir, sub, strings.Repeat("f", i+1)), nil, 0644); err != nil {
+				t.Fatalf("WriteFile returned an unexpected error: %v", err)
+			}
+			n++
+		}
+	}
+	var stats Stats
+	var found, hashed atomic.Uint64
+	if _, _, err := DigestAll(context.Background(), dir, iphash.GetFileHashMD5bytes, 4, Options{}, &stats, &found, &hashed); err != nil {
+		t.Fatalf("DigestAll returned an unexpected error: %v", err)
+	}
+	if found.Load() != uint64(n) || hashed.Load() != uint64(n) {
+		t.Errorf("Counter mismatch. Got: %d found, %d hashed, Want: %d", found.Load(), hashed.Load(), n)
+	}
+}
+
+// TestCount checks that the pre-count finds the files and bytes DigestAll hashes,
+// leaving out the files Options.Skip excludes.
+func TestCount(t *testing.T) {
+	dir := t.TempDir()
+	for i, name := range []string{"a", "x/b", "x/y/c", "x/y/skip.tmp"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll returned an unexpected error: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(strings.Repeat("z", 100*(i+1))), 0644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+	}
+	opts := Options{Skip: func(path string, info os.FileInfo) bool { return strings.HasSuffix(path, ".tmp") }}
+	files, bytes, err := Count(context.Background(), dir, 3, opts)
+	if err != nil {
+		t.Fatalf("Count returned an unexpected error: %v", err)
+	}
+	if files != 3 || bytes != 600 {
+		t.Errorf("Count mismatch. Got: %d files, %d bytes, Want: 3 files, 600 bytes", files, bytes)
+	}
+
+	var stats Stats
+	var found, hashed atomic.Uint64
+	if _, _, err := DigestAll(context.Background(), dir, iphash.GetFileHashMD5bytes, 2, opts, &stats, &found, &hashed); err != nil {
+		t.Fatalf("DigestAll returned an unexpected error: %v", err)
+	}
+	if hashed.Load() != files || stats.HashedBytes.Load() != bytes {
+		t.Errorf("DigestAll mismatch. Got: %d files, %d bytes, Want: %d files, %d bytes", hashed.Load(), stats.HashedBytes.Load(), files, bytes)
+	}
+}
+
+// TestReadInodeSet checks that DEV:INO lines are read and comments and trailing paths ignored.
+func TestReadInodeSet(t *testing.T) {
+	set, err := ReadInodeSet(strings.NewReader("# from host b\n2049:131 /srv/a\n\n2049:7\n"))
+	if err != nil {
+		t.Fatalf("ReadInodeSet returned an unexpected error: %v", err)
+	}
+	if len(set) != 2 || !set[Inode{Dev: 2049, Ino: 131}] || !set[Inode{Dev: 2049, Ino: 7}] {
+		t.Errorf("Inode set mismatch. Got: %v", set)
+	}
+	if _, err := ReadInodeSet(strings.NewReader("2049-131\n")); err == nil {
+		t.Errorf("ReadInodeSet accepted a malformed line")
+	}
+}
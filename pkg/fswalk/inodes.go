@@ -0,0 +1,83 @@
+package fswalk
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Inode identifies a file by device and inode number.
+type Inode struct {
+	Dev, Ino uint64
+}
+
+// Inode returns the device and inode of the record.
+func (r FileRecord) Inode() Inode {
+	return Inode{Dev: r.Dev, Ino: r.Ino}
+}
+
+// String formats the inode as DEV:INO, as stat -c %d:%i prints it.
+func (i Inode) String() string {
+	return fmt.Sprintf("%d:%d", i.Dev, i.Ino)
+}
+
+// InodeSet is a set of files identified by device and inode number.
+type InodeSet map[Inode]bool
+
+// ReadInodeSet reads one DEV:INO pair (decimal numbers) per line. Blank lines, lines
+// starting with # and anything after the pair separated by whitespace are ignored, so
+// the output of `find ... -printf '%D:%i %p\n'` can be used directly.
+func ReadInodeSet(r io.Reader) (InodeSet, error) {
+	set := make(InodeSet)
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		dev, ino, ok := strings.Cut(fields[0], ":")
+		d, derr := strconv.ParseUint(dev, 10, 64)
+		i, ierr := strconv.ParseUint(ino, 10, 64)
+		if !ok || derr != nil || ierr != nil {
+			return nil, fmt.Errorf("line %d: want DEV:INO, got %q", n, fields[0])
+		}
+		set[Inode{Dev: d, Ino: i}] = true
+	}
+	return set, sc.Err()
+}
+
+// StatRecord returns the current metadata of the file at path, without following a
+// final symlink and without its digest.
+func StatRecord(path string) (FileRecord, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return FileRecord{}, err
+	}
+	return newRecord(path, info), nil
+}
+
+// SameEntry reports whether a and b name one directory entry reached through two
+// paths, e.g. a bind mount, a followed junction or overlapping roots: the same file
+// under the same name in the same directory. Hard links are separate entries.
+func SameEntry(a, b string, caseInsensitive bool) bool {
+	if PathKey(filepath.Base(a), caseInsensitive) != PathKey(filepath.Base(b), caseInsensitive) {
+		return false
+	}
+	if !sameEntry(a, b) {
+		return false
+	}
+	// The parents are resolved like every other component of the paths.
+	da, err := os.Stat(filepath.Dir(a))
+	if err != nil {
+		return false
+	}
+	db, err := os.Stat(filepath.Dir(b))
+	if err != nil {
+		return false
+	}
+	return os.SameFile(da, db)
+}
@@ -0,0 +1,115 @@
+package fswalk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizePath returns path in Unicode NFC form. macOS stores names decomposed (NFD)
+// while most Linux and Windows tools write them composed, so the same name can reach
+// the tool in either form; comparisons and pattern matching use the NFC form.
+func NormalizePath(path string) string {
+	return norm.NFC.String(path)
+}
+
+// PrintableName reports whether name is valid UTF-8 without control characters or
+// bidirectional formatting characters. Other names can break the lines of text output,
+// carry terminal escape sequences or display in a misleading order, so outputs escape
+// or encode them.
+func PrintableName(name string) bool {
+	if !utf8.ValidString(name) {
+		return false
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// PathKey returns the key under which two paths name the same directory entry:
+// the NFC form, case folded when the filesystem is case-insensitive.
+func PathKey(path string, caseInsensitive bool) string {
+	key := NormalizePath(path)
+	if caseInsensitive {
+		key = strings.ToLower(key)
+	}
+	return key
+}
+
+// IsCaseInsensitive reports whether the filesystem holding dir ignores case in names.
+// It is detected without writing: a name with letters is looked up with its case
+// swapped and compared with the original. Entries of dir are tried first, as dir's own
+// filesystem looks them up; failing those, the names of dir and its ancestors, each
+// looked up in its parent, but only while that parent is on dir's device, since a
+// mount point's name belongs to the filesystem it is mounted on.
+func IsCaseInsensitive(dir string) bool {
+	if f, err := os.Open(dir); err == nil {
+		defer f.Close()
+		for {
+			names, err := f.Readdirnames(100)
+			for _, name := range names {
+				if swapped := swapCase(name); swapped != name {
+					return sameEntry(filepath.Join(dir, name), filepath.Join(dir, swapped))
+				}
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	probe := filepath.Clean(dir)
+	for {
+		parent := filepath.Dir(probe)
+		if parent == probe || !sameDevice(dir, parent) {
+			return false
+		}
+		if name := filepath.Base(probe); swapCase(name) != name {
+			return sameEntry(probe, filepath.Join(parent, swapCase(name)))
+		}
+		probe = parent
+	}
+}
+
+// sameDevice reports whether a and b lie on the same device. Where the platform reports
+// no devices, a path's volume decides its filesystem and any two paths match.
+func sameDevice(a, b string) bool {
+	ia, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	da, oka := deviceOf(ia)
+	db, okb := deviceOf(ib)
+	return oka == okb && da == db
+}
+
+func sameEntry(a, b string) bool {
+	ia, err := os.Lstat(a)
+	if err != nil {
+		return false
+	}
+	ib, err := os.Lstat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ia, ib)
+}
+
+func swapCase(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, s)
+}
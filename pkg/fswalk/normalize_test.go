@@ -0,0 +1,60 @@
+package fswalk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestPathKey checks that NFC and NFD spellings share a key and case only matters when requested.
+func TestPathKey(t *testing.T) {
+	nfc := "/data/Café.txt"
+	nfd := "/data/Café.txt"
+	if PathKey(nfc, false) != PathKey(nfd, false) {
+		t.Errorf("NFC and NFD forms have different keys: %q vs %q", PathKey(nfc, false), PathKey(nfd, false))
+	}
+	if PathKey(nfc, false) == PathKey("/data/café.txt", false) {
+		t.Error("Case variants share a key on a case-sensitive filesystem")
+	}
+	if PathKey(nfd, true) != PathKey("/DATA/café.TXT", true) {
+		t.Error("Case variants have different keys on a case-insensitive filesystem")
+	}
+}
+
+// TestPrintableName checks that line breaks, escape sequences, bidirectional overrides
+// and invalid UTF-8 make a name unprintable, and other Unicode does not.
+func TestPrintableName(t *testing.T) {
+	cases := map[string]bool{
+		"/data/Café 日本.txt":   true,
+		"/data/a\nb":          false,
+		"/data/\x1b[2J":       false,
+		"/data/gpj.\u202eexe": false,
+		"/data/\xff":          false,
+	}
+	for name, want := range cases {
+		if got := PrintableName(name); got != want {
+			t.Errorf("PrintableName(%q) mismatch. Got: %v, Want: %v", name, got, want)
+		}
+	}
+}
+
+// TestIsCaseInsensitive checks detection against a direct lookup of a case variant.
+func TestIsCaseInsensitive(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "probe"), nil, 0666); err != nil {
+		t.Fatalf("Failed to create probe file: %v", err)
+	}
+	_, err := os.Stat(filepath.Join(dir, "PROBE"))
+	want := err == nil
+	if IsCaseInsensitive(dir) != want {
+		t.Errorf("IsCaseInsensitive(%s) = %v, want %v", dir, !want, want)
+	}
+	// Without lettered entries the directory's own name, on the same device, decides.
+	empty := filepath.Join(dir, "probe2", "123")
+	if err := os.MkdirAll(empty, 0o755); err != nil {
+		t.Fatalf("MkdirAll returned an unexpected error: %v", err)
+	}
+	if IsCaseInsensitive(empty) != want {
+		t.Errorf("IsCaseInsensitive(%s) = %v, want %v", empty, !want, want)
+	}
+}
@@ -0,0 +1,19 @@
+package fswalk
+
+// Overlay is an overlayfs mount: a merged view of a writable upper directory over
+// read-only lower ones. Every file of the view is stored in one of the layers, so a
+// scan covering both sees it twice.
+type Overlay struct {
+	Mountpoint string   // The merged view
+	Upper      string   // Writable layer; empty for a read-only overlay
+	Lower      []string // Read-only layers, topmost first
+	Work       string   // overlayfs' scratch directory beside the upper layer
+}
+
+// Layers returns the directories a file of the view can be stored in, topmost first.
+func (o Overlay) Layers() []string {
+	if o.Upper == "" {
+		return o.Lower
+	}
+	return append([]string{o.Upper}, o.Lower...)
+}
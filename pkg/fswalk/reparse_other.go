@@ -0,0 +1,10 @@
+//go:build !windows
+
+package fswalk
+
+import "os"
+
+// isReparsePoint is always false outside Windows.
+func isReparsePoint(entry os.DirEntry) bool {
+	return false
+}
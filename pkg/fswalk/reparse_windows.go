@@ -0,0 +1,17 @@
+package fswalk
+
+import (
+	"os"
+	"syscall"
+)
+
+// isReparsePoint reports whether the entry is a junction, symlink or other reparse point.
+// Cloud placeholders are reparse points too, and reading one would download its content.
+func isReparsePoint(entry os.DirEntry) bool {
+	info, err := entry.Info()
+	if err != nil {
+		return false
+	}
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0
+}
@@ -0,0 +1,48 @@
+package fswalk
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// transientErrors are errno values worth retrying: interrupted or would-block calls,
+// and the timeouts and stale handles an NFS or SMB client reports during a network blip.
+var transientErrors = []syscall.Errno{syscall.EINTR, syscall.EAGAIN, syscall.ETIMEDOUT, syscall.EIO, syscall.ESTALE}
+
+// isTransient reports whether err may go away if the operation is repeated.
+func isTransient(err error) bool {
+	for _, errno := range transientErrors {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// withRetry wraps hashFile so transient errors are retried up to opts.Retries times,
+// waiting opts.RetryDelay before the first retry and twice as long before each next one.
+func withRetry(ctx context.Context, hashFile HashFunc, opts Options, stats *Stats) HashFunc {
+	if opts.Retries <= 0 {
+		return hashFile
+	}
+	return func(path string) (iphash.HashBytes, error) {
+		delay := opts.RetryDelay
+		for attempt := 0; ; attempt++ {
+			sum, err := hashFile(path)
+			if err == nil || attempt == opts.Retries || !isTransient(err) {
+				return sum, err
+			}
+			stats.Retries.Add(1)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, err
+			}
+			delay *= 2
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package fswalk
+
+import "os"
+
+// fillSys is a no-op where no unix stat structure is available.
+func fillSys(rec *FileRecord, info os.FileInfo) {}
+
+// rdevOf is unavailable where no unix stat structure is available.
+func rdevOf(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
+
+// deviceOf is unavailable where no unix stat structure is available.
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package fswalk
+
+import (
+	"os"
+	"syscall"
+)
+
+// fillSys copies owner, device and inode details from the platform stat structure.
+func fillSys(rec *FileRecord, info os.FileInfo) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	rec.Uid = st.Uid
+	rec.Gid = st.Gid
+	rec.Dev = uint64(st.Dev)
+	rec.Ino = uint64(st.Ino)
+	rec.Nlink = uint64(st.Nlink)
+	rec.Alloc = int64(st.Blocks) * 512 // st_blocks is always in 512-byte units
+}
+
+// rdevOf returns the device number a device node stands for.
+func rdevOf(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Rdev), true
+}
+
+// deviceOf returns the device holding the file, if the platform reports one.
+func deviceOf(info os.FileInfo) (uint64, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(st.Dev), true
+}
@@ -0,0 +1,38 @@
+package fswalk
+
+import "sync/atomic"
+
+// tallyBatch is how many updates a tally collects before publishing them.
+const tallyBatch = 64
+
+// tally counts locally for one goroutine and adds to a shared counter once per
+// batch, so workers on small files do not contend on the counter for every file.
+// Readers such as a progress reporter see the shared value lag by less than a batch
+// per worker; flush publishes the remainder.
+type tally struct {
+	n       uint64
+	updates int
+	shared  *atomic.Uint64
+}
+
+// inc counts one event.
+func (t *tally) inc() {
+	t.add(1)
+}
+
+// add counts n, e.g. the bytes of one file.
+func (t *tally) add(n uint64) {
+	t.n += n
+	t.updates++
+	if t.updates >= tallyBatch {
+		t.flush()
+	}
+}
+
+// flush adds the pending count to the shared counter.
+func (t *tally) flush() {
+	if t.n > 0 {
+		t.shared.Add(t.n)
+	}
+	t.n, t.updates = 0, 0
+}
@@ -0,0 +1,80 @@
+// Package fuseview presents a planned deduplication as a read-only filesystem, so the
+// result can be browsed before anything is changed.
+package fuseview
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// File is a file of the view, backed by a real file that supplies its content.
+type File struct {
+	Source  string
+	Size    int64
+	ModTime time.Time
+	Mode    os.FileMode
+	Uid     uint32
+	Gid     uint32
+	Xattrs  map[string]string // Annotations such as user.dedupe.action
+}
+
+// View is a directory tree of Files, keyed by slash-separated paths relative to the
+// mount point.
+type View struct {
+	dirs  map[string]bool
+	files map[string]File
+}
+
+// New returns an empty view.
+func New() *View {
+	return &View{dirs: map[string]bool{"": true}, files: make(map[string]File)}
+}
+
+// AddDir adds the directory rel and its parents.
+func (v *View) AddDir(rel string) {
+	for rel != "" && rel != "." && !v.dirs[rel] {
+		v.dirs[rel] = true
+		rel = parent(rel)
+	}
+}
+
+// AddFile adds a file at rel, creating its parent directories.
+func (v *View) AddFile(rel string, f File) {
+	v.AddDir(parent(rel))
+	v.files[rel] = f
+}
+
+// File returns the file at rel.
+func (v *View) File(rel string) (File, bool) {
+	f, ok := v.files[rel]
+	return f, ok
+}
+
+// Children returns the names of the directories and files directly inside dir, sorted.
+func (v *View) Children(dir string) (dirs, files []string) {
+	for d := range v.dirs {
+		if d != "" && parent(d) == dir {
+			dirs = append(dirs, path.Base(d))
+		}
+	}
+	for f := range v.files {
+		if parent(f) == dir {
+			files = append(files, path.Base(f))
+		}
+	}
+	sort.Strings(dirs)
+	sort.Strings(files)
+	return dirs, files
+}
+
+// parent returns the directory of rel, "" for the top level.
+func parent(rel string) string {
+	i := strings.LastIndex(rel, "/")
+	if i < 0 {
+		return ""
+	}
+	return rel[:i]
+}
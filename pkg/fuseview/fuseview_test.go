@@ -0,0 +1,26 @@
+package fuseview
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestChildren checks that files create their parent directories and are listed per directory.
+func TestChildren(t *testing.T) {
+	v := New()
+	v.AddFile("a/b/f1", File{Source: "/r/a/b/f1"})
+	v.AddFile("top", File{Source: "/r/top"})
+	v.AddDir("empty")
+
+	dirs, files := v.Children("")
+	if strings.Join(dirs, ",") != "a,empty" || strings.Join(files, ",") != "top" {
+		t.Errorf("Top level mismatch. Got: %v %v, Want: [a empty] [top]", dirs, files)
+	}
+	dirs, files = v.Children("a")
+	if strings.Join(dirs, ",") != "b" || len(files) != 0 {
+		t.Errorf("Children of a mismatch. Got: %v %v, Want: [b] []", dirs, files)
+	}
+	if f, ok := v.File("a/b/f1"); !ok || f.Source != "/r/a/b/f1" {
+		t.Errorf("File lookup mismatch. Got: %+v, %v", f, ok)
+	}
+}
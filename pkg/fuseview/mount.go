@@ -0,0 +1,112 @@
+//go:build linux || darwin || freebsd
+
+package fuseview
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Mount serves v read-only at mountpoint until ctx is done or it is unmounted
+// externally (fusermount -u, umount).
+func Mount(ctx context.Context, v *View, mountpoint, name string) error {
+	server, err := fs.Mount(mountpoint, &dirNode{view: v}, &fs.Options{
+		// DirectMount avoids needing fusermount when running as root.
+		MountOptions: fuse.MountOptions{FsName: name, Name: "dedupe", Options: []string{"ro"}, DirectMount: true},
+	})
+	if err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		server.Unmount()
+	}()
+	server.Wait()
+	return nil
+}
+
+// dirNode is a directory of the view; its whole subtree is created when it is added.
+type dirNode struct {
+	fs.Inode
+	view *View
+	rel  string
+}
+
+var _ = (fs.NodeOnAdder)((*dirNode)(nil))
+
+func (n *dirNode) OnAdd(ctx context.Context) {
+	dirs, files := n.view.Children(n.rel)
+	for _, name := range dirs {
+		child := &dirNode{view: n.view, rel: path.Join(n.rel, name)}
+		n.AddChild(name, n.NewPersistentInode(ctx, child, fs.StableAttr{Mode: syscall.S_IFDIR}), true)
+	}
+	for _, name := range files {
+		f, _ := n.view.File(path.Join(n.rel, name))
+		n.AddChild(name, n.NewPersistentInode(ctx, &fileNode{file: f}, fs.StableAttr{Mode: syscall.S_IFREG}), true)
+	}
+}
+
+// fileNode is a file of the view whose content is read from its source file.
+type fileNode struct {
+	fs.Inode
+	file File
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*fileNode)(nil))
+	_ = (fs.NodeOpener)((*fileNode)(nil))
+	_ = (fs.NodeGetxattrer)((*fileNode)(nil))
+	_ = (fs.NodeListxattrer)((*fileNode)(nil))
+)
+
+func (n *fileNode) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = syscall.S_IFREG | uint32(n.file.Mode.Perm())
+	out.Size = uint64(n.file.Size)
+	out.Owner = fuse.Owner{Uid: n.file.Uid, Gid: n.file.Gid}
+	out.SetTimes(nil, &n.file.ModTime, nil)
+	return 0
+}
+
+func (n *fileNode) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC|syscall.O_APPEND) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	fd, err := syscall.Open(n.file.Source, syscall.O_RDONLY, 0)
+	if err != nil {
+		return nil, 0, fs.ToErrno(err)
+	}
+	return fs.NewLoopbackFile(fd), 0, 0
+}
+
+func (n *fileNode) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	value, ok := n.file.Xattrs[attr]
+	if !ok {
+		return 0, fs.ENOATTR
+	}
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+	return uint32(copy(dest, value)), 0
+}
+
+func (n *fileNode) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	names := make([]string, 0, len(n.file.Xattrs))
+	for name := range n.file.Xattrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := strings.Join(names, "\x00")
+	if list != "" {
+		list += "\x00"
+	}
+	if len(dest) < len(list) {
+		return uint32(len(list)), syscall.ERANGE
+	}
+	return uint32(copy(dest, list)), 0
+}
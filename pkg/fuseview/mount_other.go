@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package fuseview
+
+import (
+	"context"
+	"errors"
+)
+
+// Mount is not available on this platform.
+func Mount(ctx context.Context, v *View, mountpoint, name string) error {
+	return errors.New("FUSE mounts are only supported on Linux, macOS and FreeBSD")
+}
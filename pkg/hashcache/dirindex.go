@@ -0,0 +1,172 @@
+package hashcache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// DirEntry is a directory of the Merkle index kept next to the file digests. Its rollup
+// covers everything below it, so an unchanged subtree can be taken from the index as a
+// whole instead of being listed and looked up file by file.
+type DirEntry struct {
+	ModTime time.Time           // Of the directory, taken before it was listed
+	Files   []fswalk.FileRecord // Direct regular files, with their base names as Path
+	Dirs    []string            // Names of the direct subdirectories
+	Rollup  iphash.HashBytes    // Over the files' names, sizes, times and digests and the subdirectories' rollups
+}
+
+// rollup computes the rollup of e from the rollups of its subdirectories. ok is false
+// when one of them has no entry.
+func rollup(e DirEntry, dirs map[string]DirEntry, dir string) (sum iphash.HashBytes, ok bool) {
+	h := sha256.New()
+	for _, f := range e.Files {
+		fmt.Fprintf(h, "f %q %d %d %x\n", f.Path, f.Size, f.ModTime.UnixNano(), f.Sum)
+	}
+	for _, name := range e.Dirs {
+		sub, ok := dirs[filepath.Join(dir, name)]
+		if !ok {
+			return nil, false
+		}
+		fmt.Fprintf(h, "d %q %x\n", name, sub.Rollup)
+	}
+	return h.Sum(nil), true
+}
+
+// UpdateDirs records the directories listed by a walk in the index. listed holds the
+// modification time of every directory read, taken before it was read; files and dirs
+// are everything the walk found, including what it took from the index. Directories
+// below one that no longer lists them are dropped. Only a walk without read errors or
+// filters should be recorded: a file missing from files would be missing from later
+// scans too.
+func (c *Cache) UpdateDirs(listed map[string]time.Time, files map[string]fswalk.FileRecord, dirs []string) {
+	byDir := make(map[string][]fswalk.FileRecord)
+	for path, rec := range files {
+		parent := filepath.Dir(path)
+		if _, ok := listed[parent]; ok {
+			rec.Path = filepath.Base(path)
+			byDir[parent] = append(byDir[parent], rec)
+		}
+	}
+	subdirs := make(map[string][]string)
+	for _, dir := range dirs {
+		parent := filepath.Dir(dir)
+		if _, ok := listed[parent]; ok {
+			subdirs[parent] = append(subdirs[parent], filepath.Base(dir))
+		}
+	}
+	order := make([]string, 0, len(listed))
+	for dir := range listed {
+		order = append(order, dir)
+	}
+	// Deepest first, so every subdirectory has its rollup before its parent needs it.
+	depth := func(dir string) int { return strings.Count(dir, string(filepath.Separator)) }
+	sort.Slice(order, func(i, j int) bool { return depth(order[i]) > depth(order[j]) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, dir := range order {
+		e := DirEntry{ModTime: listed[dir], Files: byDir[dir], Dirs: subdirs[dir]}
+		sort.Slice(e.Files, func(i, j int) bool { return e.Files[i].Path < e.Files[j].Path })
+		sort.Strings(e.Dirs)
+		if old, ok := c.dirs[dir]; ok {
+			for _, name := range old.Dirs {
+				if i := sort.SearchStrings(e.Dirs, name); i == len(e.Dirs) || e.Dirs[i] != name {
+					c.dropDirsLocked(filepath.Join(dir, name))
+				}
+			}
+		}
+		var ok bool
+		if e.Rollup, ok = rollup(e, c.dirs, dir); ok {
+			c.dirs[dir] = e
+		} else {
+			delete(c.dirs, dir)
+		}
+	}
+}
+
+// dropDirsLocked drops dir and every directory below it from the index.
+func (c *Cache) dropDirsLocked(dir string) {
+	prefix := dir + string(filepath.Separator)
+	for d := range c.dirs {
+		if d == dir || strings.HasPrefix(d, prefix) {
+			delete(c.dirs, d)
+		}
+	}
+}
+
+// ClearDirs empties the directory index, e.g. after a walk that could not read
+// everything.
+func (c *Cache) ClearDirs() {
+	c.mu.Lock()
+	c.dirs = make(map[string]DirEntry)
+	c.mu.Unlock()
+}
+
+// UnchangedDirs returns a function for the walker's Options.Unchanged. It takes a
+// subtree from the index when the directory and every one below it still have their
+// recorded modification times and the recorded rollups agree. Adding, removing or
+// renaming an entry changes a directory's modification time; rewriting a file in place
+// does not, so such a change goes unnoticed until the directory changes or the index
+// is cleared. Every directory is checked at most once per function.
+func (c *Cache) UnchangedDirs() func(dir string) ([]fswalk.FileRecord, []string, bool) {
+	var mu sync.Mutex
+	checked := make(map[string]bool)
+	var unchanged func(dir string, files *[]fswalk.FileRecord, dirs *[]string) bool
+	unchanged = func(dir string, files *[]fswalk.FileRecord, dirs *[]string) bool {
+		mu.Lock()
+		same, done := checked[dir]
+		mu.Unlock()
+		if done && !same {
+			return false
+		}
+		c.mu.Lock()
+		e, ok := c.dirs[dir]
+		if ok {
+			var sum iphash.HashBytes
+			sum, ok = rollup(e, c.dirs, dir)
+			ok = ok && bytes.Equal(sum, e.Rollup)
+		}
+		c.mu.Unlock()
+		if ok && !done {
+			info, err := os.Lstat(dir)
+			ok = err == nil && info.IsDir() && info.ModTime().Equal(e.ModTime)
+		}
+		for _, name := range e.Dirs {
+			if !ok {
+				break
+			}
+			sub := filepath.Join(dir, name)
+			*dirs = append(*dirs, sub)
+			ok = unchanged(sub, files, dirs)
+		}
+		mu.Lock()
+		checked[dir] = ok
+		mu.Unlock()
+		if !ok {
+			return false
+		}
+		for _, f := range e.Files {
+			f.Path = filepath.Join(dir, f.Path)
+			*files = append(*files, f)
+		}
+		return true
+	}
+	return func(dir string) ([]fswalk.FileRecord, []string, bool) {
+		var files []fswalk.FileRecord
+		var dirs []string
+		if !unchanged(dir, &files, &dirs) {
+			return nil, nil, false
+		}
+		return files, dirs, true
+	}
+}
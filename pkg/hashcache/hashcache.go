@@ -0,0 +1,195 @@
+// Package hashcache keeps file digests between runs so unchanged files are not read again.
+package hashcache
+
+import (
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/atomicfile"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/manifest"
+)
+
+// version is raised whenever the file layout changes; older files are rejected.
+const version = 1
+
+// Entry is the cached digest of one file and the metadata it was valid for.
+type Entry struct {
+	Size     int64
+	ModTime  time.Time
+	Sum      iphash.HashBytes
+	Verified time.Time // Last time the content was actually read and hashed
+}
+
+// file is the on-disk layout of a cache.
+type file struct {
+	Version int
+	Algo    string
+	Entries map[string]Entry
+	Dirs    map[string]DirEntry // Absent from caches written before the index existed
+}
+
+// Cache maps file paths to digests of one hash algorithm. It is safe for concurrent use.
+type Cache struct {
+	Algo string
+
+	mu      sync.Mutex
+	entries map[string]Entry
+	dirs    map[string]DirEntry // Directory index, by path
+	hits    atomic.Uint64
+}
+
+// New returns an empty cache for the given algorithm.
+func New(algo string) *Cache {
+	return &Cache{Algo: algo, entries: make(map[string]Entry), dirs: make(map[string]DirEntry)}
+}
+
+// Load reads the cache at path, or returns an empty one if the file does not exist yet.
+// A cache written for another hash algorithm is an error rather than silently discarded.
+func Load(path, algo string) (*Cache, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return New(algo), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hash cache: %w", err)
+	}
+	defer f.Close()
+	var data file
+	if err := gob.NewDecoder(f).Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to read hash cache %s: %w", path, err)
+	}
+	if data.Version != version {
+		return nil, fmt.Errorf("hash cache %s has version %d, want %d", path, data.Version, version)
+	}
+	if data.Algo != algo {
+		return nil, fmt.Errorf("hash cache %s holds %s digests, not %s", path, data.Algo, algo)
+	}
+	c := New(algo)
+	if data.Entries != nil {
+		c.entries = data.Entries
+	}
+	if data.Dirs != nil {
+		c.dirs = data.Dirs
+	}
+	return c, nil
+}
+
+// Save writes the cache to path. The file is replaced atomically, so an interrupted
+// save leaves the previous cache intact.
+func (c *Cache) Save(path string) error {
+	err := atomicfile.Write(path, 0o600, func(w io.Writer) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return gob.NewEncoder(w).Encode(file{Version: version, Algo: c.Algo, Entries: c.entries, Dirs: c.dirs})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save hash cache: %w", err)
+	}
+	return nil
+}
+
+// Get returns the entry for path.
+func (c *Cache) Get(path string) (Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[path]
+	return e, ok
+}
+
+// Put stores the entry for path. The index entry of its directory, which may hold an
+// older digest, is dropped.
+func (c *Cache) Put(path string, e Entry) {
+	c.mu.Lock()
+	c.entries[path] = e
+	delete(c.dirs, filepath.Dir(path))
+	c.mu.Unlock()
+}
+
+// Len returns the number of cached files.
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+// Hits returns how many digests HashFunc took from the cache.
+func (c *Cache) Hits() uint64 {
+	return c.hits.Load()
+}
+
+// Paths returns the cached paths in lexical order.
+func (c *Cache) Paths() []string {
+	c.mu.Lock()
+	paths := make([]string, 0, len(c.entries))
+	for p := range c.entries {
+		paths = append(paths, p)
+	}
+	c.mu.Unlock()
+	sort.Strings(paths)
+	return paths
+}
+
+// Fresh reports whether e is still valid for a file with the given stat information.
+func (e Entry) Fresh(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime.Equal(info.ModTime())
+}
+
+// HashFunc wraps hash so that files whose size and modification time match their
+// cached entry are not read again, and every newly computed digest is cached.
+func (c *Cache) HashFunc(hash fswalk.HashFunc) fswalk.HashFunc {
+	return func(path string) (iphash.HashBytes, error) {
+		// Stat before reading: a file changed while it is hashed gets a stale
+		// modification time and is read again next time.
+		info, err := os.Stat(path)
+		if err != nil {
+			return hash(path)
+		}
+		if e, ok := c.Get(path); ok && e.Fresh(info) {
+			c.hits.Add(1)
+			return e.Sum, nil
+		}
+		sum, err := hash(path)
+		if err == nil {
+			c.Put(path, Entry{Size: info.Size(), ModTime: info.ModTime(), Sum: sum, Verified: time.Now()})
+		}
+		return sum, err
+	}
+}
+
+// Import seeds the cache with digests computed elsewhere, e.g. by md5sum. An entry is
+// only taken when its file exists with the listed size and was last modified no later
+// than notAfter, the time the checksums were written; files without a fresh cached
+// digest are left alone otherwise. Imported digests are never marked verified.
+func (c *Cache) Import(entries map[string]manifest.Entry, notAfter time.Time) int {
+	n := 0
+	for path, m := range entries {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.ModTime().After(notAfter) {
+			continue
+		}
+		if m.Size >= 0 && m.Size != info.Size() {
+			continue
+		}
+		if e, ok := c.Get(path); ok && e.Fresh(info) {
+			continue
+		}
+		sum, err := hex.DecodeString(m.Hash)
+		if err != nil {
+			continue
+		}
+		c.Put(path, Entry{Size: info.Size(), ModTime: info.ModTime(), Sum: sum})
+		n++
+	}
+	return n
+}
@@ -0,0 +1,216 @@
+package hashcache
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/manifest"
+)
+
+// TestHashFunc checks that unchanged files are served from the cache, modified files
+// are hashed again, and that the cache survives a save and load.
+func TestHashFunc(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "f")
+	if err := os.WriteFile(path, []byte("one"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reads := 0
+	hash := func(p string) (iphash.HashBytes, error) {
+		reads++
+		return iphash.GetFileHashSHA256bytes(p)
+	}
+
+	c := New("sha256")
+	cached := c.HashFunc(hash)
+	first, err := cached(path)
+	if err != nil {
+		t.Fatalf("HashFunc returned an unexpected error: %v", err)
+	}
+	if _, err := cached(path); err != nil || reads != 1 || c.Hits() != 1 {
+		t.Errorf("Unchanged file mismatch. Got: %d reads, %d hits, Want: 1 read, 1 hit", reads, c.Hits())
+	}
+
+	if err := os.WriteFile(path, []byte("two"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := cached(path)
+	if reads != 2 || iphash.HashToString(second) == iphash.HashToString(first) {
+		t.Errorf("Modified file was not hashed again (%d reads)", reads)
+	}
+
+	cacheFile := filepath.Join(dir, "cache")
+	if err := c.Save(cacheFile); err != nil {
+		t.Fatalf("Save returned an unexpected error: %v", err)
+	}
+	loaded, err := Load(cacheFile, "sha256")
+	if err != nil {
+		t.Fatalf("Load returned an unexpected error: %v", err)
+	}
+	if e, ok := loaded.Get(path); !ok || iphash.HashToString(e.Sum) != iphash.HashToString(second) {
+		t.Errorf("Loaded entry mismatch. Got: %+v, Want sum: %x", e, second)
+	}
+	if _, err := Load(cacheFile, "md5"); err == nil {
+		t.Errorf("Load accepted a cache written for another algorithm")
+	}
+	if c, err := Load(filepath.Join(dir, "missing"), "md5"); err != nil || c.Len() != 0 {
+		t.Errorf("Load of a missing file mismatch. Got: %v, %v, Want an empty cache", c, err)
+	}
+}
+
+// TestImport checks that imported digests are only trusted for files that were not
+// modified after the checksums were written and still have the listed size.
+func TestImport(t *testing.T) {
+	dir := t.TempDir()
+	old, changed, resized := filepath.Join(dir, "old"), filepath.Join(dir, "changed"), filepath.Join(dir, "resized")
+	for _, p := range []string{old, changed, resized} {
+		if err := os.WriteFile(p, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	written := time.Now().Add(time.Hour)
+	later := written.Add(time.Minute)
+	if err := os.Chtimes(changed, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	c := New("md5")
+	n := c.Import(map[string]manifest.Entry{
+		old:                          {Path: old, Size: 4, Hash: "0102"},
+		changed:                      {Path: changed, Size: -1, Hash: "0102"},
+		resized:                      {Path: resized, Size: 9, Hash: "0102"},
+		filepath.Join(dir, "absent"): {Path: filepath.Join(dir, "absent"), Size: -1, Hash: "0102"},
+	}, written)
+	if n != 1 || c.Len() != 1 {
+		t.Errorf("Imported count mismatch. Got: %d, Want: 1", n)
+	}
+	if e, ok := c.Get(old); !ok || iphash.HashToString(e.Sum) != "0102" || !e.Verified.IsZero() {
+		t.Errorf("Imported entry mismatch. Got: %+v", e)
+	}
+}
+
+// TestPruneVerify checks that pruning drops deleted files and that verifying drops
+// stale and mismatching entries while confirming good ones.
+func TestPruneVerify(t *testing.T) {
+	dir := t.TempDir()
+	good, bad, gone := filepath.Join(dir, "good"), filepath.Join(dir, "bad"), filepath.Join(dir, "gone")
+	c := New("sha256")
+	cached := c.HashFunc(iphash.GetFileHashSHA256bytes)
+	for _, p := range []string{good, bad, gone} {
+		if err := os.WriteFile(p, []byte(p), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := cached(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Remove(gone)
+	e, _ := c.Get(bad)
+	e.Sum = iphash.HashBytes{0}
+	c.Put(bad, e)
+
+	if n := c.Prune(); n != 1 || c.Len() != 2 {
+		t.Errorf("Prune mismatch. Got: %d pruned, %d left, Want: 1, 2", n, c.Len())
+	}
+	res := c.Verify(iphash.GetFileHashSHA256bytes, 10, rand.New(rand.NewSource(1)))
+	if res.Checked != 2 || res.OK != 1 || len(res.Mismatch) != 1 || res.Mismatch[0] != bad {
+		t.Errorf("Verify mismatch. Got: %+v", res)
+	}
+	if _, ok := c.Get(bad); ok || c.Len() != 1 {
+		t.Errorf("Mismatching entry was not dropped")
+	}
+}
+
+// TestDirIndex checks that a second walk takes an unchanged tree from the directory
+// index without listing it, that a changed directory is listed again while its
+// unchanged siblings are not, and that the index survives a save and load.
+func TestDirIndex(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a/f1", "b/f2", "top"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := New("sha256")
+	reads := 0
+	var mu sync.Mutex
+	hash := c.HashFunc(func(p string) (iphash.HashBytes, error) {
+		mu.Lock()
+		reads++
+		mu.Unlock()
+		return iphash.GetFileHashSHA256bytes(p)
+	})
+	walk := func() (files int, listed []string) {
+		reads = 0
+		times := make(map[string]time.Time)
+		opts := fswalk.Options{
+			Unchanged: c.UnchangedDirs(),
+			OnDirListed: func(dir string, info os.FileInfo) {
+				mu.Lock()
+				times[dir] = info.ModTime()
+				mu.Unlock()
+			},
+		}
+		var stats fswalk.Stats
+		var found, hashed atomic.Uint64
+		m, dirs, err := fswalk.DigestAll(context.Background(), root, hash, 2, opts, &stats, &found, &hashed)
+		if err != nil {
+			t.Fatalf("DigestAll returned an unexpected error: %v", err)
+		}
+		c.UpdateDirs(times, m, dirs)
+		for dir := range times {
+			rel, _ := filepath.Rel(root, dir)
+			listed = append(listed, filepath.ToSlash(rel))
+		}
+		sort.Strings(listed)
+		return len(m), listed
+	}
+
+	if files, listed := walk(); files != 3 || reads != 3 || strings.Join(listed, " ") != ". a b" {
+		t.Errorf("First walk mismatch. Got: %d files, %d reads, listed %v", files, reads, listed)
+	}
+	if files, listed := walk(); files != 3 || reads != 0 || len(listed) != 0 {
+		t.Errorf("Unchanged walk mismatch. Got: %d files, %d reads, listed %v", files, reads, listed)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "b", "f3"), []byte("new"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(root, "b"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	if files, listed := walk(); files != 4 || reads != 1 || strings.Join(listed, " ") != ". b" {
+		t.Errorf("Changed walk mismatch. Got: %d files, %d reads, listed %v", files, reads, listed)
+	}
+
+	cacheFile := filepath.Join(t.TempDir(), "cache")
+	if err := c.Save(cacheFile); err != nil {
+		t.Fatalf("Save returned an unexpected error: %v", err)
+	}
+	loaded, err := Load(cacheFile, "sha256")
+	if err != nil {
+		t.Fatalf("Load returned an unexpected error: %v", err)
+	}
+	if n := loaded.Stats().Dirs; n != 3 {
+		t.Errorf("Indexed directories mismatch after Load. Got: %d, Want: 3", n)
+	}
+}
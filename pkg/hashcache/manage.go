@@ -0,0 +1,117 @@
+package hashcache
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// Stats describes the contents of a cache.
+type Stats struct {
+	Algo          string    `json:"algo"`
+	Entries       int       `json:"entries"`
+	Bytes         int64     `json:"bytes"`          // Total size of the cached files
+	NeverVerified int       `json:"never_verified"` // Imported digests not yet read back
+	OldestVerify  time.Time `json:"oldest_verified"`
+	NewestVerify  time.Time `json:"newest_verified"`
+	Dirs          int       `json:"dirs_indexed"` // Directories in the index of --dir-index
+}
+
+// Stats summarises the cache.
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := Stats{Algo: c.Algo, Entries: len(c.entries), Dirs: len(c.dirs)}
+	for _, e := range c.entries {
+		s.Bytes += e.Size
+		if e.Verified.IsZero() {
+			s.NeverVerified++
+			continue
+		}
+		if s.OldestVerify.IsZero() || e.Verified.Before(s.OldestVerify) {
+			s.OldestVerify = e.Verified
+		}
+		if e.Verified.After(s.NewestVerify) {
+			s.NewestVerify = e.Verified
+		}
+	}
+	return s
+}
+
+// Prune drops the entries of files that no longer exist or are no longer regular
+// files, and returns how many were dropped. Indexed directories that no longer exist
+// are dropped too.
+func (c *Cache) Prune() int {
+	c.mu.Lock()
+	for dir := range c.dirs {
+		if _, err := os.Lstat(dir); os.IsNotExist(err) {
+			delete(c.dirs, dir)
+		}
+	}
+	c.mu.Unlock()
+	n := 0
+	for _, p := range c.Paths() {
+		info, err := os.Lstat(p)
+		if (err != nil && os.IsNotExist(err)) || (err == nil && !info.Mode().IsRegular()) {
+			c.delete(p)
+			n++
+		}
+	}
+	return n
+}
+
+// VerifyResult is the outcome of a spot check.
+type VerifyResult struct {
+	Checked  int      `json:"checked"`
+	OK       int      `json:"ok"`
+	Stale    int      `json:"stale"`    // File changed or vanished since it was cached
+	Errors   int      `json:"errors"`   // File could not be read
+	Mismatch []string `json:"mismatch"` // Unchanged file whose content differs from its entry
+}
+
+// Verify re-hashes up to n randomly chosen entries. Entries that turn out to be stale
+// or wrong are dropped, so the files are read again on the next scan; confirmed ones
+// are marked verified.
+func (c *Cache) Verify(hash fswalk.HashFunc, n int, rnd *rand.Rand) VerifyResult {
+	paths := c.Paths()
+	rnd.Shuffle(len(paths), func(i, j int) { paths[i], paths[j] = paths[j], paths[i] })
+	if len(paths) > n {
+		paths = paths[:n]
+	}
+	res := VerifyResult{Mismatch: []string{}}
+	for _, p := range paths {
+		res.Checked++
+		e, _ := c.Get(p)
+		info, err := os.Stat(p)
+		if err != nil || !e.Fresh(info) {
+			res.Stale++
+			c.delete(p)
+			continue
+		}
+		sum, err := hash(p)
+		switch {
+		case err != nil:
+			res.Errors++
+		case iphash.HashToString(sum) != iphash.HashToString(e.Sum):
+			res.Mismatch = append(res.Mismatch, p)
+			c.delete(p)
+		default:
+			res.OK++
+			e.Verified = time.Now()
+			c.Put(p, e)
+		}
+	}
+	return res
+}
+
+// delete drops the entry for path and the index entry of its directory.
+func (c *Cache) delete(path string) {
+	c.mu.Lock()
+	delete(c.entries, path)
+	delete(c.dirs, filepath.Dir(path))
+	c.mu.Unlock()
+}
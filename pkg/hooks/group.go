@@ -0,0 +1,180 @@
+// Package hooks runs user supplied commands at defined points of a deduplication run.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// Placeholders recognised in an --exec-per-group template.
+const (
+	placeholderOriginal = "{original}"
+	placeholderDups     = "{dups...}"
+)
+
+// GroupCommand is a parsed --exec-per-group template such as 'cmd {original} {dups...}'.
+// The template is split into words once; paths are substituted as whole arguments and the
+// command is run without a shell, so file names can never be interpreted as shell syntax.
+type GroupCommand struct {
+	words []string
+
+	// Stdout receives the command's standard output; os.Stdout when nil.
+	Stdout io.Writer
+}
+
+// ParseGroupCommand splits a template into words using shell-like quoting rules.
+func ParseGroupCommand(tmpl string) (*GroupCommand, error) {
+	words, err := splitWords(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty command template")
+	}
+	for _, w := range words {
+		if strings.Contains(w, placeholderDups) && w != placeholderDups {
+			return nil, fmt.Errorf("%s must be a separate word in %q", placeholderDups, tmpl)
+		}
+	}
+	return &GroupCommand{words: words}, nil
+}
+
+// Args expands the template for one group.
+func (c *GroupCommand) Args(original string, dups []string) []string {
+	var args []string
+	for _, w := range c.words {
+		if w == placeholderDups {
+			args = append(args, dups...)
+			continue
+		}
+		args = append(args, strings.ReplaceAll(w, placeholderOriginal, original))
+	}
+	return args
+}
+
+// Run executes the command for one group, passing through its output.
+func (c *GroupCommand) Run(ctx context.Context, original string, dups []string) error {
+	args := c.Args(original, dups)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = c.Stdout
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("group command %s failed: %w", args[0], err)
+	}
+	return nil
+}
+
+// Preview renders the expanded command as a copy-pasteable shell line.
+func (c *GroupCommand) Preview(original string, dups []string) string {
+	args := c.Args(original, dups)
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = ShellQuote(a)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ShellQuote quotes s for a POSIX shell, leaving plain words untouched. Names that are
+// not printable (see fswalk.PrintableName) use $'...' quoting with every byte outside
+// printable ASCII escaped, so the line stays on one line and safe to display.
+func ShellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, needsQuote) < 0 {
+		return s
+	}
+	if !fswalk.PrintableName(s) {
+		return ansiCQuote(s)
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ansiCQuote quotes s as $'...', escaping quotes, backslashes and every byte outside
+// printable ASCII as \xHH.
+func ansiCQuote(s string) string {
+	var b strings.Builder
+	b.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+func needsQuote(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	case strings.ContainsRune("-_./,:=@%+", r):
+		return false
+	}
+	return true
+}
+
+// splitWords splits s like a POSIX shell would, honouring single quotes,
+// double quotes and backslash escapes, but without any expansion.
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, r := range s {
+		switch {
+		case escaped:
+			cur.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case quote == '"':
+			switch r {
+			case '"':
+				quote = 0
+			case '\\':
+				escaped = true
+			default:
+				cur.WriteRune(r)
+			}
+		case r == '\\':
+			escaped, inWord = true, true
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote or escape in %q", s)
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
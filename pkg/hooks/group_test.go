@@ -0,0 +1,45 @@
+package hooks
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestGroupCommandArgs checks word splitting and placeholder expansion.
+func TestGroupCommandArgs(t *testing.T) {
+	c, err := ParseGroupCommand(`cmp --label="a b" {original} '{dups...}'`)
+	if err != nil {
+		t.Fatalf("ParseGroupCommand returned an unexpected error: %v", err)
+	}
+	got := c.Args("/x/orig file", []string{"/y/d1", "/z/d 2"})
+	want := []string{"cmp", "--label=a b", "/x/orig file", "/y/d1", "/z/d 2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Args mismatch. Got: %q, Want: %q", got, want)
+	}
+}
+
+// TestParseGroupCommandErrors checks that malformed templates are rejected.
+func TestParseGroupCommandErrors(t *testing.T) {
+	for _, tmpl := range []string{"", "cmd 'open", "cmd x{dups...}"} {
+		if _, err := ParseGroupCommand(tmpl); err == nil {
+			t.Errorf("Expected an error for template %q, but got nil", tmpl)
+		}
+	}
+}
+
+// TestShellQuote checks quoting of plain and hostile file names.
+func TestShellQuote(t *testing.T) {
+	cases := map[string]string{
+		"/plain/path.txt": "/plain/path.txt",
+		"it's here":       `'it'\''s here'`,
+		"$(rm -rf /)":     "'$(rm -rf /)'",
+		"":                "''",
+		"a\nb\x1b[2J":     `$'a\x0ab\x1b[2J'`,
+		"bad\xff'\\":      `$'bad\xff\'\\'`,
+	}
+	for in, want := range cases {
+		if got := ShellQuote(in); got != want {
+			t.Errorf("ShellQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// mailTimeout bounds the whole SMTP conversation, like webhookTimeout.
+const mailTimeout = 30 * time.Second
+
+// Mail sends run notifications by email, for hosts where webhooks cannot reach
+// anyone. STARTTLS is used whenever the server offers it.
+type Mail struct {
+	Server   string   // host:port
+	From     string   // Envelope and header sender
+	To       []string // Recipients
+	Username string   // Enables PLAIN authentication, which needs TLS or a local server
+	Password string
+	On       string // always (default), success or failure
+}
+
+// Validate checks the addresses and the trigger.
+func (m Mail) Validate() error {
+	if _, _, err := net.SplitHostPort(m.Server); err != nil {
+		return fmt.Errorf("invalid SMTP server %q: %w", m.Server, err)
+	}
+	if _, err := mail.ParseAddress(m.From); err != nil {
+		return fmt.Errorf("invalid sender %q: %w", m.From, err)
+	}
+	if len(m.To) == 0 {
+		return fmt.Errorf("no mail recipients")
+	}
+	for _, to := range m.To {
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", to, err)
+		}
+	}
+	return validTrigger(m.On)
+}
+
+// Fires reports whether mail is sent for a run with the given outcome.
+func (m Mail) Fires(success bool) bool {
+	return fires(m.On, success)
+}
+
+// Message returns the RFC 5322 message with the given subject and plain text body.
+func (m Mail) Message(subject, body string, date time.Time) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes()
+}
+
+// Send delivers the message to every recipient.
+func (m Mail) Send(subject, body string) error {
+	host, _, _ := net.SplitHostPort(m.Server)
+	conn, err := net.DialTimeout("tcp", m.Server, mailTimeout)
+	if err != nil {
+		return fmt.Errorf("mail server %s: %w", m.Server, err)
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("mail server %s: %w", m.Server, err)
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return fmt.Errorf("mail server %s: %w", m.Server, err)
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, host)); err != nil {
+			return fmt.Errorf("mail server %s: %w", m.Server, err)
+		}
+	}
+	from, _ := mail.ParseAddress(m.From)
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("mail server %s refused sender: %w", m.Server, err)
+	}
+	for _, to := range m.To {
+		addr, _ := mail.ParseAddress(to)
+		if err := c.Rcpt(addr.Address); err != nil {
+			return fmt.Errorf("mail server %s refused %s: %w", m.Server, to, err)
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("mail server %s: %w", m.Server, err)
+	}
+	if _, err := w.Write(m.Message(subject, body, time.Now())); err != nil {
+		return fmt.Errorf("mail server %s: %w", m.Server, err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("mail server %s: %w", m.Server, err)
+	}
+	return c.Quit()
+}
@@ -0,0 +1,101 @@
+package hooks
+
+import (
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// fakeSMTP accepts one SMTP session on a local port and returns its address and a
+// channel receiving the envelope recipients and message.
+func fakeSMTP(t *testing.T) (string, <-chan []string) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen locally: %v", err)
+	}
+	got := make(chan []string, 1)
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		tp := textproto.NewConn(conn)
+		var session []string
+		tp.PrintfLine("220 fake ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				got <- session
+				return
+			}
+			switch cmd := strings.ToUpper(strings.Fields(line)[0]); cmd {
+			case "EHLO", "HELO":
+				tp.PrintfLine("250 fake")
+			case "MAIL":
+				tp.PrintfLine("250 ok")
+			case "RCPT":
+				session = append(session, line)
+				tp.PrintfLine("250 ok")
+			case "DATA":
+				tp.PrintfLine("354 go ahead")
+				data, _ := tp.ReadDotLines()
+				session = append(session, strings.Join(data, "\n"))
+				tp.PrintfLine("250 queued")
+			case "QUIT":
+				tp.PrintfLine("221 bye")
+				got <- session
+				return
+			default:
+				tp.PrintfLine("502 unsupported")
+			}
+		}
+	}()
+	return l.Addr().String(), got
+}
+
+// TestMailSend checks the SMTP conversation and the headers and body of the message.
+func TestMailSend(t *testing.T) {
+	addr, got := fakeSMTP(t)
+	m := Mail{Server: addr, From: "Dedupe <dedupe@nas.example>", To: []string{"admin@example.com", "ops@example.com"}}
+	if err := m.Validate(); err != nil {
+		t.Fatalf("Validate returned an unexpected error: %v", err)
+	}
+	if err := m.Send("Run succeeded – 3 groups", "Line one\n.hidden dot\n"); err != nil {
+		t.Fatalf("Send returned an unexpected error: %v", err)
+	}
+	session := <-got
+	if len(session) != 3 || session[0] != "RCPT TO:<admin@example.com>" || session[1] != "RCPT TO:<ops@example.com>" {
+		t.Fatalf("Session mismatch. Got: %q", session)
+	}
+	msg := session[2]
+	for _, want := range []string{"From: Dedupe <dedupe@nas.example>", "To: admin@example.com, ops@example.com",
+		"Subject: =?utf-8?q?Run_succeeded_=E2=80=93_3_groups?=", "\n\nLine one\n.hidden dot"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("Message lacks %q. Got:\n%s", want, msg)
+		}
+	}
+}
+
+// TestMailValidate checks that bad addresses and triggers are rejected.
+func TestMailValidate(t *testing.T) {
+	ok := Mail{Server: "localhost:25", From: "a@b.example", To: []string{"c@d.example"}, On: OnFailure}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("Validate returned an unexpected error: %v", err)
+	}
+	if ok.Fires(true) || !ok.Fires(false) {
+		t.Errorf("Fires mismatch for a failure-only mail")
+	}
+	for _, m := range []Mail{
+		{Server: "localhost", From: ok.From, To: ok.To},
+		{Server: ok.Server, From: "not an address", To: ok.To},
+		{Server: ok.Server, From: ok.From},
+		{Server: ok.Server, From: ok.From, To: ok.To, On: "sometimes"},
+	} {
+		if err := m.Validate(); err == nil {
+			t.Errorf("Validate accepted %+v", m)
+		}
+	}
+}
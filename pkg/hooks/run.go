@@ -0,0 +1,112 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// When a run hook fires.
+const (
+	OnAlways  = "always"
+	OnSuccess = "success"
+	OnFailure = "failure"
+)
+
+// RunHook is a command or webhook notified when a run finishes.
+// Exactly one of Command and URL is set.
+type RunHook struct {
+	Command string `json:"command"` // Split like --exec-per-group, run without a shell
+	URL     string `json:"url"`     // Receives an HTTP POST
+	On      string `json:"on"`      // always (default), success or failure
+}
+
+// Validate checks that the hook is well formed.
+func (h RunHook) Validate() error {
+	if (h.Command == "") == (h.URL == "") {
+		return fmt.Errorf("hook needs exactly one of command or url")
+	}
+	if err := validTrigger(h.On); err != nil {
+		return err
+	}
+	if h.Command != "" {
+		if _, err := splitWords(h.Command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validTrigger checks the On field of a hook or Mail.
+func validTrigger(on string) error {
+	switch on {
+	case "", OnAlways, OnSuccess, OnFailure:
+		return nil
+	}
+	return fmt.Errorf("unknown hook trigger %q (use always, success or failure)", on)
+}
+
+// Fires reports whether the hook should run for a run with the given outcome.
+func (h RunHook) Fires(success bool) bool {
+	return fires(h.On, success)
+}
+
+// fires reports whether a hook or Mail with the trigger on fires for the outcome.
+func fires(on string, success bool) bool {
+	switch on {
+	case OnSuccess:
+		return success
+	case OnFailure:
+		return !success
+	}
+	return true
+}
+
+// webhookTimeout bounds how long a slow endpoint can delay the end of a run.
+const webhookTimeout = 10 * time.Second
+
+// Notify delivers the JSON summary to the hook: on stdin for commands, as the body for webhooks.
+func (h RunHook) Notify(ctx context.Context, summary []byte) error {
+	if h.URL != "" {
+		return postJSON(ctx, h.URL, summary)
+	}
+	words, err := splitWords(h.Command)
+	if err != nil {
+		return err
+	}
+	if len(words) == 0 {
+		return fmt.Errorf("empty hook command")
+	}
+	cmd := exec.CommandContext(ctx, words[0], words[1:]...)
+	cmd.Stdin = bytes.NewReader(summary)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook command %s failed: %w", words[0], err)
+	}
+	return nil
+}
+
+func postJSON(ctx context.Context, url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s returned %s", url, resp.Status)
+	}
+	return nil
+}
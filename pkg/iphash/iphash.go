@@ -0,0 +1,203 @@
+// /home/nicky/src/go/go-file-dedupe/pkg/iphash/iphash.go
+package iphash
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex" // Import the hash interface
+	"fmt"
+	"hash"
+	"io" // Import the io package for io.Copy
+	"os"
+
+	"github.com/zeebo/blake3"
+)
+
+// HashBytes remains the same type alias for the MD5 fixed-size array
+type HashBytes []byte
+
+// GetFileHashBytes calculates the MD5 hash of a file efficiently using streaming I/O.
+// This version avoids loading the entire file into memory.
+func GetFileHashMD5bytes(path string) (HashBytes, error) {
+	return getFileHash(path, md5.New())
+}
+
+// GetFileHashSHA256bytes calculates the SHA256 hash of a file efficiently using streaming I/O.
+func GetFileHashSHA256bytes(path string) (HashBytes, error) {
+	return getFileHash(path, sha256.New())
+}
+
+// GetFileHashBLAKE3bytes calculates the BLAKE3 hash of a file efficiently using streaming I/O.
+func GetFileHashBLAKE3bytes(path string) (HashBytes, error) {
+	return getFileHash(path, blake3.New())
+}
+
+// New returns a fresh hash.Hash for the named algorithm (blake3, sha256 or md5),
+// for content that is not read from a file, such as entries of an archive.
+func New(algo string) (hash.Hash, error) {
+	switch algo {
+	case "blake3":
+		return blake3.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "md5":
+		return md5.New(), nil
+	}
+	return nil, fmt.Errorf("unknown hash algorithm %q", algo)
+}
+
+// GetFileSampleHash digests only the size of a file and three runs of sample bytes
+// taken at its start, middle and end. It is far cheaper than reading a large file, but
+// files that differ only outside the samples get the same digest, so matches must be
+// confirmed with a full hash. The digest never equals a full hash of the same file.
+func GetFileSampleHash(path string, hasher hash.Hash, sample int64) (HashBytes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file %s: %w", path, err)
+	}
+	size := info.Size()
+	fmt.Fprintf(hasher, "sample:%d:%d:", sample, size)
+	if size <= 3*sample {
+		if _, err := io.Copy(hasher, file); err != nil {
+			return nil, fmt.Errorf("failed to hash file %s: %w", path, err)
+		}
+		return hasher.Sum(nil), nil
+	}
+	for _, off := range []int64{0, size/2 - sample/2, size - sample} {
+		if _, err := io.Copy(hasher, io.NewSectionReader(file, off, sample)); err != nil {
+			return nil, fmt.Errorf("failed to hash file %s: %w", path, err)
+		}
+	}
+	return hasher.Sum(nil), nil
+}
+
+// GetFileHashCtx hashes a file like getFileHash but stops reading as soon as ctx is
+// done, so cancelling a scan does not wait for a huge file to be read to the end. The
+// error then wraps the context's error.
+func GetFileHashCtx(ctx context.Context, path string, hasher hash.Hash) (HashBytes, error) {
+	return GetFileHashObserved(ctx, path, hasher, nil, 0)
+}
+
+// Observer follows the hashing of large files, e.g. to show that a worker busy with
+// one huge file for minutes is making progress. Its methods may be called from
+// several goroutines at once.
+type Observer interface {
+	HashStarted(path string, size int64)  // Before the first byte is read
+	HashProgress(path string, done int64) // Bytes read so far, about once per MiB
+	HashDone(path string)                 // Read to the end, failed or cancelled
+}
+
+// observeEvery is how many bytes are read between two HashProgress calls.
+const observeEvery = 1 << 20
+
+// GetFileHashObserved is GetFileHashCtx reporting to obs while it hashes files of at
+// least minSize bytes. A nil obs observes nothing.
+func GetFileHashObserved(ctx context.Context, path string, hasher hash.Hash, obs Observer, minSize int64) (HashBytes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	r := &ctxReader{done: ctx.Done(), ctx: ctx, r: file}
+	if obs != nil {
+		if info, err := file.Stat(); err == nil && info.Size() >= minSize {
+			obs.HashStarted(path, info.Size())
+			defer obs.HashDone(path)
+			r.obs, r.path = obs, path
+		}
+	}
+	if _, err := io.Copy(hasher, r); err != nil {
+		return nil, fmt.Errorf("failed to hash file %s: %w", path, err)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// ctxReader fails with the context's error once it is done, checked before every
+// read, and reports the bytes read to an optional Observer.
+type ctxReader struct {
+	done <-chan struct{}
+	ctx  context.Context
+	r    io.Reader
+
+	obs      Observer
+	path     string
+	read     int64 // Bytes read so far
+	reported int64 // Bytes read at the last HashProgress call
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	select {
+	case <-c.done:
+		return 0, c.ctx.Err()
+	default:
+	}
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	if c.obs != nil && c.read-c.reported >= observeEvery {
+		c.obs.HashProgress(c.path, c.read)
+		c.reported = c.read
+	}
+	return n, err
+}
+
+// getFileHash is a generic helper that computes the hash of a file using any provided hash.Hash implementation.
+func getFileHash(path string, hasher hash.Hash) (HashBytes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close() // Ensure file is closed
+
+	// io.Copy efficiently copies data from the file (Reader) to the hasher (Writer)
+	if _, err := io.Copy(hasher, file); err != nil {
+		return nil, fmt.Errorf("failed to hash file %s: %w", path, err)
+	}
+
+	// Get the final hash sum. hasher.Sum(nil) appends the hash to a nil slice.
+	return hasher.Sum(nil), nil
+}
+
+// GetFileHash remains the same, it now benefits from the efficient GetFileHashBytes
+func GetFileHash(path string) (string, error) {
+	data, err := GetFileHashMD5bytes(path) // Calls the new efficient version
+	if err != nil {
+		// Wrap the error from GetFileHashBytes
+		return "", fmt.Errorf("could not execute digest for %s: %w", path, err)
+	}
+	// Pass the array directly, HashToString handles the slicing
+	return HashToString(data), nil
+}
+func GetFileHashSHA256(path string) (string, error) {
+	data, err := GetFileHashSHA256bytes(path) // Calls the new efficient version
+	if err != nil {
+		// Wrap the error from GetFileHashBytes
+		return "", fmt.Errorf("could not execute digest for %s: %w", path, err)
+	}
+	// Pass the array directly, HashToString handles the slicing
+	return HashToString(data), nil
+}
+
+// HashToString remains the same. Note: Original didn't return error, keeping it that way.
+func HashToString(code HashBytes) string {
+	if code == nil {
+		return "" // Or return an error if a nil hash is unexpected
+	}
+	return hex.EncodeToString(code) // Slice the array to pass to EncodeToString
+}
+
+// GroupID returns the identifier of the duplicate group with the given content hash.
+// It depends only on the content, so the same group has the same ID in every scan
+// made with the same algorithm.
+func GroupID(code HashBytes) string {
+	if len(code) > 8 {
+		code = code[:8]
+	}
+	return "dg-" + hex.EncodeToString(code)
+}
@@ -1,6 +1,9 @@
 package iphash
 
 import (
+	"context"
+	"crypto/md5"
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -103,3 +106,70 @@ func TestHashToString(t *testing.T) {
 		t.Errorf("Expected %s for known bytes, got %s", expectedStr, str)
 	}
 }
+
+func TestGroupID(t *testing.T) {
+	sum := HashBytes{0x5e, 0xb6, 0x3b, 0xbb, 0xe0, 0x1e, 0xee, 0xd0, 0x93, 0xcb}
+	if id := GroupID(sum); id != "dg-5eb63bbbe01eeed0" {
+		t.Errorf("Expected dg-5eb63bbbe01eeed0 for known bytes, got %s", id)
+	}
+	if id := GroupID(HashBytes{0x01}); id != "dg-01" {
+		t.Errorf("Expected dg-01 for a short hash, got %s", id)
+	}
+}
+
+// TestGetFileHashCtx checks that the context variant matches the plain hash and stops
+// once its context is cancelled.
+func TestGetFileHashCtx(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "testfile.txt")
+	if err := os.WriteFile(tmpFile, []byte("hello world"), 0666); err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	hashBytes, err := GetFileHashCtx(context.Background(), tmpFile, md5.New())
+	if err != nil {
+		t.Fatalf("GetFileHashCtx returned an unexpected error: %v", err)
+	}
+	if got, want := HashToString(hashBytes), "5eb63bbbe01eeed093cb22bb8f5acdc3"; got != want {
+		t.Errorf("Hash mismatch. Got: %s, Want: %s", got, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := GetFileHashCtx(ctx, tmpFile, md5.New()); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected a cancellation error, got %v", err)
+	}
+}
+
+// recorder is an Observer remembering its calls.
+type recorder struct {
+	size, done int64
+	progress   int
+	finished   bool
+}
+
+func (r *recorder) HashStarted(path string, size int64)  { r.size = size }
+func (r *recorder) HashProgress(path string, done int64) { r.done, r.progress = done, r.progress+1 }
+func (r *recorder) HashDone(path string)                 { r.finished = true }
+
+// TestGetFileHashObserved checks that files from the threshold on are reported while
+// they are hashed, and smaller ones are not.
+func TestGetFileHashObserved(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "big")
+	if err := os.WriteFile(tmpFile, make([]byte, 5*observeEvery/2), 0666); err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	var rec recorder
+	if _, err := GetFileHashObserved(context.Background(), tmpFile, md5.New(), &rec, observeEvery); err != nil {
+		t.Fatalf("GetFileHashObserved returned an unexpected error: %v", err)
+	}
+	if rec.size != 5*observeEvery/2 || rec.progress != 2 || rec.done < 2*observeEvery || !rec.finished {
+		t.Errorf("Observer mismatch. Got: %+v, Want: size %d, 2 progress calls, finished", rec, 5*observeEvery/2)
+	}
+
+	var small recorder
+	if _, err := GetFileHashObserved(context.Background(), tmpFile, md5.New(), &small, 3*observeEvery); err != nil {
+		t.Fatalf("GetFileHashObserved returned an unexpected error: %v", err)
+	}
+	if small != (recorder{}) {
+		t.Errorf("A file below the threshold was observed: %+v", small)
+	}
+}
@@ -0,0 +1,72 @@
+package manifest
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// digestLen is the hex length of each algorithm's digests.
+var digestLen = map[string]int{"md5": 32, "sha256": 64, "blake3": 64}
+
+// ReadChecksums reads a checksum file written by md5sum, sha256sum or b3sum, or a
+// hashdeep manifest. Relative paths are resolved against the file's own directory, or
+// for hashdeep against the directory recorded in its "## Invoked from:" line.
+func ReadChecksums(path, algo string) (map[string]Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(f)
+	if first, _ := br.Peek(len(header)); string(first) == header {
+		// The comment lines follow the two header lines.
+		head, _ := br.Peek(4096)
+		for _, line := range strings.Split(string(head), "\n") {
+			if line = strings.TrimRight(line, "\r"); strings.HasPrefix(line, invokedFrom) {
+				base = strings.TrimPrefix(line, invokedFrom)
+				break
+			}
+		}
+		return Read(br, algo, base)
+	}
+
+	entries := make(map[string]Entry)
+	sc := bufio.NewScanner(br)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimRight(sc.Text(), "\r")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		// "<digest>  <name>" in text mode, "<digest> *<name>" in binary mode.
+		sum, name, ok := strings.Cut(text, " ")
+		if !ok || len(name) < 2 || (name[0] != ' ' && name[0] != '*') {
+			return nil, fmt.Errorf("%s:%d: not a checksum line", path, line)
+		}
+		name = name[1:]
+		if len(sum) != digestLen[algo] {
+			return nil, fmt.Errorf("%s:%d: digest is not %s", path, line, algo)
+		}
+		if _, err := hex.DecodeString(sum); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid digest: %v", path, line, err)
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(base, name)
+		}
+		name = filepath.Clean(name)
+		entries[name] = Entry{Path: name, Size: -1, Hash: strings.ToLower(sum)}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return entries, nil
+}
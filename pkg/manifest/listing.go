@@ -0,0 +1,199 @@
+package manifest
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// listingEntry is one file of a JSON listing.
+type listingEntry struct {
+	Path  string          `json:"path"`
+	Size  *int64          `json:"size"`
+	MTime json.RawMessage `json:"mtime"` // RFC 3339 string or Unix seconds
+	Hash  string          `json:"hash"`
+}
+
+// ReadListing reads a file listing exported by a storage system: CSV with a header
+// row naming the path, size and mtime columns and optionally a hash column, or JSON,
+// either an array or one object per line, with the same keys. mtime is RFC 3339 or
+// Unix seconds; hash is a hex digest of algo. Records without a hash have a nil Sum.
+// Relative paths are resolved against the listing's own directory.
+func ReadListing(path, algo string) ([]fswalk.FileRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	first, err := firstByte(br)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var recs []fswalk.FileRecord
+	if first == '[' || first == '{' {
+		recs, err = readJSONListing(br, algo, first == '[')
+	} else {
+		recs, err = readCSVListing(br, algo)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i := range recs {
+		if !filepath.IsAbs(recs[i].Path) {
+			recs[i].Path = filepath.Join(base, recs[i].Path)
+		}
+		recs[i].Path = filepath.Clean(recs[i].Path)
+	}
+	return recs, nil
+}
+
+// firstByte skips white space and a byte order mark and returns the next byte
+// without consuming it.
+func firstByte(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			if err == io.EOF {
+				return 0, fmt.Errorf("empty listing")
+			}
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n', 0xef, 0xbb, 0xbf: // White space and a UTF-8 byte order mark
+		default:
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+// readJSONListing reads a JSON array of entries, or with array false a sequence of
+// entry objects such as JSON Lines.
+func readJSONListing(r io.Reader, algo string, array bool) ([]fswalk.FileRecord, error) {
+	dec := json.NewDecoder(r)
+	var entries []listingEntry
+	if array {
+		if err := dec.Decode(&entries); err != nil {
+			return nil, fmt.Errorf("invalid JSON listing: %w", err)
+		}
+	} else {
+		for {
+			var e listingEntry
+			if err := dec.Decode(&e); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("entry %d: invalid JSON: %w", len(entries)+1, err)
+			}
+			entries = append(entries, e)
+		}
+	}
+	recs := make([]fswalk.FileRecord, 0, len(entries))
+	for i, e := range entries {
+		if e.Path == "" || e.Size == nil || len(e.MTime) == 0 {
+			return nil, fmt.Errorf("entry %d: path, size and mtime are required", i+1)
+		}
+		mtime := string(e.MTime)
+		if s, err := strconv.Unquote(mtime); err == nil {
+			mtime = s
+		}
+		rec, err := listingRecord(e.Path, strconv.FormatInt(*e.Size, 10), mtime, e.Hash, algo)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// readCSVListing reads CSV whose header row names the columns.
+func readCSVListing(r io.Reader, algo string) ([]fswalk.FileRecord, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV listing: %w", err)
+	}
+	col := map[string]int{"path": -1, "size": -1, "mtime": -1, "hash": -1}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := col[name]; ok {
+			col[name] = i
+		}
+	}
+	if col["path"] < 0 || col["size"] < 0 || col["mtime"] < 0 {
+		return nil, fmt.Errorf("CSV header %q lacks a path, size or mtime column", strings.Join(header, ","))
+	}
+	var recs []fswalk.FileRecord
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return recs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV listing: %w", err)
+		}
+		field := func(name string) string {
+			if i := col[name]; i >= 0 && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		rec, err := listingRecord(field("path"), field("size"), field("mtime"), field("hash"), algo)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		recs = append(recs, rec)
+	}
+}
+
+// listingRecord parses the fields of one listed file.
+func listingRecord(path, size, mtime, hash, algo string) (fswalk.FileRecord, error) {
+	rec := fswalk.FileRecord{Path: path}
+	if path == "" {
+		return rec, fmt.Errorf("empty path")
+	}
+	n, err := strconv.ParseInt(size, 10, 64)
+	if err != nil || n < 0 {
+		return rec, fmt.Errorf("invalid size %q", size)
+	}
+	rec.Size, rec.Alloc = n, n
+	if rec.ModTime, err = parseMTime(mtime); err != nil {
+		return rec, err
+	}
+	if hash != "" {
+		if len(hash) != digestLen[algo] {
+			return rec, fmt.Errorf("hash %q is not %s", hash, algo)
+		}
+		if rec.Sum, err = hex.DecodeString(hash); err != nil {
+			return rec, fmt.Errorf("invalid hash %q: %v", hash, err)
+		}
+	}
+	return rec, nil
+}
+
+// parseMTime accepts RFC 3339 times and Unix seconds, with or without a fraction.
+func parseMTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid mtime %q: want RFC 3339 or Unix seconds", s)
+	}
+	whole := int64(secs)
+	return time.Unix(whole, int64((secs-float64(whole))*1e9)), nil
+}
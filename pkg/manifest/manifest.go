@@ -0,0 +1,197 @@
+// Package manifest reads and writes hashdeep-style file manifests and audits a scanned
+// tree against one.
+package manifest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// header is the first line of a hashdeep manifest.
+const header = "%%%% HASHDEEP-1.0"
+
+// invokedFrom starts the comment line recording the directory hashdeep ran in.
+const invokedFrom = "## Invoked from: "
+
+// Entry is one file listed in a manifest.
+type Entry struct {
+	Path string // Absolute, resolved against the root for relative manifest paths
+	Size int64  // -1 where the manifest has no sizes
+	Hash string // Lower-case hex digest
+}
+
+// Read parses a hashdeep manifest and returns its entries by absolute path. The
+// manifest must have a column for algo (md5, sha256, blake3, ...); relative paths
+// are taken relative to root.
+func Read(r io.Reader, algo, root string) (map[string]Entry, error) {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	var cols []string
+	sizeCol, hashCol := -1, -1
+	entries := make(map[string]Entry)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimRight(sc.Text(), "\r")
+		switch {
+		case text == "" || strings.HasPrefix(text, "##"):
+			continue
+		case text == header:
+			continue
+		case strings.HasPrefix(text, "%%%% "):
+			cols = strings.Split(strings.TrimPrefix(text, "%%%% "), ",")
+			sizeCol, hashCol = -1, -1
+			for i, c := range cols {
+				switch c {
+				case "size":
+					sizeCol = i
+				case algo:
+					hashCol = i
+				}
+			}
+			if hashCol < 0 || cols[len(cols)-1] != "filename" {
+				return nil, fmt.Errorf("line %d: manifest has no %s column followed by filename: %q", line, algo, text)
+			}
+			continue
+		}
+		if cols == nil {
+			return nil, fmt.Errorf("line %d: entry before the %%%%%%%% column header", line)
+		}
+		// The file name is the last column and may itself contain commas.
+		fields := strings.SplitN(text, ",", len(cols))
+		if len(fields) != len(cols) {
+			return nil, fmt.Errorf("line %d: want %d columns, got %d", line, len(cols), len(fields))
+		}
+		e := Entry{Path: unquoteName(fields[len(fields)-1]), Size: -1, Hash: strings.ToLower(fields[hashCol])}
+		if sizeCol >= 0 {
+			size, err := strconv.ParseInt(fields[sizeCol], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid size: %v", line, err)
+			}
+			e.Size = size
+		}
+		if !filepath.IsAbs(e.Path) {
+			e.Path = filepath.Join(root, e.Path)
+		}
+		e.Path = filepath.Clean(e.Path)
+		entries[e.Path] = e
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return entries, nil
+}
+
+// Write writes files as a hashdeep manifest with paths relative to root, sorted by path.
+// Names containing line breaks, which the format cannot hold, are written Go-quoted
+// ("./a\nb"); Read restores them, though hashdeep itself takes them literally.
+func Write(w io.Writer, algo, root string, files map[string]fswalk.FileRecord) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "%s\n%%%%%%%% size,%s,filename\n%s%s\n##\n", header, algo, invokedFrom, root)
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		name := p
+		if rel, err := filepath.Rel(root, p); err == nil && !strings.HasPrefix(rel, "..") {
+			name = "." + string(filepath.Separator) + rel
+		}
+		if strings.ContainsAny(name, "\r\n") {
+			name = strconv.Quote(name) // The format has no escapes; a raw name would split the line
+		}
+		rec := files[p]
+		fmt.Fprintf(bw, "%d,%s,%s\n", rec.Size, iphash.HashToString(rec.Sum), name)
+	}
+	return bw.Flush()
+}
+
+// unquoteName reverses the quoting Write applies to names with line breaks. Only a
+// quoted string holding a line break is unquoted: written names otherwise start with
+// "./" or "/", and a hashdeep name that merely looks quoted is taken as it is.
+func unquoteName(name string) string {
+	if !strings.HasPrefix(name, `"`) {
+		return name
+	}
+	if s, err := strconv.Unquote(name); err == nil && strings.ContainsAny(s, "\r\n") {
+		return s
+	}
+	return name
+}
+
+// Result classifies every file of a scan and a manifest. All lists are sorted.
+type Result struct {
+	Matched int      `json:"matched"`
+	Changed []string `json:"changed"` // Same path, different content
+	Moved   []Move   `json:"moved"`   // Known content that only exists under a new path
+	New     []string `json:"new"`     // Unknown path and content
+	Missing []string `json:"missing"` // Listed in the manifest but gone
+}
+
+// Move is known content found at a new path.
+type Move struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// OK reports whether the tree matches the manifest exactly.
+func (r Result) OK() bool {
+	return len(r.Changed) == 0 && len(r.Moved) == 0 && len(r.New) == 0 && len(r.Missing) == 0
+}
+
+// Compare audits the scanned files against the manifest. A file whose path is not in
+// the manifest counts as moved when its content belonged to a listed path that is now
+// missing; each missing path can explain at most one move.
+func Compare(known map[string]Entry, files map[string]fswalk.FileRecord) Result {
+	r := Result{Changed: []string{}, Moved: []Move{}, New: []string{}, Missing: []string{}}
+
+	gone := make(map[string][]string) // hash -> missing manifest paths
+	for _, p := range sortedKeys(known) {
+		if _, ok := files[p]; !ok {
+			gone[known[p].Hash] = append(gone[known[p].Hash], p)
+		}
+	}
+	moved := make(map[string]bool)
+
+	for _, p := range sortedKeys(files) {
+		sum := iphash.HashToString(files[p].Sum)
+		if e, ok := known[p]; ok {
+			if e.Hash == sum {
+				r.Matched++
+			} else {
+				r.Changed = append(r.Changed, p)
+			}
+			continue
+		}
+		if from := gone[sum]; len(from) > 0 {
+			r.Moved = append(r.Moved, Move{From: from[0], To: p})
+			moved[from[0]] = true
+			gone[sum] = from[1:]
+			continue
+		}
+		r.New = append(r.New, p)
+	}
+	for _, p := range sortedKeys(known) {
+		if _, ok := files[p]; !ok && !moved[p] {
+			r.Missing = append(r.Missing, p)
+		}
+	}
+	return r
+}
+
+// sortedKeys returns the keys of m in lexical order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,156 @@
+package manifest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// TestReadWrite checks that a written manifest reads back with absolute paths, names
+// with line breaks included, and that hashdeep manifests with extra columns and commas
+// in names are understood.
+func TestReadWrite(t *testing.T) {
+	root := filepath.FromSlash("/data")
+	files := map[string]fswalk.FileRecord{
+		filepath.Join(root, "a.txt"):       {Size: 3, Sum: iphash.HashBytes{0xab, 0xcd}},
+		filepath.Join(root, "sub", "b,c"):  {Size: 5, Sum: iphash.HashBytes{0x01}},
+		filepath.Join(root, "x\n3,ff,./y"): {Size: 1, Sum: iphash.HashBytes{0x02}},
+		filepath.Join(root, `"q"`):         {Size: 2, Sum: iphash.HashBytes{0x03}},
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, "sha256", root, files); err != nil {
+		t.Fatalf("Write returned an unexpected error: %v", err)
+	}
+	got, err := Read(&buf, "sha256", root)
+	if err != nil {
+		t.Fatalf("Read returned an unexpected error: %v", err)
+	}
+	want := map[string]Entry{
+		filepath.Join(root, "a.txt"):       {Path: filepath.Join(root, "a.txt"), Size: 3, Hash: "abcd"},
+		filepath.Join(root, "sub", "b,c"):  {Path: filepath.Join(root, "sub", "b,c"), Size: 5, Hash: "01"},
+		filepath.Join(root, "x\n3,ff,./y"): {Path: filepath.Join(root, "x\n3,ff,./y"), Size: 1, Hash: "02"},
+		filepath.Join(root, `"q"`):         {Path: filepath.Join(root, `"q"`), Size: 2, Hash: "03"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Round trip mismatch. Got: %v, Want: %v", got, want)
+	}
+
+	hashdeep := "%%%% HASHDEEP-1.0\n%%%% size,md5,sha256,filename\n## comment\n3,ffff,ABCD,./a.txt\n"
+	got, err = Read(strings.NewReader(hashdeep), "sha256", root)
+	if err != nil {
+		t.Fatalf("Read returned an unexpected error: %v", err)
+	}
+	if e := got[filepath.Join(root, "a.txt")]; e.Hash != "abcd" || e.Size != 3 {
+		t.Errorf("hashdeep entry mismatch. Got: %+v", e)
+	}
+	if _, err := Read(strings.NewReader(hashdeep), "blake3", root); err == nil {
+		t.Errorf("Read accepted a manifest without a blake3 column")
+	}
+}
+
+// TestCompare checks the classification of matched, changed, moved, new and missing files.
+func TestCompare(t *testing.T) {
+	known := map[string]Entry{
+		"/r/same":    {Path: "/r/same", Hash: "01"},
+		"/r/edited":  {Path: "/r/edited", Hash: "02"},
+		"/r/old":     {Path: "/r/old", Hash: "03"},
+		"/r/deleted": {Path: "/r/deleted", Hash: "04"},
+	}
+	files := map[string]fswalk.FileRecord{
+		"/r/same":   {Sum: iphash.HashBytes{0x01}},
+		"/r/edited": {Sum: iphash.HashBytes{0x09}},
+		"/r/new":    {Sum: iphash.HashBytes{0x03}},
+		"/r/extra":  {Sum: iphash.HashBytes{0x05}},
+		"/r/copy":   {Sum: iphash.HashBytes{0x01}}, // Content of a path that is still there
+	}
+	got := Compare(known, files)
+	want := Result{
+		Matched: 1,
+		Changed: []string{"/r/edited"},
+		Moved:   []Move{{From: "/r/old", To: "/r/new"}},
+		New:     []string{"/r/copy", "/r/extra"},
+		Missing: []string{"/r/deleted"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Compare mismatch. Got: %+v, Want: %+v", got, want)
+	}
+	if got.OK() {
+		t.Errorf("OK() = true for a tree that differs from its manifest")
+	}
+}
+
+// TestReadChecksums checks md5sum text and binary mode lines, relative to the file's directory.
+func TestReadChecksums(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "MD5SUMS")
+	data := "0cc175b9c0f1b6a831c399e269772661  a\n# comment\n92EB5FFEE6AE2FEC3AD71C777531578F *sub/b c\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadChecksums(path, "md5")
+	if err != nil {
+		t.Fatalf("ReadChecksums returned an unexpected error: %v", err)
+	}
+	want := map[string]Entry{
+		filepath.Join(dir, "a"):          {Path: filepath.Join(dir, "a"), Size: -1, Hash: "0cc175b9c0f1b6a831c399e269772661"},
+		filepath.Join(dir, "sub", "b c"): {Path: filepath.Join(dir, "sub", "b c"), Size: -1, Hash: "92eb5ffee6ae2fec3ad71c777531578f"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadChecksums mismatch. Got: %v, Want: %v", got, want)
+	}
+	if _, err := ReadChecksums(path, "sha256"); err == nil {
+		t.Errorf("ReadChecksums accepted md5 digests as sha256")
+	}
+}
+
+// TestReadListing checks that CSV, JSON array and JSON Lines listings read back the
+// same records, with optional digests and relative paths resolved.
+func TestReadListing(t *testing.T) {
+	dir := t.TempDir()
+	listings := map[string]string{
+		"files.csv": "\ufeffsize,path,mtime,hash\n" +
+			"1,/r/a,2024-01-02T03:04:05Z,0cc175b9c0f1b6a831c399e269772661\n" +
+			"2,\"sub/b,c\",1704164645,\n",
+		"files.json": `[{"path": "/r/a", "size": 1, "mtime": "2024-01-02T03:04:05Z", "hash": "0cc175b9c0f1b6a831c399e269772661"},
+			{"path": "sub/b,c", "size": 2, "mtime": 1704164645}]`,
+		"files.jsonl": `{"path": "/r/a", "size": 1, "mtime": "2024-01-02T03:04:05Z", "hash": "0CC175B9C0F1B6A831C399E269772661"}` + "\n" +
+			`{"path": "sub/b,c", "size": 2, "mtime": 1704164645}` + "\n",
+	}
+	for name, data := range listings {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		recs, err := ReadListing(path, "md5")
+		if err != nil {
+			t.Fatalf("ReadListing(%s) returned an unexpected error: %v", name, err)
+		}
+		if len(recs) != 2 {
+			t.Fatalf("ReadListing(%s) mismatch. Got: %d records, Want: 2", name, len(recs))
+		}
+		a, b := recs[0], recs[1]
+		if a.Path != "/r/a" || a.Size != 1 || iphash.HashToString(a.Sum) != "0cc175b9c0f1b6a831c399e269772661" || a.ModTime.Unix() != 1704164645 {
+			t.Errorf("ReadListing(%s) first record mismatch. Got: %+v", name, a)
+		}
+		if b.Path != filepath.Join(dir, "sub", "b,c") || b.Size != 2 || b.Sum != nil || b.ModTime.Unix() != 1704164645 {
+			t.Errorf("ReadListing(%s) second record mismatch. Got: %+v", name, b)
+		}
+		if _, err := ReadListing(path, "sha256"); err == nil {
+			t.Errorf("ReadListing(%s) accepted md5 digests as sha256", name)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.csv")
+	if err := os.WriteFile(bad, []byte("path,size\n/r/a,1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadListing(bad, "md5"); err == nil {
+		t.Errorf("ReadListing accepted a listing without an mtime column")
+	}
+}
@@ -0,0 +1,106 @@
+// Package memwatch samples the heap and goroutine count of the process and reacts when
+// they pass thresholds, so a day-long run can protect itself before the kernel's OOM
+// killer ends it without a report.
+package memwatch
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Sample is the memory use of the process at one point in time.
+type Sample struct {
+	Heap       uint64 // Bytes of live and not yet collected heap objects
+	Sys        uint64 // Bytes obtained from the operating system
+	Goroutines int
+}
+
+// Read samples the running process. It briefly stops the world, so it should not be
+// called more than every few seconds.
+func Read() Sample {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return Sample{Heap: ms.HeapAlloc, Sys: ms.Sys, Goroutines: runtime.NumGoroutine()}
+}
+
+// Limits are the thresholds a Watchdog checks. A zero value disables its check.
+type Limits struct {
+	WarnHeap       uint64 // Heap bytes above which to warn
+	StopHeap       uint64 // Heap bytes above which to stop
+	WarnGoroutines int    // Goroutines above which to warn
+}
+
+// Watchdog checks samples against its Limits. A warning is given when a threshold is
+// first passed and again only after use dropped back below it; Stop is called at most
+// once. It is safe for concurrent use.
+type Watchdog struct {
+	Limits
+	Warn func(s Sample, msg string) // Called for every warning
+	Stop func(s Sample, msg string) // Called when StopHeap is passed
+
+	mu          sync.Mutex
+	last        Sample
+	heapHigh    bool
+	threadsHigh bool
+	stopped     bool
+}
+
+// Check compares s with the limits and calls Warn or Stop as needed.
+func (w *Watchdog) Check(s Sample) {
+	w.mu.Lock()
+	w.last = s
+	var warnings []string
+	stop := false
+	if w.WarnHeap > 0 {
+		high := s.Heap > w.WarnHeap
+		if high && !w.heapHigh {
+			warnings = append(warnings, fmt.Sprintf("heap in use is %d MiB, above the warning threshold of %d MiB", s.Heap>>20, w.WarnHeap>>20))
+		}
+		w.heapHigh = high
+	}
+	if w.WarnGoroutines > 0 {
+		high := s.Goroutines > w.WarnGoroutines
+		if high && !w.threadsHigh {
+			warnings = append(warnings, fmt.Sprintf("%d goroutines are running, above the warning threshold of %d", s.Goroutines, w.WarnGoroutines))
+		}
+		w.threadsHigh = high
+	}
+	if w.StopHeap > 0 && s.Heap > w.StopHeap && !w.stopped {
+		w.stopped, stop = true, true
+	}
+	w.mu.Unlock()
+
+	for _, msg := range warnings {
+		if w.Warn != nil {
+			w.Warn(s, msg)
+		}
+	}
+	if stop && w.Stop != nil {
+		w.Stop(s, fmt.Sprintf("heap in use is %d MiB, above the limit of %d MiB", s.Heap>>20, w.StopHeap>>20))
+	}
+}
+
+// Last returns the most recent sample checked.
+func (w *Watchdog) Last() Sample {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.last
+}
+
+// Run checks a sample of the process every interval until ctx is done.
+func (w *Watchdog) Run(ctx context.Context, interval time.Duration) {
+	w.Check(Read())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(Read())
+		}
+	}
+}
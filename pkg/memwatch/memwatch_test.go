@@ -0,0 +1,40 @@
+package memwatch
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestWatchdog checks that a warning is given once per crossing of a threshold, and
+// that passing the stop limit stops only once.
+func TestWatchdog(t *testing.T) {
+	var warnings, stops []string
+	w := &Watchdog{
+		Limits: Limits{WarnHeap: 100 << 20, StopHeap: 200 << 20, WarnGoroutines: 50},
+		Warn:   func(_ Sample, msg string) { warnings = append(warnings, msg) },
+		Stop:   func(_ Sample, msg string) { stops = append(stops, msg) },
+	}
+	for _, s := range []Sample{
+		{Heap: 50 << 20, Goroutines: 10},
+		{Heap: 150 << 20, Goroutines: 10}, // Heap warning
+		{Heap: 160 << 20, Goroutines: 60}, // Goroutine warning only
+		{Heap: 90 << 20, Goroutines: 60},  // Back below
+		{Heap: 250 << 20, Goroutines: 10}, // Heap warning again, and stop
+		{Heap: 300 << 20, Goroutines: 10}, // No second stop
+	} {
+		w.Check(s)
+	}
+
+	if len(warnings) != 3 {
+		t.Fatalf("Warning count mismatch. Got: %q, Want: 3 warnings", warnings)
+	}
+	if !strings.Contains(warnings[1], "60 goroutines") || !strings.Contains(warnings[2], "250 MiB") {
+		t.Errorf("Warnings mismatch. Got: %q", warnings)
+	}
+	if len(stops) != 1 || !strings.Contains(stops[0], "limit of 200 MiB") {
+		t.Errorf("Stops mismatch. Got: %q, Want: one stop at the 200 MiB limit", stops)
+	}
+	if w.Last().Heap != 300<<20 {
+		t.Errorf("Last sample mismatch. Got: %d, Want: %d", w.Last().Heap, 300<<20)
+	}
+}
@@ -0,0 +1,290 @@
+// Package ocilayout reads container images from an OCI image layout or a containerd
+// content store so the files of their layers can be compared.
+package ocilayout
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// maxManifestSize bounds the blobs parsed as JSON; layers are far larger.
+const maxManifestSize = 4 << 20
+
+// Annotations naming an image in index.json.
+var refAnnotations = []string{"org.opencontainers.image.ref.name", "io.containerd.image.name"}
+
+// Layer is one layer blob of the store.
+type Layer struct {
+	Digest string   `json:"digest"`
+	Size   int64    `json:"size"`   // Blob size, usually compressed
+	Images []string `json:"images"` // Images using the layer
+	Files  int      `json:"files"`  // Regular files in the layer
+	Error  string   `json:"error,omitempty"`
+}
+
+// File is a regular file inside a layer.
+type File struct {
+	Layer string // Digest of the layer
+	Path  string // Inside the image, without a leading slash
+	Size  int64
+	Sum   iphash.HashBytes
+}
+
+// Store is an image layout or content store with its image manifests resolved.
+type Store struct {
+	Dir    string
+	Images int      // Image manifests found
+	Layers []*Layer // Sorted by digest; each blob appears once however many images share it
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+	Platform    *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+	} `json:"platform"`
+}
+
+// manifest covers both image manifests (layers) and image indexes (manifests).
+type manifest struct {
+	Config    *descriptor  `json:"config"`
+	Layers    []descriptor `json:"layers"`
+	Manifests []descriptor `json:"manifests"`
+}
+
+// Open finds the image manifests below dir, which must contain blobs/sha256: an OCI
+// image layout, or the content store of containerd
+// (/var/lib/containerd/io.containerd.content.v1.content). Images are named after the
+// references of index.json where there is one, otherwise after their manifest digest.
+func Open(dir string) (*Store, error) {
+	s := &Store{Dir: dir}
+	entries, err := os.ReadDir(filepath.Join(dir, "blobs", "sha256"))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not an image layout or content store: %w", dir, err)
+	}
+	names := make(map[string]string)
+	if data, err := os.ReadFile(filepath.Join(dir, "index.json")); err == nil {
+		var ix manifest
+		if err := json.Unmarshal(data, &ix); err != nil {
+			return nil, fmt.Errorf("invalid index.json: %w", err)
+		}
+		s.nameImages(ix.Manifests, "", names, 0)
+	}
+
+	layers := make(map[string]*Layer)
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || info.Size() > maxManifestSize {
+			continue
+		}
+		m, ok := s.readManifest("sha256:" + e.Name())
+		if !ok || m.Config == nil || len(m.Layers) == 0 {
+			continue
+		}
+		s.Images++
+		digest := "sha256:" + e.Name()
+		name := names[digest]
+		if name == "" {
+			name = ShortDigest(digest)
+		}
+		for _, l := range m.Layers {
+			layer := layers[l.Digest]
+			if layer == nil {
+				layer = &Layer{Digest: l.Digest, Size: l.Size}
+				layers[l.Digest] = layer
+				s.Layers = append(s.Layers, layer)
+			}
+			layer.Images = append(layer.Images, name)
+		}
+	}
+	sort.Slice(s.Layers, func(i, j int) bool { return s.Layers[i].Digest < s.Layers[j].Digest })
+	for _, l := range s.Layers {
+		l.Images = uniqueSorted(l.Images)
+	}
+	return s, nil
+}
+
+// nameImages records the reference of every manifest reachable from descs. Manifests of
+// a multi-platform index inherit its name, qualified by their platform.
+func (s *Store) nameImages(descs []descriptor, parent string, names map[string]string, depth int) {
+	if depth > 8 {
+		return
+	}
+	for _, d := range descs {
+		name := parent
+		for _, key := range refAnnotations {
+			if ref := d.Annotations[key]; ref != "" {
+				name = ref
+				break
+			}
+		}
+		if name != "" && parent != "" && d.Platform != nil {
+			name += " (" + d.Platform.OS + "/" + d.Platform.Architecture + ")"
+		}
+		if name != "" {
+			names[d.Digest] = name
+		}
+		if m, ok := s.readManifest(d.Digest); ok && len(m.Manifests) > 0 {
+			s.nameImages(m.Manifests, name, names, depth+1)
+		}
+	}
+}
+
+// readManifest parses a small JSON blob; ok is false for anything else.
+func (s *Store) readManifest(digest string) (m manifest, ok bool) {
+	p, err := s.blobPath(digest)
+	if err != nil {
+		return m, false
+	}
+	data, err := os.ReadFile(p)
+	if err != nil || len(data) > maxManifestSize || !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return m, false
+	}
+	return m, json.Unmarshal(data, &m) == nil
+}
+
+// blobPath maps a digest to its file, rejecting anything that is not a sha256 digest.
+func (s *Store) blobPath(digest string) (string, error) {
+	hex := strings.TrimPrefix(digest, "sha256:")
+	if hex == digest || len(hex) != 64 || strings.ContainsAny(hex, `/\.`) {
+		return "", fmt.Errorf("unsupported digest %q", digest)
+	}
+	return filepath.Join(s.Dir, "blobs", "sha256", hex), nil
+}
+
+// ShortDigest abbreviates a digest for display.
+func ShortDigest(digest string) string {
+	if len(digest) > 19 {
+		return digest[:19]
+	}
+	return digest
+}
+
+// Files hashes every regular file of every layer with algo, using workers layers at a
+// time. A layer that cannot be read is skipped and keeps the reason in its Error.
+func (s *Store) Files(ctx context.Context, algo string, workers int) ([]File, error) {
+	if _, err := iphash.New(algo); err != nil {
+		return nil, err
+	}
+	var mu sync.Mutex
+	var files []File
+	var wg sync.WaitGroup
+	work := make(chan *Layer)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for l := range work {
+				found, err := s.layerFiles(ctx, l.Digest, algo)
+				mu.Lock()
+				if err != nil {
+					l.Error = err.Error()
+				} else {
+					l.Files = len(found)
+					files = append(files, found...)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, l := range s.Layers {
+		select {
+		case work <- l:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return files, ctx.Err()
+	}
+	return files, nil
+}
+
+// layerFiles reads one layer tar, gzip-compressed or not.
+func (s *Store) layerFiles(ctx context.Context, digest, algo string) ([]File, error) {
+	p, err := s.blobPath(digest)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errors.New("blob not present in the store")
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, errors.New("zstd-compressed layers are not supported")
+	}
+
+	var files []File
+	tr := tar.NewReader(r)
+	for {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("corrupt layer: %w", err)
+		}
+		name := strings.TrimPrefix(path.Clean("/"+hdr.Name), "/")
+		if hdr.Typeflag != tar.TypeReg || strings.HasPrefix(path.Base(name), ".wh.") {
+			continue // Directories, links and whiteouts carry no content
+		}
+		h, _ := iphash.New(algo)
+		n, err := io.Copy(h, tr)
+		if err != nil {
+			return nil, fmt.Errorf("corrupt layer at %s: %w", name, err)
+		}
+		files = append(files, File{Layer: digest, Path: name, Size: n, Sum: h.Sum(nil)})
+	}
+}
+
+// uniqueSorted sorts names and drops repeats, e.g. of an image listing a layer twice.
+func uniqueSorted(names []string) []string {
+	sort.Strings(names)
+	out := names[:0]
+	for i, n := range names {
+		if i == 0 || n != names[i-1] {
+			out = append(out, n)
+		}
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package ocilayout
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// writeBlob stores data in the layout and returns its digest.
+func writeBlob(t *testing.T, dir string, data []byte) string {
+	t.Helper()
+	sum := sha256.Sum256(data)
+	hexSum := hex.EncodeToString(sum[:])
+	if err := os.WriteFile(filepath.Join(dir, "blobs", "sha256", hexSum), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return "sha256:" + hexSum
+}
+
+// layerBlob builds a gzip-compressed layer tar of name/content pairs.
+func layerBlob(t *testing.T, entries ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(zw)
+	tw.WriteHeader(&tar.Header{Name: "./etc/", Typeflag: tar.TypeDir, Mode: 0o755})
+	for i := 0; i < len(entries); i += 2 {
+		content := entries[i+1]
+		tw.WriteHeader(&tar.Header{Name: entries[i], Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(content))})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	zw.Close()
+	return buf.Bytes()
+}
+
+// TestFiles checks that two images sharing a layer are resolved by name and every layer
+// is read once, skipping directories and whiteouts.
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "blobs", "sha256"), 0o755)
+	base := writeBlob(t, dir, layerBlob(t, "./etc/os-release", "base", "usr/lib/libc.so", "libc"))
+	app := writeBlob(t, dir, layerBlob(t, "app/libc.so", "libc", "etc/.wh.os-release", ""))
+	config := writeBlob(t, dir, []byte(`{"architecture":"amd64"}`))
+
+	var refs []map[string]interface{}
+	for _, img := range []struct {
+		name   string
+		layers []string
+	}{{"base:1", []string{base}}, {"app:1", []string{base, app}}} {
+		m := map[string]interface{}{
+			"schemaVersion": 2,
+			"config":        map[string]interface{}{"digest": config, "size": 1},
+		}
+		var layers []map[string]interface{}
+		for _, l := range img.layers {
+			layers = append(layers, map[string]interface{}{"digest": l, "size": 1})
+		}
+		m["layers"] = layers
+		data, _ := json.Marshal(m)
+		refs = append(refs, map[string]interface{}{
+			"digest":      writeBlob(t, dir, data),
+			"annotations": map[string]string{"org.opencontainers.image.ref.name": img.name},
+		})
+	}
+	index, _ := json.Marshal(map[string]interface{}{"schemaVersion": 2, "manifests": refs})
+	os.WriteFile(filepath.Join(dir, "index.json"), index, 0o644)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open returned an unexpected error: %v", err)
+	}
+	if s.Images != 2 || len(s.Layers) != 2 {
+		t.Fatalf("Store mismatch. Got: %d images, %d layers, Want: 2 images, 2 layers", s.Images, len(s.Layers))
+	}
+	images := make(map[string][]string)
+	for _, l := range s.Layers {
+		images[l.Digest] = l.Images
+	}
+	if want := []string{"app:1", "base:1"}; !reflect.DeepEqual(images[base], want) {
+		t.Errorf("Images of the base layer mismatch. Got: %v, Want: %v", images[base], want)
+	}
+
+	files, err := s.Files(context.Background(), "sha256", 2)
+	if err != nil {
+		t.Fatalf("Files returned an unexpected error: %v", err)
+	}
+	var paths []string
+	for _, f := range files {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+	if want := []string{"app/libc.so", "etc/os-release", "usr/lib/libc.so"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Files mismatch. Got: %v, Want: %v", paths, want)
+	}
+}
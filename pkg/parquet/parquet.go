@@ -0,0 +1,414 @@
+// Package parquet writes flat tables as Apache Parquet files, the columnar format read
+// by DuckDB, Spark, pandas and most other analysis tools. Only what a file index needs
+// is supported: required or optional string, int64 and timestamp columns, PLAIN
+// encoded in gzip-compressed data pages.
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// magic starts and ends every Parquet file.
+const magic = "PAR1"
+
+// DefaultRowGroupSize is the number of rows buffered and written per row group.
+const DefaultRowGroupSize = 1 << 17
+
+// Kind is the type of a column's values.
+type Kind int
+
+const (
+	String    Kind = iota // UTF-8 text, written from a string
+	Int64                 // Written from an int64
+	Timestamp             // Microseconds since the Unix epoch, written from a time.Time
+)
+
+// Column describes one column of the table.
+type Column struct {
+	Name     string
+	Kind     Kind
+	Optional bool // Values may be nil, read back as null
+}
+
+// Parquet physical and converted types, encodings and other enumerations, as numbered
+// in parquet.thrift.
+const (
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repRequired = 0
+	repOptional = 1
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecGzip    = 2
+	pageTypeData = 0
+)
+
+// chunk records where a column chunk was written, for the footer.
+type chunk struct {
+	offset       int64
+	values       int
+	uncompressed int
+	compressed   int
+}
+
+// rowGroup records a written row group, for the footer.
+type rowGroup struct {
+	rows   int
+	chunks []chunk
+}
+
+// Writer writes rows to a Parquet file. Rows are buffered and written a row group at a
+// time; Close writes the last row group and the footer.
+type Writer struct {
+	RowGroupSize int // Rows per row group; DefaultRowGroupSize when zero
+
+	w      io.Writer
+	pos    int64
+	cols   []Column
+	values []bytes.Buffer // Column -> PLAIN encoded non-null values
+	defs   [][]bool       // Optional column -> whether each row has a value
+	rows   int            // In the buffered row group
+	total  int64
+	groups []rowGroup
+	err    error
+}
+
+// NewWriter returns a Writer of a table with the given columns to w.
+func NewWriter(w io.Writer, cols []Column) *Writer {
+	return &Writer{
+		w:      w,
+		cols:   cols,
+		values: make([]bytes.Buffer, len(cols)),
+		defs:   make([][]bool, len(cols)),
+	}
+}
+
+// Write adds a row holding one value per column, in column order.
+func (w *Writer) Write(row []interface{}) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.cols) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(w.cols))
+	}
+	for i, c := range w.cols {
+		if err := w.add(i, c, row[i]); err != nil {
+			w.err = err // The columns no longer line up
+			return err
+		}
+	}
+	w.rows++
+	size := w.RowGroupSize
+	if size <= 0 {
+		size = DefaultRowGroupSize
+	}
+	if w.rows >= size {
+		return w.flush()
+	}
+	return nil
+}
+
+// add appends the value of column i to its buffer.
+func (w *Writer) add(i int, c Column, v interface{}) error {
+	if c.Optional {
+		w.defs[i] = append(w.defs[i], v != nil)
+	}
+	var num [8]byte
+	buf := &w.values[i]
+	switch v := v.(type) {
+	case nil:
+		if !c.Optional {
+			return fmt.Errorf("parquet: column %s is required", c.Name)
+		}
+		return nil
+	case string:
+		if c.Kind != String {
+			break
+		}
+		binary.LittleEndian.PutUint32(num[:4], uint32(len(v)))
+		buf.Write(num[:4])
+		buf.WriteString(v)
+		return nil
+	case int64:
+		if c.Kind != Int64 {
+			break
+		}
+		binary.LittleEndian.PutUint64(num[:], uint64(v))
+		buf.Write(num[:])
+		return nil
+	case time.Time:
+		if c.Kind != Timestamp {
+			break
+		}
+		binary.LittleEndian.PutUint64(num[:], uint64(v.Unix()*1e6+int64(v.Nanosecond()/1e3)))
+		buf.Write(num[:])
+		return nil
+	}
+	return fmt.Errorf("parquet: value of type %T for column %s", v, c.Name)
+}
+
+// Close writes the buffered rows and the footer. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.rows > 0 {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	if w.pos == 0 {
+		w.write([]byte(magic)) // A table without rows
+	}
+	footer := w.footer()
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(footer)))
+	w.write(footer)
+	w.write(n[:])
+	w.write([]byte(magic))
+	return w.err
+}
+
+// write writes p to the file, keeping the first error.
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.w.Write(p)
+	w.pos += int64(n)
+	w.err = err
+}
+
+// flush writes the buffered rows as a row group of one data page per column.
+func (w *Writer) flush() error {
+	if w.pos == 0 {
+		w.write([]byte(magic))
+	}
+	g := rowGroup{rows: w.rows}
+	for i, c := range w.cols {
+		var page bytes.Buffer
+		if c.Optional {
+			levels := definitionLevels(w.defs[i])
+			var n [4]byte
+			binary.LittleEndian.PutUint32(n[:], uint32(len(levels)))
+			page.Write(n[:])
+			page.Write(levels)
+		}
+		page.Write(w.values[i].Bytes())
+		var zipped bytes.Buffer
+		zw := gzip.NewWriter(&zipped)
+		zw.Write(page.Bytes())
+		if err := zw.Close(); err != nil {
+			w.err = err
+			return err
+		}
+		var header encoder
+		header.pageHeader(w.rows, page.Len(), zipped.Len())
+		g.chunks = append(g.chunks, chunk{
+			offset:       w.pos,
+			values:       w.rows,
+			uncompressed: header.buf.Len() + page.Len(),
+			compressed:   header.buf.Len() + zipped.Len(),
+		})
+		w.write(header.buf.Bytes())
+		w.write(zipped.Bytes())
+		w.values[i].Reset()
+		w.defs[i] = w.defs[i][:0]
+	}
+	w.groups = append(w.groups, g)
+	w.total += int64(w.rows)
+	w.rows = 0
+	return w.err
+}
+
+// definitionLevels encodes whether each value is present as a bit-packed run of the
+// RLE/bit-packing hybrid encoding with a bit width of one.
+func definitionLevels(present []bool) []byte {
+	groups := (len(present) + 7) / 8
+	out := make([]byte, binary.MaxVarintLen64+groups)
+	n := binary.PutUvarint(out, uint64(groups)<<1|1)
+	for i, ok := range present {
+		if ok {
+			out[n+i/8] |= 1 << (i % 8)
+		}
+	}
+	return out[:n+groups]
+}
+
+// footer returns the file metadata.
+func (w *Writer) footer() []byte {
+	var e encoder
+	e.i32(1, 1) // version
+	e.list(2, thriftStruct, len(w.cols)+1)
+	e.begin()
+	e.binary(4, "schema")
+	e.i32(5, int32(len(w.cols)))
+	e.end()
+	for _, c := range w.cols {
+		e.begin()
+		e.i32(1, physicalType(c.Kind))
+		rep := int32(repRequired)
+		if c.Optional {
+			rep = repOptional
+		}
+		e.i32(3, rep)
+		e.binary(4, c.Name)
+		switch c.Kind {
+		case String:
+			e.i32(6, convertedUTF8)
+		case Timestamp:
+			e.i32(6, convertedTimestampMicros)
+		}
+		e.end()
+	}
+	e.i64(3, w.total)
+	e.list(4, thriftStruct, len(w.groups))
+	for _, g := range w.groups {
+		e.begin()
+		e.list(1, thriftStruct, len(g.chunks))
+		size := 0
+		for i, ch := range g.chunks {
+			size += ch.uncompressed
+			e.begin()
+			e.i64(2, ch.offset) // file_offset
+			e.beginField(3)     // meta_data
+			e.i32(1, physicalType(w.cols[i].Kind))
+			e.list(2, thriftI32, 2)
+			e.varint(encodingPlain)
+			e.varint(encodingRLE)
+			e.list(3, thriftBinary, 1)
+			e.str(w.cols[i].Name)
+			e.i32(4, codecGzip)
+			e.i64(5, int64(ch.values))
+			e.i64(6, int64(ch.uncompressed))
+			e.i64(7, int64(ch.compressed))
+			e.i64(9, ch.offset) // data_page_offset
+			e.end()
+			e.end()
+		}
+		e.i64(2, int64(size))
+		e.i64(3, int64(g.rows))
+		e.end()
+	}
+	e.binary(6, "go-file-dedupe")
+	e.buf.WriteByte(0)
+	return e.buf.Bytes()
+}
+
+// physicalType returns the Parquet type a kind of column is stored as.
+func physicalType(k Kind) int32 {
+	if k == String {
+		return typeByteArray
+	}
+	return typeInt64
+}
+
+// Thrift compact protocol field and element types.
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// encoder writes Thrift structures in the compact protocol, in which Parquet encodes
+// its page headers and footer. Fields must be written in increasing id order.
+type encoder struct {
+	buf   bytes.Buffer
+	last  int16   // Id of the previous field of the current struct
+	stack []int16 // last of the enclosing structs
+}
+
+// pageHeader writes the header of a data page of n values.
+func (e *encoder) pageHeader(n, uncompressed, compressed int) {
+	e.i32(1, pageTypeData)
+	e.i32(2, int32(uncompressed))
+	e.i32(3, int32(compressed))
+	e.beginField(5) // data_page_header
+	e.i32(1, int32(n))
+	e.i32(2, encodingPlain)
+	e.i32(3, encodingRLE) // definition_level_encoding
+	e.i32(4, encodingRLE) // repetition_level_encoding
+	e.end()
+	e.buf.WriteByte(0)
+}
+
+func (e *encoder) field(id int16, typ byte) {
+	if delta := id - e.last; delta > 0 && delta <= 15 {
+		e.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		e.buf.WriteByte(typ)
+		e.varint(int64(id))
+	}
+	e.last = id
+}
+
+// varint writes a zigzag encoded integer.
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], uint64(v<<1^v>>63))])
+}
+
+// str writes a binary value without a field header, as in lists.
+func (e *encoder) str(s string) {
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], uint64(len(s)))])
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) i32(id int16, v int32) {
+	e.field(id, thriftI32)
+	e.varint(int64(v))
+}
+
+func (e *encoder) i64(id int16, v int64) {
+	e.field(id, thriftI64)
+	e.varint(v)
+}
+
+func (e *encoder) binary(id int16, s string) {
+	e.field(id, thriftBinary)
+	e.str(s)
+}
+
+// list writes the header of a list field of n elements.
+func (e *encoder) list(id int16, elem byte, n int) {
+	e.field(id, thriftList)
+	if n < 15 {
+		e.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	e.buf.WriteByte(0xf0 | elem)
+	var b [binary.MaxVarintLen64]byte
+	e.buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+// beginField starts a struct field; end finishes it.
+func (e *encoder) beginField(id int16) {
+	e.field(id, thriftStruct)
+	e.begin()
+}
+
+// begin starts a struct list element; end finishes it.
+func (e *encoder) begin() {
+	e.stack = append(e.stack, e.last)
+	e.last = 0
+}
+
+func (e *encoder) end() {
+	e.buf.WriteByte(0)
+	e.last = e.stack[len(e.stack)-1]
+	e.stack = e.stack[:len(e.stack)-1]
+}
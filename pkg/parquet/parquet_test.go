@@ -0,0 +1,194 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestWriter checks that the rows of a written file read back, across row groups and
+// with nulls, following the page offsets and sizes recorded in the footer.
+func TestWriter(t *testing.T) {
+	cols := []Column{
+		{Name: "path", Kind: String},
+		{Name: "size", Kind: Int64},
+		{Name: "mtime", Kind: Timestamp},
+		{Name: "group_id", Kind: String, Optional: true},
+	}
+	mtime := time.Date(2024, 1, 2, 3, 4, 5, 6000, time.UTC)
+	var want [][]interface{}
+	for i := 0; i < 20; i++ {
+		var group interface{}
+		if i%3 == 0 {
+			group = fmt.Sprintf("dg-%02x", i)
+		}
+		want = append(want, []interface{}{fmt.Sprintf("/r/%d", i), int64(i * 1000), mtime.Add(time.Duration(i) * time.Hour), group})
+	}
+	var buf bytes.Buffer
+	w := NewWriter(&buf, cols)
+	w.RowGroupSize = 8
+	for _, row := range want {
+		if err := w.Write(row); err != nil {
+			t.Fatalf("Write returned an unexpected error: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned an unexpected error: %v", err)
+	}
+
+	got, err := readTable(buf.Bytes(), cols)
+	if err != nil {
+		t.Fatalf("readTable returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Round trip mismatch. Got: %v, Want: %v", got, want)
+	}
+
+	if err := NewWriter(io.Discard, cols).Write([]interface{}{"/r/a", int64(1), mtime, 7}); err == nil {
+		t.Errorf("Write accepted an int for a string column")
+	}
+	if err := NewWriter(io.Discard, cols).Write([]interface{}{nil, int64(1), mtime, nil}); err == nil {
+		t.Errorf("Write accepted a null in a required column")
+	}
+}
+
+// readTable reads back a file written by Writer.
+func readTable(data []byte, cols []Column) ([][]interface{}, error) {
+	n := len(data)
+	if string(data[:4]) != magic || string(data[n-4:]) != magic {
+		return nil, fmt.Errorf("missing %s magic", magic)
+	}
+	size := int(binary.LittleEndian.Uint32(data[n-8:]))
+	meta, err := decode(bytes.NewReader(data[n-8-size : n-8]))
+	if err != nil {
+		return nil, err
+	}
+	schema := meta[2].([]interface{})
+	if len(schema) != len(cols)+1 {
+		return nil, fmt.Errorf("schema has %d elements for %d columns", len(schema), len(cols))
+	}
+	var rows [][]interface{}
+	for _, g := range meta[4].([]interface{}) {
+		group := g.(map[int16]interface{})
+		start := len(rows)
+		for i := int64(0); i < group[3].(int64); i++ {
+			rows = append(rows, make([]interface{}, len(cols)))
+		}
+		for i, c := range group[1].([]interface{}) {
+			md := c.(map[int16]interface{})[3].(map[int16]interface{})
+			r := bytes.NewReader(data[md[9].(int64):])
+			header, err := decode(r)
+			if err != nil {
+				return nil, err
+			}
+			zr, err := gzip.NewReader(io.LimitReader(r, header[3].(int64)))
+			if err != nil {
+				return nil, err
+			}
+			page, err := io.ReadAll(zr)
+			if err != nil {
+				return nil, err
+			}
+			present := make([]bool, len(rows)-start)
+			for j := range present {
+				present[j] = true
+			}
+			if cols[i].Optional {
+				levels := page[4 : 4+binary.LittleEndian.Uint32(page)]
+				page = page[4+len(levels):]
+				_, k := binary.Uvarint(levels)
+				for j := range present {
+					present[j] = levels[k+j/8]&(1<<(j%8)) != 0
+				}
+			}
+			for j, ok := range present {
+				if !ok {
+					continue
+				}
+				var v interface{}
+				switch cols[i].Kind {
+				case String:
+					l := binary.LittleEndian.Uint32(page)
+					v, page = string(page[4:4+l]), page[4+l:]
+				case Int64:
+					v, page = int64(binary.LittleEndian.Uint64(page)), page[8:]
+				case Timestamp:
+					us := int64(binary.LittleEndian.Uint64(page))
+					v, page = time.Unix(us/1e6, us%1e6*1e3).UTC(), page[8:]
+				}
+				rows[start+j][i] = v
+			}
+		}
+	}
+	return rows, nil
+}
+
+// decode reads a Thrift compact protocol struct into a map of field id to value:
+// int64 for integers, string for binary, []interface{} for lists and nested maps for
+// structs.
+func decode(r *bytes.Reader) (map[int16]interface{}, error) {
+	fields := make(map[int16]interface{})
+	var id int16
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == 0 {
+			return fields, nil
+		}
+		if delta := int16(b >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := binary.ReadVarint(r)
+			if err != nil {
+				return nil, err
+			}
+			id = int16(v)
+		}
+		if fields[id], err = decodeValue(r, b&0x0f); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func decodeValue(r *bytes.Reader, typ byte) (interface{}, error) {
+	switch typ {
+	case thriftI32, thriftI64:
+		return binary.ReadVarint(r)
+	case thriftBinary:
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, err
+		}
+		s := make([]byte, n)
+		_, err = io.ReadFull(r, s)
+		return string(s), err
+	case thriftStruct:
+		return decode(r)
+	case thriftList:
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		n := uint64(b >> 4)
+		if n == 15 {
+			if n, err = binary.ReadUvarint(r); err != nil {
+				return nil, err
+			}
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			if list[i], err = decodeValue(r, b&0x0f); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unexpected Thrift type %d", typ)
+}
@@ -0,0 +1,391 @@
+package policy
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// Filter is a compiled --filter expression deciding which duplicate groups are
+// reported and acted upon, e.g. `size > 100MB && count >= 3 && !path("/master/**")`.
+//
+// Attributes, compared with <, <=, >, >=, == and !=:
+//
+//	size    bytes of one copy; units B, KB, MB, GB, TB (powers of 1024, KiB etc. also accepted)
+//	wasted  bytes of the copies beyond the first, same units
+//	count   number of copies
+//	age     time since the newest copy was modified; units s, m, h, d, w
+//
+// Predicates, true when any copy matches:
+//
+//	path("glob")   glob over the absolute path with / separators; * and ? stop at /, ** does not
+//	owner("name")  user name or numeric uid
+//
+// Terms combine with !, && and || (in decreasing precedence) and parentheses.
+type Filter struct {
+	expr string
+	eval func(g *groupInfo) bool
+}
+
+// groupInfo is what a filter sees of a duplicate group.
+type groupInfo struct {
+	files []fswalk.FileRecord
+	now   time.Time
+}
+
+func (g *groupInfo) size() int64 {
+	if len(g.files) == 0 {
+		return 0
+	}
+	return g.files[0].Size
+}
+
+func (g *groupInfo) age() time.Duration {
+	var newest time.Time
+	for _, f := range g.files {
+		if f.ModTime.After(newest) {
+			newest = f.ModTime
+		}
+	}
+	return g.now.Sub(newest)
+}
+
+// String returns the source expression.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// Match reports whether the group of files satisfies the filter at time now.
+func (f *Filter) Match(files []fswalk.FileRecord, now time.Time) bool {
+	return f.eval(&groupInfo{files: files, now: now})
+}
+
+// ParseFilter compiles a filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	toks, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	eval, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %q at offset %d", t.text, t.pos)
+	}
+	return &Filter{expr: expr, eval: eval}, nil
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber // Digits, optionally followed by a unit
+	tokString
+	tokOp // Operators and parentheses
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+// lexFilter splits an expression into tokens.
+func lexFilter(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j], i})
+			i = j
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			for j < len(s) && unicode.IsLetter(rune(s[j])) {
+				j++
+			}
+			toks = append(toks, token{tokNumber, s[i:j], i})
+			i = j
+		case c == '"':
+			str, n, err := unquotePrefix(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d: %w", i, err)
+			}
+			toks = append(toks, token{tokString, str, i})
+			i += n
+		default:
+			op := ""
+			for _, cand := range []string{"&&", "||", ">=", "<=", "==", "!=", ">", "<", "!", "(", ")"} {
+				if strings.HasPrefix(s[i:], cand) {
+					op = cand
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected %q at offset %d", c, i)
+			}
+			toks = append(toks, token{tokOp, op, i})
+			i += len(op)
+		}
+	}
+	return append(toks, token{tokEOF, "end of expression", len(s)}), nil
+}
+
+// unquotePrefix reads the double-quoted string at the start of s and returns its
+// value and length in s.
+func unquotePrefix(s string) (string, int, error) {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			v, err := strconv.Unquote(s[:i+1])
+			return v, i + 1, err
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type filterParser struct {
+	toks []token
+	pos  int
+}
+
+func (p *filterParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *filterParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the operator op if it comes next.
+func (p *filterParser) accept(op string) bool {
+	if t := p.peek(); t.kind == tokOp && t.text == op {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *filterParser) expect(op string) error {
+	if !p.accept(op) {
+		t := p.peek()
+		return fmt.Errorf("expected %q at offset %d, found %q", op, t.pos, t.text)
+	}
+	return nil
+}
+
+func (p *filterParser) or() (func(*groupInfo) bool, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(g *groupInfo) bool { return l(g) || right(g) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (func(*groupInfo) bool, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(g *groupInfo) bool { return l(g) && right(g) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) unary() (func(*groupInfo) bool, error) {
+	if p.accept("!") {
+		inner, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(g *groupInfo) bool { return !inner(g) }, nil
+	}
+	if p.accept("(") {
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+	t := p.next()
+	if t.kind != tokIdent {
+		return nil, fmt.Errorf("expected an attribute or predicate at offset %d, found %q", t.pos, t.text)
+	}
+	switch t.text {
+	case "path", "owner":
+		return p.predicate(t)
+	case "size", "wasted", "count", "age":
+		return p.comparison(t)
+	}
+	return nil, fmt.Errorf("unknown attribute %q at offset %d (use size, wasted, count, age, path() or owner())", t.text, t.pos)
+}
+
+// predicate parses the argument of path() or owner().
+func (p *filterParser) predicate(name token) (func(*groupInfo) bool, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arg := p.next()
+	if arg.kind != tokString {
+		return nil, fmt.Errorf("%s() needs a quoted string at offset %d", name.text, arg.pos)
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if name.text == "owner" {
+		uid, err := lookupUID(arg.text)
+		if err != nil {
+			return nil, err
+		}
+		return func(g *groupInfo) bool {
+			for _, f := range g.files {
+				if f.Uid == uid {
+					return true
+				}
+			}
+			return false
+		}, nil
+	}
+	re := globRegexp(filepath.ToSlash(fswalk.NormalizePath(arg.text)))
+	return func(g *groupInfo) bool {
+		for _, f := range g.files {
+			if re.MatchString(filepath.ToSlash(fswalk.NormalizePath(f.Path))) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// comparison parses the operator and value following a numeric attribute.
+func (p *filterParser) comparison(attr token) (func(*groupInfo) bool, error) {
+	op := p.next()
+	cmp, ok := map[string]func(a, b int64) bool{
+		"<":  func(a, b int64) bool { return a < b },
+		"<=": func(a, b int64) bool { return a <= b },
+		">":  func(a, b int64) bool { return a > b },
+		">=": func(a, b int64) bool { return a >= b },
+		"==": func(a, b int64) bool { return a == b },
+		"!=": func(a, b int64) bool { return a != b },
+	}[op.text]
+	if op.kind != tokOp || !ok {
+		return nil, fmt.Errorf("expected a comparison after %s at offset %d, found %q", attr.text, op.pos, op.text)
+	}
+	val := p.next()
+	if val.kind != tokNumber {
+		return nil, fmt.Errorf("expected a number after %s %s at offset %d, found %q", attr.text, op.text, val.pos, val.text)
+	}
+
+	var get func(g *groupInfo) int64
+	var units map[string]float64
+	switch attr.text {
+	case "size":
+		get, units = (*groupInfo).size, sizeUnits
+	case "wasted":
+		get, units = func(g *groupInfo) int64 { return g.size() * int64(len(g.files)-1) }, sizeUnits
+	case "count":
+		get, units = func(g *groupInfo) int64 { return int64(len(g.files)) }, map[string]float64{"": 1}
+	case "age":
+		get, units = func(g *groupInfo) int64 { return int64(g.age()) }, ageUnits
+	}
+	want, err := parseQuantity(val.text, units)
+	if err != nil {
+		return nil, fmt.Errorf("%s at offset %d: %w", attr.text, val.pos, err)
+	}
+	return func(g *groupInfo) bool { return cmp(get(g), want) }, nil
+}
+
+var sizeUnits = map[string]float64{
+	"": 1, "b": 1,
+	"k": 1 << 10, "kb": 1 << 10, "kib": 1 << 10,
+	"m": 1 << 20, "mb": 1 << 20, "mib": 1 << 20,
+	"g": 1 << 30, "gb": 1 << 30, "gib": 1 << 30,
+	"t": 1 << 40, "tb": 1 << 40, "tib": 1 << 40,
+}
+
+var ageUnits = map[string]float64{
+	"s": float64(time.Second),
+	"m": float64(time.Minute),
+	"h": float64(time.Hour),
+	"d": float64(24 * time.Hour),
+	"w": float64(7 * 24 * time.Hour),
+}
+
+// parseQuantity reads a number with an optional unit suffix from units.
+func parseQuantity(s string, units map[string]float64) (int64, error) {
+	i := strings.IndexFunc(s, unicode.IsLetter)
+	if i < 0 {
+		i = len(s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	mult, ok := units[strings.ToLower(s[i:])]
+	if !ok {
+		if s[i:] == "" {
+			return 0, fmt.Errorf("%q needs a unit", s)
+		}
+		return 0, fmt.Errorf("unknown unit %q", s[i:])
+	}
+	return int64(n * mult), nil
+}
+
+// globRegexp translates a path glob into an anchored regular expression.
+func globRegexp(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
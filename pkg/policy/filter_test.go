@@ -0,0 +1,43 @@
+package policy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// TestFilter checks attribute comparisons, units, predicates and operator precedence.
+func TestFilter(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	group := []fswalk.FileRecord{
+		{Path: "/master/photos/a.jpg", Size: 200 << 20, ModTime: now.Add(-40 * 24 * time.Hour), Uid: 1000},
+		{Path: "/backup/a.jpg", Size: 200 << 20, ModTime: now.Add(-10 * 24 * time.Hour), Uid: 0},
+		{Path: "/tmp/a.jpg", Size: 200 << 20, ModTime: now.Add(-20 * 24 * time.Hour), Uid: 0},
+	}
+	for expr, want := range map[string]bool{
+		`size > 100MB && count >= 3`:                        true,
+		`size > 100MB && count >= 3 && !path("/master/**")`: false,
+		`path("/master/*")`:                                 false,
+		`path("/master/*/*.jpg")`:                           true,
+		`wasted == 400MiB`:                                  true,
+		`age > 2w`:                                          false,
+		`age >= 10d && owner("1000")`:                       true,
+		`count > 5 || size < 1G && !owner("0")`:             false,
+		`(count > 5 || size < 1G) && owner("0")`:            true,
+	} {
+		f, err := ParseFilter(expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) returned an unexpected error: %v", expr, err)
+			continue
+		}
+		if got := f.Match(group, now); got != want {
+			t.Errorf("Filter %q mismatch. Got: %v, Want: %v", expr, got, want)
+		}
+	}
+	for _, expr := range []string{`size >`, `age > 3`, `size > 3XB`, `colour == 1`, `path(/x)`, `(count > 1`, `count > 1 count`} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("ParseFilter accepted %q", expr)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// Package policy decides which members of a duplicate group are kept and which are removed.
+package policy
+
+import (
+	"fmt"
+	"os/user"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// Action is what happens to one member of a duplicate group.
+type Action int
+
+const (
+	ActionNone    Action = iota // No rule matched
+	ActionKeep                  // Leave the file as the (or an) original
+	ActionRemove                // Delete the duplicate
+	ActionLink                  // Replace the duplicate with a hard link to the original
+	ActionSkip                  // Leave the file untouched and out of the plan
+	ActionReflink               // Replace the duplicate with a copy-on-write clone of the original
+)
+
+func (a Action) String() string {
+	switch a {
+	case ActionKeep:
+		return "keep"
+	case ActionRemove:
+		return "remove"
+	case ActionLink:
+		return "link"
+	case ActionSkip:
+		return "skip"
+	case ActionReflink:
+		return "reflink"
+	}
+	return "none"
+}
+
+// ParseAction converts a config/flag value into an Action.
+func ParseAction(s string) (Action, error) {
+	switch s {
+	case "keep":
+		return ActionKeep, nil
+	case "remove":
+		return ActionRemove, nil
+	case "link":
+		return ActionLink, nil
+	case "skip":
+		return ActionSkip, nil
+	case "reflink":
+		return ActionReflink, nil
+	}
+	return ActionNone, fmt.Errorf("unknown action %q (use keep, remove, link, reflink or skip)", s)
+}
+
+// Spec is the declarative form of a rule as written in the config file.
+// Every condition that is set must hold for the rule to match.
+type Spec struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`         // Regex matched against the full path in NFC form
+	MinSize    int64  `json:"min_size"`     // Bytes
+	MaxSize    int64  `json:"max_size"`     // Bytes, 0 for no limit
+	MinAgeDays int    `json:"min_age_days"` // Days since last modification
+	MaxAgeDays int    `json:"max_age_days"` // 0 for no limit
+	Owner      string `json:"owner"`        // User name or numeric uid
+	Action     string `json:"action"`       // keep, remove, link, reflink or skip
+}
+
+// Rule is a compiled Spec.
+type Rule struct {
+	Name    string
+	Path    *regexp.Regexp
+	MinSize int64
+	MaxSize int64
+	MinAge  time.Duration
+	MaxAge  time.Duration
+	Owner   *uint32
+	Action  Action
+}
+
+// Rules is an ordered rule list. The first matching rule decides a file's action.
+//
+// Resolution, evaluated per duplicate group:
+//  1. Files whose first matching rule is keep are always kept.
+//  2. Files matching remove, link or skip get that action.
+//  3. If nothing was kept, SelectOriginal picks the original among the unmatched files, or
+//     without it the first unmatched path (in sorted order) becomes the original; failing
+//     that the first path marked for remove or link is kept anyway, so that at least one
+//     copy of the content always survives.
+//  4. Remaining unmatched files get the Default action.
+type Rules struct {
+	Rules   []Rule
+	Default Action
+	Now     time.Time // Reference time for age conditions
+
+	// SelectOriginal, when set, chooses the original among the files no rule matched,
+	// e.g. SelectOldest or an embedder's own logic. It must be safe for concurrent use.
+	SelectOriginal SelectFunc
+}
+
+// Entry is the action selected for one member of a group.
+type Entry struct {
+	Path   string
+	Action Action
+	Rule   string // Name of the rule that selected the action, empty for the default
+}
+
+// Decision is the outcome of applying Rules to one duplicate group.
+type Decision struct {
+	Original string // The kept copy that linked duplicates point at
+	Entries  []Entry
+}
+
+// Paths returns the paths of the entries with the given action.
+func (d Decision) Paths(a Action) []string {
+	var paths []string
+	for _, e := range d.Entries {
+		if e.Action == a {
+			paths = append(paths, e.Path)
+		}
+	}
+	return paths
+}
+
+// Compile builds Rules from the raw --keep-matching and --remove-matching expressions.
+// Keep patterns are placed before remove patterns so they win when both match.
+func Compile(keep, remove []string) (*Rules, error) {
+	r := &Rules{Default: ActionRemove, Now: time.Now()}
+	for _, expr := range keep {
+		if err := r.Add(Spec{Name: "keep-matching " + expr, Path: expr, Action: "keep"}); err != nil {
+			return nil, err
+		}
+	}
+	for _, expr := range remove {
+		if err := r.Add(Spec{Name: "remove-matching " + expr, Path: expr, Action: "remove"}); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Add compiles a Spec and appends it to the rule list.
+func (r *Rules) Add(s Spec) error {
+	name := s.Name
+	if name == "" {
+		name = fmt.Sprintf("rule %d", len(r.Rules)+1)
+	}
+	action, err := ParseAction(s.Action)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	rule := Rule{
+		Name:    name,
+		MinSize: s.MinSize,
+		MaxSize: s.MaxSize,
+		MinAge:  time.Duration(s.MinAgeDays) * 24 * time.Hour,
+		MaxAge:  time.Duration(s.MaxAgeDays) * 24 * time.Hour,
+		Action:  action,
+	}
+	if s.Path != "" {
+		re, err := regexp.Compile(s.Path)
+		if err != nil {
+			return fmt.Errorf("%s: invalid path pattern %q: %w", name, s.Path, err)
+		}
+		rule.Path = re
+	}
+	if s.Owner != "" {
+		uid, err := lookupUID(s.Owner)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		rule.Owner = &uid
+	}
+	r.Rules = append(r.Rules, rule)
+	return nil
+}
+
+// lookupUID resolves a user name or numeric uid.
+func lookupUID(owner string) (uint32, error) {
+	if n, err := strconv.ParseUint(owner, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return 0, fmt.Errorf("unknown owner %q: %w", owner, err)
+	}
+	n, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("owner %q has non-numeric uid %q", owner, u.Uid)
+	}
+	return uint32(n), nil
+}
+
+// matches reports whether every condition of the rule holds for the file.
+func (rule *Rule) matches(f fswalk.FileRecord, now time.Time) bool {
+	if rule.Path != nil && !rule.Path.MatchString(fswalk.NormalizePath(f.Path)) {
+		return false
+	}
+	if f.Size < rule.MinSize || (rule.MaxSize > 0 && f.Size > rule.MaxSize) {
+		return false
+	}
+	age := now.Sub(f.ModTime)
+	if age < rule.MinAge || (rule.MaxAge > 0 && age > rule.MaxAge) {
+		return false
+	}
+	if rule.Owner != nil && *rule.Owner != f.Uid {
+		return false
+	}
+	return true
+}
+
+// match returns the first rule matching the file, or nil.
+func (r *Rules) match(f fswalk.FileRecord) *Rule {
+	for i := range r.Rules {
+		if r.Rules[i].matches(f, r.Now) {
+			return &r.Rules[i]
+		}
+	}
+	return nil
+}
+
+// Apply decides the action for every member of a duplicate group.
+func (r *Rules) Apply(files []fswalk.FileRecord) Decision {
+	sorted := append([]fswalk.FileRecord(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+
+	entries := make([]Entry, len(sorted))
+	for i, f := range sorted {
+		entries[i] = Entry{Path: f.Path}
+		if rule := r.match(f); rule != nil {
+			entries[i].Action = rule.Action
+			entries[i].Rule = rule.Name
+		}
+	}
+
+	var d Decision
+	for _, e := range entries {
+		if e.Action == ActionKeep {
+			d.Original = e.Path
+			break
+		}
+	}
+	if d.Original == "" && r.SelectOriginal != nil {
+		d.Original = r.selectOriginal(sorted, entries)
+	}
+	if d.Original == "" {
+		d.Original = promote(entries, ActionNone)
+	}
+	if d.Original == "" {
+		d.Original = promote(entries, ActionRemove, ActionLink, ActionReflink)
+	}
+	for i := range entries {
+		if entries[i].Action == ActionNone {
+			entries[i].Action = r.Default
+		}
+	}
+	d.Entries = entries
+	return d
+}
+
+// selectOriginal keeps the unmatched file chosen by SelectOriginal and returns its path,
+// or "" when there is none or the choice is left to the default.
+func (r *Rules) selectOriginal(files []fswalk.FileRecord, entries []Entry) string {
+	var candidates []fswalk.FileRecord
+	var index []int // Entry index of each candidate
+	for i, e := range entries {
+		if e.Action == ActionNone {
+			candidates = append(candidates, files[i])
+			index = append(index, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	i := r.SelectOriginal(candidates)
+	if i < 0 || i >= len(candidates) {
+		return ""
+	}
+	e := &entries[index[i]]
+	e.Action = ActionKeep
+	return e.Path
+}
+
+// promote marks the first entry with one of the given actions as kept and returns its path.
+func promote(entries []Entry, from ...Action) string {
+	for i := range entries {
+		for _, a := range from {
+			if entries[i].Action == a {
+				entries[i].Action = ActionKeep
+				if a != ActionNone {
+					entries[i].Rule += " (overridden: last copy)"
+				}
+				return entries[i].Path
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,132 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// records builds minimal FileRecords for the given paths.
+func records(paths ...string) []fswalk.FileRecord {
+	var recs []fswalk.FileRecord
+	for _, p := range paths {
+		recs = append(recs, fswalk.FileRecord{Path: p})
+	}
+	return recs
+}
+
+// TestApplyDefault checks that without rules the first sorted path is kept.
+func TestApplyDefault(t *testing.T) {
+	r, err := Compile(nil, nil)
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	d := r.Apply(records("/b/file", "/a/file", "/c/file"))
+	if want := []string{"/a/file"}; !reflect.DeepEqual(d.Paths(ActionKeep), want) {
+		t.Errorf("Keep mismatch. Got: %v, Want: %v", d.Paths(ActionKeep), want)
+	}
+	if want := []string{"/b/file", "/c/file"}; !reflect.DeepEqual(d.Paths(ActionRemove), want) {
+		t.Errorf("Remove mismatch. Got: %v, Want: %v", d.Paths(ActionRemove), want)
+	}
+}
+
+// TestApplyPrecedence checks that keep patterns win over remove patterns.
+func TestApplyPrecedence(t *testing.T) {
+	r, err := Compile([]string{"^/master/"}, []string{"^/tmp/", "^/master/"})
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	d := r.Apply(records("/tmp/x", "/master/x", "/home/x"))
+	if want := []string{"/master/x"}; !reflect.DeepEqual(d.Paths(ActionKeep), want) {
+		t.Errorf("Keep mismatch. Got: %v, Want: %v", d.Paths(ActionKeep), want)
+	}
+	if want := []string{"/home/x", "/tmp/x"}; !reflect.DeepEqual(d.Paths(ActionRemove), want) {
+		t.Errorf("Remove mismatch. Got: %v, Want: %v", d.Paths(ActionRemove), want)
+	}
+}
+
+// TestApplyNeverRemovesAll checks that one copy survives when every path matches a remove pattern.
+func TestApplyNeverRemovesAll(t *testing.T) {
+	r, err := Compile(nil, []string{"^/tmp/"})
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	d := r.Apply(records("/tmp/b", "/tmp/a"))
+	if d.Original != "/tmp/a" {
+		t.Errorf("Expected /tmp/a to be kept, got %q", d.Original)
+	}
+	if got := d.Paths(ActionRemove); len(got) != 1 {
+		t.Errorf("Expected one removal, got %v", got)
+	}
+}
+
+// TestApplySpecConditions checks size, age and owner conditions from a config rule.
+func TestApplySpecConditions(t *testing.T) {
+	now := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	r := &Rules{Default: ActionRemove, Now: now}
+	specs := []Spec{
+		{Name: "old-large", MinSize: 100, MinAgeDays: 10, Owner: "1000", Action: "link"},
+		{Name: "rest", Action: "skip"},
+	}
+	for _, s := range specs {
+		if err := r.Add(s); err != nil {
+			t.Fatalf("Add returned an unexpected error: %v", err)
+		}
+	}
+	files := []fswalk.FileRecord{
+		{Path: "/a", Size: 200, ModTime: now.AddDate(0, 0, -30), Uid: 1000},
+		{Path: "/b", Size: 200, ModTime: now.AddDate(0, 0, -30), Uid: 1000},
+		{Path: "/c", Size: 200, ModTime: now.AddDate(0, 0, -1), Uid: 1000},
+	}
+	d := r.Apply(files)
+	want := []Entry{
+		{Path: "/a", Action: ActionKeep, Rule: "old-large (overridden: last copy)"},
+		{Path: "/b", Action: ActionLink, Rule: "old-large"},
+		{Path: "/c", Action: ActionSkip, Rule: "rest"},
+	}
+	if !reflect.DeepEqual(d.Entries, want) {
+		t.Errorf("Entries mismatch. Got: %+v, Want: %+v", d.Entries, want)
+	}
+}
+
+// TestCompileInvalid checks that a bad expression is reported.
+func TestCompileInvalid(t *testing.T) {
+	if _, err := Compile([]string{"("}, nil); err == nil {
+		t.Fatal("Expected an error for an invalid pattern, but got nil")
+	}
+}
+
+// TestApplySelectOriginal checks that SelectOriginal picks among the files no rule matched
+// and that keep rules still win.
+func TestApplySelectOriginal(t *testing.T) {
+	now := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)
+	r, err := Compile(nil, []string{"^/tmp/"})
+	if err != nil {
+		t.Fatalf("Compile returned an unexpected error: %v", err)
+	}
+	r.SelectOriginal = SelectOldest
+	files := []fswalk.FileRecord{
+		{Path: "/lib/x", ModTime: now},
+		{Path: "/mirror/x", ModTime: now.AddDate(0, 0, -1)},
+		{Path: "/old/x", ModTime: now.AddDate(0, 0, -2)},
+		{Path: "/tmp/c", ModTime: now.AddDate(0, 0, -9)},
+	}
+	if d := r.Apply(files); d.Original != "/old/x" {
+		t.Errorf("Original mismatch. Got: %s, Want: /old/x", d.Original)
+	}
+
+	r.SelectOriginal = SelectUnder("/none", "/mirror/")
+	if d := r.Apply(files); d.Original != "/mirror/x" {
+		t.Errorf("Original mismatch. Got: %s, Want: /mirror/x", d.Original)
+	}
+
+	if err := r.Add(Spec{Name: "pin", Path: "^/tmp/", Action: "keep"}); err != nil {
+		t.Fatalf("Add returned an unexpected error: %v", err)
+	}
+	r.Rules = r.Rules[1:] // Only the keep rule
+	if d := r.Apply(files); d.Original != "/tmp/c" {
+		t.Errorf("Original mismatch. Got: %s, Want: /tmp/c", d.Original)
+	}
+}
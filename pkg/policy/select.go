@@ -0,0 +1,87 @@
+package policy
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+)
+
+// SelectFunc chooses the original of a duplicate group. It is given the candidates,
+// the members no rule matched, in path order, and returns the index of the one to
+// keep, or -1 to fall back to the first of them.
+type SelectFunc func(candidates []fswalk.FileRecord) int
+
+// SelectOldest keeps the least recently modified copy.
+func SelectOldest(files []fswalk.FileRecord) int {
+	return selectBest(files, func(a, b fswalk.FileRecord) bool { return a.ModTime.Before(b.ModTime) })
+}
+
+// SelectNewest keeps the most recently modified copy.
+func SelectNewest(files []fswalk.FileRecord) int {
+	return selectBest(files, func(a, b fswalk.FileRecord) bool { return a.ModTime.After(b.ModTime) })
+}
+
+// SelectShortestPath keeps the copy with the shortest path, e.g. the one closest to
+// the root rather than a copy buried in a backup folder.
+func SelectShortestPath(files []fswalk.FileRecord) int {
+	return selectBest(files, func(a, b fswalk.FileRecord) bool { return len(a.Path) < len(b.Path) })
+}
+
+// SelectMostLinks keeps the copy with the most hard links, so linking the others to
+// it frees the most space and disturbs the fewest existing links.
+func SelectMostLinks(files []fswalk.FileRecord) int {
+	return selectBest(files, func(a, b fswalk.FileRecord) bool { return a.Nlink > b.Nlink })
+}
+
+// SelectUnder returns a SelectFunc keeping the first copy below the first of dirs
+// that holds one, e.g. a primary library before its mirrors.
+func SelectUnder(dirs ...string) SelectFunc {
+	return func(files []fswalk.FileRecord) int {
+		for _, dir := range dirs {
+			prefix := strings.TrimSuffix(fswalk.NormalizePath(dir), "/") + "/"
+			for i, f := range files {
+				if strings.HasPrefix(fswalk.NormalizePath(f.Path), prefix) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+}
+
+// selectBest returns the index of the first file no other file is better than.
+func selectBest(files []fswalk.FileRecord, better func(a, b fswalk.FileRecord) bool) int {
+	best := -1
+	for i, f := range files {
+		if best < 0 || better(f, files[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+// selectors are the built-in SelectFuncs by name.
+var selectors = map[string]SelectFunc{
+	"first":    nil,
+	"oldest":   SelectOldest,
+	"newest":   SelectNewest,
+	"shortest": SelectShortestPath,
+	"links":    SelectMostLinks,
+}
+
+// ParseSelect returns the built-in SelectFunc of the given name; "first" is nil, the
+// default resolution.
+func ParseSelect(name string) (SelectFunc, error) {
+	sel, ok := selectors[name]
+	if !ok {
+		names := make([]string, 0, len(selectors))
+		for n := range selectors {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown original selection %q (use %s)", name, strings.Join(names, ", "))
+	}
+	return sel, nil
+}
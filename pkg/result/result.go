@@ -0,0 +1,181 @@
+// Package result scans a tree and presents its duplicate groups, with the accounting
+// and serialization every consumer would otherwise reimplement on the raw file map.
+package result
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// Result is the outcome of a scan: every hashed file and the duplicate groups among them.
+type Result struct {
+	files  map[string]fswalk.FileRecord
+	groups []Group
+	errs   []error
+}
+
+// Group is a set of files with identical content.
+type Group struct {
+	Hash  string              // Hex content hash
+	Size  int64               // Size of each copy in bytes
+	Files []fswalk.FileRecord // In path order
+}
+
+// Reclaimable is the number of bytes freed by keeping one copy. Hard links of one
+// file share their data, so each inode is counted once.
+func (g Group) Reclaimable() int64 {
+	inodes := make(map[fswalk.Inode]bool)
+	n := 0
+	for _, f := range g.Files {
+		if f.Ino == 0 {
+			n++
+			continue
+		}
+		if !inodes[f.Inode()] {
+			inodes[f.Inode()] = true
+			n++
+		}
+	}
+	return g.Size * int64(n-1)
+}
+
+// Paths returns the paths of the copies in path order.
+func (g Group) Paths() []string {
+	paths := make([]string, len(g.Files))
+	for i, f := range g.Files {
+		paths[i] = f.Path
+	}
+	return paths
+}
+
+// Scan hashes every regular file below root and groups the duplicates. Read errors
+// do not stop the scan; they are available from Errors. The returned error is that of
+// DigestAll, e.g. the context's error after cancellation.
+func Scan(ctx context.Context, root string, hash fswalk.HashFunc, workers int, opts fswalk.Options) (*Result, error) {
+	var mu sync.Mutex
+	var errs []error
+	onError := opts.OnError
+	opts.OnError = func(path string, err error) {
+		mu.Lock()
+		errs = append(errs, fmt.Errorf("%s: %w", path, err))
+		mu.Unlock()
+		if onError != nil {
+			onError(path, err)
+		}
+	}
+	var stats fswalk.Stats
+	var found, hashed atomic.Uint64
+	files, _, err := fswalk.DigestAll(ctx, root, hash, workers, opts, &stats, &found, &hashed)
+	if err != nil {
+		return nil, err
+	}
+	r := New(files)
+	r.errs = errs
+	return r, nil
+}
+
+// New groups already hashed files, e.g. from fswalk.DigestAll or a manifest.
+func New(files map[string]fswalk.FileRecord) *Result {
+	byHash := make(map[string][]fswalk.FileRecord)
+	for _, rec := range files {
+		h := iphash.HashToString(rec.Sum)
+		byHash[h] = append(byHash[h], rec)
+	}
+	r := &Result{files: files}
+	for h, recs := range byHash {
+		if len(recs) < 2 {
+			continue
+		}
+		sort.Slice(recs, func(i, j int) bool { return recs[i].Path < recs[j].Path })
+		r.groups = append(r.groups, Group{Hash: h, Size: recs[0].Size, Files: recs})
+	}
+	sort.Slice(r.groups, func(i, j int) bool {
+		a, b := r.groups[i], r.groups[j]
+		if wa, wb := a.Reclaimable(), b.Reclaimable(); wa != wb {
+			return wa > wb
+		}
+		return a.Hash < b.Hash
+	})
+	return r
+}
+
+// Files returns every hashed file by path.
+func (r *Result) Files() map[string]fswalk.FileRecord {
+	return r.files
+}
+
+// Groups returns the duplicate groups, most reclaimable bytes first, then by hash.
+func (r *Result) Groups() []Group {
+	return r.groups
+}
+
+// TotalReclaimable is the number of bytes freed by keeping one copy of every group.
+func (r *Result) TotalReclaimable() int64 {
+	var total int64
+	for _, g := range r.groups {
+		total += g.Reclaimable()
+	}
+	return total
+}
+
+// Errors returns the read errors met by Scan, in the order they occurred.
+func (r *Result) Errors() []error {
+	return r.errs
+}
+
+// jsonResult is the JSON form of a Result.
+type jsonResult struct {
+	Files       int         `json:"files"`
+	Reclaimable int64       `json:"reclaimable_bytes"`
+	Groups      []jsonGroup `json:"groups"`
+	Errors      []string    `json:"errors"`
+}
+
+type jsonGroup struct {
+	Hash        string   `json:"hash"`
+	Size        int64    `json:"size"`
+	Reclaimable int64    `json:"reclaimable_bytes"`
+	Files       []string `json:"files"`
+}
+
+// WriteJSON writes the groups, totals and errors as one indented JSON object.
+func (r *Result) WriteJSON(w io.Writer) error {
+	out := jsonResult{Files: len(r.files), Reclaimable: r.TotalReclaimable(), Groups: []jsonGroup{}, Errors: []string{}}
+	for _, g := range r.groups {
+		out.Groups = append(out.Groups, jsonGroup{Hash: g.Hash, Size: g.Size, Reclaimable: g.Reclaimable(), Files: g.Paths()})
+	}
+	for _, err := range r.errs {
+		out.Errors = append(out.Errors, err.Error())
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// WriteCSV writes one row per copy: group number, hash, size and path, with a header.
+func (r *Result) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"group", "hash", "size", "path"}); err != nil {
+		return err
+	}
+	for i, g := range r.groups {
+		for _, f := range g.Files {
+			row := []string{strconv.Itoa(i + 1), g.Hash, strconv.FormatInt(g.Size, 10), f.Path}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
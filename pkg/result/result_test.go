@@ -0,0 +1,56 @@
+package result
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// TestScan checks the groups, totals and both serializations of a scan.
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a": "four", "b": "four", "c": "fives", "d": "fives", "e": "fives", "f": "one"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile returned an unexpected error: %v", err)
+		}
+	}
+	if err := os.Link(filepath.Join(dir, "a"), filepath.Join(dir, "g")); err != nil {
+		t.Fatalf("Link returned an unexpected error: %v", err)
+	}
+	r, err := Scan(context.Background(), dir, iphash.GetFileHashMD5bytes, 2, fswalk.Options{})
+	if err != nil {
+		t.Fatalf("Scan returned an unexpected error: %v", err)
+	}
+	groups := r.Groups()
+	if len(groups) != 2 || len(groups[0].Files) != 3 || groups[0].Size != 5 {
+		t.Fatalf("Groups mismatch. Got: %+v, Want: the three copies of five bytes first", groups)
+	}
+	// a and g are one inode, so only b frees space in the second group.
+	if got := r.TotalReclaimable(); got != 2*5+4 {
+		t.Errorf("TotalReclaimable mismatch. Got: %d, Want: %d", got, 2*5+4)
+	}
+	if len(r.Errors()) != 0 {
+		t.Errorf("Unexpected errors: %v", r.Errors())
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV returned an unexpected error: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 7 || lines[0] != "group,hash,size,path" {
+		t.Errorf("CSV mismatch. Got: %q", lines)
+	}
+	buf.Reset()
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatalf("WriteJSON returned an unexpected error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"reclaimable_bytes": 14`) {
+		t.Errorf("JSON lacks the total: %s", buf.String())
+	}
+}
@@ -0,0 +1,24 @@
+// Package sandbox confines the process to the paths a run actually needs.
+//
+// On Linux, Restrict uses Landlock to limit filesystem access and installs a seccomp
+// filter that denies system administration syscalls the tool never makes. Both are
+// inherited by every thread and cannot be lifted for the rest of the process lifetime.
+package sandbox
+
+// Policy lists the paths the process may still use after Restrict.
+type Policy struct {
+	Read  []string // Read-only access to these files and directory trees
+	Write []string // Full access to these directory trees
+}
+
+// systemReadPaths are needed to deliver webhooks (name resolution and TLS roots).
+// Missing entries are ignored.
+var systemReadPaths = []string{
+	"/etc/hosts",
+	"/etc/resolv.conf",
+	"/etc/nsswitch.conf",
+	"/etc/ssl",
+	"/etc/pki",
+	"/etc/ca-certificates",
+	"/usr/share/ca-certificates",
+}
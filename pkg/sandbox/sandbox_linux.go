@@ -0,0 +1,182 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// Landlock syscalls share one number on every architecture Go supports.
+const (
+	sysLandlockCreateRuleset = 444
+	sysLandlockAddRule       = 445
+	sysLandlockRestrictSelf  = 446
+
+	landlockCreateRulesetVersion = 1 << 0
+	landlockRulePathBeneath      = 1
+
+	prSetNoNewPrivs = 38
+	prSetSeccomp    = 22
+	seccompModeFilt = 2
+
+	oPath = 0x200000 // O_PATH; not exported by syscall on every architecture
+)
+
+// Landlock filesystem access rights.
+const (
+	accessExecute    = 1 << 0
+	accessWriteFile  = 1 << 1
+	accessReadFile   = 1 << 2
+	accessReadDir    = 1 << 3
+	accessRemoveDir  = 1 << 4
+	accessRemoveFile = 1 << 5
+	accessMakeChar   = 1 << 6
+	accessMakeDir    = 1 << 7
+	accessMakeReg    = 1 << 8
+	accessMakeSock   = 1 << 9
+	accessMakeFifo   = 1 << 10
+	accessMakeBlock  = 1 << 11
+	accessMakeSym    = 1 << 12
+	accessRefer      = 1 << 13 // ABI 2
+	accessTruncate   = 1 << 14 // ABI 3
+
+	accessFileOnly = accessExecute | accessWriteFile | accessReadFile | accessTruncate
+	accessRead     = accessReadFile | accessReadDir
+)
+
+type rulesetAttr struct {
+	handledAccessFS uint64
+}
+
+type pathBeneathAttr struct {
+	allowedAccess uint64
+	parentFd      int32
+}
+
+// Restrict applies the policy to every thread of the process.
+// The binary must be built with CGO_ENABLED=0, since only then can Go apply a
+// syscall to all threads at once.
+func Restrict(p Policy) error {
+	abi, _, errno := syscall.Syscall(sysLandlockCreateRuleset, 0, 0, landlockCreateRulesetVersion)
+	if errno != 0 {
+		return fmt.Errorf("landlock is not available on this kernel: %w", errno)
+	}
+	handled := uint64(accessExecute | accessWriteFile | accessReadFile | accessReadDir |
+		accessRemoveDir | accessRemoveFile | accessMakeChar | accessMakeDir | accessMakeReg |
+		accessMakeSock | accessMakeFifo | accessMakeBlock | accessMakeSym)
+	if abi >= 2 {
+		handled |= accessRefer
+	}
+	if abi >= 3 {
+		handled |= accessTruncate
+	}
+
+	attr := rulesetAttr{handledAccessFS: handled}
+	fd, _, errno := syscall.Syscall(sysLandlockCreateRuleset, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to create landlock ruleset: %w", errno)
+	}
+	defer syscall.Close(int(fd))
+
+	for _, path := range p.Read {
+		if err := addRule(int(fd), path, accessRead, true); err != nil {
+			return err
+		}
+	}
+	for _, path := range systemReadPaths {
+		if err := addRule(int(fd), path, accessRead, false); err != nil {
+			return err
+		}
+	}
+	for _, path := range p.Write {
+		if err := addRule(int(fd), path, handled, true); err != nil {
+			return err
+		}
+	}
+
+	if _, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return allThreadsError("no_new_privs", errno)
+	}
+	if _, _, errno := syscall.AllThreadsSyscall(sysLandlockRestrictSelf, fd, 0, 0); errno != 0 {
+		return allThreadsError("landlock", errno)
+	}
+	return installSeccomp()
+}
+
+// addRule allows access below path. Missing optional paths are skipped.
+func addRule(rulesetFd int, path string, access uint64, required bool) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !required && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("sandbox path %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		access &= accessFileOnly
+	}
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("failed to open sandbox path %s: %w", path, err)
+	}
+	defer syscall.Close(fd)
+
+	attr := pathBeneathAttr{allowedAccess: access, parentFd: int32(fd)}
+	_, _, errno := syscall.Syscall6(sysLandlockAddRule, uintptr(rulesetFd), landlockRulePathBeneath,
+		uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return fmt.Errorf("failed to add landlock rule for %s: %w", path, errno)
+	}
+	return nil
+}
+
+// installSeccomp denies the syscalls listed in deniedSyscalls with EPERM.
+func installSeccomp() error {
+	if auditArch == 0 {
+		return fmt.Errorf("seccomp filter not available on %s", runtime.GOARCH)
+	}
+	const (
+		retAllow = 0x7fff0000
+		retErrno = 0x00050000
+		offNr    = 0
+		offArch  = 4
+	)
+	n := len(deniedSyscalls)
+	prog := []syscall.SockFilter{
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: offArch},
+		// Foreign architecture: refuse everything rather than misinterpret numbers.
+		{Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K, K: auditArch, Jt: 1},
+		{Code: syscall.BPF_RET | syscall.BPF_K, K: retErrno | uint32(syscall.EPERM)},
+		{Code: syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS, K: offNr},
+	}
+	for i, nr := range deniedSyscalls {
+		// On a match jump to the deny return placed after the remaining checks and the allow.
+		prog = append(prog, syscall.SockFilter{
+			Code: syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K,
+			K:    uint32(nr),
+			Jt:   uint8(n - i),
+		})
+	}
+	prog = append(prog,
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: retAllow},
+		syscall.SockFilter{Code: syscall.BPF_RET | syscall.BPF_K, K: retErrno | uint32(syscall.EPERM)},
+	)
+
+	fprog := syscall.SockFprog{Len: uint16(len(prog)), Filter: &prog[0]}
+	_, _, errno := syscall.AllThreadsSyscall(syscall.SYS_PRCTL, prSetSeccomp, seccompModeFilt, uintptr(unsafe.Pointer(&fprog)))
+	runtime.KeepAlive(prog)
+	if errno != 0 {
+		return allThreadsError("seccomp", errno)
+	}
+	return nil
+}
+
+func allThreadsError(what string, errno syscall.Errno) error {
+	if errno == syscall.ENOTSUP {
+		return fmt.Errorf("cannot apply %s to all threads: rebuild with CGO_ENABLED=0", what)
+	}
+	return fmt.Errorf("failed to apply %s: %w", what, errno)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package sandbox
+
+import "errors"
+
+// Restrict is only implemented on Linux.
+func Restrict(p Policy) error {
+	return errors.New("sandboxing is only supported on Linux")
+}
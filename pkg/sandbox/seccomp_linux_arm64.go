@@ -0,0 +1,12 @@
+package sandbox
+
+import "syscall"
+
+const auditArch = 0xc00000b7 // AUDIT_ARCH_AARCH64
+
+var deniedSyscalls = []int{
+	syscall.SYS_PTRACE, syscall.SYS_MOUNT, syscall.SYS_UMOUNT2, syscall.SYS_PIVOT_ROOT,
+	syscall.SYS_CHROOT, syscall.SYS_REBOOT, syscall.SYS_KEXEC_LOAD, syscall.SYS_INIT_MODULE,
+	syscall.SYS_DELETE_MODULE, syscall.SYS_SWAPON, syscall.SYS_SWAPOFF, syscall.SYS_ACCT,
+	syscall.SYS_SETTIMEOFDAY, syscall.SYS_PERF_EVENT_OPEN,
+}
@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !arm64
+
+package sandbox
+
+// The seccomp filter is only defined for amd64 and arm64; Landlock still applies elsewhere.
+const auditArch = 0
+
+var deniedSyscalls []int
@@ -0,0 +1,76 @@
+// Package scanindex saves the result of a scan so another machine can compare against it.
+package scanindex
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// version is raised whenever the layout changes; older indexes are rejected.
+const version = 1
+
+// Index is a portable snapshot of a scan.
+type Index struct {
+	Version int
+	Algo    string // Hash algorithm of every Sum
+	Host    string
+	Root    string
+	Created time.Time
+	Files   []File // Sorted by path
+}
+
+// File is one scanned file of an Index.
+type File struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Sum     iphash.HashBytes
+}
+
+// New builds an index of the scanned files.
+func New(algo, root string, files map[string]fswalk.FileRecord, created time.Time) *Index {
+	host, _ := os.Hostname()
+	ix := &Index{Version: version, Algo: algo, Host: host, Root: root, Created: created}
+	for p, rec := range files {
+		ix.Files = append(ix.Files, File{Path: p, Size: rec.Size, ModTime: rec.ModTime, Sum: rec.Sum})
+	}
+	sort.Slice(ix.Files, func(i, j int) bool { return ix.Files[i].Path < ix.Files[j].Path })
+	return ix
+}
+
+// Write encodes the index to w.
+func (ix *Index) Write(w io.Writer) error {
+	return gob.NewEncoder(w).Encode(ix)
+}
+
+// Read decodes an index and checks that it holds digests of algo.
+func Read(r io.Reader, algo string) (*Index, error) {
+	var ix Index
+	if err := gob.NewDecoder(r).Decode(&ix); err != nil {
+		return nil, fmt.Errorf("not a scan index: %w", err)
+	}
+	if ix.Version != version {
+		return nil, fmt.Errorf("scan index has version %d, want %d", ix.Version, version)
+	}
+	if ix.Algo != algo {
+		return nil, fmt.Errorf("scan index holds %s digests, not %s", ix.Algo, algo)
+	}
+	return &ix, nil
+}
+
+// ByHash returns the index's paths by hex digest.
+func (ix *Index) ByHash() map[string][]string {
+	m := make(map[string][]string)
+	for _, f := range ix.Files {
+		h := iphash.HashToString(f.Sum)
+		m[h] = append(m[h], f.Path)
+	}
+	return m
+}
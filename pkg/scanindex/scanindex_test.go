@@ -0,0 +1,39 @@
+package scanindex
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/fswalk"
+	"github.com/nicky-ayoub/go-file-dedupe/pkg/iphash"
+)
+
+// TestRoundTrip checks that an index reads back unchanged and is rejected for another algorithm.
+func TestRoundTrip(t *testing.T) {
+	created := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	ix := New("md5", "/r", map[string]fswalk.FileRecord{
+		"/r/b": {Size: 2, Sum: iphash.HashBytes{2}},
+		"/r/a": {Size: 1, Sum: iphash.HashBytes{1}},
+		"/r/c": {Size: 1, Sum: iphash.HashBytes{1}},
+	}, created)
+	var buf bytes.Buffer
+	if err := ix.Write(&buf); err != nil {
+		t.Fatalf("Write returned an unexpected error: %v", err)
+	}
+	data := buf.Bytes()
+	got, err := Read(bytes.NewReader(data), "md5")
+	if err != nil {
+		t.Fatalf("Read returned an unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(got, ix) {
+		t.Errorf("Round trip mismatch. Got: %+v, Want: %+v", got, ix)
+	}
+	if want := []string{"/r/a", "/r/c"}; !reflect.DeepEqual(got.ByHash()["01"], want) {
+		t.Errorf("ByHash mismatch. Got: %v, Want: %v", got.ByHash()["01"], want)
+	}
+	if _, err := Read(bytes.NewReader(data), "sha256"); err == nil {
+		t.Errorf("Read accepted an index of another algorithm")
+	}
+}
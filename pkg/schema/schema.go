@@ -0,0 +1,15 @@
+// Package schema versions the machine-readable outputs: the JSON report, the run
+// summary passed to hooks, the audit log records and the sidecar files.
+package schema
+
+import _ "embed"
+
+// Version is written as schema_version into every JSON document the tool produces.
+// It is raised whenever a field is removed, renamed or changes meaning; new optional
+// fields do not change it.
+const Version = 1
+
+// JSON is the JSON Schema describing all versioned outputs.
+//
+//go:embed schema.json
+var JSON []byte
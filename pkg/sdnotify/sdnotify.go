@@ -0,0 +1,99 @@
+// Package sdnotify reports the progress of a run to systemd (sd_notify(3)) when it is
+// started as a Type=notify service, so `systemctl status` shows what the run is doing
+// and a configured WatchdogSec= can detect a hung run.
+package sdnotify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notifier sends state updates to the service manager. A nil Notifier, returned when
+// the process was not started by systemd, ignores every call.
+type Notifier struct {
+	conn     net.Conn
+	watchdog time.Duration // WatchdogSec of the unit; zero when not enabled
+}
+
+// New connects to $NOTIFY_SOCKET. It returns nil and no error when the variable is not
+// set, i.e. when not running under systemd.
+func New() (*Notifier, error) {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(addr, "@") {
+		addr = "\x00" + addr[1:] // Abstract socket namespace
+	}
+	conn, err := net.Dial("unixgram", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the systemd notification socket: %w", err)
+	}
+	n := &Notifier{conn: conn}
+	usec, _ := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	pid := os.Getenv("WATCHDOG_PID")
+	if usec > 0 && (pid == "" || pid == strconv.Itoa(os.Getpid())) {
+		n.watchdog = time.Duration(usec) * time.Microsecond
+	}
+	return n, nil
+}
+
+// send writes one or more newline-separated VARIABLE=value assignments.
+func (n *Notifier) send(state string) error {
+	if n == nil {
+		return nil
+	}
+	_, err := n.conn.Write([]byte(state))
+	return err
+}
+
+// Ready tells systemd that the service has started up.
+func (n *Notifier) Ready() error {
+	return n.send("READY=1")
+}
+
+// Status sets the free-form status line shown by systemctl status.
+func (n *Notifier) Status(format string, args ...interface{}) error {
+	return n.send("STATUS=" + strings.ReplaceAll(fmt.Sprintf(format, args...), "\n", " "))
+}
+
+// Stopping tells systemd that the service is shutting down.
+func (n *Notifier) Stopping() error {
+	return n.send("STOPPING=1")
+}
+
+// Enabled reports whether notifications are delivered anywhere.
+func (n *Notifier) Enabled() bool {
+	return n != nil
+}
+
+// Watchdog pings the service manager at half the unit's watchdog interval until ctx is
+// done. It returns at once when the watchdog is not enabled.
+func (n *Notifier) Watchdog(ctx context.Context) {
+	if n == nil || n.watchdog <= 0 {
+		return
+	}
+	ticker := time.NewTicker(n.watchdog / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.send("WATCHDOG=1")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Close closes the connection to the service manager.
+func (n *Notifier) Close() error {
+	if n == nil {
+		return nil
+	}
+	return n.conn.Close()
+}
@@ -0,0 +1,43 @@
+package sdnotify
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// TestNotifier checks that state updates arrive as datagrams on $NOTIFY_SOCKET and that
+// a nil Notifier is harmless.
+func TestNotifier(t *testing.T) {
+	var none *Notifier
+	if err := none.Status("ignored %d", 1); err != nil || none.Enabled() {
+		t.Fatalf("nil Notifier mismatch. Got: enabled %v, error %v", none.Enabled(), err)
+	}
+
+	addr := filepath.Join(t.TempDir(), "notify")
+	sock, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		t.Skipf("unixgram sockets unavailable: %v", err)
+	}
+	defer sock.Close()
+	t.Setenv("NOTIFY_SOCKET", addr)
+	t.Setenv("WATCHDOG_USEC", "")
+	n, err := New()
+	if err != nil {
+		t.Fatalf("New returned an unexpected error: %v", err)
+	}
+	defer n.Close()
+
+	n.Ready()
+	n.Status("Hashed %d\nfiles", 3)
+	buf := make([]byte, 256)
+	for _, want := range []string{"READY=1", "STATUS=Hashed 3 files"} {
+		m, err := sock.Read(buf)
+		if err != nil {
+			t.Fatalf("Read returned an unexpected error: %v", err)
+		}
+		if got := string(buf[:m]); got != want {
+			t.Errorf("Notification mismatch. Got: %q, Want: %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// TestSignFileVerifies checks that ssh-keygen accepts the detached signature.
+func TestSignFileVerifies(t *testing.T) {
+	keygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen not installed")
+	}
+	dir := t.TempDir()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey returned an unexpected error: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey returned an unexpected error: %v", err)
+	}
+	keyPath := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	report := filepath.Join(dir, "report.json")
+	if err := os.WriteFile(report, []byte(`{"schema_version":1}`), 0644); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+
+	s, err := LoadSigner(keyPath, nil)
+	if err != nil {
+		t.Fatalf("LoadSigner returned an unexpected error: %v", err)
+	}
+	sigPath, err := s.SignFile(report)
+	if err != nil {
+		t.Fatalf("SignFile returned an unexpected error: %v", err)
+	}
+	allowed := filepath.Join(dir, "allowed_signers")
+	if err := os.WriteFile(allowed, []byte("dedupe "+s.PublicKey()+"\n"), 0644); err != nil {
+		t.Fatalf("Failed to write allowed signers: %v", err)
+	}
+
+	verify := func() error {
+		data, _ := os.ReadFile(report)
+		cmd := exec.Command(keygen, "-Y", "verify", "-f", allowed, "-I", "dedupe", "-n", Namespace, "-s", sigPath)
+		cmd.Stdin = bytes.NewReader(data)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Logf("ssh-keygen: %s", out)
+		}
+		return err
+	}
+	if err := verify(); err != nil {
+		t.Fatalf("ssh-keygen rejected the signature: %v", err)
+	}
+	if err := os.WriteFile(report, []byte(`{"schema_version":2}`), 0644); err != nil {
+		t.Fatalf("Failed to modify report: %v", err)
+	}
+	if err := verify(); err == nil {
+		t.Error("ssh-keygen accepted the signature of a modified report")
+	}
+}
@@ -0,0 +1,81 @@
+// Package simhash fingerprints text so that nearly identical documents get
+// fingerprints differing in only a few bits.
+package simhash
+
+import (
+	"bufio"
+	"hash/fnv"
+	"io"
+	"math/bits"
+	"strings"
+	"unicode"
+)
+
+// shingle is the number of consecutive words forming one feature, so that word order
+// matters and not only vocabulary.
+const shingle = 3
+
+// Fingerprint reads r to the end and returns the simhash of its words, lower-cased and
+// split at anything but letters and digits. Text with fewer words than a shingle is
+// fingerprinted as one feature.
+func Fingerprint(r io.Reader) (uint64, error) {
+	br := bufio.NewReader(r)
+	var weights [64]int
+	var window []string
+	var word strings.Builder
+	features := 0
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := range weights {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+		features++
+	}
+	endWord := func() {
+		if word.Len() == 0 {
+			return
+		}
+		window = append(window, word.String())
+		word.Reset()
+		if len(window) == shingle {
+			add(strings.Join(window, " "))
+			window = window[1:]
+		}
+	}
+	for {
+		c, _, err := br.ReadRune()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if unicode.IsLetter(c) || unicode.IsDigit(c) {
+			word.WriteRune(unicode.ToLower(c))
+		} else {
+			endWord()
+		}
+	}
+	endWord()
+	if features == 0 && len(window) > 0 {
+		add(strings.Join(window, " "))
+	}
+	var fp uint64
+	for i, w := range weights {
+		if w > 0 {
+			fp |= 1 << uint(i)
+		}
+	}
+	return fp, nil
+}
+
+// Distance returns the number of bits in which two fingerprints differ.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
@@ -0,0 +1,35 @@
+package simhash
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestFingerprint checks that a lightly edited document stays close to the original
+// while unrelated text does not, and that case and punctuation are ignored.
+func TestFingerprint(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&b, "Paragraph %d describes the quarterly results of unit %d in some detail. ", i, i%7)
+	}
+	original := b.String()
+	edited := strings.Replace(original, "Paragraph 100 describes", "Paragraph 100 summarises", 1)
+	fp := func(s string) uint64 {
+		v, err := Fingerprint(strings.NewReader(s))
+		if err != nil {
+			t.Fatalf("Fingerprint returned an unexpected error: %v", err)
+		}
+		return v
+	}
+	a := fp(original)
+	if d := Distance(a, fp(edited)); d > 3 {
+		t.Errorf("Edited distance mismatch. Got: %d, Want: at most 3", d)
+	}
+	if d := Distance(a, fp(strings.ToUpper(strings.ReplaceAll(original, ".", ";")))); d != 0 {
+		t.Errorf("Case and punctuation changed the fingerprint by %d bits", d)
+	}
+	if d := Distance(a, fp(strings.Repeat("An entirely different text about gardening and soil. ", 100))); d < 10 {
+		t.Errorf("Unrelated distance mismatch. Got: %d, Want: at least 10", d)
+	}
+}
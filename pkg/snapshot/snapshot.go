@@ -0,0 +1,51 @@
+// Package snapshot takes a read-only snapshot of a directory tree so it can be scanned
+// in a consistent state while the live tree keeps changing.
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Kinds of snapshot Create can take.
+const (
+	Btrfs = "btrfs" // Read-only subvolume snapshot next to the root, which must be a subvolume
+	LVM   = "lvm"   // Copy-on-write snapshot of the logical volume holding the root, mounted read-only
+)
+
+// Snapshot is a frozen copy of a tree; Dir shows the content of the snapshotted root.
+type Snapshot struct {
+	Dir     string
+	cleanup []func() error // Undone in reverse order by Remove
+}
+
+// Remove unmounts and deletes the snapshot. It is safe to call more than once.
+func (s *Snapshot) Remove() error {
+	var errs []string
+	for i := len(s.cleanup) - 1; i >= 0; i-- {
+		if err := s.cleanup[i](); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	s.cleanup = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to remove snapshot: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// run executes an external command, returning its trimmed output and, on failure, an
+// error that includes what it printed.
+func run(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		var ee *exec.ExitError
+		if errors.As(err, &ee) {
+			return "", fmt.Errorf("%s %s: %s", name, strings.Join(args, " "), strings.TrimSpace(string(out)))
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
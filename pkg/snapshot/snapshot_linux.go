@@ -0,0 +1,167 @@
+package snapshot
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Create snapshots the tree at root, which must be an absolute path. lvmSize is the
+// copy-on-write space reserved for an LVM snapshot, in lvcreate syntax such as 1G.
+func Create(kind, root, lvmSize string) (*Snapshot, error) {
+	s := &Snapshot{}
+	var err error
+	switch kind {
+	case Btrfs:
+		err = s.btrfs(root)
+	case LVM:
+		err = s.lvm(root, lvmSize)
+	default:
+		return nil, fmt.Errorf("unknown snapshot kind %q (use btrfs or lvm)", kind)
+	}
+	if err != nil {
+		s.Remove() // Whatever was set up before the failure
+		return nil, err
+	}
+	return s, nil
+}
+
+// btrfs takes a read-only snapshot of the subvolume at root next to it.
+func (s *Snapshot) btrfs(root string) error {
+	dest := filepath.Join(filepath.Dir(root), "."+filepath.Base(root)+".dedupe-snapshot")
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("%s already exists, left over from an earlier run? Delete it with btrfs subvolume delete", dest)
+	}
+	if _, err := run("btrfs", "subvolume", "snapshot", "-r", root, dest); err != nil {
+		return err
+	}
+	s.cleanup = append(s.cleanup, func() error {
+		_, err := run("btrfs", "subvolume", "delete", dest)
+		return err
+	})
+	s.Dir = dest
+	return nil
+}
+
+// lvm snapshots the logical volume mounted at or above root and mounts it read-only.
+func (s *Snapshot) lvm(root, size string) error {
+	m, err := mountOf(root)
+	if err != nil {
+		return err
+	}
+	out, err := run("lvs", "--noheadings", "-o", "vg_name,lv_name", m.source)
+	if err != nil {
+		return fmt.Errorf("%s is not on a logical volume: %w", root, err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return fmt.Errorf("unexpected lvs output for %s: %q", m.source, out)
+	}
+	vg, lv := fields[0], fields[1]
+	snap := lv + "-dedupe-snapshot"
+	if _, err := run("lvcreate", "--snapshot", "--size", size, "--name", snap, vg+"/"+lv); err != nil {
+		return err
+	}
+	s.cleanup = append(s.cleanup, func() error {
+		_, err := run("lvremove", "--force", vg+"/"+snap)
+		return err
+	})
+
+	// A fixed mount point keeps the paths, and so --cache entries, the same between runs.
+	dir := filepath.Join(os.TempDir(), "go-file-dedupe-"+snap)
+	if err := os.Mkdir(dir, 0o700); err != nil {
+		return err
+	}
+	s.cleanup = append(s.cleanup, func() error { return os.Remove(dir) })
+	opts := "ro"
+	if m.fsType == "xfs" {
+		opts += ",nouuid" // The snapshot carries the filesystem UUID of the mounted original
+	}
+	if _, err := run("mount", "-t", m.fsType, "-o", opts, "/dev/"+vg+"/"+snap, dir); err != nil {
+		return err
+	}
+	s.cleanup = append(s.cleanup, func() error {
+		_, err := run("umount", dir)
+		return err
+	})
+
+	rel, err := filepath.Rel(m.point, root)
+	if err != nil {
+		return err
+	}
+	s.Dir = filepath.Join(dir, rel)
+	return nil
+}
+
+// mount is an entry of /proc/self/mountinfo.
+type mount struct {
+	point  string
+	fsType string
+	source string
+}
+
+// mountOf returns the mount holding path: the one with the longest mount point that
+// is path or one of its parents.
+func mountOf(path string) (mount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return mount{}, err
+	}
+	defer f.Close()
+	mounts, err := parseMountinfo(bufio.NewScanner(f))
+	if err != nil {
+		return mount{}, err
+	}
+	var best mount
+	for _, m := range mounts {
+		if (path == m.point || strings.HasPrefix(path, strings.TrimSuffix(m.point, "/")+"/")) && len(m.point) >= len(best.point) {
+			best = m
+		}
+	}
+	if best.point == "" {
+		return mount{}, fmt.Errorf("no mount found for %s", path)
+	}
+	return best, nil
+}
+
+// parseMountinfo reads the mount point, type and source of every line.
+func parseMountinfo(sc *bufio.Scanner) ([]mount, error) {
+	var mounts []mount
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 5 || len(fields) < sep+3 {
+			continue
+		}
+		mounts = append(mounts, mount{point: unescapeOctal(fields[4]), fsType: fields[sep+1], source: unescapeOctal(fields[sep+2])})
+	}
+	return mounts, sc.Err()
+}
+
+// unescapeOctal decodes the \ooo escapes mountinfo uses for spaces and the like.
+func unescapeOctal(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,31 @@
+package snapshot
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// TestParseMountinfo checks that mount points, types and sources are read, including
+// escaped spaces and optional fields.
+func TestParseMountinfo(t *testing.T) {
+	const info = `22 1 253:0 / / rw,relatime shared:1 - ext4 /dev/mapper/vg0-root rw
+40 22 253:2 / /srv/my\040data rw,relatime shared:20 master:1 - xfs /dev/mapper/vg0-data rw,attr2
+`
+	mounts, err := parseMountinfo(bufio.NewScanner(strings.NewReader(info)))
+	if err != nil {
+		t.Fatalf("parseMountinfo returned an unexpected error: %v", err)
+	}
+	want := []mount{
+		{point: "/", fsType: "ext4", source: "/dev/mapper/vg0-root"},
+		{point: "/srv/my data", fsType: "xfs", source: "/dev/mapper/vg0-data"},
+	}
+	if len(mounts) != len(want) {
+		t.Fatalf("Mount count mismatch. Got: %d, Want: %d", len(mounts), len(want))
+	}
+	for i := range want {
+		if mounts[i] != want[i] {
+			t.Errorf("Mount %d mismatch. Got: %+v, Want: %+v", i, mounts[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package snapshot
+
+import "errors"
+
+// Create is only implemented on Linux.
+func Create(kind, root, lvmSize string) (*Snapshot, error) {
+	return nil, errors.New("snapshots are only supported on Linux")
+}
@@ -0,0 +1,70 @@
+// Package throttle caps the rate at which file content is read while hashing or
+// comparing files, so a scan of a network share does not saturate the link it shares
+// with everyone else.
+package throttle
+
+import (
+	"context"
+	"hash"
+	"sync"
+	"time"
+)
+
+// Limiter is a token bucket of bytes shared by all hashing workers: it allows a
+// steady rate with bursts of up to one second's worth. It is safe for concurrent use.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // Bytes per second
+	tokens float64 // Bytes that may be read now; negative while readers wait
+	last   time.Time
+}
+
+// New returns a Limiter allowing bytesPerSecond.
+func New(bytesPerSecond int64) *Limiter {
+	return &Limiter{rate: float64(bytesPerSecond), tokens: float64(bytesPerSecond), last: time.Now()}
+}
+
+// Wait blocks until n more bytes may be read or ctx is done. Readers are served in
+// the order they call Wait.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n) // Reserved even if the wait is abandoned
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Hash returns h with every Write waiting for the limiter first. Content copied from
+// a file into it is then read no faster than the limit allows.
+func (l *Limiter) Hash(ctx context.Context, h hash.Hash) hash.Hash {
+	return &limitedHash{Hash: h, l: l, ctx: ctx}
+}
+
+type limitedHash struct {
+	hash.Hash
+	l   *Limiter
+	ctx context.Context
+}
+
+func (h *limitedHash) Write(p []byte) (int, error) {
+	if err := h.l.Wait(h.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return h.Hash.Write(p)
+}
@@ -0,0 +1,37 @@
+package throttle
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestLimiter checks that writes beyond the one-second burst are held back to the
+// rate, that the digest is unchanged, and that a cancelled wait returns at once.
+func TestLimiter(t *testing.T) {
+	l := New(1 << 20)
+	h := l.Hash(context.Background(), sha256.New())
+	data := make([]byte, 1<<20+1<<18) // The burst and a quarter second more
+	start := time.Now()
+	if _, err := h.Write(data); err != nil {
+		t.Fatalf("Write returned an unexpected error: %v", err)
+	}
+	if took := time.Since(start); took < 200*time.Millisecond || took > 2*time.Second {
+		t.Errorf("Write took %s, want about 250ms", took)
+	}
+	if want := sha256.Sum256(data); string(h.Sum(nil)) != string(want[:]) {
+		t.Errorf("Digest mismatch through the limiter")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	if err := l.Wait(ctx, 10<<20); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait error mismatch. Got: %v, Want: %v", err, context.Canceled)
+	}
+	if took := time.Since(start); took > 100*time.Millisecond {
+		t.Errorf("Cancelled Wait took %s", took)
+	}
+}
@@ -1,7 +0,0 @@
-module me/go-file-dedupe
-
-go 1.18
-
-require github.com/zeebo/blake3 v0.2.3
-
-require github.com/klauspost/cpuid/v2 v2.0.12 // indirect